@@ -0,0 +1,125 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "io/ioutil"
+  "log/slog"
+  "os"
+  "path/filepath"
+
+  "golang.org/x/oauth2/google"
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+)
+
+// Environment variables replacing the arguments, so no configuration files
+// are needed, e.g. in containers. The secrets may also be read from the
+// files named by the variables with a _FILE suffix.
+const (
+  filesEnv          = config.EnvPrefix + "FILES"
+  clientSecretEnv   = config.EnvPrefix + "CLIENT_SECRET"
+  serviceAccountEnv = config.EnvPrefix + "SERVICE_ACCOUNT_KEY"
+)
+
+// arguments holds the .kdbx file paths and the Drive credentials.
+type arguments struct {
+  ringFiles      []string
+  clientSecret   []byte
+  serviceAccount []byte
+}
+
+// parseArguments parses the arguments of a command: the .kdbx file paths, unless given
+// in $KEEPASSX_BACKUP_FILES, followed by the client secret file path, unless the client
+// secret or a service account key is given in the environment. The bench, status and mirror commands
+// take no .kdbx file paths, and backing up the standard input needs none.
+func parseArguments(command string, args []string, stdin bool) (*arguments, error) {
+  a := &arguments{}
+  var err error
+  if a.serviceAccount, err = config.EnvSecret(serviceAccountEnv); err != nil {
+    return nil, err
+  }
+  if a.clientSecret, err = config.EnvSecret(clientSecretEnv); err != nil {
+    return nil, err
+  }
+  if a.serviceAccount == nil && a.clientSecret == nil {
+    if len(args) == 0 {
+      return nil, fmt.Errorf("Please provide client secret file path as argument, or $%s or $%s!",
+        clientSecretEnv, serviceAccountEnv)
+    }
+    if a.clientSecret, err = ioutil.ReadFile(args[len(args)-1]); err != nil {
+      return nil, fmt.Errorf("Unable to read client secret file: %v", err)
+    }
+    args = args[:len(args)-1]
+  }
+
+  if command == "bench" || command == "status" || command == "mirror" {
+    if len(args) > 0 {
+      return nil, fmt.Errorf("The %s command takes the client secret file path only", command)
+    }
+    return a, nil
+  }
+  if len(args) == 0 {
+    args = filepath.SplitList(os.Getenv(filesEnv))
+  }
+  if len(args) == 0 && !stdin {
+    return nil, fmt.Errorf("Please provide .kdbx file paths as arguments, or $%s!", filesEnv)
+  }
+  for _, p := range args {
+    a.ringFiles = append(a.ringFiles, config.NormalizePath(p))
+  }
+  return a, nil
+}
+
+// newDriveService authorizes the application with the service account key, or with
+// the client secret and the token kept in the credential store.
+// It returns the Drive client, and the function authorizing it again once Google
+// no longer accepts the token.
+func newDriveService(ctx context.Context, opts *config.Options, a *arguments) (*drive.Service, func(err error) *drive.Service) {
+  return newAccountService(ctx, opts, a, "")
+}
+
+// newAccountService authorizes the application like newDriveService, for another Google account
+// of the user with a given name, whose token is kept apart from the one of the main account,
+// or for the main account with "".
+func newAccountService(ctx context.Context, opts *config.Options, a *arguments, account string) (*drive.Service,
+  func(err error) *drive.Service) {
+  if a.serviceAccount != nil && account != "" {
+    logging.Fatal("A service account acts as a single account, authorize with a client secret file instead")
+  }
+  if a.serviceAccount != nil {
+    srv, err := auth.NewServiceAccountService(ctx, a.serviceAccount, auth.Scope(opts), opts.Impersonate)
+    if err != nil {
+      logging.Fatal("Unable to retrieve drive Client", "error", err)
+    }
+    return srv, func(err error) *drive.Service {
+      logging.Fatal("The service account key is no longer accepted", "error", err)
+      return nil
+    }
+  }
+
+  if opts.Impersonate != "" {
+    logging.Fatal("-impersonate needs a service account key in $" + serviceAccountEnv)
+  }
+
+  // If modifying these scopes, delete your previously saved credentials
+  // at ~/.cache/keepassx_backup/drive-go-keepassx-backup.json
+  oauthConfig, err := google.ConfigFromJSON(a.clientSecret, auth.Scope(opts))
+  if err != nil {
+    logging.Fatal("Unable to parse client secret file to config", "error", err)
+  }
+  store, err := auth.NewAccountStore(opts, account)
+  if err != nil {
+    logging.Fatal("Invalid -credential-store option", "error", err)
+  }
+  // the browser may still be signed in to the main account
+  if _, err := store.Load(); account != "" && err == auth.ErrNoToken {
+    slog.Warn("Authorize the application signed in to the Google account to copy the backups to", "account", account)
+  }
+  return auth.NewDriveService(ctx, oauthConfig, store), func(err error) *drive.Service {
+    return auth.Reauthorize(ctx, oauthConfig, store, err)
+  }
+}
@@ -0,0 +1,7 @@
+package main
+
+// Backends compiled into the application, which register themselves by name.
+import (
+  _ "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  _ "github.com/pawelu/keepassx_backup_tool/internal/localdir"
+)
@@ -0,0 +1,184 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "log/slog"
+  "os"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// backupRunner backs up the files of a run, or of every run of the daemon, which reuses the authorized
+// Drive client and the backends set up by the first run, reconciling the journal of Drive only once.
+type backupRunner struct {
+  opts         *config.Options
+  srv          *drive.Service
+  reauthorize  func(err error) *drive.Service
+  backendNames []string
+  // ringFiles are the files the exports are made of
+  ringFiles []string
+  stateFile string
+
+  // st is the state of the current run, which started at start
+  st    *state.State
+  start time.Time
+
+  // backends are the backends set up by the previous runs, by name
+  backends map[string]engine.Backend
+}
+
+// run backs up given files with the state of the run, together with the exports, the files written
+// by the pipelines and the backups queued while offline, saving the state.
+// It returns the report of the run, or the error which stopped it before backing up files.
+func (r *backupRunner) run(ctx context.Context, localRingFilePaths []string) (*report.Report, error) {
+  opts, st := r.opts, r.st
+  localRingFilePaths = append([]string{}, localRingFilePaths...)
+
+  // the exports and the files written by the pipelines are backed up like the requested files
+  if opts.Export != "" {
+    for _, p := range exportRingFiles(ctx, opts, r.ringFiles) {
+      localRingFilePaths = appendPath(localRingFilePaths, p)
+    }
+  }
+  if len(opts.Pipelines) > 0 {
+    for _, p := range runPipelines(ctx, opts) {
+      localRingFilePaths = appendPath(localRingFilePaths, p)
+    }
+  }
+
+  // back up files queued while offline together with the requested ones
+  var ringFilePaths []string
+  for _, p := range localRingFilePaths {
+    ringFilePaths = appendPath(ringFilePaths, p)
+  }
+  for _, p := range st.Pending {
+    if engine.IsLockOrTempFile(p.Path) {
+      slog.Info("Not backing up queued lock or temporary file of KeePass", "file", p.Path)
+      continue
+    }
+    ringFilePaths = appendPath(ringFilePaths, p.Path)
+  }
+
+  // without network connectivity, the backups to the backends which need it
+  // are queued, while other backends are still backed up to
+  var backends []engine.Backend
+  var results []engine.Result
+  queued := make(map[string]bool)
+
+  env := &engine.Env{ Opts: opts, Drive: r.srv, State: st }
+  for _, name := range r.backendNames {
+    if b, ok := r.backends[name]; ok {
+      backends = append(backends, b)
+      continue
+    }
+    factory, _ := engine.Lookup(name)
+    b, err := factory(ctx, env)
+    if auth.IsInvalidGrant(err) {
+      r.srv = r.reauthorize(err)
+      env.Drive = r.srv
+      b, err = factory(ctx, env)
+    }
+    switch {
+    case engine.IsOffline(err):
+      state.QueueBackups(st, ringFilePaths)
+      slog.Warn("No network connectivity, backup queued until next sync", "backend", name, "error", err)
+      for _, p := range ringFilePaths {
+        results = append(results, engine.Result{ Path: p, Backend: name, Action: engine.ActionQueued })
+        queued[p] = true
+      }
+      // the standard input is read once, and cannot be queued
+      if opts.Stdin {
+        results = append(results, engine.Result{ Path: engine.StdinPath(opts.StdinName), Backend: name,
+          Action: engine.ActionFailed, Err: err })
+      }
+    case err != nil:
+      return nil, fmt.Errorf("Unable to set up backend %s: %w", name, err)
+    default:
+      r.backends[name] = b
+      backends = append(backends, b)
+    }
+  }
+  for _, p := range env.Retry {
+    ringFilePaths = appendPath(ringFilePaths, p)
+  }
+  // a full Drive fails every upload, so it is told before it happens
+  for _, b := range backends {
+    if b.Name() == "drive" {
+      gdrive.WarnQuota(ctx, r.srv, opts)
+    }
+  }
+
+  if len(backends) == 0 {
+    if err := state.Save(r.stateFile, st); err != nil {
+      return nil, fmt.Errorf("Unable to save state file: %w", err)
+    }
+    events.PublishResults(results, st)
+    return &report.Report{ Code: report.ExitSuccess, Results: results, Duration: time.Since(r.start) }, nil
+  }
+
+  var backupPaths []string
+  for _, ringFilePath := range ringFilePaths {
+    _, err := os.Stat(ringFilePath)
+    if os.IsNotExist(err) && !containsPath(localRingFilePaths, ringFilePath) {
+      slog.Warn("Dropping queued backup of missing file", "file", ringFilePath)
+      st.RemovePending(ringFilePath)
+      continue
+    }
+    backupPaths = append(backupPaths, ringFilePath)
+  }
+
+  // progress bars of parallel uploads would overwrite each other
+  if opts.Jobs > 1 && len(backupPaths) > 1 {
+    opts.Progress = false
+  }
+
+  var started []string
+  for _, b := range backends {
+    started = append(started, b.Name())
+  }
+  engine.ResolveLinks(opts, st, backupPaths)
+  followRenames(ctx, opts, st, backends, backupPaths)
+  startedPaths := backupPaths
+  if opts.Stdin {
+    startedPaths = append(startedPaths, engine.StdinPath(opts.StdinName))
+  }
+  events.Publish(events.BackupStarted{ Paths: startedPaths, Backends: started })
+  results = append(results, engine.Apply(opts, st, engine.SyncRingFiles(ctx, opts, st, backends, backupPaths), queued)...)
+  if opts.Stdin {
+    results = append(results, engine.Apply(opts, st, engine.SyncStdin(ctx, opts, st, backends, os.Stdin, opts.StdinName), queued)...)
+  }
+  events.PublishResults(results, st)
+
+  if err := state.Save(r.stateFile, st); err != nil {
+    return nil, fmt.Errorf("Unable to save state file: %w", err)
+  }
+
+  rep := &report.Report{ Code: report.ExitCode(results), Results: results, Duration: time.Since(r.start) }
+  if opts.ExitSkipped && rep.Status() == report.StatusSkip {
+    rep.Code = report.ExitSkipped
+  }
+  return rep, nil
+}
+
+// writeSummary prints the summary of a run, and writes it to -summary-file.
+func writeSummary(opts *config.Options, rep *report.Report) {
+  // the summary would break the JSON lines logged to the standard output
+  if !opts.Quiet && !(opts.LogTarget == "stdout" && opts.LogFormat == "json") {
+    rep.WriteSummary(os.Stdout, report.ColorEnabled(os.Stdout))
+  }
+  if opts.SummaryFile != "" {
+    if err := rep.SaveSummary(opts.SummaryFile); err != nil {
+      slog.Error("Unable to write summary file", "path", opts.SummaryFile, "error", err)
+    }
+  }
+}
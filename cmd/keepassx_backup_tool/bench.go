@@ -0,0 +1,69 @@
+package main
+
+import (
+  "context"
+  "os"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/bench"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/localdir"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// runBenchCommand runs the bench command with the Drive backend and all
+// configured ones, and exits.
+func runBenchCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options) {
+  size, err := config.ParseSize(opts.BenchSize)
+  if err != nil || size <= 0 {
+    logging.Fatal("Invalid -bench-size option", "size", opts.BenchSize)
+  }
+  chunkSizes, err := bench.ParseChunkSizes(opts.BenchChunks)
+  if err != nil {
+    logging.Fatal("Invalid -bench-chunk-sizes option", "error", err)
+  }
+
+  c, err := gdrive.OpenClient(ctx, srv, opts)
+  if err != nil {
+    logging.Fatal("Unable to find shared drive", "error", err)
+  }
+  folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+  if auth.IsInvalidGrant(err) {
+    if c, err = gdrive.OpenClient(ctx, reauthorize(err), opts); err != nil {
+      logging.Fatal("Unable to find shared drive", "error", err)
+    }
+    folderId, err = gdrive.FindBackupsFolder(ctx, c, opts)
+  }
+  if err != nil {
+    logging.Fatal("Unable to find backups folder", "error", err)
+  }
+  jr, cleanup, err := bench.NewJournal()
+  if err != nil {
+    logging.Fatal("Unable to create bench journal", "error", err)
+  }
+
+  backends := []engine.Backend{ gdrive.New(c, opts, jr, folderId) }
+  if opts.BackupDir != "" {
+    backends = append(backends, localdir.New(opts))
+  }
+
+  start := time.Now()
+  results, err := bench.Run(ctx, opts, backends, size, chunkSizes, os.Stdout)
+  if err != nil {
+    logging.Fatal("Unable to run bench", "error", err)
+  }
+  code := report.ExitSuccess
+  for _, r := range results {
+    if r.Err != nil {
+      code = report.ExitPartialFailure
+    }
+  }
+  cleanup()
+  logging.Exit(&report.Report{ Code: code, Duration: time.Since(start) })
+}
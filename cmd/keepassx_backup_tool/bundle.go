@@ -0,0 +1,183 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+  "github.com/pawelu/keepassx_backup_tool/internal/recovery"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// bundledBackup is where a file is backed up, as listed in backups.json of the recovery bundle.
+type bundledBackup struct {
+  File     string    `json:"file"`
+  Backend  string    `json:"backend"`
+  Name     string    `json:"name"`
+  Id       string    `json:"id"`
+  Md5      string    `json:"md5,omitempty"`
+  SHA256   string    `json:"sha256,omitempty"`
+  Size     int64     `json:"size,omitempty"`
+  Modified time.Time `json:"modified,omitempty"`
+}
+
+// runBundleCommand writes the disaster recovery bundle to -o: the setup, as written by config export, with
+// the saved token with -bundle-token, the state, where every file is backed up, the manifests of the cas layout
+// of -backup-dir and the instructions, sealed with a passphrase, and exits.
+func runBundleCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, parsed *arguments, backendNames, paths []string) {
+  passphrase, err := prompt.EnvSecret(recovery.PassphraseEnv, "Passphrase of the recovery bundle: ")
+  if err != nil {
+    logging.Fatal("Unable to read passphrase", "error", err)
+  }
+  if len(passphrase) == 0 {
+    logging.Fatal("The bundle command needs a passphrase in $" + recovery.PassphraseEnv)
+  }
+
+  f := exportSetup(opts, parsed, opts.BundleToken)
+  setupJSON, err := f.Marshal()
+  if err != nil {
+    logging.Fatal("Unable to encode setup", "error", err)
+  }
+  stateJSON, err := json.MarshalIndent(st, "", "  ")
+  if err != nil {
+    logging.Fatal("Unable to encode state", "error", err)
+  }
+  backups := bundledBackups(ctx, srv, reauthorize, opts, st, backendNames, paths)
+  backupsJSON, err := json.MarshalIndent(backups, "", "  ")
+  if err != nil {
+    logging.Fatal("Unable to encode backups", "error", err)
+  }
+  entries := []recovery.Entry{
+    { Name: "setup.json", Data: setupJSON },
+    { Name: "state.json", Data: append(stateJSON, '\n') },
+    { Name: "backups.json", Data: append(backupsJSON, '\n') },
+  }
+  manifests := bundledManifests(opts)
+  entries = append(entries, manifests...)
+  readme := recoveryInstructions(f.Hostname, f.Created, f.Secrets.Token != nil, backups, len(manifests) > 0)
+  entries = append([]recovery.Entry{ { Name: "README.txt", Data: readme } }, entries...)
+
+  headers := map[string]string{
+    "Created":  f.Created.Format(time.RFC3339),
+    "Hostname": f.Hostname,
+    "Open":     "keepassx_backup_tool decrypt <this file> | tar xz",
+  }
+  var out bytes.Buffer
+  if err := recovery.Write(&out, entries, string(passphrase), headers); err != nil {
+    logging.Fatal("Unable to write recovery bundle", "error", err)
+  }
+  if opts.Output == "" || opts.Output == "-" {
+    _, err = os.Stdout.Write(out.Bytes())
+  } else {
+    err = fsutil.WriteFileAtomic(opts.Output, out.Bytes(), 0600)
+  }
+  if err != nil {
+    logging.Fatal("Unable to write recovery bundle", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// bundledBackups looks up the backups of given files by every backend of -backend.
+func bundledBackups(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, backendNames, paths []string) []bundledBackup {
+  backups := []bundledBackup{}
+  for _, name := range backendNames {
+    b, err := lookupBackend(ctx, srv, opts, name)
+    if auth.IsInvalidGrant(err) {
+      srv = reauthorize(err)
+      b, err = lookupBackend(ctx, srv, opts, name)
+    }
+    if err != nil {
+      logging.Fatal("Unable to set up backend", "backend", name, "error", err)
+    }
+    if b == nil {
+      continue
+    }
+    for _, p := range paths {
+      remote, err := b.Find(ctx, compress.BackupName(p, opts.Compress), st.File(p).BackendId(name))
+      if err != nil {
+        logging.Fatal("Unable to find backup", "file", p, "backend", name, "error", err)
+      }
+      if remote == nil {
+        continue
+      }
+      backups = append(backups, bundledBackup{ File: p, Backend: name, Name: remote.Name, Id: remote.Id, Md5: remote.Md5,
+        SHA256: remote.Meta[engine.MetaSHA256], Size: remote.Size, Modified: remote.SourceModTime() })
+    }
+  }
+  return backups
+}
+
+// bundledManifests returns the manifests of the cas layout of -backup-dir, which name the objects holding
+// the versions of every file, as entries in the manifests/ directory.
+func bundledManifests(opts *config.Options) []recovery.Entry {
+  if opts.BackupDir == "" || opts.DirLayout != "cas" {
+    return nil
+  }
+  files, err := filepath.Glob(filepath.Join(opts.BackupDir, "manifests", "*.json"))
+  if err != nil {
+    logging.Fatal("Unable to list manifests", "error", err)
+  }
+  var entries []recovery.Entry
+  for _, file := range files {
+    b, err := ioutil.ReadFile(file)
+    if err != nil {
+      logging.Fatal("Unable to read manifest", "file", file, "error", err)
+    }
+    entries = append(entries, recovery.Entry{ Name: "manifests/" + filepath.Base(file), Data: b })
+  }
+  return entries
+}
+
+// recoveryInstructions returns README.txt of the recovery bundle.
+func recoveryInstructions(hostname string, created time.Time, token bool, backups []bundledBackup, manifests bool) []byte {
+  var sb strings.Builder
+  fmt.Fprintf(&sb, "Recovery bundle of keepassx_backup_tool on %s, created %s.\n\n", hostname, created.Format(time.RFC3339))
+  sb.WriteString("Files:\n\n")
+  sb.WriteString("  setup.json    the options, the files backed up and the Drive credentials, for config import\n")
+  sb.WriteString("  state.json    the local state: the hashes of the files and the ids of their backups\n")
+  sb.WriteString("  backups.json  where every file is backed up, with the hashes of the backups\n")
+  if manifests {
+    sb.WriteString("  manifests/    the manifests of the cas layout of -backup-dir, naming the objects of every version\n")
+  }
+  sb.WriteString("\nBackups:\n\n")
+  if len(backups) == 0 {
+    sb.WriteString("  none found\n")
+  }
+  for _, b := range backups {
+    fmt.Fprintf(&sb, "  %s\n    %s: %s, id %s, md5 %s\n", b.File, b.Backend, b.Name, b.Id, b.Md5)
+  }
+  sb.WriteString("\nTo recover the backups on a new machine:\n\n")
+  sb.WriteString("  1. Install keepassx_backup_tool from https://github.com/pawelu/keepassx_backup_tool/releases\n")
+  sb.WriteString("  2. Import the setup, which prints the command line backing up like this machine:\n\n")
+  sb.WriteString("       keepassx_backup_tool config import setup.json\n\n")
+  sb.WriteString("  3. Run the restore command with the same options and arguments, writing every backup next to\n")
+  sb.WriteString("     its file with the .restored suffix:\n\n")
+  sb.WriteString("       keepassx_backup_tool restore <options> <files> <client secret file>\n\n")
+  if token {
+    sb.WriteString("The setup holds the OAuth token, so Drive is accessed without authorizing the application again,\n")
+    sb.WriteString("unless the token was revoked since.\n")
+  } else {
+    sb.WriteString("The setup holds no OAuth token, so the application is authorized again on the first restore.\n")
+  }
+  sb.WriteString("Without Drive, e.g. on a NAS, the backups of -backup-dir are copies of the files, or with the cas\n")
+  sb.WriteString("layout the objects named by the sha256 hashes in the manifests.\n")
+  return []byte(sb.String())
+}
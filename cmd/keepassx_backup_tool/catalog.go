@@ -0,0 +1,103 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "text/tabwriter"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/catalog"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// catalogCommands are the subcommands of the catalog command.
+var catalogCommands = []string{ "latest", "size", "versions", "rebuild" }
+
+// runCatalogCommand runs a subcommand of the catalog command, and exits: latest prints the latest version
+// of every file by every host and backend, size the number and the total size of the backups of every backend,
+// versions the versions of given files, or of all files, backed up within -since and -until, and rebuild
+// catalogs the uploads of the history log anew.
+func runCatalogCommand(opts *config.Options, command string, args []string) {
+  file, err := catalog.CacheFile()
+  if err != nil {
+    logging.Fatal("Unable to get path to catalog", "error", err)
+  }
+  c, err := catalog.Open(file)
+  if err != nil {
+    logging.Fatal("Unable to open catalog", "error", err)
+  }
+
+  tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  switch command {
+  case "latest":
+    entries, err := c.Latest()
+    if err != nil {
+      logging.Fatal("Unable to query catalog", "error", err)
+    }
+    fmt.Fprintln(tw, i18n.T("FILE\tHOST\tBACKEND\tVERSION\tTIME\tSIZE\tLOCATION"))
+    for _, e := range entries {
+      fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", e.File, e.Hostname, e.Backend, e.Version, e.Time.Local().Format(time.RFC3339),
+        progress.FormatBytes(e.Size), e.Location)
+    }
+  case "size":
+    totals, err := c.Totals()
+    if err != nil {
+      logging.Fatal("Unable to query catalog", "error", err)
+    }
+    fmt.Fprintln(tw, i18n.T("BACKEND\tFILES\tVERSIONS\tSIZE"))
+    var size int64
+    for _, t := range totals {
+      fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", t.Backend, t.Files, t.Versions, progress.FormatBytes(t.Size))
+      size += t.Size
+    }
+    fmt.Fprintf(tw, "%s\t\t\t%s\n", i18n.T("total"), progress.FormatBytes(size))
+  case "versions":
+    since, err := parseHistoryTime(opts.Since, false)
+    if err != nil {
+      logging.Fatal("Invalid -since option", "error", err)
+    }
+    until, err := parseHistoryTime(opts.Until, true)
+    if err != nil {
+      logging.Fatal("Invalid -until option", "error", err)
+    }
+    var files []string
+    for _, p := range args {
+      files = append(files, config.NormalizePath(p))
+    }
+    entries, err := c.Versions(files, since, until)
+    if err != nil {
+      logging.Fatal("Unable to query catalog", "error", err)
+    }
+    fmt.Fprintln(tw, i18n.T("FILE\tBACKEND\tVERSION\tTIME\tHOST\tHASH\tSIZE"))
+    for _, e := range entries {
+      fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", e.File, e.Backend, e.Version, e.Time.Local().Format(time.RFC3339), e.Hostname,
+        e.Hash, progress.FormatBytes(e.Size))
+    }
+  case "rebuild":
+    events, err := report.LoadHistory()
+    if err != nil {
+      logging.Fatal("Unable to read history log", "error", err)
+    }
+    // the history log is local, so its uploads were made by this host
+    hostname, _ := os.Hostname()
+    var entries []catalog.Entry
+    for _, e := range events {
+      if e.Result == engine.ActionCreated || e.Result == engine.ActionUpdated {
+        entries = append(entries, catalog.Entry{ File: e.File, Backend: e.Backend, Time: e.Time, Hostname: hostname, Hash: e.Hash,
+          Size: e.Bytes, Location: e.RemoteId })
+      }
+    }
+    if err := c.Replace(entries); err != nil {
+      logging.Fatal("Unable to rebuild catalog", "error", err)
+    }
+    fmt.Println(i18n.Sprintf("Cataloged %d backups from the history log", len(entries)))
+  }
+  tw.Flush()
+  c.Close()
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
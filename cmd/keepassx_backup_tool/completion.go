@@ -0,0 +1,270 @@
+package main
+
+import (
+  "context"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "sort"
+  "strings"
+  "time"
+
+  "golang.org/x/oauth2"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/transport"
+)
+
+// commands lists the commands, which come before the options.
+var commands = []string{ "backup", "restore", "bench", "daemon", "install", "self-update", "decrypt", "discover", "status",
+  "versions", "tui", "check", "completion", "config", "diff", "verify", "bundle", "gc", "history", "catalog",
+  "mirror" }
+
+// completeFiles is the line of the output of __complete telling the shell to complete file paths too.
+const completeFiles = ":files"
+
+// completeTimeout limits how long completion waits for Drive.
+const completeTimeout = 5 * time.Second
+
+// The completion scripts call back the executable with __complete followed by the words
+// of the command line up to the one being completed, see runCompleteCommand.
+const bashCompletion = `_keepassx_backup_tool() {
+  local cur=${COMP_WORDS[COMP_CWORD]} line files=
+  COMPREPLY=()
+  while IFS= read -r line; do
+    if [[ $line == ":files" ]]; then
+      files=1
+      continue
+    fi
+    COMPREPLY+=("${line%%$'\t'*}")
+  done < <("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)
+  if [[ -n $files ]]; then
+    local IFS=$'\n'
+    COMPREPLY+=($(compgen -f -- "$cur"))
+  fi
+}
+complete -o filenames -F _keepassx_backup_tool keepassx_backup_tool
+`
+
+const zshCompletion = `#compdef keepassx_backup_tool
+_keepassx_backup_tool() {
+  local -a candidates
+  local line value files
+  for line in "${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+    if [[ $line == ":files" ]]; then
+      files=1
+      continue
+    fi
+    [[ -z $line ]] && continue
+    value=${line%%$'\t'*}
+    value=${value//:/\\:}
+    if [[ $line == *$'\t'* ]]; then
+      candidates+=("$value:${line#*$'\t'}")
+    else
+      candidates+=("$value")
+    fi
+  done
+  _describe 'keepassx_backup_tool' candidates
+  [[ -n $files ]] && _files
+}
+compdef _keepassx_backup_tool keepassx_backup_tool
+`
+
+const fishCompletion = `function __keepassx_backup_tool_complete
+  set -l words (commandline -opc) (commandline -ct)
+  set -l files
+  for line in ($words[1] __complete $words[2..-1] 2>/dev/null)
+    if test "$line" = ":files"
+      set files 1
+      continue
+    end
+    echo $line
+  end
+  if set -q files[1]
+    __fish_complete_path (commandline -ct)
+  end
+end
+complete -c keepassx_backup_tool -f -a '(__keepassx_backup_tool_complete)'
+`
+
+// runCompletionCommand prints the completion script of a given shell: bash, zsh or fish, and exits.
+func runCompletionCommand(args []string) {
+  scripts := map[string]string{ "bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion }
+  if len(args) != 1 || scripts[args[0]] == "" {
+    logging.Fatal("The completion command takes the shell: bash, zsh or fish")
+  }
+  fmt.Print(scripts[args[0]])
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// runCompleteCommand prints the candidates completing the last of given words of the command line,
+// one per line, followed by a tab and a description for some of them, and exits. The line completeFiles
+// tells the shell to complete file paths too. The files, which have backups, complete the arguments
+// of the restore and versions commands, and so do the names of the backups on Drive and the ids
+// of their revisions for -revision, if Drive can be accessed without asking to authorize.
+func runCompleteCommand(ctx context.Context, opts *config.Options, words []string) {
+  if len(words) == 0 {
+    words = []string{ "" }
+  }
+  cur, words := words[len(words)-1], words[:len(words)-1]
+  command, named := "backup", len(words) > 0 && containsString(commands, words[0])
+  if named {
+    command, words = words[0], words[1:]
+  }
+  prev := ""
+  if len(words) > 0 {
+    prev = words[len(words)-1]
+  }
+
+  switch {
+  case len(words) == 0 && !named && !strings.HasPrefix(cur, "-"):
+    fmt.Println(completeFiles)
+    printCandidates(commands, cur)
+  case strings.HasPrefix(cur, "-"):
+    flag.VisitAll(func(f *flag.Flag) {
+      if strings.HasPrefix("-"+f.Name, cur) {
+        fmt.Printf("-%s\t%s\n", f.Name, strings.SplitN(f.Usage, "\n", 2)[0])
+      }
+    })
+  case command == "completion":
+    printCandidates([]string{ "bash", "zsh", "fish" }, cur)
+  case command == "config" && len(words) == 0:
+    printCandidates([]string{ "export", "import" }, cur)
+  case command == "catalog" && len(words) == 0:
+    printCandidates(catalogCommands, cur)
+  case takesValue(prev) && prev != "-revision":
+    fmt.Println(completeFiles)
+  case prev == "-revision":
+    completeRemote(ctx, opts, words[:len(words)-1], cur, true)
+  case command == "restore" || command == "versions":
+    fmt.Println(completeFiles)
+    completeRemote(ctx, opts, words, cur, false)
+  default:
+    fmt.Println(completeFiles)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// completeRemote prints the files, which have backups, and the names of their backups on Drive,
+// or with revisions the ids of the revisions of the backups on Drive, with the options among given words.
+// Drive is only asked with the client secret or the service account key in the environment, or given
+// among the words already, which the arguments of the command may not be yet.
+func completeRemote(ctx context.Context, opts *config.Options, words []string, cur string, revisions bool) {
+  // the words may be incomplete, and completion must not print anything else
+  flag.CommandLine.Init("", flag.ContinueOnError)
+  flag.CommandLine.SetOutput(ioutil.Discard)
+  config.ApplyEnv(flag.CommandLine)
+  if err := flag.CommandLine.Parse(words); err != nil {
+    return
+  }
+  if opts.User != "" && config.SetUser(opts.User) != nil {
+    return
+  }
+  auth.DisablePrompts()
+
+  st := &state.State{}
+  if stateFile, err := state.CacheFile(); err == nil {
+    st, _ = state.Load(stateFile)
+  }
+  var paths []string
+  for p := range st.Files {
+    paths = append(paths, p)
+  }
+  sort.Strings(paths)
+  if !revisions {
+    printCandidates(paths, cur)
+  }
+
+  var secret []string
+  for _, w := range flag.Args() {
+    if strings.HasSuffix(w, ".json") {
+      secret = []string{ w }
+    }
+  }
+  parsed, err := parseArguments("status", secret, false)
+  if err != nil || opts.RestoreFrom != "drive" {
+    return
+  }
+  httpClient, err := transport.NewHTTPClient(opts)
+  if err != nil {
+    return
+  }
+  ctx, cancel := context.WithTimeout(context.WithValue(ctx, oauth2.HTTPClient, httpClient), completeTimeout)
+  defer cancel()
+  srv, _ := newDriveService(ctx, opts, parsed)
+  b, err := lookupBackend(ctx, srv, opts, "drive")
+  d, ok := b.(*gdrive.Backend)
+  if err != nil || !ok {
+    return
+  }
+
+  if !revisions {
+    remotes, err := d.List(ctx)
+    if err != nil {
+      return
+    }
+    var names []string
+    for _, r := range remotes {
+      names = append(names, r.Name)
+    }
+    printCandidates(names, cur)
+    return
+  }
+  for _, p := range paths {
+    if st.Files[p].BackendId(d.Name()) == "" {
+      continue
+    }
+    remote, err := engine.FindBackup(ctx, d, opts, st, p)
+    if err != nil {
+      continue
+    }
+    revs, err := d.Revisions(ctx, remote)
+    if err != nil {
+      continue
+    }
+    for i := len(revs) - 1; i >= 0; i-- {
+      if strings.HasPrefix(revs[i].Id, cur) {
+        fmt.Printf("%s\t%s %s\n", revs[i].Id, revs[i].ModifiedTime, p)
+      }
+    }
+  }
+}
+
+// printCandidates prints the given candidates starting with the word being completed, sorted.
+func printCandidates(candidates []string, cur string) {
+  sort.Strings(candidates)
+  for _, c := range candidates {
+    if strings.HasPrefix(c, cur) {
+      fmt.Println(c)
+    }
+  }
+}
+
+// takesValue reports whether a word is an option followed by its value.
+func takesValue(word string) bool {
+  if !strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+    return false
+  }
+  f := flag.Lookup(strings.TrimLeft(word, "-"))
+  if f == nil {
+    return false
+  }
+  b, ok := f.Value.(interface{ IsBoolFlag() bool })
+  return !ok || !b.IsBoolFlag()
+}
+
+// containsString reports whether a list contains a given string.
+func containsString(list []string, s string) bool {
+  for _, e := range list {
+    if e == s {
+      return true
+    }
+  }
+  return false
+}
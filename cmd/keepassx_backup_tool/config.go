@@ -0,0 +1,261 @@
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "fmt"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "golang.org/x/oauth2"
+  "golang.org/x/oauth2/google"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/initscript"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/setup"
+)
+
+// configFlags select what the config and bundle commands do, so they are not part of the exported setup.
+var configFlags = []string{ "o", "encrypt-secrets", "bundle-token" }
+
+// secretFlags hold secrets, so they are exported with the secrets of the setup.
+var secretFlags = []string{ "telegram-token", "ntfy-token", "gotify-token", "mqtt-url" }
+
+// Names of the files the config import command writes the credentials to, in the credentials directory.
+const (
+  clientSecretFile   = "client_secret.json"
+  serviceAccountFile = "service_account.json"
+)
+
+// runConfigExportCommand writes the setup to -o: the options set, the files backed up, the client secret
+// or the service account key, and the saved token, sealed with a passphrase with -encrypt-secrets, and exits.
+func runConfigExportCommand(opts *config.Options, parsed *arguments) {
+  f := exportSetup(opts, parsed, true)
+  if opts.EncryptSecrets {
+    passphrase, err := setupPassphrase()
+    if err != nil {
+      logging.Fatal("Unable to read passphrase", "error", err)
+    }
+    if len(passphrase) == 0 {
+      logging.Fatal("-encrypt-secrets needs a passphrase in $" + setup.PassphraseEnv)
+    }
+    if err := f.Seal(string(passphrase)); err != nil {
+      logging.Fatal("Unable to encrypt secrets", "error", err)
+    }
+  } else {
+    slog.Warn("The exported setup holds the secrets unencrypted, keep it safe or use -encrypt-secrets")
+  }
+
+  b, err := f.Marshal()
+  if err != nil {
+    logging.Fatal("Unable to encode setup", "error", err)
+  }
+  if opts.Output == "" || opts.Output == "-" {
+    _, err = os.Stdout.Write(b)
+  } else {
+    err = fsutil.WriteFileAtomic(opts.Output, b, 0600)
+  }
+  if err != nil {
+    logging.Fatal("Unable to write setup", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// exportSetup returns the setup of the application: the options set, the files backed up, the client secret
+// or the service account key, and with token the saved token.
+func exportSetup(opts *config.Options, parsed *arguments, token bool) *setup.File {
+  flags, secret := setFlags()
+  f := &setup.File{ Version: setup.Version, Created: time.Now().UTC(), Flags: flags, Files: parsed.ringFiles }
+  f.Hostname, _ = os.Hostname()
+
+  f.Secrets = &setup.Secrets{ Flags: secret }
+  if parsed.serviceAccount != nil {
+    if !json.Valid(parsed.serviceAccount) {
+      logging.Fatal("Unable to parse service account key")
+    }
+    f.Secrets.ServiceAccount = parsed.serviceAccount
+    return f
+  }
+  if _, err := google.ConfigFromJSON(parsed.clientSecret, auth.Scope(opts)); err != nil {
+    logging.Fatal("Unable to parse client secret file to config", "error", err)
+  }
+  f.Secrets.ClientSecret = parsed.clientSecret
+  if token {
+    f.Secrets.Token = exportToken(opts)
+  }
+  return f
+}
+
+// exportToken returns the token saved in the credential store, if it can be refreshed on another machine.
+func exportToken(opts *config.Options) *oauth2.Token {
+  store, err := auth.NewStore(opts)
+  if err != nil {
+    logging.Fatal("Invalid -credential-store option", "error", err)
+  }
+  tok, err := store.Load()
+  switch {
+  case err == auth.ErrNoToken:
+    slog.Warn("No token saved yet, the application will be authorized on the new machine")
+    return nil
+  case err != nil:
+    logging.Fatal("Unable to read token", "error", err)
+  case tok.RefreshToken == "":
+    slog.Warn("The saved token cannot be refreshed, the application will be authorized on the new machine")
+    return nil
+  }
+  return tok
+}
+
+// runConfigImportCommand imports a setup exported by the config export command: it writes the client
+// secret or the service account key to the credentials directory, and saves the token to the credential
+// store, with the options of the setup, unless given to the import already. It prints the command line
+// backing up like the exporting machine, and exits.
+func runConfigImportCommand(opts *config.Options, flags, args []string) {
+  if len(args) != 1 {
+    logging.Fatal("The config import command takes the setup file path")
+  }
+  f, err := setup.Load(args[0])
+  if err != nil {
+    logging.Fatal("Unable to read setup file", "error", err)
+  }
+  if len(f.Sealed) > 0 {
+    passphrase, err := setupPassphrase()
+    if err != nil {
+      logging.Fatal("Unable to read passphrase", "error", err)
+    }
+    err = f.Open(string(passphrase))
+    if err == setup.ErrSealed {
+      logging.Fatal("The secrets of the setup need the passphrase in $" + setup.PassphraseEnv)
+    }
+    if err != nil {
+      logging.Fatal("Unable to open setup file", "error", err)
+    }
+  }
+
+  // the options given to the import, e.g. another -user, win over the ones of the setup
+  setupFlags := append([]string{}, f.Flags...)
+  if f.Secrets != nil {
+    setupFlags = append(setupFlags, f.Secrets.Flags...)
+  }
+  flags = withoutFlags(flags, configFlags...)
+  opts.Pipelines = nil
+  flag.CommandLine.Parse(append(append([]string{}, setupFlags...), flags...))
+  if opts.User != "" {
+    if err := config.SetUser(opts.User); err != nil {
+      logging.Fatal("Invalid -user option", "error", err)
+    }
+  }
+  if opts.Portable {
+    if err := config.SetPortable(); err != nil {
+      logging.Fatal("Unable to find the directory of the executable", "error", err)
+    }
+  }
+
+  command := append([]string{ "keepassx_backup_tool" }, setupFlags...)
+  command = append(command, flags...)
+  for _, p := range f.Files {
+    if _, err := os.Stat(p); err != nil {
+      slog.Warn("File of the setup is missing on this machine", "file", p, "error", err)
+    }
+    command = append(command, p)
+  }
+
+  dir, err := config.CredentialsDir()
+  if err != nil {
+    logging.Fatal("Unable to get path to credentials directory", "error", err)
+  }
+  var env string
+  switch s := f.Secrets; {
+  case s == nil:
+    slog.Warn("The setup holds no secrets, give the client secret file path as last argument")
+  case s.ServiceAccount != nil:
+    path := filepath.Join(dir, serviceAccountFile)
+    if err := fsutil.WriteFileAtomic(path, s.ServiceAccount, 0600); err != nil {
+      logging.Fatal("Unable to write service account key", "error", err)
+    }
+    env = serviceAccountEnv + "_FILE=" + shellWord(path) + " "
+  case s.ClientSecret != nil:
+    if _, err := google.ConfigFromJSON(s.ClientSecret, auth.Scope(opts)); err != nil {
+      logging.Fatal("Unable to parse client secret file to config", "error", err)
+    }
+    path := filepath.Join(dir, clientSecretFile)
+    if err := fsutil.WriteFileAtomic(path, s.ClientSecret, 0600); err != nil {
+      logging.Fatal("Unable to write client secret file", "error", err)
+    }
+    command = append(command, path)
+    importToken(opts, s)
+  }
+
+  var words []string
+  for _, w := range command {
+    words = append(words, shellWord(w))
+  }
+  fmt.Print(i18n.Sprintf("Setup of %s imported, back up with:\n\n  %s%s\n", f.Hostname, env, strings.Join(words, " ")))
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// importToken saves the token of a setup to the credential store, unless the store is not kept between runs.
+func importToken(opts *config.Options, s *setup.Secrets) {
+  switch {
+  case s.Token == nil || s.Token.RefreshToken == "":
+    slog.Warn("The setup holds no token, the application will be authorized on the first backup")
+    return
+  case opts.CredentialStore == "env" || opts.CredentialStore == "memory":
+    slog.Warn("The token is not imported into the credential store, which is not kept between runs",
+      "credential-store", opts.CredentialStore)
+    return
+  }
+  store, err := auth.NewStore(opts)
+  if err != nil {
+    logging.Fatal("Invalid -credential-store option", "error", err)
+  }
+  if err := store.Save(s.Token); err != nil {
+    logging.Fatal("Unable to save token", "error", err)
+  }
+  slog.Info("Token imported", "credential-store", opts.CredentialStore)
+}
+
+// setupPassphrase returns the passphrase of the secrets of the setup, or asks for it.
+func setupPassphrase() ([]byte, error) {
+  return prompt.EnvSecret(setup.PassphraseEnv, "Passphrase of the exported setup: ")
+}
+
+// setFlags returns the options set in the command line or the environment, as -name=value flags,
+// without the ones of the config command itself, and apart from them the ones holding secrets.
+func setFlags() (flags, secret []string) {
+  flag.Visit(func(f *flag.Flag) {
+    var values []string
+    if l, ok := f.Value.(*listFlag); ok {
+      values = *l
+    } else {
+      values = []string{ f.Value.String() }
+    }
+    for _, v := range values {
+      switch {
+      case containsString(configFlags, f.Name):
+      case containsString(secretFlags, f.Name):
+        secret = append(secret, "-"+f.Name+"="+v)
+      default:
+        flags = append(flags, "-"+f.Name+"="+v)
+      }
+    }
+  })
+  return flags, secret
+}
+
+// shellWord quotes a word of a printed command line for sh, if needed.
+func shellWord(s string) string {
+  if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$;&|<>()*?[]`#~!{}") {
+    return s
+  }
+  return initscript.ShellQuote(s)
+}
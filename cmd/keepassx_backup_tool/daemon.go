@@ -0,0 +1,143 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "log/slog"
+  "os"
+  "os/signal"
+  "path/filepath"
+  "sync"
+  "syscall"
+  "time"
+
+  "go.opentelemetry.io/otel/attribute"
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/daemon"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tracing"
+)
+
+// runDaemonCommand backs up given files every -interval with runner, serving the control API, until
+// interrupted, or with -users-file and a nil runner, the files of every user with the given flags.
+// With -watch-remote, the Drive client of the runner watches the changes of Drive. It never returns.
+func runDaemonCommand(ctx context.Context, opts *config.Options, flags []string, runner *backupRunner, paths []string,
+  shutdownTracing func()) {
+  // the backups run by the daemon must not see the end of the flags twice
+  if n := len(flags); n > 0 && flags[n-1] == "--" {
+    flags = flags[:n-1]
+  }
+  var backup daemon.Backup
+  if runner != nil {
+    backup = func(ctx context.Context) *report.Report {
+      return runDaemonBackup(ctx, runner, paths)
+    }
+  }
+  d, err := daemon.New(opts, flags, backup)
+  if err != nil {
+    logging.Fatal("Unable to start daemon", "error", err)
+  }
+  if opts.WatchRemote > 0 && runner == nil {
+    logging.Fatal("-watch-remote is not supported with -users-file")
+  }
+
+  socket := controlSocket(opts)
+
+  ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+  defer stop()
+
+  var wg sync.WaitGroup
+  wg.Add(1)
+  go func() {
+    defer wg.Done()
+    if err := d.Serve(ctx, socket); err != nil {
+      logging.Fatal("Unable to serve control API", "socket", socket, "error", err)
+    }
+  }()
+  if opts.WatchRemote > 0 {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      watchRemote(ctx, opts, runner.srv, d)
+    }()
+  }
+  d.Run(ctx)
+  wg.Wait()
+  shutdownTracing()
+  // every backup has been reported already, stopping the daemon is no run of its own
+  os.Exit(report.ExitSuccess)
+}
+
+// runDaemonBackup runs a backup of the daemon with the state read again, as other runs may have
+// changed it meanwhile, publishing its report like a run of the backup command.
+// It returns the report of the backup.
+func runDaemonBackup(ctx context.Context, runner *backupRunner, paths []string) *report.Report {
+  opts := runner.opts
+  runner.start = time.Now()
+  ctx, span := tracing.Tracer.Start(ctx, "run")
+  events.Publish(events.RunStarted{})
+
+  var rep *report.Report
+  st, err := state.Load(runner.stateFile)
+  if err == nil {
+    runner.st = st
+    rep, err = runner.run(ctx, paths)
+  } else {
+    err = fmt.Errorf("Unable to read state file: %w", err)
+  }
+  if err != nil {
+    slog.Error("Unable to back up", "error", err)
+    rep = &report.Report{ Code: report.ExitFailure, Message: err.Error(), Duration: time.Since(runner.start) }
+  }
+  writeSummary(opts, rep)
+
+  span.SetAttributes(attribute.String("status", rep.Status()))
+  span.End()
+  events.Publish(events.RunFinished{ Report: rep })
+  return rep
+}
+
+// watchRemote triggers a backup, whenever a backup on Drive was changed by another machine,
+// so the conflict is resolved with -on-conflict before the local file is changed again.
+func watchRemote(ctx context.Context, opts *config.Options, srv *drive.Service, d *daemon.Daemon) {
+  c, err := gdrive.OpenClient(ctx, srv, opts)
+  if err != nil {
+    slog.Error("Unable to find shared drive, not watching Drive", "error", err)
+    return
+  }
+  folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+  if err != nil {
+    slog.Error("Unable to find backups folder, not watching Drive", "error", err)
+    return
+  }
+
+  slog.Info("Watching Drive for backups changed elsewhere", "interval", opts.WatchRemote)
+  err = gdrive.WatchChanges(ctx, c, folderId, opts.WatchRemote, slog.Default(), func(f *gdrive.File) {
+    slog.Info("Backup changed on another machine, backing up", "name", f.Name, "id", f.Id,
+      "source_hostname", f.AppProperties[engine.MetaHostname])
+    d.Trigger()
+  })
+  if err != nil {
+    slog.Error("Unable to watch Drive", "error", err)
+  }
+}
+
+// controlSocket returns the path to the unix socket of the control API, -control-socket
+// or control.sock in the state directory.
+func controlSocket(opts *config.Options) string {
+  if opts.ControlSocket != "" {
+    return opts.ControlSocket
+  }
+  dir, err := config.StateDir()
+  if err != nil {
+    logging.Fatal("Unable to get path to control socket", "error", err)
+  }
+  return filepath.Join(dir, "control.sock")
+}
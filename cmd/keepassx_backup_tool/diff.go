@@ -0,0 +1,129 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "text/tabwriter"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// runDiffCommand compares given files with their backups by every backend of -backend, printing side by side
+// their sizes, hashes, modification times and database headers, and which side looks newer, without changing
+// anything, and exits with ExitInSync, ExitOutdated or ExitCheckError.
+func runDiffCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, backendNames, paths []string) {
+  var backends []engine.Backend
+  var missing []engine.Diff
+  for _, name := range backendNames {
+    b, err := lookupBackend(ctx, srv, opts, name)
+    if auth.IsInvalidGrant(err) {
+      srv = reauthorize(err)
+      b, err = lookupBackend(ctx, srv, opts, name)
+    }
+    switch {
+    case err != nil:
+      logging.Fatal("Unable to set up backend", "backend", name, "error", err)
+    case b == nil:
+      // nothing was backed up to Drive yet
+      for _, p := range paths {
+        missing = append(missing, engine.Diff{ Path: p, Backend: name, Newer: engine.NewerLocal })
+      }
+    default:
+      backends = append(backends, b)
+    }
+  }
+  diffs := append(engine.DiffRingFiles(ctx, opts, st, backends, paths), missing...)
+  for i := range diffs {
+    if i > 0 {
+      fmt.Println()
+    }
+    printDiff(&diffs[i])
+  }
+  logging.Exit(&report.Report{ Code: report.DiffExitCode(diffs) })
+}
+
+// printDiff prints a file and its backup side by side, and which side looks newer.
+func printDiff(d *engine.Diff) {
+  fmt.Printf("%s, %s:\n", d.Path, d.Backend)
+  if d.Err != nil {
+    fmt.Print(i18n.Sprintf("  Unable to compare: %v\n", d.Err))
+    return
+  }
+  local, remote := d.Local, d.Remote
+  if local == nil {
+    local = &engine.DiffSide{}
+  }
+  if remote == nil {
+    remote = &engine.DiffSide{}
+  }
+  tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(tw, i18n.T("  \tLOCAL\tBACKUP"))
+  fmt.Fprintf(tw, "  %s\t%s\t%s\n", i18n.T("size"), diffSize(local.Size), diffSize(remote.Size))
+  fmt.Fprintf(tw, "  md5\t%s\t%s\n", diffValue(local.Md5), diffValue(remote.Md5))
+  fmt.Fprintf(tw, "  sha256\t%s\t%s\n", diffValue(local.SHA256), diffValue(remote.SHA256))
+  fmt.Fprintf(tw, "  %s\t%s\t%s\n", i18n.T("modified"), diffTime(local.ModTime), diffTime(remote.ModTime))
+  if local.Header != nil || remote.Header != nil {
+    fmt.Fprintf(tw, "  %s\t%s\t%s\n", i18n.T("format"), diffHeader(local), diffHeader(remote))
+  }
+  if d.Hostname != "" {
+    fmt.Fprintf(tw, "  %s\t%s\t%s\n", i18n.T("machine"), "-", d.Hostname)
+  }
+  tw.Flush()
+
+  switch {
+  case d.Remote == nil:
+    fmt.Println(i18n.T("  No backup yet, back up to push the local file"))
+  case d.Newer == engine.NewerNone:
+    fmt.Println(i18n.T("  In sync"))
+  case d.Newer == engine.NewerLocal:
+    fmt.Println(i18n.T("  The local file looks newer, back up to push it"))
+  case d.Newer == engine.NewerRemote:
+    fmt.Println(i18n.T("  The backup looks newer, restore to pull it"))
+  case d.Newer == engine.NewerBoth:
+    fmt.Println(i18n.T("  Both were changed since the last sync, see -on-conflict"))
+  }
+}
+
+// diffValue formats a value of a side, which may be unknown.
+func diffValue(v string) string {
+  if v == "" {
+    return "-"
+  }
+  return v
+}
+
+// diffSize formats a size of a side, which may be unknown.
+func diffSize(n int64) string {
+  if n <= 0 {
+    return "-"
+  }
+  return progress.FormatBytes(n)
+}
+
+// diffTime formats a modification time of a side, which may be unknown.
+func diffTime(t time.Time) string {
+  if t.IsZero() {
+    return "-"
+  }
+  return t.Local().Format(time.RFC3339)
+}
+
+// diffHeader formats the database header of a side, which may be unknown.
+func diffHeader(s *engine.DiffSide) string {
+  if s.Header == nil {
+    return "-"
+  }
+  return s.Header.String()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/daemon"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// runDiscoverCommand lists the databases found in the standard locations, which are not
+// backed up yet, asking whether to back up each of them when interactive. The chosen ones
+// are added to the files of -user in -users-file, if given, or printed as $KEEPASSX_BACKUP_FILES.
+// It exits afterwards.
+func runDiscoverCommand(opts *config.Options) {
+  if opts.UsersFile != "" && opts.User == "" {
+    logging.Fatal("The discover command needs -user to add the databases to -users-file")
+  }
+  var known []string
+  for _, p := range filepath.SplitList(os.Getenv(filesEnv)) {
+    known = append(known, config.NormalizePath(p))
+  }
+  if opts.UsersFile != "" {
+    if users, err := daemon.LoadUsers(opts.UsersFile); err == nil {
+      for _, u := range users {
+        if u.Name == opts.User {
+          for _, p := range u.Files {
+            known = append(known, config.NormalizePath(p))
+          }
+        }
+      }
+    }
+  }
+
+  var found []string
+  for _, db := range config.DiscoverDatabases() {
+    if !containsPath(known, db) {
+      found = append(found, db)
+    }
+  }
+  if len(found) == 0 {
+    fmt.Println(i18n.T("No databases found, which are not backed up yet"))
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+
+  chosen := found
+  if auth.IsInteractive() {
+    chosen = nil
+    in := bufio.NewReader(os.Stdin)
+    for _, db := range found {
+      fmt.Print(i18n.Sprintf("Back up %s? [Y/n] ", db))
+      answer, err := in.ReadString('\n')
+      if err != nil {
+        logging.Fatal("Unable to read answer", "error", err)
+      }
+      if i18n.IsYes(answer) {
+        chosen = append(chosen, db)
+      }
+    }
+  } else {
+    for _, db := range found {
+      fmt.Println(db)
+    }
+  }
+  if len(chosen) == 0 {
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+
+  // the users file is only changed once the user has confirmed every database
+  switch {
+  case opts.UsersFile == "":
+    fmt.Printf("%s=%s\n", filesEnv, strings.Join(append(known, chosen...), string(filepath.ListSeparator)))
+  case auth.IsInteractive():
+    if err := daemon.AddUserFiles(opts.UsersFile, opts.User, chosen); err != nil {
+      logging.Fatal("Unable to add databases to users file", "path", opts.UsersFile, "error", err)
+    }
+    fmt.Print(i18n.Sprintf("Added %d databases to user %s in %s\n", len(chosen), opts.User, opts.UsersFile))
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
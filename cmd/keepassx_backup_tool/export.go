@@ -0,0 +1,108 @@
+package main
+
+import (
+  "context"
+  "io/ioutil"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/export"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+  "github.com/pawelu/keepassx_backup_tool/internal/recovery"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// isKdbx reports whether a path names a KeePass database, which keepassxc-cli exports.
+func isKdbx(path string) bool {
+  return strings.EqualFold(filepath.Ext(path), ".kdbx")
+}
+
+// exportRingFiles makes the sealed exports of -export of the .kdbx files, and returns
+// their paths. A failed export is logged, without failing the backup of the database itself.
+func exportRingFiles(ctx context.Context, opts *config.Options, ringFiles []string) []string {
+  formats, err := export.ParseFormats(opts.Export)
+  if err != nil {
+    logging.Fatal("Invalid -export option", "error", err)
+  }
+  e, err := export.NewExporter(opts.KeyFile)
+  if err != nil {
+    logging.Fatal("Unable to set up exports", "error", err)
+  }
+  var paths []string
+  for _, db := range ringFiles {
+    if !isKdbx(db) || opts.IsGeneric(db) {
+      continue
+    }
+    for _, format := range formats {
+      p, err := e.Export(ctx, db, format)
+      if err != nil {
+        slog.Error("Unable to export database", "file", db, "export", format, "error", err)
+        continue
+      }
+      paths = append(paths, p)
+    }
+  }
+  return paths
+}
+
+// exportedPaths returns the paths of the sealed exports of -export of the .kdbx files,
+// which the restore command restores.
+func exportedPaths(opts *config.Options, ringFiles []string) []string {
+  formats, err := export.ParseFormats(opts.Export)
+  if err != nil {
+    logging.Fatal("Invalid -export option", "error", err)
+  }
+  dir, err := export.Dir()
+  if err != nil {
+    logging.Fatal("Unable to get path to exports directory", "error", err)
+  }
+  var paths []string
+  for _, db := range ringFiles {
+    if !isKdbx(db) || opts.IsGeneric(db) {
+      continue
+    }
+    for _, format := range formats {
+      paths = append(paths, export.Path(dir, db, format))
+    }
+  }
+  return paths
+}
+
+// runDecryptCommand writes the decrypted sealed export or recovery bundle given as the argument
+// to the standard output, and exits.
+func runDecryptCommand(args []string) {
+  if len(args) != 1 {
+    logging.Fatal("The decrypt command takes the path of a sealed export or a recovery bundle only")
+  }
+  if data, err := ioutil.ReadFile(args[0]); err == nil && recovery.IsBundle(data) {
+    runDecryptBundle(args[0], data)
+  }
+  plain, err := export.Open(args[0])
+  if err != nil {
+    logging.Fatal("Unable to decrypt export", "file", args[0], "error", err)
+  }
+  if _, err := os.Stdout.Write(plain); err != nil {
+    logging.Fatal("Unable to write export", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// runDecryptBundle writes the gzipped tar archive of a recovery bundle to the standard output, and exits.
+func runDecryptBundle(file string, data []byte) {
+  passphrase, err := prompt.EnvSecret(recovery.PassphraseEnv, "Passphrase of the recovery bundle: ")
+  if err != nil {
+    logging.Fatal("Unable to read passphrase", "error", err)
+  }
+  archive, err := recovery.Open(data, string(passphrase))
+  if err != nil {
+    logging.Fatal("Unable to decrypt recovery bundle", "file", file, "error", err)
+  }
+  if _, err := os.Stdout.Write(archive); err != nil {
+    logging.Fatal("Unable to write recovery bundle", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
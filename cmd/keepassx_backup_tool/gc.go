@@ -0,0 +1,83 @@
+package main
+
+import (
+  "bufio"
+  "context"
+  "fmt"
+  "os"
+  "strings"
+  "text/tabwriter"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// runGCCommand lists the orphaned backups of every backend of -backend, which no given file, nor a file
+// of the state references, asking whether to remove each of them when interactive, and exits.
+func runGCCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, backendNames, paths []string) {
+  var backends []engine.Backend
+  for _, name := range backendNames {
+    b, err := lookupBackend(ctx, srv, opts, name)
+    if auth.IsInvalidGrant(err) {
+      srv = reauthorize(err)
+      b, err = lookupBackend(ctx, srv, opts, name)
+    }
+    if err != nil {
+      logging.Fatal("Unable to set up backend", "backend", name, "error", err)
+    }
+    // nothing was backed up to Drive yet
+    if b != nil {
+      backends = append(backends, b)
+    }
+  }
+  orphans, err := engine.FindOrphans(ctx, opts, st, backends, paths)
+  if err != nil {
+    logging.Fatal("Unable to find orphaned backups", "error", err)
+  }
+  if len(orphans) == 0 {
+    fmt.Println(i18n.T("No orphaned backups found"))
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+
+  tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(tw, i18n.T("BACKEND\tNAME\tSIZE\tMODIFIED"))
+  for _, o := range orphans {
+    fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Backend.Name(), o.Remote.Name, diffSize(o.Remote.Size), diffTime(o.Remote.ModTime))
+  }
+  tw.Flush()
+  if !auth.IsInteractive() {
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+
+  // removing is never the default answer
+  fmt.Println()
+  in := bufio.NewReader(os.Stdin)
+  removed, code := 0, report.ExitSuccess
+  for _, o := range orphans {
+    fmt.Print(i18n.Sprintf("Remove %s from %s? [y/N] ", o.Remote.Name, o.Backend.Name()))
+    answer, err := in.ReadString('\n')
+    if err != nil {
+      logging.Fatal("Unable to read answer", "error", err)
+    }
+    if strings.TrimSpace(answer) == "" || !i18n.IsYes(answer) {
+      continue
+    }
+    if err := o.Backend.Remove(ctx, o.Remote); err != nil {
+      opts.Log().Error("Unable to remove orphaned backup", "backend", o.Backend.Name(), "name", o.Remote.Name, "error", err)
+      code = report.ExitPartialFailure
+      continue
+    }
+    opts.Log().Info("Removed orphaned backup", "backend", o.Backend.Name(), "name", o.Remote.Name, "id", o.Remote.Id)
+    removed++
+  }
+  fmt.Print(i18n.Sprintf("Removed %d orphaned backups\n", removed))
+  logging.Exit(&report.Report{ Code: code })
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// historyDate is the layout of the dates of -since and -until, which may also be RFC 3339 times.
+const historyDate = "2006-01-02"
+
+// runHistoryCommand writes the events of the history log to -o as CSV, or as JSON with -format json,
+// only the ones of given files, of the backends of -backend when given, and made within -since and -until,
+// and exits.
+func runHistoryCommand(opts *config.Options, args []string) {
+  if opts.Format != "csv" && opts.Format != "json" {
+    logging.Fatal("Invalid -format option, expected csv or json", "format", opts.Format)
+  }
+  filter := &report.HistoryFilter{}
+  for _, p := range args {
+    filter.Files = append(filter.Files, config.NormalizePath(p))
+  }
+  // the default backend would hide the events of all the others
+  flag.Visit(func(f *flag.Flag) {
+    if f.Name != "backend" {
+      return
+    }
+    for _, name := range strings.Split(opts.Backends, ",") {
+      if name = strings.TrimSpace(name); name != "" {
+        filter.Backends = append(filter.Backends, name)
+      }
+    }
+  })
+  var err error
+  if filter.Since, err = parseHistoryTime(opts.Since, false); err != nil {
+    logging.Fatal("Invalid -since option", "error", err)
+  }
+  if filter.Until, err = parseHistoryTime(opts.Until, true); err != nil {
+    logging.Fatal("Invalid -until option", "error", err)
+  }
+
+  events, err := report.LoadHistory()
+  if err != nil {
+    logging.Fatal("Unable to read history log", "error", err)
+  }
+  var selected []report.HistoryEvent
+  for _, e := range events {
+    if filter.Match(e) {
+      selected = append(selected, e)
+    }
+  }
+  var out bytes.Buffer
+  if opts.Format == "json" {
+    err = report.WriteHistoryJSON(&out, selected)
+  } else {
+    err = report.WriteHistoryCSV(&out, selected)
+  }
+  if err == nil && (opts.Output == "" || opts.Output == "-") {
+    _, err = os.Stdout.Write(out.Bytes())
+  } else if err == nil {
+    err = fsutil.WriteFileAtomic(opts.Output, out.Bytes(), 0600)
+  }
+  if err != nil {
+    logging.Fatal("Unable to write history", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// parseHistoryTime parses the time of -since or -until: an RFC 3339 time, or a local date,
+// which the range includes all of, so -until ends with the end of its date. An empty value is the zero time.
+func parseHistoryTime(s string, end bool) (time.Time, error) {
+  if s == "" {
+    return time.Time{}, nil
+  }
+  if t, err := time.Parse(time.RFC3339, s); err == nil {
+    return t, nil
+  }
+  t, err := time.ParseInLocation(historyDate, s, time.Local)
+  if err != nil {
+    return time.Time{}, fmt.Errorf("Expected a date like 2024-01-31, or an RFC 3339 time: %q", s)
+  }
+  if end {
+    t = t.AddDate(0, 0, 1)
+  }
+  return t, nil
+}
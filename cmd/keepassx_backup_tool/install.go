@@ -0,0 +1,60 @@
+package main
+
+import (
+  "os"
+  "os/user"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/initscript"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// runInstallCommand writes the -init service script, running the daemon command with
+// the given flags and arguments as the current user, to the standard output, and exits.
+func runInstallCommand(opts *config.Options, flags, args []string) {
+  exe, err := os.Executable()
+  if err != nil {
+    logging.Fatal("Unable to find own executable", "error", err)
+  }
+  usr, err := user.Current()
+  if err != nil {
+    logging.Fatal("Unable to get current user", "error", err)
+  }
+
+  // services do not run in the current directory
+  daemonArgs := append([]string{ "daemon" }, withoutFlags(flags, "init")...)
+  for _, a := range args {
+    abs, err := filepath.Abs(a)
+    if err != nil {
+      logging.Fatal("Unable to get absolute path", "path", a, "error", err)
+    }
+    daemonArgs = append(daemonArgs, abs)
+  }
+
+  script, err := initscript.Generate(opts.Init, &initscript.Service{ Exe: exe, Args: daemonArgs, User: usr.Username })
+  if err != nil {
+    logging.Fatal("Invalid -init option", "error", err)
+  }
+  if _, err := os.Stdout.Write(script); err != nil {
+    logging.Fatal("Unable to write service script", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
+
+// withoutFlags removes given flags, with their values, from the flags.
+func withoutFlags(flags []string, names ...string) []string {
+  var out []string
+  for i := 0; i < len(flags); i++ {
+    name := strings.SplitN(strings.TrimLeft(flags[i], "-"), "=", 2)[0]
+    switch {
+    case !containsString(names, name):
+      out = append(out, flags[i])
+    case takesValue(flags[i]):
+      i++
+    }
+  }
+  return out
+}
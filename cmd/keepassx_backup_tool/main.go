@@ -0,0 +1,538 @@
+// Command keepassx_backup_tool backs up KeePassX databases to Google Drive.
+package main
+
+import (
+  "context"
+  "flag"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "go.opentelemetry.io/otel/attribute"
+  "go.opentelemetry.io/otel/trace"
+  "golang.org/x/oauth2"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/catalog"
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/export"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/initscript"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/notify"
+  "github.com/pawelu/keepassx_backup_tool/internal/plugin"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/setup"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tracing"
+  "github.com/pawelu/keepassx_backup_tool/internal/transport"
+)
+
+func main() {
+  ctx := context.Background()
+
+  opts := &config.Options{}
+  flag.DurationVar(&opts.WaitTimeout, "wait-timeout", time.Minute,
+    "how long to wait for the .kdbx file to be completely saved")
+  flag.IntVar(&opts.Jobs, "jobs", 4,
+    "maximum number of files backed up in parallel")
+  flag.StringVar(&opts.Backends, "backend", "drive",
+    "comma separated backends to back up to: "+strings.Join(engine.Names(), ", ")+", or a backend plugin")
+  flag.StringVar(&opts.PluginsDir, "plugins-dir", config.PluginsDir(),
+    "directory of backend-<name> and notify-<name> plugin executables")
+  flag.BoolVar(&opts.Portable, "portable", false,
+    "keep the state, the token and the plugins in the keepassx_backup directory next to the executable")
+  flag.StringVar(&opts.User, "user", "",
+    "keep the token and the state of this user apart from the other users of a shared installation")
+  flag.StringVar(&opts.UsersFile, "users-file", "",
+    "JSON file with the users the daemon command backs up, each with their own files, client secret and flags")
+  flag.StringVar(&opts.Impersonate, "impersonate", "",
+    "email of the Google Workspace user the service account acts as with domain-wide delegation, backing up to their Drive")
+  flag.BoolVar(&opts.KeePassXCConfig, "keepassxc-config", false,
+    "also back up the configuration of KeePassXC: keepassxc.ini and the browser integration manifests")
+  flag.StringVar(&opts.Generic, "generic", "",
+    "comma separated file name patterns of generic secrets files, e.g. *.json, backed up without the KeePass database checks")
+  flag.Var((*listFlag)(&opts.Pipelines), "pipeline",
+    "name=command exporting another password manager to back up, writing to the standard output or to {}; may be repeated")
+  flag.StringVar(&opts.Export, "export", "",
+    "comma separated exports of the .kdbx files made with keepassxc-cli and backed up sealed too: "+
+      strings.Join(export.Formats, ", "))
+  flag.StringVar(&opts.KeyFile, "key-file", "",
+    "key file of the .kdbx files, which keepassxc-cli opens them with for -export and -on-conflict merge")
+  flag.StringVar(&opts.OnConflict, "on-conflict", "overwrite",
+    "what to do when a .kdbx file and its backup were both changed since the last sync: overwrite, keep or merge")
+  flag.StringVar(&opts.OnOlderLocal, "on-older-local", "abort",
+    "what to do when a backup looks newer than the .kdbx file replacing it: abort the backup of the file, or warn and overwrite it")
+  flag.BoolVar(&opts.GCUnknownHost, "gc-unknown-host", false,
+    "let the gc command list backups recorded without the machine they were made on, e.g. made by older versions")
+  flag.StringVar(&opts.OnRename, "on-rename", "ask",
+    "what to do when a file looks renamed since it was backed up: ask in a terminal, rename its backups, "+
+      "or back it up anew as new")
+  flag.StringVar(&opts.BackupDir, "backup-dir", "",
+    "also back up to this local directory, e.g. a mounted NAS share or USB drive")
+  flag.StringVar(&opts.DirLayout, "backup-dir-layout", "plain",
+    "layout of -backup-dir: plain copies, or cas for deduplicated objects named by their SHA-256 hash")
+  flag.StringVar(&opts.Compress, "compress", "",
+    "compress backups before uploading them: gzip or zstd")
+  flag.DurationVar(&opts.Interval, "interval", time.Hour,
+    "how often the daemon command backs up")
+  flag.DurationVar(&opts.WatchRemote, "watch-remote", 0,
+    "how often the daemon command polls Drive for backups uploaded by other machines, backing up right away, 0 to never")
+  flag.IntVar(&opts.MinBattery, "min-battery", 0,
+    "postpone scheduled backups of the daemon command while on battery charged below this percentage, 0 to never postpone")
+  flag.StringVar(&opts.Init, "init", "systemd",
+    "init system the install command writes the service script of: "+strings.Join(initscript.Inits, ", "))
+  flag.StringVar(&opts.ControlSocket, "control-socket", "",
+    "unix socket of the control API of the daemon command (default control.sock in the state directory)")
+  flag.StringVar(&opts.RestoreFrom, "restore-from", "drive",
+    "backend to restore from: drive, or dir for -backup-dir")
+  flag.StringVar(&opts.Revision, "revision", "",
+    "id of the revision of the backup on Drive the restore command restores, listed by versions -drive-revisions")
+  flag.BoolVar(&opts.DriveRevisions, "drive-revisions", false,
+    "list the revisions of the backups Drive keeps with the versions command, instead of the history log")
+  flag.BoolVar(&opts.Pick, "pick", false,
+    "pick the version to restore and the path to restore it to in a terminal UI with the restore command")
+  flag.BoolVar(&opts.VerifyKdbx, "verify-kdbx", false,
+    "also check that a restored .kdbx file has a valid database header, besides its hashes")
+  flag.StringVar(&opts.Output, "o", "",
+    "file the config export command writes the setup to, the bundle command the recovery bundle, or the history command the history, "+
+      "- for the standard output (default); or the path the restore command restores to instead of the .restored "+
+      "file, a directory for several files, - to stream the backup to the standard output")
+  flag.BoolVar(&opts.Stdin, "stdin", false,
+    "back up the content of the standard input, e.g. a database piped from another program, named with -name")
+  flag.StringVar(&opts.StdinName, "name", "",
+    "name of the backup of the standard input with -stdin, e.g. passwords.kdbx")
+  flag.StringVar(&opts.Format, "format", "csv",
+    "format the history command exports the history log in: csv or json")
+  flag.StringVar(&opts.Since, "since", "",
+    "select the backups made since this date, e.g. 2024-01-31, or RFC 3339 time with the history and catalog versions commands")
+  flag.StringVar(&opts.Until, "until", "",
+    "select the backups made until the end of this date, or before this RFC 3339 time with the history and catalog versions commands")
+  flag.BoolVar(&opts.BundleToken, "bundle-token", false,
+    "include the saved OAuth token in the recovery bundle written by the bundle command")
+  flag.BoolVar(&opts.EncryptSecrets, "encrypt-secrets", false,
+    "seal the client secret and the token exported by the config export command with a passphrase (in $"+
+      setup.PassphraseEnv+")")
+  flag.StringVar(&opts.BenchSize, "bench-size", "16M",
+    "size of the random payload the bench command uploads")
+  flag.StringVar(&opts.BenchChunks, "bench-chunk-sizes", "256k,1M,8M,0",
+    "comma separated chunk sizes the bench command uploads to Drive with")
+  flag.StringVar(&opts.RemoteFolder, "remote-folder", gdrive.BackupsFolder,
+    "Drive folder to back up to, e.g. Backups/KeePass/laptop, creating every missing folder of the path")
+  flag.StringVar(&opts.SharedDrive, "shared-drive", "",
+    "name or id of the shared drive keeping the -remote-folder folder, instead of My Drive")
+  flag.StringVar(&opts.SharedFolder, "shared-folder", "",
+    "id or path of the Drive folder shared by another account keeping the -remote-folder folder, e.g. Family/KeePass")
+  flag.IntVar(&opts.QuotaWarn, "quota-warn", 90,
+    "warn when more than this percentage of the Drive storage is used, 0 to never")
+  flag.BoolVar(&opts.MergeDuplicates, "merge-duplicate-folders", false,
+    "move the files of duplicate -remote-folder folders, e.g. created by the first runs on two machines, into the oldest one")
+  flag.BoolVar(&opts.RestoreTrashed, "restore-trashed", false,
+    "restore the backups folder or .kdbx file from the trash instead of creating a new one")
+  flag.StringVar(&opts.CredentialStore, "credential-store", "file",
+    "where the OAuth token is kept: file, keyring, encrypted-file (passphrase in $"+auth.PassphraseEnv+
+      "), env (refresh token in $"+auth.RefreshTokenEnv+") or memory")
+  flag.StringVar(&opts.Proxy, "proxy", "",
+    "HTTP(S) or SOCKS5 proxy URL, overriding the HTTP_PROXY and HTTPS_PROXY environment variables")
+  flag.StringVar(&opts.BwLimit, "bwlimit", "",
+    "upload bandwidth limit in bytes per second, e.g. 512k, or a schedule like \"08:00,512k 23:00,off\"")
+  chunkSize := flag.String("chunk-size", "8M",
+    "size of upload chunks buffered in memory, e.g. 1M on low-memory devices, or 0 to upload in a single request")
+  flag.StringVar(&opts.CaCert, "ca-cert", "",
+    "PEM file with additional CA certificates to trust")
+  flag.StringVar(&opts.ClientCert, "client-cert", "",
+    "PEM file with TLS client certificate")
+  flag.StringVar(&opts.ClientKey, "client-key", "",
+    "PEM file with TLS client certificate key")
+  flag.StringVar(&opts.TlsMinVersion, "tls-min-version", "1.2",
+    "minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+  flag.BoolVar(&opts.DebugHTTP, "debug-http", false,
+    "log method, URL, status and duration of every HTTP request, with secrets redacted")
+  flag.StringVar(&opts.LogLevel, "log-level", "info",
+    "minimum level of logged messages: debug, info, warn or error")
+  flag.StringVar(&opts.LogFormat, "log-format", "text",
+    "format of logged messages: text or json")
+  flag.StringVar(&opts.LogTarget, "log-target", "stderr",
+    "destination of logged messages: stderr, stdout, syslog or journald")
+  flag.BoolVar(&opts.NonInteractive, "non-interactive", false,
+    "never ask to authorize the application, exit with the reauthorization required code instead")
+  flag.DurationVar(&opts.MaxAge, "max-age", 0,
+    "instead of backing up, check that the last successful backup of every file is not older than this")
+  flag.BoolVar(&opts.ExitSkipped, "exit-skipped", false,
+    "exit with code 5 instead of 0 when nothing has changed, telling skipped runs from uploads")
+  flag.BoolVar(&opts.Quiet, "quiet", false,
+    "do not show the upload progress bar and the end of run summary")
+  flag.StringVar(&opts.Lang, "lang", "",
+    "language of the messages shown to the user: "+strings.Join(i18n.Languages, ", ")+" (default from $LC_ALL, $LC_MESSAGES or $LANG)")
+  flag.StringVar(&opts.SummaryFile, "summary-file", "",
+    "also write the end of run summary to this file")
+  flag.StringVar(&opts.ResultFile, "result-file", "",
+    "write the result of every run to this file, as JSON or Prometheus textfile if it ends with .prom")
+  flag.StringVar(&opts.OtlpEndpoint, "otlp-endpoint", "",
+    "OTLP/HTTP traces endpoint URL to export OpenTelemetry spans to")
+  flag.StringVar(&opts.MetricsTextfile, "metrics-textfile", "",
+    "write Prometheus metrics to this file, e.g. for the node_exporter textfile collector")
+  flag.StringVar(&opts.HealthcheckURL, "healthcheck-url", "",
+    "healthchecks.io compatible ping URL, notified when a run starts, succeeds or fails")
+  flag.StringVar(&opts.NotifyDesktop, "notify-desktop", "",
+    "comma separated run results to show a desktop notification for: success, skip, failure")
+  flag.StringVar(&opts.WebhookURL, "webhook-url", "",
+    "URL to post the summary of every run to")
+  flag.StringVar(&opts.WebhookFormat, "webhook-format", "generic",
+    "webhook payload format: generic, slack (also for Mattermost) or discord")
+  flag.StringVar(&opts.TelegramToken, "telegram-token", "",
+    "Telegram bot token to send the summary of every run with")
+  flag.StringVar(&opts.TelegramChatId, "telegram-chat-id", "",
+    "Telegram chat id to send the summary of every run to")
+  flag.StringVar(&opts.NtfyURL, "ntfy-url", "",
+    "ntfy topic URL to publish the summary of every run to, e.g. https://ntfy.sh/mytopic")
+  flag.StringVar(&opts.NtfyToken, "ntfy-token", "",
+    "ntfy access token, for protected topics")
+  flag.StringVar(&opts.GotifyURL, "gotify-url", "",
+    "Gotify server URL to send the summary of every run to")
+  flag.StringVar(&opts.GotifyToken, "gotify-token", "",
+    "Gotify application token")
+  flag.StringVar(&opts.MqttURL, "mqtt-url", "",
+    "mqtt:// or mqtts:// broker URL with optional user and password and the topic as path, to publish the status of every run to")
+  // the command, if any, comes before the options
+  command, args := "backup", os.Args[1:]
+  if len(args) > 0 && containsString(commands, args[0]) {
+    command, args = args[0], args[1:]
+  }
+  // the config and catalog commands are followed by their subcommands
+  if command == "config" && len(args) > 0 && (args[0] == "export" || args[0] == "import") {
+    command, args = "config "+args[0], args[1:]
+  }
+  if command == "catalog" && len(args) > 0 && containsString(catalogCommands, args[0]) {
+    command, args = "catalog "+args[0], args[1:]
+  }
+  // the completion scripts complete the command line with the output of __complete
+  if len(args) > 0 && args[0] == "__complete" {
+    runCompleteCommand(ctx, opts, args[1:])
+  }
+  // every option may be given in the environment too, e.g. KEEPASSX_BACKUP_LOG_FORMAT=json
+  envErr := config.ApplyEnv(flag.CommandLine)
+  flag.CommandLine.Parse(args)
+  if opts.Jobs < 1 {
+    opts.Jobs = 1
+  }
+
+  // scripts tell an outdated backup from a failure by the exit code of the check, diff and verify commands
+  if command == "check" || command == "diff" || command == "verify" {
+    logging.SetFatalCode(report.ExitCheckError)
+  }
+  if err := logging.Setup(opts); err != nil {
+    logging.Fatal("Unable to set up logging", "error", err)
+  }
+  if envErr != nil {
+    logging.Fatal("Invalid environment", "error", envErr)
+  }
+  if err := i18n.Setup(opts.Lang); err != nil {
+    logging.Fatal("Invalid -lang option", "error", err)
+  }
+  if opts.NonInteractive {
+    auth.DisablePrompts()
+  }
+  if opts.User != "" {
+    if err := config.SetUser(opts.User); err != nil {
+      logging.Fatal("Invalid -user option", "error", err)
+    }
+  }
+  if opts.Portable {
+    if err := config.SetPortable(); err != nil {
+      logging.Fatal("Unable to find the directory of the executable", "error", err)
+    }
+    // the default of -plugins-dir was generated before -portable was parsed
+    pluginsDirGiven := false
+    flag.Visit(func(f *flag.Flag) {
+      pluginsDirGiven = pluginsDirGiven || f.Name == "plugins-dir"
+    })
+    if !pluginsDirGiven {
+      opts.PluginsDir = config.PluginsDir()
+    }
+  }
+
+  size, err := config.ParseSize(*chunkSize)
+  if err != nil {
+    logging.Fatal("Invalid -chunk-size option", "error", err)
+  }
+  opts.ChunkSize = int(size)
+  if opts.DirLayout != "plain" && opts.DirLayout != "cas" {
+    logging.Fatal("Invalid -backup-dir-layout option, expected plain or cas", "layout", opts.DirLayout)
+  }
+  plugins, err := plugin.Discover(opts.PluginsDir)
+  if err != nil {
+    logging.Fatal("Unable to discover plugins", "error", err)
+  }
+  plugin.RegisterBackends(plugins)
+  backendNames, err := parseBackends(opts)
+  if err != nil {
+    logging.Fatal("Invalid -backend option", "error", err)
+  }
+  if opts.OnConflict != "overwrite" && opts.OnConflict != "keep" && opts.OnConflict != "merge" {
+    logging.Fatal("Invalid -on-conflict option, expected overwrite, keep or merge", "on-conflict", opts.OnConflict)
+  }
+  if err := opts.ValidateGeneric(); err != nil {
+    logging.Fatal("Invalid -generic option", "error", err)
+  }
+  if opts.OnOlderLocal != "abort" && opts.OnOlderLocal != "warn" {
+    logging.Fatal("Invalid -on-older-local option, expected abort or warn", "on-older-local", opts.OnOlderLocal)
+  }
+  if opts.OnRename != "ask" && opts.OnRename != "rename" && opts.OnRename != "new" {
+    logging.Fatal("Invalid -on-rename option, expected ask, rename or new", "on-rename", opts.OnRename)
+  }
+  if opts.Stdin && command != "backup" {
+    logging.Fatal("-stdin is supported by the backup command only")
+  }
+  if opts.Stdin != (opts.StdinName != "") {
+    logging.Fatal("-stdin needs -name to name its backup, and -name is for -stdin only")
+  }
+  // the name is the one of the backup, which is never in a subfolder
+  if name := opts.StdinName; name != "" && (name != filepath.Base(name) || name == "." || name == "..") {
+    logging.Fatal("Invalid -name option, expected a file name without directories", "name", name)
+  }
+  if opts.Stdin && auth.IsTerminal(os.Stdin) {
+    logging.Fatal("-stdin backs up what is piped into the application, not a terminal")
+  }
+  if opts.SharedFolder != "" && opts.SharedDrive != "" {
+    logging.Fatal("Only one of -shared-folder and -shared-drive may be given")
+  }
+  if _, ok := compress.Suffixes[opts.Compress]; opts.Compress != "" && !ok {
+    logging.Fatal("Invalid -compress option, expected gzip or zstd", "compress", opts.Compress)
+  }
+  slog.Info("Beginning of syncing")
+
+  // registered first, so failures of the rest of the setup are recorded too
+  if opts.ResultFile != "" {
+    events.OnRunFinished(report.ResultFileHandler(opts.ResultFile))
+  }
+
+  // the progress bar would garble JSON logs, and is useless without a terminal
+  opts.Progress = !opts.Quiet && opts.LogFormat == "text" && opts.LogTarget == "stderr" && auth.IsTerminal(os.Stderr)
+  runStart := time.Now()
+
+  if command == "self-update" {
+    runSelfUpdateCommand(ctx, opts)
+  }
+  if command == "decrypt" {
+    runDecryptCommand(flag.Args())
+  }
+  if command == "completion" {
+    runCompletionCommand(flag.Args())
+  }
+  if command == "discover" {
+    runDiscoverCommand(opts)
+  }
+  if command == "tui" {
+    runTuiCommand(ctx, opts)
+  }
+  if command == "history" {
+    runHistoryCommand(opts, flag.Args())
+  }
+  if command == "config" {
+    logging.Fatal("The config command takes the export or import subcommand")
+  }
+  if command == "catalog" {
+    logging.Fatal("The catalog command takes the latest, size, versions or rebuild subcommand")
+  }
+  if strings.HasPrefix(command, "catalog ") {
+    runCatalogCommand(opts, strings.TrimPrefix(command, "catalog "), flag.Args())
+  }
+  if command == "config import" {
+    runConfigImportCommand(opts, args[:len(args)-flag.NArg()], flag.Args())
+  }
+  // the daemon takes the arguments of every user from the -users-file
+  if command == "daemon" && opts.UsersFile != "" {
+    runDaemonCommand(ctx, opts, args[:len(args)-flag.NArg()], nil, nil, func() {})
+  }
+  parsed, err := parseArguments(command, flag.Args(), opts.Stdin)
+  if err != nil {
+    logging.Fatal("Invalid arguments", "error", err)
+  }
+
+  if command == "install" {
+    runInstallCommand(opts, args[:len(args)-flag.NArg()], flag.Args())
+  }
+  if command == "config export" {
+    runConfigExportCommand(opts, parsed)
+  }
+  // lock files and temporary files of KeePass may be given with a glob, only the databases are backed up
+  var localRingFilePaths []string
+  for _, p := range parsed.ringFiles {
+    if engine.IsLockOrTempFile(p) {
+      slog.Info("Not backing up lock or temporary file of KeePass", "file", p)
+      continue
+    }
+    localRingFilePaths = append(localRingFilePaths, p)
+  }
+  if opts.KeePassXCConfig {
+    for _, p := range config.KeePassXCConfigFiles() {
+      localRingFilePaths = appendPath(localRingFilePaths, p)
+    }
+  }
+  // the files of the exports and pipelines are backed up too, so their backups are not orphaned
+  if opts.Export != "" && (command == "restore" || command == "gc") {
+    for _, p := range exportedPaths(opts, parsed.ringFiles) {
+      localRingFilePaths = appendPath(localRingFilePaths, p)
+    }
+  }
+  if len(opts.Pipelines) > 0 && (command == "restore" || command == "gc") {
+    for _, p := range pipelinePaths(opts) {
+      localRingFilePaths = appendPath(localRingFilePaths, p)
+    }
+  }
+
+  // the OAuth token exchange and the Drive client both use this HTTP client
+  httpClient, err := transport.NewHTTPClient(opts)
+  if err != nil {
+    logging.Fatal("Unable to create HTTP client", "error", err)
+  }
+  ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+  shutdownTracing, err := tracing.Setup(ctx, opts)
+  if err != nil {
+    logging.Fatal("Unable to set up tracing", "error", err)
+  }
+  // every backup of the daemon is a run of its own
+  if command != "daemon" {
+    var runSpan trace.Span
+    ctx, runSpan = tracing.Tracer.Start(ctx, "run")
+    events.OnRunFinished(func(r *report.Report) {
+      runSpan.SetAttributes(attribute.String("status", r.Status()))
+      runSpan.End()
+      shutdownTracing()
+    })
+  }
+
+  // notifications report on backups only
+  if command == "backup" || command == "daemon" {
+    notified := localRingFilePaths
+    if opts.Stdin {
+      notified = append(notified, engine.StdinPath(opts.StdinName))
+    }
+    notify.Setup(opts, httpClient, notified, plugins)
+  }
+  if command == "backup" {
+    events.Publish(events.RunStarted{})
+  }
+
+  srv, reauthorize := newDriveService(ctx, opts, parsed)
+
+  stateFile, err := state.CacheFile()
+  if err != nil {
+    logging.Fatal("Unable to get path to state file", "error", err)
+  }
+  st, err := state.Load(stateFile)
+  if err != nil {
+    logging.Fatal("Unable to read state file", "error", err)
+  }
+
+  runner := &backupRunner{ opts: opts, srv: srv, reauthorize: reauthorize, backendNames: backendNames,
+    ringFiles: parsed.ringFiles, stateFile: stateFile, st: st, start: runStart, backends: make(map[string]engine.Backend) }
+
+  // the history log and the metrics record the results of every sync
+  events.Subscribe(func(e events.Event) {
+    f, ok := e.(events.SyncFinished)
+    if !ok {
+      return
+    }
+    if err := report.AppendHistory(f.Results); err != nil {
+      slog.Error("Unable to write history log", "error", err)
+    }
+    if err := catalog.Record(f.Results); err != nil {
+      slog.Error("Unable to update catalog", "error", err)
+    }
+    if opts.MetricsTextfile != "" {
+      if err := report.WriteMetrics(opts.MetricsTextfile, runner.start, f.Results, f.State); err != nil {
+        slog.Error("Unable to write metrics textfile", "path", opts.MetricsTextfile, "error", err)
+      }
+    }
+  })
+
+  if command == "daemon" {
+    runDaemonCommand(ctx, opts, args[:len(args)-flag.NArg()], runner, localRingFilePaths, shutdownTracing)
+  }
+  if command == "versions" {
+    runVersionsCommand(ctx, srv, reauthorize, opts, st, localRingFilePaths)
+  }
+  if command == "restore" {
+    // revisions are kept by Drive for every backup on its own
+    if opts.Revision != "" && (opts.RestoreFrom != "drive" || len(localRingFilePaths) != 1) {
+      logging.Fatal("-revision restores a single file from Drive")
+    }
+    if opts.Pick && (opts.Revision != "" || !auth.IsTerminal(os.Stdin) || !auth.IsTerminal(os.Stdout)) {
+      logging.Fatal("-pick needs a terminal, and picks the revision itself")
+    }
+    if opts.Pick && opts.Output != "" {
+      logging.Fatal("-pick asks for the path to restore to itself")
+    }
+    // only a directory holds the backups of several files
+    if info, err := os.Stat(opts.Output); opts.Output != "" && len(localRingFilePaths) != 1 && (err != nil || !info.IsDir()) {
+      logging.Fatal("-o restores a single file, or several into a directory")
+    }
+    if opts.Output == engine.StdoutTarget && opts.LogTarget == "stdout" {
+      logging.Fatal("restore -o - writes the backup to the standard output, log with -log-target stderr")
+    }
+    b, err := restoreBackend(ctx, srv, opts)
+    if auth.IsInvalidGrant(err) {
+      srv = reauthorize(err)
+      b, err = restoreBackend(ctx, srv, opts)
+    }
+    if err != nil {
+      logging.Fatal("Unable to find backups", "error", err)
+    }
+    if opts.Pick {
+      runPickCommand(ctx, b, opts, st, localRingFilePaths, runStart)
+    }
+    results := engine.RestoreRingFiles(ctx, b, opts, st, localRingFilePaths)
+    logging.Exit(&report.Report{ Code: report.ExitCode(results), Results: results, Duration: time.Since(runStart) })
+  }
+
+  if command == "bench" {
+    runBenchCommand(ctx, srv, reauthorize, opts)
+  }
+  if command == "check" {
+    runCheckCommand(ctx, srv, reauthorize, opts, st, backendNames, localRingFilePaths, runStart)
+  }
+  if command == "diff" {
+    runDiffCommand(ctx, srv, reauthorize, opts, st, backendNames, localRingFilePaths)
+  }
+  if command == "verify" {
+    runVerifyCommand(ctx, srv, reauthorize, opts, st, backendNames, localRingFilePaths, runStart)
+  }
+  if command == "gc" {
+    runGCCommand(ctx, srv, reauthorize, opts, st, backendNames, localRingFilePaths)
+  }
+  if command == "bundle" {
+    runBundleCommand(ctx, srv, reauthorize, opts, st, parsed, backendNames, localRingFilePaths)
+  }
+  if command == "status" {
+    runStatusCommand(ctx, srv, reauthorize, opts, st)
+  }
+  if command == "mirror" {
+    runMirrorCommand(ctx, srv, reauthorize, opts, parsed, runStart)
+  }
+
+  if opts.MaxAge > 0 {
+    c, err := gdrive.OpenClient(ctx, srv, opts)
+    if err != nil {
+      logging.Fatal("Unable to find shared drive", "error", err)
+    }
+    logging.Exit(gdrive.CheckMaxAge(ctx, c, opts, st, localRingFilePaths))
+  }
+
+  rep, err := runner.run(ctx, localRingFilePaths)
+  if err != nil {
+    logging.Fatal("Unable to back up", "error", err)
+  }
+  writeSummary(opts, rep)
+
+  slog.Info("End of syncing")
+  logging.Exit(rep)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+  "context"
+  "os"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// mirrorAccount names the Google account the mirror command copies the backups to, whose token
+// is kept apart from the one of the main account, see auth.NewAccountStore.
+const mirrorAccount = "mirror"
+
+// runMirrorCommand copies the backups in the backups folder on Drive to the backups folder on Drive
+// of a second Google account, authorized on the first run, and exits.
+func runMirrorCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  a *arguments, start time.Time) {
+  b, err := lookupBackend(ctx, srv, opts, "drive")
+  if auth.IsInvalidGrant(err) {
+    srv = reauthorize(err)
+    b, err = lookupBackend(ctx, srv, opts, "drive")
+  }
+  if err != nil {
+    logging.Fatal("Unable to set up backend", "backend", "drive", "error", err)
+  }
+  if b == nil {
+    logging.Fatal("Nothing was backed up to Drive yet")
+  }
+  src := b.(*gdrive.Backend)
+
+  mirrorSrv, mirrorReauthorize := newAccountService(ctx, opts, a, mirrorAccount)
+  // the backups are copied to My Drive of the second account, as folders shared with the main one would be the same
+  c := gdrive.NewClient(mirrorSrv, opts.Log())
+  folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+  if auth.IsInvalidGrant(err) {
+    c = gdrive.NewClient(mirrorReauthorize(err), opts.Log())
+    folderId, err = gdrive.FindBackupsFolder(ctx, c, opts)
+  }
+  if err != nil {
+    logging.Fatal("Unable to find backups folder of the second account", "error", err)
+  }
+
+  results, err := gdrive.Mirror(ctx, opts, src, gdrive.New(c, opts, nil, folderId))
+  if err != nil {
+    logging.Fatal("Unable to list backups", "error", err)
+  }
+  rep := &report.Report{ Code: report.ExitCode(results), Results: results, Duration: time.Since(start) }
+  // the summary would break the JSON lines logged to the standard output
+  if !opts.Quiet && !(opts.LogTarget == "stdout" && opts.LogFormat == "json") {
+    rep.WriteSummary(os.Stdout, report.ColorEnabled(os.Stdout))
+  }
+  logging.Exit(rep)
+}
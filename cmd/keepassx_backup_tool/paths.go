@@ -0,0 +1,50 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// containsPath reports whether path is one of paths.
+func containsPath(paths []string, path string) bool {
+  for _, p := range paths {
+    if config.SamePath(p, path) {
+      return true
+    }
+  }
+  return false
+}
+
+// appendPath appends path to paths, unless it is already there.
+func appendPath(paths []string, path string) []string {
+  if containsPath(paths, path) {
+    return paths
+  }
+  return append(paths, path)
+}
+
+// parseBackends parses the comma separated list of backends given with -backend,
+// adding dir, when -backup-dir is given.
+// It returns the names of the backends, all of which are registered.
+func parseBackends(opts *config.Options) ([]string, error) {
+  var names []string
+  for _, name := range strings.Split(opts.Backends, ",") {
+    if name = strings.TrimSpace(name); name == "" {
+      continue
+    }
+    if _, err := engine.Lookup(name); err != nil {
+      return nil, err
+    }
+    names = appendPath(names, name)
+  }
+  if opts.BackupDir != "" {
+    names = appendPath(names, "dir")
+  }
+  if len(names) == 0 {
+    return nil, fmt.Errorf("No backend given, available backends: %s", strings.Join(engine.Names(), ", "))
+  }
+  return names, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+  "context"
+  "log/slog"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/pipeline"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// listFlag is a flag, which may be given several times.
+type listFlag []string
+
+func (l *listFlag) String() string {
+  return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+  *l = append(*l, value)
+  return nil
+}
+
+// parsePipelines parses the pipelines of -pipeline.
+func parsePipelines(opts *config.Options) []*pipeline.Pipeline {
+  var pipelines []*pipeline.Pipeline
+  for _, spec := range opts.Pipelines {
+    p, err := pipeline.Parse(spec)
+    if err != nil {
+      logging.Fatal("Invalid -pipeline option", "error", err)
+    }
+    pipelines = append(pipelines, p)
+  }
+  return pipelines
+}
+
+// runPipelines runs the export commands of -pipeline, removing the written files once
+// the run has finished, and returns their paths. A failed pipeline is logged, without
+// failing the backups of the other files.
+func runPipelines(ctx context.Context, opts *config.Options) []string {
+  pipelines := parsePipelines(opts)
+  dir, err := pipeline.Dir()
+  if err != nil {
+    logging.Fatal("Unable to get path to pipelines directory", "error", err)
+  }
+  var paths []string
+  events.OnRunFinished(func(r *report.Report) {
+    for _, p := range paths {
+      if err := pipeline.Remove(p); err != nil {
+        slog.Error("Unable to remove file written by pipeline", "file", p, "error", err)
+      }
+    }
+  })
+  for _, p := range pipelines {
+    slog.Info("Running pipeline", "pipeline", p.Name)
+    path, err := p.Run(ctx, dir)
+    if err != nil {
+      slog.Error("Unable to run pipeline", "pipeline", p.Name, "error", err)
+      continue
+    }
+    paths = append(paths, path)
+  }
+  return paths
+}
+
+// pipelinePaths returns the paths of the files written by the pipelines of -pipeline,
+// which the restore command restores.
+func pipelinePaths(opts *config.Options) []string {
+  dir, err := pipeline.Dir()
+  if err != nil {
+    logging.Fatal("Unable to get path to pipelines directory", "error", err)
+  }
+  var paths []string
+  for _, p := range parsePipelines(opts) {
+    paths = append(paths, filepath.Join(dir, p.Name))
+  }
+  return paths
+}
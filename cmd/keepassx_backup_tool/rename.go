@@ -0,0 +1,48 @@
+package main
+
+import (
+  "bufio"
+  "context"
+  "fmt"
+  "log/slog"
+  "os"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// followRenames renames the backups of given files, which look renamed since they were backed up,
+// with -on-rename rename, or when the user agrees with -on-rename ask, instead of backing them up anew.
+func followRenames(ctx context.Context, opts *config.Options, st *state.State, backends []engine.Backend, paths []string) {
+  if opts.OnRename == "new" {
+    return
+  }
+  var in *bufio.Reader
+  for _, r := range engine.FindRenames(opts, st, paths) {
+    if opts.OnRename == "ask" {
+      if !auth.IsInteractive() {
+        slog.Warn("File looks renamed, backing it up anew, rename its backups with -on-rename rename", "file", r.To,
+          "from", r.From)
+        continue
+      }
+      if in == nil {
+        in = bufio.NewReader(os.Stdin)
+      }
+      fmt.Print(i18n.Sprintf("%s looks renamed from %s, rename its backups too? [Y/n] ", r.To, r.From))
+      answer, err := in.ReadString('\n')
+      if err != nil {
+        logging.Fatal("Unable to read answer", "error", err)
+      }
+      if !i18n.IsYes(answer) {
+        continue
+      }
+    }
+    if err := engine.RenameBackups(ctx, opts, st, backends, r); err != nil {
+      slog.Error("Unable to rename backups of renamed file", "file", r.To, "from", r.From, "error", err)
+    }
+  }
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tui"
+)
+
+// restoreBackend returns the backend selected with -restore-from, without creating
+// the backups folder on Drive.
+func restoreBackend(ctx context.Context, srv *drive.Service, opts *config.Options) (engine.Backend, error) {
+  b, err := lookupBackend(ctx, srv, opts, opts.RestoreFrom)
+  if err == nil && b == nil {
+    return nil, fmt.Errorf("No backups folder %s found on Drive", opts.RemoteFolder)
+  }
+  return b, err
+}
+
+// lookupBackend returns a given backend without creating the backups folder on Drive,
+// or nil if there is no backups folder.
+func lookupBackend(ctx context.Context, srv *drive.Service, opts *config.Options, name string) (engine.Backend, error) {
+  switch name {
+  case "drive":
+    c, err := gdrive.OpenClient(ctx, srv, opts)
+    if err != nil {
+      return nil, err
+    }
+    folderId, err := gdrive.LookupBackupsFolder(ctx, c, opts)
+    if err != nil || folderId == "" {
+      return nil, err
+    }
+    return gdrive.New(c, opts, nil, folderId), nil
+  default:
+    factory, err := engine.Lookup(name)
+    if err != nil {
+      return nil, err
+    }
+    return factory(ctx, &engine.Env{ Opts: opts, Drive: srv })
+  }
+}
+
+// runPickCommand restores the version of a backup picked in the terminal UI, and exits.
+func runPickCommand(ctx context.Context, b engine.Backend, opts *config.Options, st *state.State, paths []string, start time.Time) {
+  versions, err := tui.ListVersions(ctx, b, opts, st, paths)
+  if err != nil {
+    logging.Fatal("Unable to list backups", "error", err)
+  }
+  result, err := tui.RunRestore(ctx, b, versions)
+  if err != nil {
+    logging.Fatal("Unable to run terminal UI", "error", err)
+  }
+  var results []engine.Result
+  if result != nil {
+    results = append(results, *result)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitCode(results), Results: results, Duration: time.Since(start) })
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+  "context"
+  "log/slog"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/selfupdate"
+  "github.com/pawelu/keepassx_backup_tool/internal/transport"
+)
+
+// runSelfUpdateCommand replaces the executable with the latest release, and exits.
+func runSelfUpdateCommand(ctx context.Context, opts *config.Options) {
+  httpClient, err := transport.NewHTTPClient(opts)
+  if err != nil {
+    logging.Fatal("Unable to create HTTP client", "error", err)
+  }
+  latest, updated, err := selfupdate.Update(ctx, httpClient, opts.Log())
+  if err != nil {
+    logging.Fatal("Unable to update", "error", err)
+  }
+  if updated {
+    slog.Info("Updated", "from", selfupdate.Version, "to", latest)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
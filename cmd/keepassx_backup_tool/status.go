@@ -0,0 +1,61 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "sort"
+  "text/tabwriter"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// runStatusCommand prints the last backup of every file in the state, and the storage quota
+// of the Drive account, warning with -quota-warn, and exits.
+func runStatusCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State) {
+  var paths []string
+  for p := range st.Files {
+    paths = append(paths, p)
+  }
+  sort.Strings(paths)
+
+  tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(tw, i18n.T("FILE\tLAST BACKUP\tFAILURES"))
+  for _, p := range paths {
+    last := i18n.T("never")
+    if fs := st.Files[p]; !fs.LastBackup.IsZero() {
+      last = fs.LastBackup.Local().Format(time.RFC3339)
+    }
+    fmt.Fprintf(tw, "%s\t%s\t%d\n", p, last, st.Files[p].Failures)
+  }
+  tw.Flush()
+  fmt.Print(i18n.Sprintf("%d backups queued until network connectivity returns\n", len(st.Pending)))
+
+  if opts.SharedDrive != "" {
+    fmt.Println(i18n.T("Drive storage: shared drive, using the storage of the organization"))
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+  q, err := gdrive.GetQuota(ctx, srv)
+  if auth.IsInvalidGrant(err) {
+    q, err = gdrive.GetQuota(ctx, reauthorize(err))
+  }
+  if err != nil {
+    logging.Fatal("Unable to check Drive storage", "error", err)
+  }
+  fmt.Print(i18n.Sprintf("Drive storage: %s\n", q))
+  if opts.QuotaWarn > 0 && q.Percent() >= float64(opts.QuotaWarn) {
+    opts.Log().Warn("Drive storage is almost full, backups fail once it is full", "percent", int(q.Percent()),
+      "quota-warn", opts.QuotaWarn)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
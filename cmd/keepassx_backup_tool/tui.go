@@ -0,0 +1,34 @@
+package main
+
+import (
+  "context"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/daemon"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tui"
+)
+
+// dashboardRefresh is how often the dashboard of the tui command is refreshed.
+const dashboardRefresh = 2 * time.Second
+
+// runTuiCommand shows the dashboard of the daemon running with the same -control-socket
+// and -user until the user quits, and exits.
+func runTuiCommand(ctx context.Context, opts *config.Options) {
+  if !auth.IsTerminal(os.Stdin) || !auth.IsTerminal(os.Stdout) {
+    logging.Fatal("The tui command needs a terminal")
+  }
+  stateFile, err := state.CacheFile()
+  if err != nil {
+    logging.Fatal("Unable to get path to state file", "error", err)
+  }
+  if err := tui.RunDashboard(ctx, daemon.NewClient(controlSocket(opts)), stateFile, dashboardRefresh); err != nil {
+    logging.Fatal("Unable to run terminal UI", "error", err)
+  }
+  logging.Exit(&report.Report{ Code: report.ExitSuccess })
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// runVerifyCommand downloads the backups of given files by every backend of -backend, checking that they exist
+// and are not corrupted, without reading the files or creating the backups folder on Drive, and exits with
+// ExitInSync, ExitOutdated or ExitCheckError.
+func runVerifyCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, backendNames, paths []string, start time.Time) {
+  var backends []engine.Backend
+  var results []engine.Result
+  for _, name := range backendNames {
+    b, err := lookupBackend(ctx, srv, opts, name)
+    if auth.IsInvalidGrant(err) {
+      srv = reauthorize(err)
+      b, err = lookupBackend(ctx, srv, opts, name)
+    }
+    switch {
+    case err != nil:
+      logging.Fatal("Unable to set up backend", "backend", name, "error", err)
+    case b == nil:
+      // nothing was backed up to Drive yet
+      for _, p := range paths {
+        results = append(results, engine.Result{ Path: p, Backend: name, Action: engine.ActionMissing,
+          Err: fmt.Errorf("Backup is missing") })
+      }
+    default:
+      backends = append(backends, b)
+    }
+  }
+  results = append(results, engine.VerifyRingFiles(ctx, opts, st, backends, paths)...)
+  logging.Exit(&report.Report{ Code: report.VerifyExitCode(results), Results: results, Duration: time.Since(start) })
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "text/tabwriter"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/auth"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// runVersionsCommand prints the versions of given files backed up to every backend, from the history log,
+// or with -drive-revisions the revisions of their backups Drive keeps, which restore -revision restores,
+// and exits.
+func runVersionsCommand(ctx context.Context, srv *drive.Service, reauthorize func(err error) *drive.Service, opts *config.Options,
+  st *state.State, paths []string) {
+  tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  if !opts.DriveRevisions {
+    events, err := report.LoadHistory()
+    if err != nil {
+      logging.Fatal("Unable to read history log", "error", err)
+    }
+    fmt.Fprintln(tw, "FILE\tTIME\tBACKEND\tREMOTE ID\tHASH\tSIZE")
+    for _, e := range events {
+      if (e.Result == engine.ActionCreated || e.Result == engine.ActionUpdated) && containsPath(paths, e.File) {
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.File, e.Time.Local().Format(time.RFC3339), e.Backend, e.RemoteId, e.Hash,
+          progress.FormatBytes(e.Bytes))
+      }
+    }
+    tw.Flush()
+    logging.Exit(&report.Report{ Code: report.ExitSuccess })
+  }
+
+  c, err := gdrive.OpenClient(ctx, srv, opts)
+  if err != nil {
+    logging.Fatal("Unable to find shared drive", "error", err)
+  }
+  folderId, err := gdrive.LookupBackupsFolder(ctx, c, opts)
+  if auth.IsInvalidGrant(err) {
+    if c, err = gdrive.OpenClient(ctx, reauthorize(err), opts); err != nil {
+      logging.Fatal("Unable to find shared drive", "error", err)
+    }
+    folderId, err = gdrive.LookupBackupsFolder(ctx, c, opts)
+  }
+  if err != nil {
+    logging.Fatal("Unable to find backups folder", "error", err)
+  }
+  if folderId == "" {
+    logging.Fatal("No backups folder found on Drive", "folder", opts.RemoteFolder)
+  }
+  b := gdrive.New(c, opts, nil, folderId)
+
+  code := report.ExitSuccess
+  fmt.Fprintln(tw, "FILE\tREVISION\tMODIFIED\tMD5\tSIZE\tKEEP FOREVER")
+  for _, path := range paths {
+    remote, err := engine.FindBackup(ctx, b, opts, st, path)
+    var revisions []*gdrive.Revision
+    if err == nil {
+      revisions, err = b.Revisions(ctx, remote)
+    }
+    if err != nil {
+      opts.Log().Error("Unable to list revisions", "file", path, "error", err)
+      code = report.ExitPartialFailure
+      continue
+    }
+    for _, rev := range revisions {
+      fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\n", path, rev.Id, rev.ModifiedTime, rev.Md5Checksum, progress.FormatBytes(rev.Size),
+        rev.KeepForever)
+    }
+  }
+  tw.Flush()
+  logging.Exit(&report.Report{ Code: code })
+}
@@ -0,0 +1,202 @@
+// Package auth authorizes the application to access Google Drive,
+// caching the OAuth token between runs.
+package auth
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "os"
+  "path/filepath"
+  "sync"
+
+  "golang.org/x/oauth2"
+  "golang.org/x/oauth2/google"
+  "google.golang.org/api/drive/v3"
+  "google.golang.org/api/option"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// getClient uses a Context and Config to retrieve a Token from the store
+// then generate a Client. It returns the generated Client.
+func getClient(ctx context.Context, oauthConfig *oauth2.Config, store CredentialStore) *http.Client {
+  tok, err := store.Load()
+  if err != nil {
+    if err != ErrNoToken {
+      slog.Warn("Unable to load saved credentials, authorizing again", "error", err)
+    }
+    if !IsInteractive() {
+      slog.Error("No saved authorization, run keepassx_backup_tool from a terminal to authorize it, " +
+        "or provide a refresh token in $" + RefreshTokenEnv + " with -credential-store env")
+      logging.Exit(&report.Report{ Code: report.ExitReauthRequired, Message: "Authorization required" })
+    }
+    tok = getTokenFromWeb(ctx, oauthConfig)
+    saveToken(store, tok)
+  }
+  src := &savingTokenSource{ src: oauthConfig.TokenSource(ctx, tok), store: store, last: tok }
+  return oauth2.NewClient(ctx, src)
+}
+
+// NewDriveService creates the Drive client authorized with the token saved in the store,
+// asking the user to authorize the application if there is none.
+func NewDriveService(ctx context.Context, config *oauth2.Config, store CredentialStore) *drive.Service {
+  client := getClient(ctx, config, store)
+
+  srv, err := drive.NewService(ctx, option.WithHTTPClient(client))
+  if err != nil {
+    logging.Fatal("Unable to retrieve drive Client", "error", err)
+  }
+  return srv
+}
+
+// Scope returns the OAuth scope the application is authorized with: drive.file, which gives access
+// to the files created by the application only, or drive with -shared-folder, as folders shared
+// by other accounts are not seen with drive.file.
+func Scope(opts *config.Options) string {
+  if opts.SharedFolder != "" {
+    return drive.DriveScope
+  }
+  return drive.DriveFileScope
+}
+
+// NewServiceAccountService creates the Drive client authorized with a service account key
+// for a given scope, which needs neither a client secret nor a saved token. Unless subject is "",
+// the service account acts as the Google Workspace user with that email, so the backups go to
+// the Drive of the user, which needs domain-wide delegation of the scope to the service account.
+func NewServiceAccountService(ctx context.Context, key []byte, scope, subject string) (*drive.Service, error) {
+  creds, err := google.CredentialsFromJSONWithParams(ctx, key, google.CredentialsParams{ Scopes: []string{ scope },
+    Subject: subject })
+  if err != nil {
+    return nil, fmt.Errorf("Unable to parse service account key: %v", err)
+  }
+  return drive.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, creds.TokenSource)))
+}
+
+// IsInvalidGrant reports whether err was caused by a revoked or expired refresh token.
+func IsInvalidGrant(err error) bool {
+  var retrieveErr *oauth2.RetrieveError
+  return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
+
+// DisablePrompts makes IsInteractive report false even in a terminal,
+// so the user is never asked to authorize the application, nor for secrets.
+func DisablePrompts() {
+  prompt.Disable()
+}
+
+// IsInteractive reports whether the standard input is a terminal,
+// so the user can type in the authorization code.
+func IsInteractive() bool {
+  return prompt.Interactive()
+}
+
+// IsTerminal reports whether a given file is a terminal.
+func IsTerminal(f *os.File) bool {
+  fi, err := f.Stat()
+  return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Reauthorize deletes the saved token, which is no longer accepted by Google,
+// and runs the authorization flow again. When not running in a terminal, it exits
+// with report.ExitReauthRequired instead.
+// It returns the Drive client authorized with the new token.
+func Reauthorize(ctx context.Context, config *oauth2.Config, store CredentialStore, cause error) *drive.Service {
+  slog.Warn("The cached authorization is no longer valid, it was revoked or has expired", "error", cause)
+  if err := store.Delete(); err != nil {
+    logging.Fatal("Unable to delete saved credentials", "error", err)
+  }
+
+  if !IsInteractive() {
+    slog.Error("Run keepassx_backup_tool from a terminal to authorize it again")
+    logging.Exit(&report.Report{ Code: report.ExitReauthRequired, Message: "Authorization was revoked or has expired" })
+  }
+  return NewDriveService(ctx, config, store)
+}
+
+// getTokenFromWeb uses Config to request a Token.
+// It returns the retrieved Token.
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config) *oauth2.Token {
+  authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+  fmt.Print(i18n.Sprintf("Go to the following link in your browser then type the "+
+    "authorization code: \n%v\n", authURL))
+
+  var code string
+  if _, err := fmt.Scan(&code); err != nil {
+    logging.Fatal("Unable to read authorization code", "error", err)
+  }
+
+  tok, err := config.Exchange(ctx, code)
+  if err != nil {
+    logging.Fatal("Unable to retrieve token from web", "error", err)
+  }
+  return tok
+}
+
+// tokenCacheFile generates credential file path/filename, of the token authorized for a given scope,
+// of the main Google account, or of another account with a given name.
+// It returns the generated credential path/filename.
+func tokenCacheFile(scope, account string) (string, error) {
+  tokenCacheDir, err := config.CredentialsDir()
+  if err != nil {
+    return "", err
+  }
+  if account != "" {
+    account = "-" + account
+  }
+  return filepath.Join(tokenCacheDir,
+    url.QueryEscape("drive-go-keepassx-backup"+scopeSuffix(scope)+account+".json")), err
+}
+
+// scopeSuffix returns the suffix of the names of the saved tokens authorized for a given scope,
+// keeping the tokens of the drive scope apart from the ones of drive.file, so -shared-folder
+// asks to authorize the application again, and dropping it uses the former token.
+func scopeSuffix(scope string) string {
+  if scope == drive.DriveScope {
+    return "-full"
+  }
+  return ""
+}
+
+// saveToken stores the token in the credential store.
+func saveToken(store CredentialStore, token *oauth2.Token) {
+  slog.Info("Saving credentials")
+  if err := store.Save(token); err != nil {
+    logging.Fatal("Unable to cache oauth token", "error", err)
+  }
+}
+
+// savingTokenSource is a TokenSource writing every newly obtained token
+// to the credential store, so refreshed access tokens survive between runs.
+type savingTokenSource struct {
+  src   oauth2.TokenSource
+  store CredentialStore
+
+  mu    sync.Mutex
+  last  *oauth2.Token
+}
+
+// Token returns a token from the wrapped source, saving it if it has changed.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+  tok, err := s.src.Token()
+  if err != nil {
+    return nil, err
+  }
+
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.last == nil || tok.AccessToken != s.last.AccessToken || tok.RefreshToken != s.last.RefreshToken {
+    if err := s.store.Save(tok); err != nil {
+      slog.Warn("Unable to save refreshed oauth token", "error", err)
+    }
+    s.last = tok
+  }
+  return tok, nil
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+
+  "github.com/zalando/go-keyring"
+  "golang.org/x/oauth2"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+  "github.com/pawelu/keepassx_backup_tool/internal/seal"
+)
+
+// ErrNoToken is returned by CredentialStore.Load, when no token has been saved yet.
+var ErrNoToken = errors.New("no token saved")
+
+// PassphraseEnv is the environment variable holding the passphrase of the encrypted-file store,
+// which may also be read from the file named by PassphraseEnv_FILE, or the descriptor by PassphraseEnv_FD.
+const PassphraseEnv = config.EnvPrefix + "PASSPHRASE"
+
+// RefreshTokenEnv is the environment variable holding the refresh token of the env store,
+// which may also be read from the file named by RefreshTokenEnv_FILE.
+const RefreshTokenEnv = config.EnvPrefix + "REFRESH_TOKEN"
+
+// CredentialStore keeps the OAuth token between runs.
+type CredentialStore interface {
+  // Load returns the saved token, or ErrNoToken.
+  Load() (*oauth2.Token, error)
+
+  // Save replaces the saved token.
+  Save(tok *oauth2.Token) error
+
+  // Delete removes the saved token, if any.
+  Delete() error
+}
+
+// NewStore creates the credential store selected with -credential-store:
+// file, keyring, encrypted-file, env or memory.
+func NewStore(opts *config.Options) (CredentialStore, error) {
+  return NewAccountStore(opts, "")
+}
+
+// NewAccountStore creates the credential store selected with -credential-store, keeping the token
+// of another Google account of the user with a given name apart, e.g. in a token file of its own,
+// or of the main account with "". The env store of another account reads the refresh token from
+// $KEEPASSX_BACKUP_<ACCOUNT>_REFRESH_TOKEN.
+func NewAccountStore(opts *config.Options, account string) (CredentialStore, error) {
+  refreshTokenEnv := RefreshTokenEnv
+  if account != "" {
+    refreshTokenEnv = config.EnvPrefix + strings.ToUpper(account) + "_REFRESH_TOKEN"
+  }
+  switch opts.CredentialStore {
+  case "", "file":
+    file, err := tokenCacheFile(Scope(opts), account)
+    if err != nil {
+      return nil, err
+    }
+    return NewFileStore(file), nil
+  case "keyring":
+    // the keyring is not scoped by directories, so the user is part of the account
+    keyringAccount := keyringUser + scopeSuffix(Scope(opts))
+    if opts.User != "" {
+      keyringAccount += "-" + opts.User
+    }
+    if account != "" {
+      keyringAccount += "-" + account
+    }
+    return NewKeyringStore(keyringAccount), nil
+  case "encrypted-file":
+    passphrase, err := prompt.EnvSecret(PassphraseEnv, "Passphrase of the encrypted token file: ")
+    if err != nil {
+      return nil, err
+    }
+    if len(passphrase) == 0 {
+      return nil, fmt.Errorf("The encrypted-file credential store needs a passphrase in %s", PassphraseEnv)
+    }
+    file, err := tokenCacheFile(Scope(opts), account)
+    if err != nil {
+      return nil, err
+    }
+    return NewEncryptedFileStore(file+".enc", string(passphrase)), nil
+  case "env":
+    refreshToken, err := config.EnvSecret(refreshTokenEnv)
+    if err != nil {
+      return nil, err
+    }
+    if len(refreshToken) == 0 {
+      return nil, fmt.Errorf("The env credential store needs a refresh token in %s or %s_FILE", refreshTokenEnv, refreshTokenEnv)
+    }
+    return NewEnvStore(strings.TrimSpace(string(refreshToken))), nil
+  case "memory":
+    return NewMemoryStore(), nil
+  default:
+    return nil, fmt.Errorf("Unknown credential store %q, expected file, keyring, encrypted-file, env or memory",
+      opts.CredentialStore)
+  }
+}
+
+// fileStore keeps the token as JSON in a file readable by the user only.
+type fileStore struct {
+  file string
+}
+
+// NewFileStore creates the store keeping the token in a given file path.
+func NewFileStore(file string) CredentialStore {
+  return &fileStore{ file: file }
+}
+
+func (s *fileStore) Load() (*oauth2.Token, error) {
+  b, err := ioutil.ReadFile(s.file)
+  if os.IsNotExist(err) {
+    return nil, ErrNoToken
+  }
+  if err != nil {
+    return nil, err
+  }
+  return decodeToken(b)
+}
+
+func (s *fileStore) Save(tok *oauth2.Token) error {
+  b, err := json.Marshal(tok)
+  if err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(s.file, b, 0600)
+}
+
+func (s *fileStore) Delete() error {
+  return removeFile(s.file)
+}
+
+// keyringService and keyringUser identify the token in the keyring,
+// keyringUser followed by the suffix of the scope and the -user, if any.
+const (
+  keyringService = "keepassx_backup_tool"
+  keyringUser    = "drive-token"
+)
+
+// keyringStore keeps the token in the keyring of the operating system: the Secret
+// Service on Linux, the Keychain on macOS and the Credential Manager on Windows.
+type keyringStore struct {
+  account string
+}
+
+// NewKeyringStore creates the store keeping the token in the keyring of the operating system,
+// under a given account name.
+func NewKeyringStore(account string) CredentialStore {
+  return keyringStore{ account: account }
+}
+
+func (s keyringStore) Load() (*oauth2.Token, error) {
+  secret, err := keyring.Get(keyringService, s.account)
+  if errors.Is(err, keyring.ErrNotFound) {
+    return nil, ErrNoToken
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read token from keyring: %w", err)
+  }
+  return decodeToken([]byte(secret))
+}
+
+func (s keyringStore) Save(tok *oauth2.Token) error {
+  b, err := json.Marshal(tok)
+  if err != nil {
+    return err
+  }
+  if err := keyring.Set(keyringService, s.account, string(b)); err != nil {
+    return fmt.Errorf("Unable to write token to keyring: %w", err)
+  }
+  return nil
+}
+
+func (s keyringStore) Delete() error {
+  if err := keyring.Delete(keyringService, s.account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+    return fmt.Errorf("Unable to delete token from keyring: %w", err)
+  }
+  return nil
+}
+
+// encryptedFileStore keeps the token in a file sealed with a passphrase,
+// see the seal package.
+type encryptedFileStore struct {
+  file       string
+  passphrase string
+}
+
+// NewEncryptedFileStore creates the store keeping the token in a given file path,
+// encrypted with a passphrase.
+func NewEncryptedFileStore(file, passphrase string) CredentialStore {
+  return &encryptedFileStore{ file: file, passphrase: passphrase }
+}
+
+func (s *encryptedFileStore) Load() (*oauth2.Token, error) {
+  b, err := ioutil.ReadFile(s.file)
+  if os.IsNotExist(err) {
+    return nil, ErrNoToken
+  }
+  if err != nil {
+    return nil, err
+  }
+  plain, err := seal.Open(b, s.passphrase)
+  if err == seal.ErrTruncated {
+    return nil, fmt.Errorf("Encrypted token file %s is truncated", s.file)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to decrypt token file %s, wrong passphrase?", s.file)
+  }
+  return decodeToken(plain)
+}
+
+func (s *encryptedFileStore) Save(tok *oauth2.Token) error {
+  plain, err := json.Marshal(tok)
+  if err != nil {
+    return err
+  }
+  out, err := seal.Seal(plain, s.passphrase)
+  if err != nil {
+    return err
+  }
+  if err := os.MkdirAll(filepath.Dir(s.file), 0700); err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(s.file, out, 0600)
+}
+
+func (s *encryptedFileStore) Delete() error {
+  return removeFile(s.file)
+}
+
+// MemoryStore keeps the token in memory only, e.g. for tests.
+type MemoryStore struct {
+  mu  sync.Mutex
+  tok *oauth2.Token
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+  return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() (*oauth2.Token, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.tok == nil {
+    return nil, ErrNoToken
+  }
+  tok := *s.tok
+  return &tok, nil
+}
+
+func (s *MemoryStore) Save(tok *oauth2.Token) error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  saved := *tok
+  s.tok = &saved
+  return nil
+}
+
+func (s *MemoryStore) Delete() error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.tok = nil
+  return nil
+}
+
+// NewEnvStore creates the store starting with a pre-provisioned refresh token,
+// e.g. from the environment of a container. Refreshed tokens are kept in memory only,
+// so nothing is written, and the refresh token is used again on the next run.
+func NewEnvStore(refreshToken string) CredentialStore {
+  // the access token is obtained with the refresh token on first use
+  return &MemoryStore{ tok: &oauth2.Token{ RefreshToken: refreshToken } }
+}
+
+// decodeToken parses a token saved as JSON.
+func decodeToken(b []byte) (*oauth2.Token, error) {
+  t := &oauth2.Token{}
+  if err := json.Unmarshal(b, t); err != nil {
+    return nil, err
+  }
+  return t, nil
+}
+
+// removeFile removes a file, which may not exist.
+func removeFile(file string) error {
+  if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  return nil
+}
@@ -0,0 +1,164 @@
+// Package bench measures hashing and upload throughput.
+package bench
+
+import (
+  "context"
+  "crypto/rand"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+)
+
+// benchName is the name of the synthetic payload uploaded to every backend.
+const benchName = "keepassx_backup_tool.bench"
+
+// Result is a single measurement of the bench command.
+type Result struct {
+  Operation string
+  Backend   string
+  ChunkSize string
+  Bytes     int64
+  Duration  time.Duration
+  Err       error
+}
+
+// throughput formats the measured throughput per second.
+func (r Result) throughput() string {
+  if r.Err != nil || r.Duration <= 0 {
+    return "-"
+  }
+  return progress.FormatBytes(int64(float64(r.Bytes)/r.Duration.Seconds())) + "/s"
+}
+
+// Run measures hashing and snapshot throughput locally, and upload throughput
+// to every backend with every given chunk size, using a random payload of a given size,
+// which is removed from the backends afterwards.
+func Run(ctx context.Context, opts *config.Options, backends []engine.Backend, size int64, chunkSizes []string, w io.Writer) ([]Result, error) {
+  payload, err := ioutil.TempFile("", "keepassx_backup_bench_")
+  if err != nil {
+    return nil, err
+  }
+  defer hashing.RemoveSnapshot(payload)
+  if _, err := io.CopyN(payload, rand.Reader, size); err != nil {
+    return nil, fmt.Errorf("Unable to write bench payload: %v", err)
+  }
+  if err := payload.Sync(); err != nil {
+    return nil, fmt.Errorf("Unable to write bench payload: %v", err)
+  }
+
+  var results []Result
+
+  start := time.Now()
+  hash, err := hashing.FileHash(payload.Name())
+  results = append(results, Result{ Operation: "hash", Bytes: size, Duration: time.Since(start), Err: err })
+
+  start = time.Now()
+  snapshot, _, _, err := hashing.SnapshotFile(payload.Name())
+  if err == nil {
+    hashing.RemoveSnapshot(snapshot)
+  }
+  results = append(results, Result{ Operation: "snapshot", Bytes: size, Duration: time.Since(start), Err: err })
+
+  for _, b := range backends {
+    sizes := chunkSizes
+    if _, ok := b.(*gdrive.Backend); !ok {
+      // only Drive uploads in chunks
+      sizes = []string{ "-" }
+    }
+    for _, chunkSize := range sizes {
+      r := Result{ Operation: "upload", Backend: b.Name(), ChunkSize: chunkSize, Bytes: size }
+      r.Duration, r.Err = benchUpload(ctx, b, opts, chunkSize, payload, size, hash)
+      results = append(results, r)
+    }
+  }
+
+  return results, writeBench(w, results)
+}
+
+// benchUpload uploads the payload to a backend with a given chunk size and removes it.
+// It returns the duration of the upload.
+func benchUpload(ctx context.Context, b engine.Backend, opts *config.Options, chunkSize string, payload *os.File, size int64, hash string) (time.Duration, error) {
+  if d, ok := b.(*gdrive.Backend); ok {
+    n, err := config.ParseSize(chunkSize)
+    if err != nil {
+      return 0, err
+    }
+    chunkedOpts := *opts
+    chunkedOpts.ChunkSize = int(n)
+    b = d.WithOptions(&chunkedOpts)
+  }
+
+  remote, err := b.Find(ctx, benchName, "")
+  if err != nil {
+    return 0, err
+  }
+  start := time.Now()
+  id, err := b.Upload(ctx, benchName, benchName, remote, io.NewSectionReader(payload, 0, size), size, hash, nil)
+  duration := time.Since(start)
+  if err != nil {
+    return 0, err
+  }
+  return duration, b.Remove(ctx, &engine.RemoteFile{ Id: id, Name: benchName, Md5: hash })
+}
+
+// writeBench writes a table of bench results.
+func writeBench(w io.Writer, results []Result) error {
+  tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(tw, "OPERATION\tBACKEND\tCHUNK SIZE\tBYTES\tDURATION\tTHROUGHPUT\tERROR")
+  for _, r := range results {
+    errText := ""
+    if r.Err != nil {
+      errText = r.Err.Error()
+    }
+    fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\t%s\t%s\n", r.Operation, dash(r.Backend), dash(r.ChunkSize),
+      progress.FormatBytes(r.Bytes), r.Duration.Round(time.Millisecond), r.throughput(), errText)
+  }
+  return tw.Flush()
+}
+
+// dash returns s, or a dash if s is empty.
+func dash(s string) string {
+  if s == "" {
+    return "-"
+  }
+  return s
+}
+
+// NewJournal opens a journal in a temporary directory, so interrupted bench
+// uploads are not reconciled by the next backup.
+func NewJournal() (*gdrive.Journal, func(), error) {
+  dir, err := ioutil.TempDir("", "keepassx_backup_bench_")
+  if err != nil {
+    return nil, nil, err
+  }
+  jr, err := gdrive.OpenJournal(filepath.Join(dir, "journal.json"))
+  if err != nil {
+    os.RemoveAll(dir)
+    return nil, nil, err
+  }
+  return jr, func() { os.RemoveAll(dir) }, nil
+}
+
+// ParseChunkSizes parses a comma separated list of chunk sizes.
+func ParseChunkSizes(list string) ([]string, error) {
+  var sizes []string
+  for _, s := range strings.Split(list, ",") {
+    s = strings.TrimSpace(s)
+    if _, err := config.ParseSize(s); err != nil {
+      return nil, err
+    }
+    sizes = append(sizes, s)
+  }
+  return sizes, nil
+}
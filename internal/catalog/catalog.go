@@ -0,0 +1,232 @@
+// Package catalog keeps an SQLite index of the backups made to every backend, which the catalog command queries.
+package catalog
+
+import (
+  "database/sql"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  _ "modernc.org/sqlite"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// schema creates the table of the backups, one row for every version of a file uploaded to a backend.
+const schema = `CREATE TABLE IF NOT EXISTS backups (
+  file      TEXT NOT NULL,
+  backend   TEXT NOT NULL,
+  version   INTEGER NOT NULL,
+  time      TEXT NOT NULL,
+  hostname  TEXT NOT NULL,
+  hash      TEXT NOT NULL,
+  size      INTEGER NOT NULL,
+  location  TEXT NOT NULL,
+  PRIMARY KEY (file, backend, version)
+);
+CREATE INDEX IF NOT EXISTS backups_time ON backups (time);`
+
+// timeLayout has a fixed width, so the times stored as text sort in time order.
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// Entry is a version of a file backed up to a backend, at the location of the backend, e.g. the id of the file on Drive.
+type Entry struct {
+  File     string
+  Backend  string
+  Version  int
+  Time     time.Time
+  Hostname string
+  Hash     string
+  Size     int64
+  Location string
+}
+
+// Total sums up the backups stored by a backend.
+type Total struct {
+  Backend  string
+  Files    int
+  Versions int
+  Size     int64
+}
+
+// Catalog is the opened catalog database.
+type Catalog struct {
+  db *sql.DB
+}
+
+// CacheFile generates the path of the catalog database.
+func CacheFile() (string, error) {
+  dir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "catalog.db"), nil
+}
+
+// Open opens the catalog database at a given path, creating it if it does not exist yet.
+func Open(path string) (*Catalog, error) {
+  db, err := sql.Open("sqlite", path)
+  if err != nil {
+    return nil, err
+  }
+  // a single connection keeps the busy timeout, as the daemon and a run from the terminal may write at once
+  db.SetMaxOpenConns(1)
+  if _, err = db.Exec("PRAGMA busy_timeout = 5000"); err == nil {
+    _, err = db.Exec(schema)
+  }
+  if err != nil {
+    db.Close()
+    return nil, err
+  }
+  // the catalog tells which backups exist, like the state
+  os.Chmod(path, 0600)
+  return &Catalog{ db: db }, nil
+}
+
+// Close closes the catalog database.
+func (c *Catalog) Close() error {
+  return c.db.Close()
+}
+
+// Add adds entries to the catalog, numbering the versions of every file and backend in turn.
+func (c *Catalog) Add(entries []Entry) error {
+  return c.update(false, entries)
+}
+
+// Replace replaces all entries of the catalog with given ones, numbering their versions like Add.
+func (c *Catalog) Replace(entries []Entry) error {
+  return c.update(true, entries)
+}
+
+// update adds entries to the catalog in a single transaction, removing all other entries first with clear.
+func (c *Catalog) update(clear bool, entries []Entry) error {
+  tx, err := c.db.Begin()
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+  if clear {
+    if _, err := tx.Exec("DELETE FROM backups"); err != nil {
+      return err
+    }
+  }
+  for _, e := range entries {
+    err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM backups WHERE file = ? AND backend = ?", e.File,
+      e.Backend).Scan(&e.Version)
+    if err != nil {
+      return err
+    }
+    _, err = tx.Exec("INSERT INTO backups (file, backend, version, time, hostname, hash, size, location) "+
+      "VALUES (?, ?, ?, ?, ?, ?, ?, ?)", e.File, e.Backend, e.Version, e.Time.UTC().Format(timeLayout), e.Hostname, e.Hash,
+      e.Size, e.Location)
+    if err != nil {
+      return err
+    }
+  }
+  return tx.Commit()
+}
+
+// Latest returns the latest version of every file backed up to every backend by every host,
+// ordered by file, host and backend.
+func (c *Catalog) Latest() ([]Entry, error) {
+  // the bare columns of a row with MAX are the ones of the row with the maximum
+  return c.query("SELECT file, backend, MAX(version), time, hostname, hash, size, location FROM backups " +
+    "GROUP BY file, hostname, backend ORDER BY file, hostname, backend")
+}
+
+// Versions returns the versions of given files, or of all files, backed up within a time range, where
+// zero times leave the range open, ordered by time.
+func (c *Catalog) Versions(files []string, since, until time.Time) ([]Entry, error) {
+  where, args := []string{ "1 = 1" }, []interface{}{}
+  if len(files) > 0 {
+    where = append(where, "file IN (?"+strings.Repeat(", ?", len(files)-1)+")")
+    for _, f := range files {
+      args = append(args, f)
+    }
+  }
+  if !since.IsZero() {
+    where = append(where, "time >= ?")
+    args = append(args, since.UTC().Format(timeLayout))
+  }
+  if !until.IsZero() {
+    where = append(where, "time < ?")
+    args = append(args, until.UTC().Format(timeLayout))
+  }
+  return c.query("SELECT file, backend, version, time, hostname, hash, size, location FROM backups WHERE "+
+    strings.Join(where, " AND ")+" ORDER BY time, file, backend", args...)
+}
+
+// Totals returns the number of files and versions backed up to every backend, and their total size.
+func (c *Catalog) Totals() ([]Total, error) {
+  rows, err := c.db.Query("SELECT backend, COUNT(DISTINCT file), COUNT(*), SUM(size) FROM backups GROUP BY backend " +
+    "ORDER BY backend")
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+  var totals []Total
+  for rows.Next() {
+    var t Total
+    if err := rows.Scan(&t.Backend, &t.Files, &t.Versions, &t.Size); err != nil {
+      return nil, err
+    }
+    totals = append(totals, t)
+  }
+  return totals, rows.Err()
+}
+
+// query returns the entries selected by a query of all columns of the backups.
+func (c *Catalog) query(query string, args ...interface{}) ([]Entry, error) {
+  rows, err := c.db.Query(query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+  var entries []Entry
+  for rows.Next() {
+    var e Entry
+    var t string
+    if err := rows.Scan(&e.File, &e.Backend, &e.Version, &t, &e.Hostname, &e.Hash, &e.Size, &e.Location); err != nil {
+      return nil, err
+    }
+    if e.Time, err = time.Parse(timeLayout, t); err != nil {
+      return nil, err
+    }
+    entries = append(entries, e)
+  }
+  return entries, rows.Err()
+}
+
+// uploads returns the entries of the uploads among the results of a sync, made now by this host.
+func uploads(results []engine.Result) []Entry {
+  hostname, _ := os.Hostname()
+  now := time.Now()
+  var entries []Entry
+  for _, r := range results {
+    if r.Action == engine.ActionCreated || r.Action == engine.ActionUpdated {
+      entries = append(entries, Entry{ File: r.Path, Backend: r.Backend, Time: now, Hostname: hostname, Hash: r.Hash,
+        Size: r.Bytes, Location: r.RemoteId })
+    }
+  }
+  return entries
+}
+
+// Record adds the uploads among the results of a sync to the catalog.
+func Record(results []engine.Result) error {
+  entries := uploads(results)
+  if len(entries) == 0 {
+    return nil
+  }
+  file, err := CacheFile()
+  if err != nil {
+    return err
+  }
+  c, err := Open(file)
+  if err != nil {
+    return err
+  }
+  defer c.Close()
+  return c.Add(entries)
+}
@@ -0,0 +1,98 @@
+// Package compress compresses backups and decompresses restored ones.
+package compress
+
+import (
+  "compress/gzip"
+  "crypto/md5"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/klauspost/compress/zstd"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+)
+
+// Suffixes are the name suffixes of compressed backups, by compression.
+var Suffixes = map[string]string{
+  "gzip": ".gz",
+  "zstd": ".zst",
+}
+
+// BackupName returns the name of the backup of a local file, compressed with a given
+// compression, or none if it is empty.
+func BackupName(path, compression string) string {
+  return filepath.Base(path) + Suffixes[compression]
+}
+
+// BackupNames returns the names a backup of a local file may have, starting
+// with the one for a given compression.
+func BackupNames(path, compression string) []string {
+  names := []string{ BackupName(path, compression) }
+  for _, c := range []string{ "", "gzip", "zstd" } {
+    if c != compression {
+      names = append(names, BackupName(path, c))
+    }
+  }
+  return names
+}
+
+// NewCompressor creates a writer compressing to w. Compressing the same data twice
+// gives the same output, so an unchanged file is not uploaded again.
+func NewCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+  switch compression {
+  case "gzip":
+    return gzip.NewWriterLevel(w, gzip.BestCompression)
+  case "zstd":
+    return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithEncoderConcurrency(1))
+  default:
+    return nil, fmt.Errorf("unsupported compression %q", compression)
+  }
+}
+
+// NewDecompressor creates a reader decompressing a backup read from r,
+// detecting the compression by the suffix of the backup name.
+func NewDecompressor(r io.Reader, name string) (io.ReadCloser, error) {
+  switch {
+  case strings.HasSuffix(name, Suffixes["gzip"]):
+    return gzip.NewReader(r)
+  case strings.HasSuffix(name, Suffixes["zstd"]):
+    d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+    if err != nil {
+      return nil, err
+    }
+    return d.IOReadCloser(), nil
+  default:
+    return ioutil.NopCloser(r), nil
+  }
+}
+
+// Snapshot compresses size bytes of a snapshot into another temporary file.
+// It returns the opened compressed snapshot and the md5 hash of its content.
+func Snapshot(snapshot *os.File, size int64, compression string) (*os.File, string, error) {
+  compressed, err := ioutil.TempFile("", "keepassx_backup_")
+  if err != nil {
+    return nil, "", err
+  }
+
+  digest := md5.New()
+  w, err := NewCompressor(io.MultiWriter(compressed, digest), compression)
+  if err == nil {
+    _, err = io.Copy(w, io.NewSectionReader(snapshot, 0, size))
+    if closeErr := w.Close(); err == nil {
+      err = closeErr
+    }
+  }
+  if err == nil {
+    _, err = compressed.Seek(0, 0)
+  }
+  if err != nil {
+    hashing.RemoveSnapshot(compressed)
+    return nil, "", err
+  }
+  return compressed, hex.EncodeToString(digest.Sum(nil)), nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+  "fmt"
+  "os"
+  "os/user"
+  "path/filepath"
+  "strings"
+)
+
+// appDir is the name of the directories of the application in the base directories.
+const appDir = "keepassx_backup"
+
+// tokenFilePrefix starts the names of the files holding the OAuth token.
+const tokenFilePrefix = "drive-go-keepassx-backup.json"
+
+// portableDir, once set with -portable, holds all files of the application.
+var portableDir string
+
+// SetPortable keeps the state, the token and the plugins in the keepassx_backup
+// directory next to the executable, e.g. on a USB stick with the database,
+// instead of the directories of the user.
+func SetPortable() error {
+  exe, err := os.Executable()
+  if err != nil {
+    return err
+  }
+  if exe, err = filepath.EvalSymlinks(exe); err != nil {
+    return err
+  }
+  portableDir = filepath.Join(filepath.Dir(exe), appDir)
+  return nil
+}
+
+// userName, once set with -user, scopes the token and the state to a user.
+var userName string
+
+// SetUser keeps the token and the state of a given user in directories of their own,
+// so a single installation backs up several users to their own Google accounts.
+func SetUser(name string) error {
+  if err := ValidUser(name); err != nil {
+    return err
+  }
+  userName = name
+  return nil
+}
+
+// ValidUser checks that a user name can name a directory.
+func ValidUser(name string) error {
+  if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+    return fmt.Errorf("Invalid user name %q", name)
+  }
+  return nil
+}
+
+// StateDir generates the directory holding the local state, the journal and the history.
+// It returns the directory path, creating it if necessary.
+func StateDir() (string, error) {
+  return makeDir(stateDir)
+}
+
+// CredentialsDir generates the directory holding the OAuth token.
+// It returns the directory path, creating it if necessary.
+func CredentialsDir() (string, error) {
+  return makeDir(credentialsDir)
+}
+
+// makeDir creates the directory returned by a function, or the portable directory,
+// with a subdirectory for the -user, if any.
+func makeDir(dirFunc func() (string, error)) (string, error) {
+  dir := portableDir
+  if dir == "" {
+    var err error
+    if dir, err = dirFunc(); err != nil {
+      return "", err
+    }
+  }
+  if userName != "" {
+    dir = filepath.Join(dir, "users", userName)
+  }
+  os.MkdirAll(dir, 0700)
+  return dir, nil
+}
+
+// legacyCacheDir returns the directory holding credentials and local state
+// on all systems in earlier versions.
+func legacyCacheDir() (string, error) {
+  usr, err := user.Current()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(usr.HomeDir, ".credentials", appDir), nil
+}
+
+// PluginsDir returns the default directory of plugins, in the user configuration directory
+// or the portable directory.
+// It returns an empty path, if the user has no configuration directory.
+func PluginsDir() string {
+  if portableDir != "" {
+    return filepath.Join(portableDir, "plugins")
+  }
+  dir, err := configDir()
+  if err != nil {
+    return ""
+  }
+  return filepath.Join(dir, "plugins")
+}
@@ -0,0 +1,114 @@
+//go:build !windows
+
+package config
+
+import (
+  "io/ioutil"
+  "os"
+  "os/user"
+  "path/filepath"
+  "strings"
+  "sync"
+)
+
+// migrateOnce moves the files of earlier versions to the XDG base directories once per run.
+var migrateOnce sync.Once
+
+// xdgDir returns keepassx_backup in the base directory given by an XDG environment
+// variable, or in its default under the home directory. Relative paths in the
+// variable are ignored, as the XDG Base Directory Specification requires.
+func xdgDir(env, defaultDir string) (string, error) {
+  if dir := os.Getenv(env); filepath.IsAbs(dir) {
+    return filepath.Join(dir, appDir), nil
+  }
+  usr, err := user.Current()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(usr.HomeDir, defaultDir, appDir), nil
+}
+
+// stateDir returns keepassx_backup in $XDG_STATE_HOME, by default ~/.local/state.
+func stateDir() (string, error) {
+  migrateOnce.Do(migrateLegacyDir)
+  return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// credentialsDir returns keepassx_backup in $XDG_CACHE_HOME, by default ~/.cache.
+func credentialsDir() (string, error) {
+  migrateOnce.Do(migrateLegacyDir)
+  return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// configDir returns keepassx_backup in $XDG_CONFIG_HOME, by default ~/.config.
+func configDir() (string, error) {
+  return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// migrateLegacyDir moves the files from ~/.credentials/keepassx_backup, where earlier
+// versions kept them: the OAuth token to the credentials directory, and everything
+// else to the state directory. Files existing in the new directories already are kept,
+// and so is the old directory, unless it ends up empty.
+func migrateLegacyDir() {
+  legacy, err := legacyCacheDir()
+  if err != nil {
+    return
+  }
+  entries, err := ioutil.ReadDir(legacy)
+  if err != nil {
+    return
+  }
+  state, err := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+  if err != nil {
+    return
+  }
+  credentials, err := xdgDir("XDG_CACHE_HOME", ".cache")
+  if err != nil {
+    return
+  }
+
+  for _, fi := range entries {
+    if fi.IsDir() {
+      continue
+    }
+    dir := state
+    if strings.HasPrefix(fi.Name(), tokenFilePrefix) {
+      dir = credentials
+    }
+    target := filepath.Join(dir, fi.Name())
+    if _, err := os.Stat(target); err == nil {
+      continue
+    }
+    if err := os.MkdirAll(dir, 0700); err != nil {
+      return
+    }
+    moveFile(filepath.Join(legacy, fi.Name()), target, fi.Mode().Perm())
+  }
+  os.Remove(legacy)
+}
+
+// moveFile moves a file, copying it when the target is on another file system.
+func moveFile(from, to string, perm os.FileMode) error {
+  if err := os.Rename(from, to); err == nil {
+    return nil
+  }
+  b, err := ioutil.ReadFile(from)
+  if err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(to, b, perm); err != nil {
+    os.Remove(to)
+    return err
+  }
+  return os.Remove(from)
+}
+
+// NormalizePath cleans a path, which is kept relative, if given so.
+func NormalizePath(path string) string {
+  return filepath.Clean(path)
+}
+
+// SamePath reports whether two normalized paths name the same file.
+func SamePath(a, b string) bool {
+  return a == b
+}
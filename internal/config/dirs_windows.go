@@ -0,0 +1,54 @@
+//go:build windows
+
+package config
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// stateDir returns keepassx_backup in %LOCALAPPDATA%, unless the directory
+// of earlier versions exists already.
+func stateDir() (string, error) {
+  legacy, err := legacyCacheDir()
+  if err == nil {
+    if _, err := os.Stat(legacy); err == nil {
+      return legacy, nil
+    }
+  }
+  base := os.Getenv("LOCALAPPDATA")
+  if base == "" {
+    return legacy, err
+  }
+  return filepath.Join(base, appDir), nil
+}
+
+// credentialsDir returns the same directory as stateDir.
+func credentialsDir() (string, error) {
+  return stateDir()
+}
+
+// configDir returns keepassx_backup in %APPDATA%.
+func configDir() (string, error) {
+  dir, err := os.UserConfigDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, appDir), nil
+}
+
+// NormalizePath makes a path absolute, resolving paths relative to the current
+// directory of a drive, e.g. C:ring.kdbx, and turning slashes into backslashes.
+func NormalizePath(path string) string {
+  if abs, err := filepath.Abs(path); err == nil {
+    return abs
+  }
+  return filepath.Clean(path)
+}
+
+// SamePath reports whether two normalized paths name the same file,
+// ignoring case like the file systems of Windows do.
+func SamePath(a, b string) bool {
+  return strings.EqualFold(a, b)
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+  "bufio"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// discoverDepth limits how deep databases are looked for below the search roots.
+const discoverDepth = 4
+
+// skippedDirs are never searched for databases, as they are large and hold none.
+var skippedDirs = map[string]bool{
+  "node_modules": true,
+  "Library":      true,
+  "AppData":      true,
+  "snap":         true,
+}
+
+// discoverRoots returns the directories searched for databases: the home directory,
+// and below it the documents and the folders of the usual sync clients, searched deeper.
+func discoverRoots() []string {
+  home, err := os.UserHomeDir()
+  if err != nil {
+    return nil
+  }
+  roots := []string{ home }
+  for _, dir := range []string{ "Documents", "Desktop", "Dropbox", "Nextcloud", "ownCloud", "OneDrive", "Google Drive",
+    "Sync", "Syncthing", "Seafile" } {
+    roots = append(roots, filepath.Join(home, dir))
+  }
+  return roots
+}
+
+// KeePassXCRecentDatabases returns the existing databases KeePassXC has opened recently,
+// read from keepassxc.ini in the configuration directory and, since KeePassXC 2.7,
+// in the cache directory.
+func KeePassXCRecentDatabases() []string {
+  files := []string{ keepassxcConfigPatterns()[0] }
+  if cacheDir, err := os.UserCacheDir(); err == nil {
+    files = append(files, filepath.Join(cacheDir, "keepassxc", "keepassxc.ini"))
+  }
+  var dbs []string
+  for _, file := range files {
+    for _, db := range readRecentDatabases(file) {
+      if fi, err := os.Stat(db); err == nil && fi.Mode().IsRegular() {
+        dbs = appendUnique(dbs, NormalizePath(db))
+      }
+    }
+  }
+  return dbs
+}
+
+// readRecentDatabases reads the LastDatabases and LastOpenedDatabases lists of a keepassxc.ini.
+func readRecentDatabases(file string) []string {
+  f, err := os.Open(file)
+  if err != nil {
+    return nil
+  }
+  defer f.Close()
+  var dbs []string
+  s := bufio.NewScanner(f)
+  for s.Scan() {
+    kv := strings.SplitN(strings.TrimSpace(s.Text()), "=", 2)
+    if len(kv) == 2 && (kv[0] == "LastDatabases" || kv[0] == "LastOpenedDatabases") {
+      dbs = append(dbs, splitSettingsList(kv[1])...)
+    }
+  }
+  return dbs
+}
+
+// splitSettingsList splits a list written by QSettings: comma separated values,
+// quoted when they hold a comma.
+func splitSettingsList(value string) []string {
+  var values []string
+  var cur strings.Builder
+  quoted := false
+  for _, c := range value {
+    switch {
+    case c == '"':
+      quoted = !quoted
+    case c == ',' && !quoted:
+      values = append(values, strings.TrimSpace(cur.String()))
+      cur.Reset()
+    default:
+      cur.WriteRune(c)
+    }
+  }
+  values = append(values, strings.TrimSpace(cur.String()))
+  var out []string
+  for _, v := range values {
+    if v != "" {
+      out = append(out, v)
+    }
+  }
+  return out
+}
+
+// DiscoverDatabases returns the .kdbx and .kdb files KeePassXC has opened recently,
+// followed by the ones found in the home directory, the documents and the folders
+// of sync clients such as Dropbox and Nextcloud.
+func DiscoverDatabases() []string {
+  dbs := KeePassXCRecentDatabases()
+  for _, root := range discoverRoots() {
+    rootDepth := strings.Count(filepath.Clean(root), string(filepath.Separator))
+    filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+      if err != nil {
+        if fi != nil && fi.IsDir() {
+          return filepath.SkipDir
+        }
+        return nil
+      }
+      if fi.IsDir() {
+        name := fi.Name()
+        depth := strings.Count(filepath.Clean(path), string(filepath.Separator)) - rootDepth
+        if path != root && (strings.HasPrefix(name, ".") || skippedDirs[name] || depth >= discoverDepth) {
+          return filepath.SkipDir
+        }
+        return nil
+      }
+      if ext := strings.ToLower(filepath.Ext(path)); fi.Mode().IsRegular() && (ext == ".kdbx" || ext == ".kdb") {
+        dbs = appendUnique(dbs, NormalizePath(path))
+      }
+      return nil
+    })
+  }
+  return dbs
+}
+
+// appendUnique appends path to paths, unless it is already there.
+func appendUnique(paths []string, path string) []string {
+  for _, p := range paths {
+    if SamePath(p, path) {
+      return paths
+    }
+  }
+  return append(paths, path)
+}
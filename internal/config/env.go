@@ -0,0 +1,83 @@
+package config
+
+import (
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strconv"
+  "strings"
+  "sync"
+)
+
+// EnvPrefix starts the names of the environment variables configuring the application,
+// e.g. KEEPASSX_BACKUP_LOG_FORMAT for -log-format.
+const EnvPrefix = "KEEPASSX_BACKUP_"
+
+// EnvName returns the name of the environment variable setting the option of a flag.
+func EnvName(flagName string) string {
+  return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets the flags of a flag set from their environment variables.
+// It is called before parsing the command line, so flags given there win.
+func ApplyEnv(fs *flag.FlagSet) error {
+  var err error
+  fs.VisitAll(func(f *flag.Flag) {
+    v, ok := os.LookupEnv(EnvName(f.Name))
+    if !ok || err != nil {
+      return
+    }
+    if setErr := fs.Set(f.Name, v); setErr != nil {
+      err = fmt.Errorf("Invalid %s environment variable: %v", EnvName(f.Name), setErr)
+    }
+  })
+  return err
+}
+
+// fdSecrets holds the secrets read from file descriptors, which can be read only once.
+var fdSecrets sync.Map
+
+// EnvSecret returns a secret given in an environment variable, or read from the file
+// named by the variable with a _FILE suffix, e.g. a mounted container secret, or from the
+// file descriptor numbered by the variable with a _FD suffix, e.g. a pipe of a script.
+// It returns nil, if neither variable is set.
+func EnvSecret(env string) ([]byte, error) {
+  if v := os.Getenv(env); v != "" {
+    return []byte(v), nil
+  }
+  if fd := os.Getenv(env + "_FD"); fd != "" {
+    return fdSecret(env, fd)
+  }
+  file := os.Getenv(env + "_FILE")
+  if file == "" {
+    return nil, nil
+  }
+  b, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read %s_FILE: %v", env, err)
+  }
+  return b, nil
+}
+
+// fdSecret reads a secret from a file descriptor, the first time it is asked for.
+func fdSecret(env, fd string) ([]byte, error) {
+  if b, ok := fdSecrets.Load(env); ok {
+    return b.([]byte), nil
+  }
+  n, err := strconv.Atoi(fd)
+  if err != nil || n < 0 {
+    return nil, fmt.Errorf("Invalid %s_FD, expected a file descriptor number", env)
+  }
+  f := os.NewFile(uintptr(n), env+"_FD")
+  if f == nil {
+    return nil, fmt.Errorf("Invalid %s_FD, expected a file descriptor number", env)
+  }
+  defer f.Close()
+  b, err := ioutil.ReadAll(f)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read %s_FD: %v", env, err)
+  }
+  fdSecrets.Store(env, b)
+  return b, nil
+}
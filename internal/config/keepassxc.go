@@ -0,0 +1,57 @@
+package config
+
+import (
+  "os"
+  "path/filepath"
+  "runtime"
+)
+
+// browserManifest is the native messaging manifest of KeePassXC-Browser.
+const browserManifest = "org.keepassxc.keepassxc_browser.json"
+
+// keepassxcConfigPatterns returns the glob patterns of the KeePassXC configuration files.
+func keepassxcConfigPatterns() []string {
+  configDir, _ := os.UserConfigDir()
+  home, _ := os.UserHomeDir()
+  switch runtime.GOOS {
+  case "windows":
+    return []string{
+      filepath.Join(configDir, "KeePassXC", "keepassxc.ini"),
+      filepath.Join(os.Getenv("LOCALAPPDATA"), "KeePassXC", "org.keepassxc.keepassxc_browser_*.json"),
+    }
+  case "darwin":
+    return []string{
+      filepath.Join(configDir, "keepassxc", "keepassxc.ini"),
+      filepath.Join(configDir, "Mozilla", "NativeMessagingHosts", browserManifest),
+      filepath.Join(configDir, "Google", "Chrome", "NativeMessagingHosts", browserManifest),
+      filepath.Join(configDir, "Chromium", "NativeMessagingHosts", browserManifest),
+    }
+  default:
+    return []string{
+      filepath.Join(configDir, "keepassxc", "keepassxc.ini"),
+      filepath.Join(home, ".mozilla", "native-messaging-hosts", browserManifest),
+      filepath.Join(configDir, "google-chrome", "NativeMessagingHosts", browserManifest),
+      filepath.Join(configDir, "chromium", "NativeMessagingHosts", browserManifest),
+    }
+  }
+}
+
+// KeePassXCConfigFiles returns the existing configuration files of KeePassXC:
+// keepassxc.ini, which holds the browser integration settings too, and the native
+// messaging manifests of KeePassXC-Browser. Backups are named after the files,
+// so of the manifests with the same name in several browsers the first one is returned.
+func KeePassXCConfigFiles() []string {
+  var files []string
+  names := make(map[string]bool)
+  for _, pattern := range keepassxcConfigPatterns() {
+    matches, _ := filepath.Glob(pattern)
+    for _, m := range matches {
+      if fi, err := os.Stat(m); err != nil || !fi.Mode().IsRegular() || names[filepath.Base(m)] {
+        continue
+      }
+      names[filepath.Base(m)] = true
+      files = append(files, m)
+    }
+  }
+  return files
+}
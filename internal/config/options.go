@@ -0,0 +1,143 @@
+// Package config holds the options and the directory of the local state.
+package config
+
+import (
+  "fmt"
+  "log/slog"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+// Options holds the command line options used while syncing.
+type Options struct {
+  WaitTimeout    time.Duration
+  Jobs           int
+  RestoreTrashed bool
+  Backends       string
+  BackupDir      string
+  PluginsDir     string
+  Interval       time.Duration
+  WatchRemote    time.Duration
+  ControlSocket  string
+  Init           string
+  MinBattery     int
+  User           string
+  UsersFile      string
+  Impersonate    string
+  Export         string
+  KeyFile        string
+  OnConflict     string
+  OnOlderLocal   string
+  OnRename       string
+  GCUnknownHost  bool
+  Generic        string
+  Pipelines      []string
+  SharedDrive    string
+  SharedFolder   string
+  QuotaWarn      int
+  RemoteFolder   string
+  DirLayout      string
+  Compress       string
+  RestoreFrom    string
+  Revision       string
+  DriveRevisions bool
+  Pick           bool
+  VerifyKdbx     bool
+  Output         string
+  Stdin          bool
+  StdinName      string
+  Format         string
+  Since          string
+  Until          string
+  EncryptSecrets bool
+  BundleToken    bool
+  BenchSize      string
+  BenchChunks    string
+  Proxy          string
+  BwLimit        string
+  ChunkSize      int
+  CaCert         string
+  ClientCert     string
+  ClientKey      string
+  TlsMinVersion  string
+  DebugHTTP      bool
+  LogLevel       string
+  LogFormat      string
+  LogTarget      string
+  NonInteractive bool
+  Portable       bool
+
+  CredentialStore string
+  KeePassXCConfig bool
+  MergeDuplicates bool
+  MetricsTextfile string
+  HealthcheckURL  string
+  NotifyDesktop   string
+  WebhookURL      string
+  WebhookFormat   string
+  TelegramToken   string
+  TelegramChatId  string
+  NtfyURL         string
+  NtfyToken       string
+  GotifyURL       string
+  GotifyToken     string
+  MqttURL         string
+  SummaryFile     string
+  ResultFile      string
+  OtlpEndpoint    string
+  MaxAge          time.Duration
+  Quiet           bool
+  Lang            string
+  ExitSkipped     bool
+
+  // Progress is set when the upload progress bar is shown
+  Progress bool
+
+  // Logger receives the log messages of syncing, slog.Default() if nil
+  Logger *slog.Logger
+
+  // OnProgress, unless nil, is called while uploading with the bytes read so far
+  // out of total, possibly concurrently for several backends
+  OnProgress func(path, backend string, read, total int64)
+}
+
+// Log returns the logger receiving the log messages of syncing.
+func (o *Options) Log() *slog.Logger {
+  if o.Logger != nil {
+    return o.Logger
+  }
+  return slog.Default()
+}
+
+// genericPatterns returns the comma separated patterns of -generic.
+func (o *Options) genericPatterns() []string {
+  var patterns []string
+  for _, pattern := range strings.Split(o.Generic, ",") {
+    if pattern = strings.TrimSpace(pattern); pattern != "" {
+      patterns = append(patterns, pattern)
+    }
+  }
+  return patterns
+}
+
+// ValidateGeneric checks each of the patterns of -generic.
+func (o *Options) ValidateGeneric() error {
+  for _, pattern := range o.genericPatterns() {
+    if _, err := filepath.Match(pattern, ""); err != nil {
+      return fmt.Errorf("Invalid pattern %q: %w", pattern, err)
+    }
+  }
+  return nil
+}
+
+// IsGeneric reports whether a file is backed up as a generic secrets file, its name matching
+// one of the comma separated patterns of -generic, so it is not checked as a KeePass database.
+func (o *Options) IsGeneric(path string) bool {
+  for _, pattern := range o.genericPatterns() {
+    if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+// ParseSize parses a number of bytes with an optional k, M or G suffix.
+func ParseSize(s string) (int64, error) {
+  number, multiplier := s, int64(1)
+  switch {
+  case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+    multiplier = 1024
+  case strings.HasSuffix(s, "M"):
+    multiplier = 1024 * 1024
+  case strings.HasSuffix(s, "G"):
+    multiplier = 1024 * 1024 * 1024
+  }
+  if multiplier > 1 {
+    number = s[:len(s)-1]
+  }
+  n, err := strconv.ParseFloat(number, 64)
+  if err != nil || n < 0 {
+    return 0, fmt.Errorf("invalid size %q", s)
+  }
+  return int64(n * float64(multiplier)), nil
+}
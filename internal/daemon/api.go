@@ -0,0 +1,139 @@
+package daemon
+
+import (
+  "context"
+  "encoding/json"
+  "log/slog"
+  "net"
+  "net/http"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// Status is the response of GET /status.
+type Status struct {
+  Running   bool              `json:"running"`
+  StartedAt *time.Time        `json:"started_at,omitempty"`
+  NextRun   *time.Time        `json:"next_run,omitempty"`
+  LastRun   *report.RunResult `json:"last_run,omitempty"`
+
+  // Users holds the last run of every user of -users-file
+  Users map[string]*report.RunResult `json:"users,omitempty"`
+}
+
+// version is a single backed up version in the response of GET /versions.
+type version struct {
+  Time     time.Time `json:"time"`
+  File     string    `json:"file"`
+  Hash     string    `json:"hash,omitempty"`
+  Backend  string    `json:"backend"`
+  RemoteId string    `json:"remote_id,omitempty"`
+  Bytes    int64     `json:"bytes,omitempty"`
+}
+
+// Serve runs the control API on a unix socket at a given path until the context is done:
+// POST /backup triggers a backup, GET /status describes the current and the last run,
+// and GET /versions lists the backed up versions, of a single file with ?file=path.
+func (d *Daemon) Serve(ctx context.Context, socket string) error {
+  // a socket left by a daemon which did not exit cleanly blocks listening
+  os.Remove(socket)
+  l, err := net.Listen("unix", socket)
+  if err != nil {
+    return err
+  }
+  defer os.Remove(socket)
+  // the API controls backups of secrets, only the user may connect
+  if err := os.Chmod(socket, 0600); err != nil {
+    l.Close()
+    return err
+  }
+
+  mux := http.NewServeMux()
+  mux.HandleFunc("/backup", d.handleBackup)
+  mux.HandleFunc("/status", d.handleStatus)
+  mux.HandleFunc("/versions", d.handleVersions)
+  srv := &http.Server{ Handler: mux, ReadHeaderTimeout: 10 * time.Second }
+
+  go func() {
+    <-ctx.Done()
+    srv.Close()
+  }()
+  slog.Info("Control API listening", "socket", socket)
+  if err := srv.Serve(l); err != http.ErrServerClosed {
+    return err
+  }
+  return nil
+}
+
+func (d *Daemon) handleBackup(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost {
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  if !d.Trigger() {
+    http.Error(w, "backup already running", http.StatusConflict)
+    return
+  }
+  w.WriteHeader(http.StatusAccepted)
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodGet {
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  d.mu.Lock()
+  s := Status{ Running: d.running, LastRun: d.last }
+  if len(d.lastByUser) > 0 {
+    s.Users = make(map[string]*report.RunResult)
+    for user, last := range d.lastByUser {
+      s.Users[user] = last
+    }
+  }
+  if d.running {
+    started := d.started
+    s.StartedAt = &started
+  } else if !d.nextRun.IsZero() {
+    next := d.nextRun
+    s.NextRun = &next
+  }
+  d.mu.Unlock()
+  writeJSON(w, s)
+}
+
+func (d *Daemon) handleVersions(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodGet {
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+  events, err := report.LoadHistory()
+  if err != nil {
+    http.Error(w, "unable to read history log: "+err.Error(), http.StatusInternalServerError)
+    return
+  }
+
+  file := r.URL.Query().Get("file")
+  versions := []version{}
+  for _, e := range events {
+    if e.Result != engine.ActionCreated && e.Result != engine.ActionUpdated {
+      continue
+    }
+    if file != "" && e.File != file {
+      continue
+    }
+    versions = append(versions, version{ Time: e.Time, File: e.File, Hash: e.Hash, Backend: e.Backend,
+      RemoteId: e.RemoteId, Bytes: e.Bytes })
+  }
+  writeJSON(w, versions)
+}
+
+// writeJSON sends a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  if err := json.NewEncoder(w).Encode(v); err != nil {
+    slog.Warn("Unable to write control API response", "error", err)
+  }
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "net"
+  "net/http"
+)
+
+// ErrRunning is returned by Client.Backup, when a backup is running already.
+var ErrRunning = errors.New("backup already running")
+
+// Client talks to the control API of a running daemon, see Serve.
+type Client struct {
+  http *http.Client
+}
+
+// NewClient creates the client of the control API on the unix socket at a given path.
+func NewClient(socket string) *Client {
+  dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+    var d net.Dialer
+    return d.DialContext(ctx, "unix", socket)
+  }
+  return &Client{ http: &http.Client{ Transport: &http.Transport{ DialContext: dial } } }
+}
+
+// Status returns the status of the daemon.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+  resp, err := c.do(ctx, http.MethodGet, "/status")
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  s := &Status{}
+  if err := json.NewDecoder(resp.Body).Decode(s); err != nil {
+    return nil, fmt.Errorf("Invalid status of daemon: %w", err)
+  }
+  return s, nil
+}
+
+// Backup has the daemon back up now, or returns ErrRunning.
+func (c *Client) Backup(ctx context.Context) error {
+  resp, err := c.do(ctx, http.MethodPost, "/backup")
+  if err != nil {
+    return err
+  }
+  resp.Body.Close()
+  return nil
+}
+
+// do sends a request to the control API, failing unless the daemon accepted it.
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+  // the host is ignored, the socket is dialed
+  req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, nil)
+  if err != nil {
+    return nil, err
+  }
+  resp, err := c.http.Do(req)
+  if err != nil {
+    return nil, fmt.Errorf("Daemon not running? %w", err)
+  }
+  if resp.StatusCode == http.StatusConflict {
+    resp.Body.Close()
+    return nil, ErrRunning
+  }
+  if resp.StatusCode < 200 || resp.StatusCode > 299 {
+    resp.Body.Close()
+    return nil, fmt.Errorf("Daemon responded with %s", resp.Status)
+  }
+  return resp, nil
+}
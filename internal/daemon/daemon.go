@@ -0,0 +1,285 @@
+// Package daemon runs backups periodically, and on request of the local control API.
+package daemon
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "log/slog"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// Backup runs a backup in the process of the daemon, returning its report.
+type Backup func(ctx context.Context) *report.Report
+
+// Daemon runs the backups in its own process, reusing the authorized Drive client, its connections and
+// the backends between runs. With -users-file, the backup command of every user runs as a child process
+// instead, as the token, the state directory and the flags of a user are global to the process running it.
+type Daemon struct {
+  backup     Backup
+  flags      []string
+  interval   time.Duration
+  minBattery int
+  resultFile string
+  users      []User
+  trigger    chan struct{}
+
+  mu         sync.Mutex
+  running    bool
+  started    time.Time
+  nextRun    time.Time
+  last       *report.RunResult
+  lastByUser map[string]*report.RunResult
+}
+
+// ResultCacheFile generates the path of the result file, which backups run
+// by the daemon write and the daemon reads their status from.
+func ResultCacheFile() (string, error) {
+  dir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "daemon-result.json"), nil
+}
+
+// New creates the daemon running backups with backup, or with -users-file the backup command
+// of every user in turn, with the given command line flags and the arguments of the user.
+func New(opts *config.Options, flags []string, backup Backup) (*Daemon, error) {
+  if opts.Interval <= 0 {
+    return nil, fmt.Errorf("-interval has to be positive")
+  }
+  resultFile, err := ResultCacheFile()
+  if err != nil {
+    return nil, err
+  }
+  d := &Daemon{ backup: backup, flags: flags, interval: opts.Interval, minBattery: opts.MinBattery, resultFile: resultFile,
+    trigger: make(chan struct{}, 1), lastByUser: make(map[string]*report.RunResult) }
+  if opts.UsersFile != "" {
+    if d.users, err = LoadUsers(opts.UsersFile); err != nil {
+      return nil, err
+    }
+  }
+  // the status survives restarts of the daemon
+  if last, err := report.LoadResult(resultFile); err == nil && d.users == nil {
+    d.last = last
+  }
+  for _, u := range d.users {
+    if last, err := report.LoadResult(userResultFile(resultFile, u.Name)); err == nil {
+      d.recordResult(u.Name, last)
+    }
+  }
+  return d, nil
+}
+
+// Run runs a backup immediately, and then every interval or when triggered,
+// until the context is done. Under systemd, it reports readiness and the status,
+// and pings the watchdog.
+func (d *Daemon) Run(ctx context.Context) {
+  timer := time.NewTimer(0)
+  defer timer.Stop()
+  sdNotify("READY=1")
+  go watchdog(ctx)
+  // retry is the wait for the next backup, while backups are queued without network connectivity
+  var retry time.Duration
+  for {
+    scheduled := false
+    select {
+    case <-ctx.Done():
+      sdNotify("STOPPING=1")
+      return
+    case <-timer.C:
+      scheduled = true
+    case <-d.trigger:
+      // since Go 1.23 a stopped timer is never received from, and Reset drops a fire not received
+      timer.Stop()
+    }
+    if scheduled && !d.waitForPower(ctx) {
+      continue
+    }
+
+    next := d.interval
+    if d.runBackup(ctx) {
+      // the queued backups are uploaded as soon as network connectivity returns
+      retry = min(max(2*retry, offlineRetryMin), d.interval)
+      next = retry
+      slog.Info("Backups queued until network connectivity returns, retrying", "in", next)
+    } else {
+      retry = 0
+    }
+    d.mu.Lock()
+    d.nextRun = time.Now().Add(next)
+    d.mu.Unlock()
+    sdNotify("STATUS=" + d.statusText())
+    timer.Reset(next)
+  }
+}
+
+// offlineRetryMin is how long after a backup, which queued backups without network connectivity,
+// the next one runs. The wait doubles with every backup queueing backups again, up to the interval.
+var offlineRetryMin = time.Minute
+
+// powerPollInterval is how often the power supply is checked while a backup is postponed.
+const powerPollInterval = time.Minute
+
+// waitForPower postpones a scheduled backup while the system runs on battery charged
+// below -min-battery, until AC power returns, the battery is charged again, or a backup
+// is triggered. It returns false, if the context is done meanwhile.
+func (d *Daemon) waitForPower(ctx context.Context) bool {
+  if d.minBattery <= 0 {
+    return true
+  }
+  postponed := false
+  for {
+    percent, onBattery := batteryLevel()
+    if !onBattery || percent >= d.minBattery {
+      if postponed {
+        slog.Info("Running postponed backup", "battery", percent)
+      }
+      return true
+    }
+    if !postponed {
+      slog.Info("Postponing backup while on battery", "battery", percent, "min_battery", d.minBattery)
+      sdNotify("STATUS=Backup postponed, on battery")
+      postponed = true
+    }
+    select {
+    case <-ctx.Done():
+      return false
+    case <-d.trigger:
+      return true
+    case <-time.After(powerPollInterval):
+    }
+  }
+}
+
+// Trigger requests a backup to run now.
+// It returns false, if a backup is running or already requested.
+func (d *Daemon) Trigger() bool {
+  d.mu.Lock()
+  running := d.running
+  d.mu.Unlock()
+  if running {
+    return false
+  }
+  select {
+  case d.trigger <- struct{}{}:
+    return true
+  default:
+    return false
+  }
+}
+
+// withoutNotifySocket removes the variables of systemd notifications from an environment.
+func withoutNotifySocket(env []string) []string {
+  var out []string
+  for _, v := range env {
+    if !strings.HasPrefix(v, "NOTIFY_SOCKET=") && !strings.HasPrefix(v, "WATCHDOG_") {
+      out = append(out, v)
+    }
+  }
+  return out
+}
+
+// runBackup runs a backup once, or the backup command once for every user, recording the results.
+// It returns whether any backups were queued without network connectivity.
+func (d *Daemon) runBackup(ctx context.Context) bool {
+  d.mu.Lock()
+  d.running = true
+  d.started = time.Now()
+  d.mu.Unlock()
+  defer func() {
+    d.mu.Lock()
+    d.running = false
+    d.mu.Unlock()
+  }()
+
+  sdNotify("STATUS=Backing up")
+  if d.users == nil {
+    last := d.runInProcess(ctx)
+    d.recordResult("", last)
+    return last.Queued > 0
+  }
+  exe, err := os.Executable()
+  if err != nil {
+    slog.Error("Unable to find own executable", "error", err)
+    return false
+  }
+  queued := false
+  for _, u := range d.users {
+    if ctx.Err() != nil {
+      break
+    }
+    flags, args := u.args(d.flags)
+    last := d.runChild(ctx, exe, flags, args, userResultFile(d.resultFile, u.Name), "user", u.Name)
+    d.recordResult(u.Name, last)
+    queued = queued || last != nil && last.Queued > 0
+  }
+  return queued
+}
+
+// runInProcess runs the backup once, saving its result to the result file of the daemon.
+// It returns the result of the backup.
+func (d *Daemon) runInProcess(ctx context.Context) *report.RunResult {
+  slog.Info("Starting backup")
+  r := d.backup(ctx)
+  switch r.Status() {
+  case report.StatusSkip:
+    slog.Info("Backup skipped, nothing has changed")
+  case report.StatusFailure:
+    slog.Warn("Backup failed", "error", r.ErrorText())
+  }
+  now := time.Now()
+  if err := r.SaveResult(d.resultFile, now); err != nil {
+    slog.Error("Unable to write result of backup", "error", err)
+  }
+  return r.RunResult(now)
+}
+
+// recordResult records the result of the last backup, of a given user if any.
+func (d *Daemon) recordResult(user string, last *report.RunResult) {
+  if last == nil {
+    return
+  }
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.last = last
+  if user != "" {
+    d.lastByUser[user] = last
+  }
+}
+
+// runChild runs the backup command of a user with given flags and arguments once.
+// It returns the result of the backup, nil if it could not be read.
+func (d *Daemon) runChild(ctx context.Context, exe string, flags, args []string, resultFile string, logArgs ...any) *report.RunResult {
+  // the last -result-file wins, so the daemon overrides the one given by the user
+  cmdArgs := []string{ "backup" }
+  cmdArgs = append(cmdArgs, flags...)
+  cmdArgs = append(cmdArgs, "-result-file", resultFile, "--")
+  cmdArgs = append(cmdArgs, args...)
+  slog.Info("Starting backup", logArgs...)
+  cmd := exec.CommandContext(ctx, exe, cmdArgs...)
+  cmd.Stdout = os.Stdout
+  cmd.Stderr = os.Stderr
+  // the backups never see NOTIFY_SOCKET, systemd would take their messages for the daemon's
+  cmd.Env = withoutNotifySocket(os.Environ())
+  var exitErr *exec.ExitError
+  if err := cmd.Run(); errors.As(err, &exitErr) && exitErr.ExitCode() == report.ExitSkipped {
+    slog.Info("Backup skipped, nothing has changed", logArgs...)
+  } else if err != nil {
+    slog.Warn("Backup failed", append(logArgs, "error", err)...)
+  }
+
+  last, err := report.LoadResult(resultFile)
+  if err != nil {
+    slog.Error("Unable to read result of backup", append(logArgs, "error", err)...)
+  }
+  return last
+}
@@ -0,0 +1,64 @@
+package daemon_test
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/daemon"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// TestRunInProcess runs the backups of the daemon in its own process, right away and when triggered.
+func TestRunInProcess(t *testing.T) {
+  t.Setenv("XDG_STATE_HOME", t.TempDir())
+  t.Setenv("HOME", t.TempDir())
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+
+  done := make(chan *report.Report)
+  reports := []*report.Report{
+    { Code: report.ExitSuccess, Results: []engine.Result{ { Path: "/ring.kdbx", Backend: "drive", Action: engine.ActionUpdated } } },
+    { Code: report.ExitFailure, Message: "Unable to back up: offline" },
+  }
+  runs := 0
+  d, err := daemon.New(&config.Options{ Interval: time.Hour }, nil, func(ctx context.Context) *report.Report {
+    r := reports[runs]
+    runs++
+    done <- r
+    return r
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  go d.Run(ctx)
+
+  resultFile, err := daemon.ResultCacheFile()
+  if err != nil {
+    t.Fatal(err)
+  }
+  for i, want := range reports {
+    if i > 0 {
+      // the previous backup may still be recorded, when the trigger comes
+      for !d.Trigger() {
+        time.Sleep(10 * time.Millisecond)
+      }
+    }
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+      t.Fatalf("backup %d was not run", i)
+    }
+    var last *report.RunResult
+    for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+      if last, err = report.LoadResult(resultFile); err == nil && last.ExitCode == want.Code {
+        break
+      }
+    }
+    if last == nil || last.Status != want.Status() || last.Error != want.ErrorText() {
+      t.Errorf("result of backup %d = %+v, want %s %q", i, last, want.Status(), want.ErrorText())
+    }
+  }
+}
@@ -0,0 +1,28 @@
+//go:build darwin
+
+package daemon
+
+import (
+  "os/exec"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// pmsetPercent matches the charge in the output of pmset -g batt.
+var pmsetPercent = regexp.MustCompile(`(\d+)%`)
+
+// batteryLevel returns the charge of the battery in percent, and whether the
+// system runs on it, from pmset.
+func batteryLevel() (int, bool) {
+  out, err := exec.Command("pmset", "-g", "batt").Output()
+  if err != nil || !strings.Contains(string(out), "'Battery Power'") {
+    return 0, false
+  }
+  m := pmsetPercent.FindSubmatch(out)
+  if m == nil {
+    return 0, false
+  }
+  percent, err := strconv.Atoi(string(m[1]))
+  return percent, err == nil
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package daemon
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+// batteryLevel returns the charge of the batteries in percent, and whether the
+// system runs on them, from the power supplies in sysfs.
+func batteryLevel() (int, bool) {
+  supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+  total, batteries, discharging := 0, 0, false
+  for _, dir := range supplies {
+    switch readSysfs(dir, "type") {
+    case "Mains", "USB":
+      if readSysfs(dir, "online") == "1" {
+        return 0, false
+      }
+    case "Battery":
+      // batteries of mice and keyboards say nothing about the system
+      if readSysfs(dir, "scope") == "Device" {
+        continue
+      }
+      capacity, err := strconv.Atoi(readSysfs(dir, "capacity"))
+      if err != nil {
+        continue
+      }
+      total += capacity
+      batteries++
+      discharging = discharging || readSysfs(dir, "status") == "Discharging"
+    }
+  }
+  if batteries == 0 || !discharging {
+    return 0, false
+  }
+  return total / batteries, true
+}
+
+// readSysfs reads an attribute of a sysfs directory.
+func readSysfs(dir, name string) string {
+  b, err := ioutil.ReadFile(filepath.Join(dir, name))
+  if err != nil {
+    return ""
+  }
+  return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package daemon
+
+// batteryLevel reports running on AC power, as the battery cannot be read on this platform.
+func batteryLevel() (int, bool) {
+  return 0, false
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package daemon
+
+import (
+  "syscall"
+  "unsafe"
+)
+
+var procGetSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// systemPowerStatus is SYSTEM_POWER_STATUS.
+type systemPowerStatus struct {
+  ACLineStatus        byte
+  BatteryFlag         byte
+  BatteryLifePercent  byte
+  SystemStatusFlag    byte
+  BatteryLifeTime     uint32
+  BatteryFullLifeTime uint32
+}
+
+// batteryLevel returns the charge of the battery in percent, and whether the
+// system runs on it, from GetSystemPowerStatus.
+func batteryLevel() (int, bool) {
+  var s systemPowerStatus
+  if r, _, _ := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s))); r == 0 {
+    return 0, false
+  }
+  // 255 is an unknown charge
+  if s.ACLineStatus != 0 || s.BatteryLifePercent == 255 {
+    return 0, false
+  }
+  return int(s.BatteryLifePercent), true
+}
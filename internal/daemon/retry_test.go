@@ -0,0 +1,58 @@
+package daemon
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// TestRunRetriesQueued runs the next backup soon after one queued backups without network connectivity,
+// and the one after it an interval later, once the queued backups were uploaded.
+func TestRunRetriesQueued(t *testing.T) {
+  t.Setenv("XDG_STATE_HOME", t.TempDir())
+  t.Setenv("HOME", t.TempDir())
+  defer func(retry time.Duration) { offlineRetryMin = retry }(offlineRetryMin)
+  offlineRetryMin = 10 * time.Millisecond
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+
+  reports := []*report.Report{
+    { Code: report.ExitSuccess, Results: []engine.Result{ { Path: "/ring.kdbx", Backend: "drive", Action: engine.ActionQueued } } },
+    { Code: report.ExitSuccess, Results: []engine.Result{ { Path: "/ring.kdbx", Backend: "drive", Action: engine.ActionUpdated } } },
+  }
+  done := make(chan int, len(reports)+1)
+  runs := 0
+  d, err := New(&config.Options{ Interval: time.Hour }, nil, func(ctx context.Context) *report.Report {
+    r := reports[runs%len(reports)]
+    runs++
+    done <- runs
+    return r
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  go d.Run(ctx)
+
+  for i := range reports {
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+      t.Fatalf("backup %d was not run", i)
+    }
+  }
+  select {
+  case n := <-done:
+    t.Errorf("backup %d ran right after the queued backups were uploaded, want it an interval later", n)
+  case <-time.After(200 * time.Millisecond):
+  }
+  d.mu.Lock()
+  nextRun := d.nextRun
+  d.mu.Unlock()
+  if wait := time.Until(nextRun); wait < 59*time.Minute {
+    t.Errorf("next backup in %v, want in the interval of %v", wait, time.Hour)
+  }
+}
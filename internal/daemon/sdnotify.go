@@ -0,0 +1,73 @@
+package daemon
+
+import (
+  "context"
+  "fmt"
+  "log/slog"
+  "net"
+  "os"
+  "strconv"
+  "time"
+)
+
+// sdNotify sends a state, e.g. READY=1, to systemd, when the daemon runs as
+// a Type=notify service. It does nothing otherwise.
+func sdNotify(state string) {
+  // abstract sockets start with @, which the net package handles
+  socket := os.Getenv("NOTIFY_SOCKET")
+  if socket == "" {
+    return
+  }
+  conn, err := net.Dial("unixgram", socket)
+  if err != nil {
+    slog.Warn("Unable to notify systemd", "socket", socket, "error", err)
+    return
+  }
+  defer conn.Close()
+  if _, err := conn.Write([]byte(state)); err != nil {
+    slog.Warn("Unable to notify systemd", "socket", socket, "error", err)
+  }
+}
+
+// watchdogInterval returns how often systemd expects watchdog pings,
+// half of WatchdogSec= to be on the safe side, or 0 without a watchdog.
+func watchdogInterval() time.Duration {
+  usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+  if err != nil || usec <= 0 {
+    return 0
+  }
+  if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+    return 0
+  }
+  return time.Duration(usec) * time.Microsecond / 2
+}
+
+// watchdog pings the systemd watchdog until the context is done.
+func watchdog(ctx context.Context) {
+  interval := watchdogInterval()
+  if interval == 0 {
+    return
+  }
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+      sdNotify("WATCHDOG=1")
+    }
+  }
+}
+
+// statusText describes the last and the next backup, for systemctl status.
+func (d *Daemon) statusText() string {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  next := d.nextRun.Format("15:04")
+  if d.last == nil {
+    return fmt.Sprintf("Next backup at %s", next)
+  }
+  return fmt.Sprintf("Last backup %s at %s, next at %s", d.last.Status,
+    d.last.Timestamp.Local().Format("15:04"), next)
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+)
+
+// User is a person backed up by a daemon shared by several users, with their
+// own token and state, see config.SetUser.
+type User struct {
+  Name string `json:"name"`
+
+  // Files are the paths of the files of the user to back up
+  Files []string `json:"files"`
+
+  // ClientSecret is the path of the client secret file, if not given in the environment
+  ClientSecret string `json:"client_secret,omitempty"`
+
+  // Impersonate is the email of the Workspace user the service account of the daemon acts as,
+  // backing up to the Drive of the user, see -impersonate
+  Impersonate string `json:"impersonate,omitempty"`
+
+  // Flags are added to the flags of the daemon for the backups of the user
+  Flags []string `json:"flags,omitempty"`
+}
+
+// usersFile is the content of -users-file.
+type usersFile struct {
+  Users []User `json:"users"`
+}
+
+// LoadUsers reads the users backed up by the daemon from a JSON file.
+func LoadUsers(path string) ([]User, error) {
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  var f usersFile
+  if err := json.Unmarshal(b, &f); err != nil {
+    return nil, fmt.Errorf("Unable to parse users file %s: %v", path, err)
+  }
+  if len(f.Users) == 0 {
+    return nil, fmt.Errorf("No users in users file %s", path)
+  }
+  seen := make(map[string]bool)
+  for _, u := range f.Users {
+    if err := config.ValidUser(u.Name); err != nil {
+      return nil, err
+    }
+    if seen[u.Name] {
+      return nil, fmt.Errorf("User %q is listed twice in users file %s", u.Name, path)
+    }
+    seen[u.Name] = true
+  }
+  return f.Users, nil
+}
+
+// args returns the flags and the arguments of the backups of the user.
+func (u *User) args(flags []string) ([]string, []string) {
+  userFlags := append(append([]string{}, flags...), "-user", u.Name)
+  if u.Impersonate != "" {
+    userFlags = append(userFlags, "-impersonate", u.Impersonate)
+  }
+  userFlags = append(userFlags, u.Flags...)
+  args := append([]string{}, u.Files...)
+  if u.ClientSecret != "" {
+    args = append(args, u.ClientSecret)
+  }
+  return userFlags, args
+}
+
+// userResultFile returns the result file of the backups of a user.
+func userResultFile(resultFile, name string) string {
+  return strings.TrimSuffix(resultFile, ".json") + "-" + name + ".json"
+}
+
+// AddUserFiles adds files to the files of a user in a JSON users file, adding the user,
+// or creating the file, if necessary.
+func AddUserFiles(path, name string, files []string) error {
+  var f usersFile
+  b, err := ioutil.ReadFile(path)
+  if err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  if err == nil {
+    if err := json.Unmarshal(b, &f); err != nil {
+      return fmt.Errorf("Unable to parse users file %s: %v", path, err)
+    }
+  }
+  i := 0
+  for i < len(f.Users) && f.Users[i].Name != name {
+    i++
+  }
+  if i == len(f.Users) {
+    f.Users = append(f.Users, User{ Name: name })
+  }
+  for _, file := range files {
+    f.Users[i].Files = append(f.Users[i].Files, file)
+  }
+  b, err = json.MarshalIndent(&f, "", "  ")
+  if err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(path, append(b, '\n'), 0600)
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Apply records the results of syncing in the state: backups which failed for
+// missing network connectivity are queued until the next sync, other failures
+// are counted, and successful backups are timestamped, for the file and for the backend. The paths queued by the
+// caller are in queued, which gets the newly queued ones added, unless it is nil.
+// It returns the results with the final action of every backup.
+func Apply(opts *config.Options, st *state.State, results []Result, queued map[string]bool) []Result {
+  if queued == nil {
+    queued = make(map[string]bool)
+  }
+  applied := make([]Result, 0, len(results))
+  for _, result := range results {
+    ringFilePath := result.Path
+    switch {
+    case IsOffline(result.Err):
+      state.QueueBackups(st, []string{ ringFilePath })
+      queued[ringFilePath] = true
+      opts.Log().Warn("No network connectivity, backup queued until next sync", "file", ringFilePath,
+        "backend", result.Backend, "error", result.Err)
+      result.Action, result.Err = ActionQueued, nil
+    case result.Err != nil:
+      opts.Log().Error("Unable to back up .kdbx file", "file", ringFilePath, "backend", result.Backend, "error", result.Err)
+      result.Action = ActionFailed
+      fs := st.File(ringFilePath)
+      fs.Failures++
+      fs.Backend(result.Backend).Failures++
+    default:
+      // the backup stays queued for the backends, which were offline
+      if !queued[ringFilePath] {
+        st.RemovePending(ringFilePath)
+      }
+      fs := st.File(ringFilePath)
+      fs.LastBackup = time.Now()
+      fs.Backend(result.Backend).LastBackup = fs.LastBackup
+    }
+    applied = append(applied, result)
+  }
+  return applied
+}
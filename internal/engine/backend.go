@@ -0,0 +1,68 @@
+package engine
+
+import (
+  "context"
+  "io"
+  "sync"
+  "time"
+)
+
+// Backend stores backups of .kdbx files.
+type Backend interface {
+  // Name identifies the backend in logs, the state and the history.
+  Name() string
+
+  // Find looks up the backup with a given name, using the id remembered from the previous sync.
+  // It returns nil if there is no backup yet.
+  Find(ctx context.Context, name, remoteId string) (*RemoteFile, error)
+
+  // Upload stores size bytes read from r as the backup of a local file with a given name,
+  // replacing remote unless it is nil, and verifies that the stored copy has the given md5 hash.
+  // Backends, which can, store the metadata describing the file with the backup.
+  // It returns the id of the stored copy.
+  Upload(ctx context.Context, path, name string, remote *RemoteFile, r io.Reader, size int64, hash string,
+    meta map[string]string) (string, error)
+
+  // Download opens the content of a backup.
+  Download(ctx context.Context, remote *RemoteFile) (io.ReadCloser, error)
+
+  // Remove deletes a backup, or moves it to the trash, where the backend has one.
+  Remove(ctx context.Context, remote *RemoteFile) error
+}
+
+// RemoteFile is the backup of a local file stored by a backend.
+type RemoteFile struct {
+  Id   string
+  Name string
+  Md5  string
+
+  // ModTime is when the backup was last changed, zero if unknown
+  ModTime time.Time
+
+  // Size is the size of the backup in bytes, 0 if unknown
+  Size int64
+
+  // Meta holds the metadata stored with the backup, see Backend.Upload, nil if unknown
+  Meta map[string]string
+
+  // Revision is the id of the revision of the backup Download reads, kept by backends
+  // with revisions, or "" for the latest content
+  Revision string
+}
+
+// Parallel calls f with every index below n, each in its own goroutine holding
+// one of the given slots, so at most cap(slots) of them run at once.
+// It returns when all of them have finished.
+func Parallel(n int, slots chan struct{}, f func(i int)) {
+  var wg sync.WaitGroup
+  for i := 0; i < n; i++ {
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      slots <- struct{}{}
+      defer func() { <-slots }()
+      f(i)
+    }(i)
+  }
+  wg.Wait()
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "os"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// CheckRingFiles compares given files with their backups by all backends, without uploading anything.
+// It returns the result of every backend in the order of the given paths, ActionUnchanged
+// if the backup is up to date, ActionOutdated if it is missing or differs from the local file.
+func CheckRingFiles(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, paths []string) []Result {
+  var results []Result
+  for _, path := range paths {
+    results = append(results, checkRingFile(ctx, opts, st, backends, path)...)
+  }
+  return results
+}
+
+// checkRingFile compares a local file with its backups, hashing it only if it has changed
+// since it was hashed last time.
+func checkRingFile(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, path string) []Result {
+  results := make([]Result, len(backends))
+  for i, b := range backends {
+    results[i] = Result{ Path: path, Backend: b.Name() }
+  }
+  fileState := st.File(path)
+  hash, payloadHash, sha256, err := localHashes(opts, fileState, path)
+  if err != nil {
+    for i := range results {
+      results[i].Action, results[i].Err = ActionFailed, err
+    }
+    return results
+  }
+
+  name := compress.BackupName(path, opts.Compress)
+  for i, b := range backends {
+    logger := opts.Log().With("file", path, "backend", b.Name())
+    remote, err := b.Find(ctx, name, fileState.BackendId(b.Name()))
+    results[i].Hash = hash
+    switch {
+    case err != nil:
+      results[i].Action, results[i].Err = ActionFailed, err
+    case remote == nil:
+      logger.Info("Backup is missing")
+      results[i].Action = ActionOutdated
+    case remote.Md5 != payloadHash || !sameSHA256(remote, sha256):
+      logger.Info("Backup differs from .kdbx file", "id", remote.Id)
+      results[i].RemoteId, results[i].Action = remote.Id, ActionOutdated
+    default:
+      logger.Info("Backup is up to date", "id", remote.Id)
+      results[i].RemoteId, results[i].Action = remote.Id, ActionUnchanged
+    }
+  }
+  return results
+}
+
+// localHashes returns the md5 hash of a local file, of the backup of it, which is compressed
+// with -compress, and the sha256 hash of the file, if known, from the state if the file
+// has not changed since it was hashed.
+func localHashes(opts *config.Options, fileState *state.FileState, path string) (hash, payloadHash, sha256 string, err error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return "", "", "", fmt.Errorf("Unable to check .kdbx file: %v", err)
+  }
+  if cached := fileState.CachedPayloadHash(info, opts.Compress); cached != "" {
+    return fileState.Hash, cached, fileState.SHA256, nil
+  }
+
+  snapshot, hash, sha256, err := hashing.SnapshotFile(path)
+  if err != nil {
+    return "", "", "", fmt.Errorf("Unable to snapshot .kdbx file: %v", err)
+  }
+  defer hashing.RemoveSnapshot(snapshot)
+  if modified, err := hashing.IsModified(path, info); err != nil || modified {
+    return "", "", "", fmt.Errorf("File .kdbx was modified while taking a snapshot, try again later")
+  }
+  fileState.CacheHash(info, hash)
+  fileState.CacheSHA256(sha256)
+  if opts.Compress == "" {
+    return hash, hash, sha256, nil
+  }
+  payload, payloadHash, err := compress.Snapshot(snapshot, info.Size(), opts.Compress)
+  if err != nil {
+    return "", "", "", fmt.Errorf("Unable to compress .kdbx file: %v", err)
+  }
+  hashing.RemoveSnapshot(payload)
+  fileState.CachePayloadHash(opts.Compress, payloadHash)
+  return hash, payloadHash, sha256, nil
+}
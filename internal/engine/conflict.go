@@ -0,0 +1,83 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "io/ioutil"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/keepassxc"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// diverged reports whether both the local file, with a given payload hash, and its backup
+// by a backend were changed since the last sync, e.g. by another machine backing up
+// the same database. Backups synced before their hashes were recorded never diverge.
+func diverged(fileState *state.FileState, backend string, remote *RemoteFile, payloadHash string) bool {
+  synced := fileState.SyncedHash(backend)
+  return synced != "" && remote.Md5 != "" && remote.Md5 != synced && payloadHash != synced
+}
+
+// modTimeSlack allows for the coarse modification times of some file systems.
+const modTimeSlack = 2 * time.Second
+
+// olderLocal reports whether the local file, modified at a given time and with a given payload
+// hash, looks older than its backup by a backend, which it would replace: the backup was changed
+// after the local file, or the local file is the one synced last time, while the backup has
+// changed since, e.g. when the machine was restored from an old image.
+func olderLocal(fileState *state.FileState, backend string, remote *RemoteFile, payloadHash string, modTime time.Time) bool {
+  if remote.Md5 == "" || remote.Md5 == payloadHash {
+    return false
+  }
+  if remoteModTime := remote.SourceModTime(); !remoteModTime.IsZero() && remoteModTime.After(modTime.Add(modTimeSlack)) {
+    return true
+  }
+  synced := fileState.SyncedHash(backend)
+  return synced != "" && synced == payloadHash
+}
+
+// resolveConflict resolves a backup changed elsewhere since the last sync, as the local file
+// was changed too, with -on-conflict: overwriting it, keeping it, or merging it into
+// the local file, if mergeable.
+// It returns whether the backup was merged.
+func resolveConflict(ctx context.Context, opts *config.Options, b Backend, remote *RemoteFile, path string, mergeable bool,
+  logger *slog.Logger) (bool, error) {
+  switch {
+  case opts.OnConflict == "keep":
+    return false, fmt.Errorf("Backup was changed elsewhere since last sync, keeping it, see -on-conflict")
+  case opts.OnConflict == "merge" && !mergeable:
+    return false, fmt.Errorf("Backup was changed elsewhere since last sync, and only KDBX databases can be merged")
+  case opts.OnConflict == "merge":
+    logger.Info("Backup was changed elsewhere since last sync, merging it into .kdbx file")
+    if err := mergeBackup(ctx, opts, b, remote, path); err != nil {
+      return false, fmt.Errorf("Unable to merge backup changed elsewhere since last sync: %v", err)
+    }
+    return true, nil
+  default:
+    logger.Warn("Backup was changed elsewhere since last sync, overwriting it, see -on-conflict")
+    return false, nil
+  }
+}
+
+// mergeBackup downloads a backup and merges it into the local .kdbx file with keepassxc-cli,
+// opening both with the same credentials.
+func mergeBackup(ctx context.Context, opts *config.Options, b Backend, remote *RemoteFile, path string) error {
+  dir, err := ioutil.TempDir("", "keepassx_backup_merge")
+  if err != nil {
+    return err
+  }
+  defer os.RemoveAll(dir)
+  other := filepath.Join(dir, filepath.Base(path))
+  if _, err := DownloadBackup(ctx, b, remote, other); err != nil {
+    return err
+  }
+  cli, err := keepassxc.NewCLI(opts.KeyFile)
+  if err != nil {
+    return err
+  }
+  return cli.Merge(ctx, path, other)
+}
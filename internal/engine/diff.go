@@ -0,0 +1,161 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/kdbx"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Which side of a diff looks newer.
+const (
+  NewerNone   = "none"
+  NewerLocal  = "local"
+  NewerRemote = "remote"
+  NewerBoth   = "both"
+)
+
+// DiffSide describes the local file or its backup.
+type DiffSide struct {
+  // Size and Md5 are of the backup, compressed with -compress, 0 and "" if unknown
+  Size int64
+  Md5  string
+
+  // SHA256 is the hash of the uncompressed file, "" if unknown
+  SHA256 string
+
+  // ModTime is when the local file was modified, as of the backup for the remote side, zero if unknown
+  ModTime time.Time
+
+  // Header is nil, unless the file is a database
+  Header *kdbx.Header
+}
+
+// Diff compares a local file with its backup by a backend.
+type Diff struct {
+  Path     string
+  Backend  string
+  RemoteId string
+
+  // Local is nil if the local file cannot be read, Remote is nil without a backup
+  Local  *DiffSide
+  Remote *DiffSide
+
+  // Hostname is the machine the backup was made on, if known
+  Hostname string
+
+  // Newer tells which side looks newer: NewerNone if they are the same, NewerBoth if both
+  // were changed since the last sync
+  Newer string
+  Err   error
+}
+
+// DiffRingFiles compares given files with their backups by all backends, without changing anything.
+// It returns the diff of every backend in the order of the given paths.
+func DiffRingFiles(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, paths []string) []Diff {
+  var diffs []Diff
+  for _, path := range paths {
+    diffs = append(diffs, diffRingFile(ctx, opts, st, backends, path)...)
+  }
+  return diffs
+}
+
+// diffRingFile compares a local file with its backups, telling which side looks newer like syncing
+// does to detect conflicts and older local files.
+func diffRingFile(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, path string) []Diff {
+  diffs := make([]Diff, len(backends))
+  for i, b := range backends {
+    diffs[i] = Diff{ Path: path, Backend: b.Name() }
+  }
+  fail := func(err error) []Diff {
+    for i := range diffs {
+      diffs[i].Err = err
+    }
+    return diffs
+  }
+  fileState := st.File(path)
+  info, err := os.Stat(path)
+  if err != nil {
+    return fail(fmt.Errorf("Unable to check .kdbx file: %v", err))
+  }
+  local := &DiffSide{ ModTime: info.ModTime(), Header: readHeader(opts, path) }
+  if _, local.Md5, local.SHA256, err = localHashes(opts, fileState, path); err != nil {
+    return fail(err)
+  }
+  // the size of the compressed backup is not known without compressing the file again
+  if opts.Compress == "" {
+    local.Size = info.Size()
+  }
+  for i := range diffs {
+    diffs[i].Local = local
+  }
+
+  name := compress.BackupName(path, opts.Compress)
+  for i, b := range backends {
+    d := &diffs[i]
+    remote, err := b.Find(ctx, name, fileState.BackendId(b.Name()))
+    if err != nil {
+      d.Err = err
+      continue
+    }
+    if remote == nil {
+      d.Newer = NewerLocal
+      continue
+    }
+    d.RemoteId, d.Hostname = remote.Id, remote.Meta[MetaHostname]
+    d.Remote = &DiffSide{ Size: remote.Size, Md5: remote.Md5, SHA256: remote.Meta[MetaSHA256], ModTime: remote.SourceModTime(),
+      Header: remote.Header() }
+    if d.Remote.Header == nil && local.Header != nil {
+      d.Remote.Header = downloadHeader(ctx, b, remote)
+    }
+
+    switch {
+    case remote.Md5 == local.Md5 && sameSHA256(remote, local.SHA256):
+      d.Newer = NewerNone
+    case diverged(fileState, b.Name(), remote, local.Md5):
+      d.Newer = NewerBoth
+    case olderLocal(fileState, b.Name(), remote, local.Md5, info.ModTime()):
+      d.Newer = NewerRemote
+    default:
+      d.Newer = NewerLocal
+    }
+  }
+  return diffs
+}
+
+// readHeader reads the header of a local database, or returns nil for other files.
+func readHeader(opts *config.Options, path string) *kdbx.Header {
+  if opts.IsGeneric(path) {
+    return nil
+  }
+  header, err := kdbx.ReadFile(path)
+  if err != nil {
+    return nil
+  }
+  return header
+}
+
+// downloadHeader reads the header of a backup, which has none in its metadata, e.g. by backends
+// storing no metadata, downloading only its start. It returns nil if it cannot be read.
+func downloadHeader(ctx context.Context, b Backend, remote *RemoteFile) *kdbx.Header {
+  body, err := b.Download(ctx, remote)
+  if err != nil {
+    return nil
+  }
+  defer body.Close()
+  r, err := compress.NewDecompressor(body, remote.Name)
+  if err != nil {
+    return nil
+  }
+  defer r.Close()
+  header, err := kdbx.Read(r)
+  if err != nil {
+    return nil
+  }
+  return header
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Lister is implemented by backends, which list everything they store, e.g. to find orphaned backups.
+type Lister interface {
+  // List lists the backups, and what interrupted uploads left over, e.g. temporary files,
+  // which Remove deletes like backups.
+  List(ctx context.Context) ([]*RemoteFile, error)
+}
+
+// orphanGrace keeps backups changed more recently, which an upload of another run may still be writing.
+const orphanGrace = time.Hour
+
+// Orphan is a backup, which no local file references.
+type Orphan struct {
+  Backend Backend
+  Remote  *RemoteFile
+}
+
+// FindOrphans lists the backups of every backend, which are neither backups of given files, nor of files
+// in the state, which still exist, e.g. leftovers of renamed or removed databases and of interrupted uploads.
+// Backups made on other machines, as recorded in their metadata, are never orphaned, as they may be of
+// files of those machines, and neither are the backups of the standard input recorded in the state.
+// Backups not recorded as made on any machine, e.g. by older versions, may be of other machines too,
+// so they are orphaned only with opts.GCUnknownHost.
+// Backends, which are not Listers, are skipped with a warning.
+func FindOrphans(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, paths []string) ([]Orphan, error) {
+  referenced := append([]string{}, paths...)
+  for p := range st.Files {
+    // the backups of the standard input have no local file
+    if _, err := os.Stat(p); err == nil || IsStdinPath(p) {
+      referenced = append(referenced, p)
+    }
+  }
+  names := make(map[string]bool)
+  for _, p := range referenced {
+    // backups compressed otherwise before are still of the file
+    for _, name := range compress.BackupNames(p, opts.Compress) {
+      names[name] = true
+    }
+  }
+  hostname, _ := os.Hostname()
+
+  var orphans []Orphan
+  for _, b := range backends {
+    lister, ok := b.(Lister)
+    if !ok {
+      opts.Log().Warn("Backend cannot list its backups, skipping it", "backend", b.Name())
+      continue
+    }
+    remotes, err := lister.List(ctx)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to list backups of %s: %w", b.Name(), err)
+    }
+    ids := make(map[string]bool)
+    for _, p := range referenced {
+      if id := st.File(p).BackendId(b.Name()); id != "" {
+        ids[id] = true
+      }
+    }
+    for _, remote := range remotes {
+      switch source := remote.Meta[MetaHostname]; {
+      case names[remote.Name] || ids[remote.Id]:
+      case source != "" && source != hostname:
+        opts.Log().Debug("Keeping backup made on another machine", "backend", b.Name(), "name", remote.Name,
+          "source_hostname", source)
+      case source == "" && !opts.GCUnknownHost:
+        opts.Log().Debug("Keeping backup not recorded as made on this machine", "backend", b.Name(),
+          "name", remote.Name)
+      case time.Since(remote.ModTime) < orphanGrace:
+        opts.Log().Debug("Keeping backup changed recently", "backend", b.Name(), "name", remote.Name)
+      default:
+        orphans = append(orphans, Orphan{ Backend: b, Remote: remote })
+      }
+    }
+  }
+  return orphans, nil
+}
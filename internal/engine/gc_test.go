@@ -0,0 +1,75 @@
+package engine_test
+
+import (
+  "bytes"
+  "os"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+func TestFindOrphans(t *testing.T) {
+  hostname, _ := os.Hostname()
+  tests := []struct {
+    name string
+    // hostname is the machine recorded in the metadata of the backup, if any
+    hostname string
+    // modified is the modification time of the backup, or "" for now
+    modified string
+    // unknownHost is the -gc-unknown-host option
+    unknownHost bool
+    orphaned bool
+  }{
+    { name: "old backup of this machine", hostname: hostname, modified: "2020-01-01T00:00:00Z", orphaned: true },
+    { name: "backup of another machine", hostname: "other-" + hostname, modified: "2020-01-01T00:00:00Z" },
+    { name: "backup changed recently", hostname: hostname },
+    { name: "old backup of unknown machine", modified: "2020-01-01T00:00:00Z" },
+    { name: "old backup of unknown machine with -gc-unknown-host", modified: "2020-01-01T00:00:00Z", unknownHost: true,
+      orphaned: true },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      f := gdrivetest.NewFixture(t, "referenced")
+      if r := f.Sync(t); r.Err != nil {
+        t.Fatal(r.Err)
+      }
+      meta := map[string]string{}
+      if tt.hostname != "" {
+        meta[engine.MetaHostname] = tt.hostname
+      }
+      // the backup of a removed database
+      orphan, err := f.Drive.Create(f.Ctx, f.FolderId, "removed.kdbx", meta, tt.modified, bytes.NewReader([]byte("orphan")), 0)
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      f.Opts.GCUnknownHost = tt.unknownHost
+      orphans, err := engine.FindOrphans(f.Ctx, f.Opts, f.State, []engine.Backend{ f.Backend }, []string{ f.Path })
+      if err != nil {
+        t.Fatal(err)
+      }
+      found := len(orphans) == 1 && orphans[0].Remote.Id == orphan.Id
+      if found != tt.orphaned || len(orphans) > 1 {
+        t.Fatalf("found %d orphans, want %s orphaned %v", len(orphans), orphan.Id, tt.orphaned)
+      }
+      if !tt.orphaned {
+        return
+      }
+      // pruning the orphan moves it to the trash, keeping the referenced backup
+      if err := orphans[0].Backend.Remove(f.Ctx, orphans[0].Remote); err != nil {
+        t.Fatal(err)
+      }
+      if trashed, err := f.Drive.Get(f.Ctx, orphan.Id); err != nil || !trashed.Trashed {
+        t.Errorf("pruned orphan = %+v, %v, want it in the trash", trashed, err)
+      }
+      orphans, err = engine.FindOrphans(f.Ctx, f.Opts, f.State, []engine.Backend{ f.Backend }, []string{ f.Path })
+      if err != nil || len(orphans) != 0 {
+        t.Errorf("found %d orphans after pruning, %v, want none", len(orphans), err)
+      }
+      if got := f.Backup(t); got != "referenced" {
+        t.Errorf("backup = %q, want %q", got, "referenced")
+      }
+    })
+  }
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package engine
+
+import (
+  "syscall"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION, returned when opening a file,
+// which another process has open in an incompatible share mode.
+const errSharingViolation syscall.Errno = 32
+
+// fileInUse reports whether another process has the file at the given path open
+// for writing, by opening it with a share mode denying writers.
+func fileInUse(path string) bool {
+  name, err := syscall.UTF16PtrFromString(path)
+  if err != nil {
+    return false
+  }
+  h, err := syscall.CreateFile(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, nil,
+    syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+  if err == errSharingViolation {
+    return true
+  }
+  if err == nil {
+    syscall.CloseHandle(h)
+  }
+  return false
+}
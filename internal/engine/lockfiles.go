@@ -0,0 +1,78 @@
+package engine
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "time"
+)
+
+// Names of the lock files of open databases: .ring.kdbx.lock of KeePassXC and ring.kdb.lock
+// of KeePassX, and of the temporary files of saves in progress: ring.kdbx.tmp and ring.kdbx.<random>.tmp
+// of KeePass, and ring.kdbx.<6 random letters> of the QSaveFile of KeePassXC, each with the name of the database.
+// Qt draws the random letters from A-Z and a-z.
+var (
+  lockFileName = regexp.MustCompile(`(?i)^\.?(.+\.kdbx?)\.lock$`)
+  tempSaveName = regexp.MustCompile(`(?i:^(.+\.kdbx?)\.(tmp|[^.]+\.tmp)$)|^(.+\.(?i:kdbx?))\.([A-Za-z]{6})$`)
+  randomSuffix = regexp.MustCompile(`[A-Z]`)
+)
+
+// tempSaveAge is how long after it was last written a temporary file is still taken
+// for a save in progress, and not for a leftover of a crashed save.
+const tempSaveAge = time.Minute
+
+// tempSaveDatabase returns the name of the database of a temporary file of a save in a given directory, or "".
+func tempSaveDatabase(dir, name string) string {
+  m := tempSaveName.FindStringSubmatch(name)
+  switch {
+  case m == nil:
+    return ""
+  case m[1] != "":
+    return m[1]
+  }
+  // a suffix without uppercase letters, e.g. .backed, is most likely not random, and
+  // KeePassXC saves only next to the database it replaces
+  if !randomSuffix.MatchString(m[4]) {
+    return ""
+  }
+  if _, err := os.Stat(filepath.Join(dir, m[3])); err != nil {
+    return ""
+  }
+  return m[3]
+}
+
+// IsLockOrTempFile reports whether a path names the lock file of an open database,
+// or the temporary file of a save in progress, which are never backed up.
+func IsLockOrTempFile(path string) bool {
+  dir, name := filepath.Split(path)
+  return lockFileName.MatchString(name) || tempSaveDatabase(dir, name) != ""
+}
+
+// saveInProgress reports whether a temporary file of a save of the database at a given path,
+// written recently, exists next to it.
+func saveInProgress(path string) bool {
+  entries, err := ioutil.ReadDir(filepath.Dir(path))
+  if err != nil {
+    return false
+  }
+  dir, base := filepath.Split(path)
+  for _, e := range entries {
+    if tempSaveDatabase(dir, e.Name()) == base && time.Since(e.ModTime()) < tempSaveAge {
+      return true
+    }
+  }
+  return false
+}
+
+// isOpen reports whether the lock file of a KeePass application, which has the database
+// at a given path open, exists next to it.
+func isOpen(path string) bool {
+  dir, base := filepath.Dir(path), filepath.Base(path)
+  for _, name := range []string{ "." + base + ".lock", base + ".lock" } {
+    if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,39 @@
+package engine_test
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+func TestIsLockOrTempFile(t *testing.T) {
+  dir := t.TempDir()
+  if err := ioutil.WriteFile(filepath.Join(dir, "ring.kdbx"), []byte("database"), 0600); err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct {
+    name string
+    want bool
+  }{
+    { name: "ring.kdbx" },
+    { name: ".ring.kdbx.lock", want: true },
+    { name: "ring.kdb.lock", want: true },
+    { name: "ring.kdbx.tmp", want: true },
+    { name: "ring.kdbx.a1b2c3.tmp", want: true },
+    // the QSaveFile of KeePassXC
+    { name: "ring.kdbx.XqPbaC", want: true },
+    { name: "ring.kdbx.QWERTY", want: true },
+    // not random, or not next to the database
+    { name: "ring.kdbx.old123" },
+    { name: "ring.kdbx.backup" },
+    { name: "ring.kdbx.facade" },
+    { name: "keys.kdbx.XqPbaC" },
+  }
+  for _, tt := range tests {
+    if got := engine.IsLockOrTempFile(filepath.Join(dir, tt.name)); got != tt.want {
+      t.Errorf("IsLockOrTempFile(%s) = %v, want %v", tt.name, got, tt.want)
+    }
+  }
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/kdbx"
+)
+
+// The metadata stored with every backup by the backends, which can, describing
+// the local file and where it was backed up from.
+const (
+  MetaSHA256      = "sha256"
+  MetaHostname    = "hostname"
+  MetaToolVersion = "tool_version"
+  MetaModTime     = "mtime"
+  MetaKdbxVersion = "kdbx_version"
+  MetaKdbxCipher  = "kdbx_cipher"
+  MetaKdbxKDF     = "kdbx_kdf"
+)
+
+// SourceModTime returns when the local file was modified as of the backup, recorded in its metadata,
+// or the modification time of the backup without it.
+func (r *RemoteFile) SourceModTime() time.Time {
+  if t, err := time.Parse(time.RFC3339, r.Meta[MetaModTime]); err == nil {
+    return t
+  }
+  return r.ModTime
+}
+
+// Header returns the header of the database recorded in the metadata of the backup, or nil without it.
+func (r *RemoteFile) Header() *kdbx.Header {
+  if r.Meta[MetaKdbxVersion] == "" {
+    return nil
+  }
+  return &kdbx.Header{ Version: r.Meta[MetaKdbxVersion], Cipher: r.Meta[MetaKdbxCipher], KDF: r.Meta[MetaKdbxKDF],
+    Legacy: r.Meta[MetaKdbxVersion] == "1.x" }
+}
+
+// sameSHA256 reports whether the backup may have the given sha256 hash of the local file,
+// which is the case unless both hashes are known and differ.
+func sameSHA256(remote *RemoteFile, sha256 string) bool {
+  recorded := remote.Meta[MetaSHA256]
+  return recorded == "" || sha256 == "" || recorded == sha256
+}
@@ -0,0 +1,23 @@
+package engine
+
+import (
+  "errors"
+  "net"
+)
+
+// IsOffline reports whether err was caused by missing network connectivity: a failed DNS lookup,
+// an unreachable network or host, or a connection, which timed out. Other network errors, e.g.
+// a refused connection, a failed TLS handshake or a broken -proxy, are failures, not being offline.
+func IsOffline(err error) bool {
+  var dnsErr *net.DNSError
+  if errors.As(err, &dnsErr) {
+    return true
+  }
+  for _, unreachable := range unreachableErrors {
+    if errors.Is(err, unreachable) {
+      return true
+    }
+  }
+  var opErr *net.OpError
+  return errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout()
+}
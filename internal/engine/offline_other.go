@@ -0,0 +1,10 @@
+//go:build !windows
+
+package engine
+
+import (
+  "syscall"
+)
+
+// unreachableErrors are the errors of connecting without a route to the network or the host.
+var unreachableErrors = []error{ syscall.ENETUNREACH, syscall.EHOSTUNREACH }
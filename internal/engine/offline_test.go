@@ -0,0 +1,47 @@
+package engine_test
+
+import (
+  "context"
+  "crypto/tls"
+  "errors"
+  "fmt"
+  "net"
+  "net/url"
+  "os"
+  "syscall"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+func TestIsOffline(t *testing.T) {
+  // dial wraps the error of connecting to Drive through the HTTP client
+  dial := func(err error) error {
+    return &url.Error{ Op: "Post", URL: "https://www.googleapis.com/upload/drive/v3/files",
+      Err: &net.OpError{ Op: "dial", Net: "tcp", Err: err } }
+  }
+  tests := []struct {
+    name string
+    err  error
+    want bool
+  }{
+    { name: "no error" },
+    { name: "DNS lookup", err: dial(&net.DNSError{ Err: "no such host", Name: "www.googleapis.com", IsNotFound: true }),
+      want: true },
+    { name: "network unreachable", err: dial(os.NewSyscallError("connect", syscall.ENETUNREACH)), want: true },
+    { name: "host unreachable", err: dial(os.NewSyscallError("connect", syscall.EHOSTUNREACH)), want: true },
+    { name: "dial timeout", err: dial(context.DeadlineExceeded), want: true },
+    { name: "wrapped", err: fmt.Errorf("Unable to create .kdbx: %w", dial(context.DeadlineExceeded)), want: true },
+    { name: "connection refused", err: dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)) },
+    { name: "read timeout", err: &net.OpError{ Op: "read", Net: "tcp", Err: context.DeadlineExceeded } },
+    { name: "TLS handshake", err: &url.Error{ Op: "Post", URL: "https://www.googleapis.com",
+      Err: tls.RecordHeaderError{ Msg: "first record does not look like a TLS handshake" } } },
+    { name: "proxy", err: &url.Error{ Op: "Post", URL: "https://www.googleapis.com",
+      Err: &net.OpError{ Op: "proxyconnect", Net: "tcp", Err: errors.New("unexpected EOF") } } },
+  }
+  for _, tt := range tests {
+    if got := engine.IsOffline(tt.err); got != tt.want {
+      t.Errorf("IsOffline(%s) = %v, want %v", tt.name, got, tt.want)
+    }
+  }
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package engine
+
+import (
+  "syscall"
+)
+
+// WSAENETUNREACH and WSAEHOSTUNREACH are returned by Winsock instead of the errors
+// of the same names on other systems.
+const (
+  errNetUnreachable  syscall.Errno = 10051
+  errHostUnreachable syscall.Errno = 10065
+)
+
+// unreachableErrors are the errors of connecting without a route to the network or the host.
+var unreachableErrors = []error{ errNetUnreachable, errHostUnreachable, syscall.ENETUNREACH, syscall.EHOSTUNREACH }
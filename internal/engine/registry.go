@@ -0,0 +1,69 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "sort"
+  "strings"
+  "sync"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Env holds everything besides the options, which backends are created from.
+type Env struct {
+  Opts  *config.Options
+  Drive *drive.Service
+
+  // State, unless nil, is where backends remember what they looked up between runs
+  State *state.State
+
+  // Retry collects paths of files, which backends found have to be backed up
+  // again, e.g. after an interrupted run.
+  Retry []string
+}
+
+// Factory creates a registered backend.
+type Factory func(ctx context.Context, env *Env) (Backend, error)
+
+var (
+  registryMu sync.Mutex
+  registry   = make(map[string]Factory)
+)
+
+// Register makes a backend available by a given name, usually from the init
+// function of the package implementing it. Registering a name twice panics.
+func Register(name string, f Factory) {
+  registryMu.Lock()
+  defer registryMu.Unlock()
+  if _, ok := registry[name]; ok {
+    panic(fmt.Sprintf("backend %q registered twice", name))
+  }
+  registry[name] = f
+}
+
+// Lookup returns the factory of the backend registered by a given name.
+func Lookup(name string) (Factory, error) {
+  registryMu.Lock()
+  f, ok := registry[name]
+  registryMu.Unlock()
+  if !ok {
+    return nil, fmt.Errorf("Unknown backend %q, available backends: %s", name, strings.Join(Names(), ", "))
+  }
+  return f, nil
+}
+
+// Names returns the sorted names of all registered backends.
+func Names() []string {
+  registryMu.Lock()
+  defer registryMu.Unlock()
+  names := make([]string, 0, len(registry))
+  for name := range registry {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
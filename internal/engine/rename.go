@@ -0,0 +1,151 @@
+package engine
+
+import (
+  "context"
+  "os"
+  "sort"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Renamer is implemented by backends, which rename backups, keeping their history.
+type Renamer interface {
+  // Rename gives a backup another name.
+  // It returns the renamed backup.
+  Rename(ctx context.Context, remote *RemoteFile, name string) (*RemoteFile, error)
+}
+
+// Rename is a local file, which was backed up under another path, which no longer exists.
+type Rename struct {
+  From string
+  To   string
+}
+
+// FindRenames returns the renames of given files, which were not backed up yet: the files which have
+// the inode, or the md5 hash, of a backed up file of the state, which no longer exists.
+func FindRenames(opts *config.Options, st *state.State, paths []string) []Rename {
+  // the files backed up before, which are gone
+  var gone []string
+  for p, fs := range st.Files {
+    if hasBackups(fs) && !IsStdinPath(p) {
+      if _, err := os.Stat(p); os.IsNotExist(err) {
+        gone = append(gone, p)
+      }
+    }
+  }
+  if len(gone) == 0 {
+    return nil
+  }
+  sort.Strings(gone)
+
+  var renames []Rename
+  matched := make(map[string]bool)
+  for _, p := range paths {
+    if fs, ok := st.Files[p]; ok && hasBackups(fs) {
+      continue
+    }
+    info, err := os.Stat(p)
+    if err != nil {
+      continue
+    }
+    id := fsutil.FileID(p, info)
+    hash := ""
+    for _, old := range gone {
+      fs := st.Files[old]
+      if matched[old] {
+        continue
+      }
+      same := id != 0 && fs.Inode == id
+      // only a file of the same size may have the same content
+      if !same && fs.Hash != "" && fs.Size == info.Size() {
+        if hash == "" {
+          if hash, err = hashing.FileHash(p); err != nil {
+            break
+          }
+        }
+        same = hash == fs.Hash
+      }
+      if same {
+        opts.Log().Debug("Found renamed file", "file", p, "from", old)
+        renames = append(renames, Rename{ From: old, To: p })
+        matched[old] = true
+        break
+      }
+    }
+  }
+  return renames
+}
+
+// hasBackups reports whether the state of a file records a backup by any backend.
+func hasBackups(fs *state.FileState) bool {
+  if fs.RemoteId != "" {
+    return true
+  }
+  for _, id := range fs.Remotes {
+    if id != "" {
+      return true
+    }
+  }
+  return false
+}
+
+// RenameBackups renames the backups of a renamed file by every backend after the new path of the file,
+// keeping the compression of every backup, and moves the state of the file to the new path, so the
+// backups keep their history. Backends, which are not Renamers, or which back up the new name already,
+// back up the file anew. The state is moved also when renaming some of the backups failed.
+// It returns the first error renaming a backup.
+func RenameBackups(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, r Rename) error {
+  fileState := st.File(r.From)
+  var firstErr error
+  fail := func(err error) {
+    if firstErr == nil {
+      firstErr = err
+    }
+  }
+  for _, b := range backends {
+    logger := opts.Log().With("file", r.To, "from", r.From, "backend", b.Name())
+    renamer, ok := b.(Renamer)
+    if !ok {
+      logger.Warn("Backend cannot rename backups, backing up the renamed file anew")
+      fileState.SetBackendId(b.Name(), "")
+      continue
+    }
+    remote, err := FindBackup(ctx, b, opts, st, r.From)
+    if err != nil {
+      logger.Warn("Unable to find backup of renamed file, backing it up anew", "error", err)
+      fileState.SetBackendId(b.Name(), "")
+      continue
+    }
+    name := compress.BackupName(r.To, "") + strings.TrimPrefix(remote.Name, compress.BackupName(r.From, ""))
+    // backups are named after the file only, not its directory
+    if name == remote.Name {
+      fileState.SetBackendId(b.Name(), remote.Id)
+      continue
+    }
+    existing, err := b.Find(ctx, name, "")
+    if err != nil {
+      fail(err)
+      continue
+    }
+    if existing != nil {
+      logger.Warn("Backup of the new name exists already, keeping the backup of the old name", "name", name)
+      fileState.SetBackendId(b.Name(), "")
+      continue
+    }
+    renamed, err := renamer.Rename(ctx, remote, name)
+    if err != nil {
+      fail(err)
+      continue
+    }
+    logger.Info("Renamed backup after the renamed file", "name", name, "old_name", remote.Name, "id", renamed.Id)
+    fileState.SetBackendId(b.Name(), renamed.Id)
+  }
+  st.RemovePending(r.From)
+  st.Move(r.From, r.To)
+  return firstErr
+}
@@ -0,0 +1,277 @@
+package engine
+
+import (
+  "context"
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/kdbx"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// RestoredSuffix is appended to the path of a local file to get the path
+// its backup is restored to, so the active database is never overwritten.
+const RestoredSuffix = ".restored"
+
+// StdoutTarget is the target of -o streaming the restored backup to the standard output.
+const StdoutTarget = "-"
+
+// RevisionFinder is implemented by backends, which keep revisions of the backups, e.g. to restore -revision.
+type RevisionFinder interface {
+  // FindRevision looks up a revision of a backup, returning the backup as of that revision,
+  // with the md5 hash of its content.
+  FindRevision(ctx context.Context, remote *RemoteFile, revisionId string) (*RemoteFile, error)
+}
+
+// ErrCorrupted is wrapped by the errors of restores, which downloaded a backup not matching
+// its recorded hashes, or not a valid database.
+var ErrCorrupted = errors.New("Backup is corrupted")
+
+// RestoreRingFiles downloads the backups of given files from a backend next to
+// every file, or of a single file to -o, decompressing the compressed ones.
+// It returns the result of every file.
+func RestoreRingFiles(ctx context.Context, b Backend, opts *config.Options, st *state.State, paths []string) []Result {
+  var results []Result
+  for _, path := range paths {
+    start := time.Now()
+    result, err := restoreRingFile(ctx, b, opts, st, path)
+    result.Duration = time.Since(start)
+    result.Err = err
+    switch {
+    case errors.Is(err, ErrCorrupted):
+      opts.Log().Error("Restored .kdbx file is corrupted", "file", path, "backend", b.Name(), "error", err)
+      result.Action = ActionCorrupted
+    case err != nil:
+      opts.Log().Error("Unable to restore .kdbx file", "file", path, "backend", b.Name(), "error", err)
+      result.Action = ActionFailed
+    }
+    results = append(results, result)
+  }
+  return results
+}
+
+// restoreRingFile downloads the backup of a local file to the file path with RestoredSuffix,
+// or to -o, streaming it to the standard output with StdoutTarget.
+// It returns the result with the restored backup.
+func restoreRingFile(ctx context.Context, b Backend, opts *config.Options, st *state.State, path string) (Result, error) {
+  result := Result{ Path: path, Backend: b.Name() }
+  remote, err := FindBackup(ctx, b, opts, st, path)
+  if err != nil {
+    return result, err
+  }
+  result.RemoteId = remote.Id
+  if opts.Revision != "" {
+    finder, ok := b.(RevisionFinder)
+    if !ok {
+      return result, fmt.Errorf("Backend %s keeps no revisions of the backups", b.Name())
+    }
+    // the metadata describes the latest revision, not the restored one, whose md5 hash is verified
+    if remote, err = finder.FindRevision(ctx, remote, opts.Revision); err != nil {
+      return result, err
+    }
+  }
+
+  target, err := RestoreTarget(opts, path)
+  if err != nil {
+    return result, err
+  }
+  // key files and generic secrets files have no header to validate
+  header := opts.VerifyKdbx && !opts.IsGeneric(path) && (remote.Header() != nil || strings.EqualFold(filepath.Ext(path), ".kdbx"))
+  var n int64
+  if target == StdoutTarget {
+    n, err = restoreBackup(ctx, b, remote, os.Stdout, header)
+  } else {
+    n, err = downloadBackup(ctx, b, remote, target, header)
+  }
+  if err != nil {
+    return result, err
+  }
+  logger := opts.Log().With("file", path, "backend", b.Name(), "id", remote.Id)
+  if remote.Meta[MetaHostname] != "" {
+    // tells where the restored version comes from, when several machines back up the same file
+    logger = logger.With("source_hostname", remote.Meta[MetaHostname], "source_version", remote.Meta[MetaToolVersion],
+      "source_modified", remote.Meta[MetaModTime])
+  }
+  // the restored file is as old as the database it was backed up from
+  if modTime := remote.SourceModTime(); !modTime.IsZero() && target != StdoutTarget {
+    if err := os.Chtimes(target, modTime, modTime); err != nil {
+      logger.Warn("Unable to set modification time of restored file", "target", target, "error", err)
+    }
+  }
+  logger.Info("Restored .kdbx file", "target", target, "bytes", n)
+  result.Action = ActionRestored
+  result.Bytes = n
+  return result, nil
+}
+
+// restoreBackup writes the decompressed content of a backup to w, like StreamBackup, and with header
+// also validates the header of the database written.
+func restoreBackup(ctx context.Context, b Backend, remote *RemoteFile, w io.Writer, header bool) (int64, error) {
+  if !header {
+    return StreamBackup(ctx, b, remote, w)
+  }
+  check := newHeaderCheck()
+  n, err := StreamBackup(ctx, b, remote, io.MultiWriter(w, check))
+  if headerErr := check.Close(); err == nil && headerErr != nil {
+    return n, fmt.Errorf("%w: restored backup %s is not a valid database: %v", ErrCorrupted, remote.Name, headerErr)
+  }
+  return n, err
+}
+
+// headerCheck reads the header of the database written to it.
+type headerCheck struct {
+  pw  *io.PipeWriter
+  err chan error
+}
+
+func newHeaderCheck() *headerCheck {
+  pr, pw := io.Pipe()
+  check := &headerCheck{ pw: pw, err: make(chan error, 1) }
+  go func() {
+    _, err := kdbx.Read(pr)
+    io.Copy(ioutil.Discard, pr)
+    check.err <- err
+  }()
+  return check
+}
+
+func (c *headerCheck) Write(p []byte) (int, error) {
+  return c.pw.Write(p)
+}
+
+// Close returns the error reading the header.
+func (c *headerCheck) Close() error {
+  c.pw.Close()
+  return <-c.err
+}
+
+// RestoreTarget returns the path the backup of a local file is restored to: -o, or the file path
+// with RestoredSuffix. It returns an error, if -o is the local file itself, as the active database
+// is never overwritten.
+func RestoreTarget(opts *config.Options, path string) (string, error) {
+  if opts.Output == "" {
+    return path + RestoredSuffix, nil
+  }
+  if opts.Output == StdoutTarget {
+    return StdoutTarget, nil
+  }
+  target, err := filepath.Abs(opts.Output)
+  if err != nil {
+    return "", err
+  }
+  if info, err := os.Stat(target); err == nil && info.IsDir() {
+    target = filepath.Join(target, filepath.Base(path))
+  }
+  if IsActiveFile(path, target) {
+    return "", fmt.Errorf("Refusing to restore over the active file %s, give another path with -o", path)
+  }
+  return target, nil
+}
+
+// IsActiveFile reports whether restoring a local file to target would overwrite the file itself.
+func IsActiveFile(path, target string) bool {
+  abs, err := filepath.Abs(path)
+  if err == nil {
+    if t, err := filepath.Abs(target); err == nil && t == abs {
+      return true
+    }
+  }
+  live, liveErr := os.Stat(path)
+  restored, restoredErr := os.Stat(target)
+  return liveErr == nil && restoredErr == nil && os.SameFile(live, restored)
+}
+
+// FindBackup looks up the backup of a local file by a backend, which may have been compressed,
+// or not, with another compression than now.
+// It returns an error, if there is no backup.
+func FindBackup(ctx context.Context, b Backend, opts *config.Options, st *state.State, path string) (*RemoteFile, error) {
+  remoteId := st.File(path).BackendId(b.Name())
+  for _, name := range compress.BackupNames(path, opts.Compress) {
+    remote, err := b.Find(ctx, name, remoteId)
+    if err != nil || remote != nil {
+      return remote, err
+    }
+    remoteId = ""
+  }
+  return nil, fmt.Errorf("No backup of .kdbx file found")
+}
+
+// StreamBackup writes the decompressed content of a backup to w, checking that the content has
+// the md5 hash recorded by the backend, and the file it decompresses to the sha256 hash recorded
+// in the metadata, when known.
+// It returns the number of bytes written, and an error wrapping ErrCorrupted if a hash differs.
+func StreamBackup(ctx context.Context, b Backend, remote *RemoteFile, w io.Writer) (int64, error) {
+  body, err := b.Download(ctx, remote)
+  if err != nil {
+    return 0, err
+  }
+  defer body.Close()
+  md5h, sha256h := md5.New(), sha256.New()
+  raw := io.TeeReader(body, md5h)
+  r, err := compress.NewDecompressor(raw, remote.Name)
+  if err != nil {
+    return 0, fmt.Errorf("Unable to decompress backup %s: %v", remote.Name, err)
+  }
+  defer r.Close()
+  n, err := io.Copy(io.MultiWriter(w, sha256h), r)
+  if err != nil {
+    return n, fmt.Errorf("Unable to restore backup %s: %v", remote.Name, err)
+  }
+  // the md5 hash is of all of the content, also after the end of the compressed stream
+  if _, err := io.Copy(ioutil.Discard, raw); err != nil {
+    return n, fmt.Errorf("Unable to restore backup %s: %v", remote.Name, err)
+  }
+  if downloaded := hex.EncodeToString(md5h.Sum(nil)); remote.Md5 != "" && downloaded != remote.Md5 {
+    return n, fmt.Errorf("%w: restored backup %s has the md5 hash %s instead of %s", ErrCorrupted, remote.Name, downloaded,
+      remote.Md5)
+  }
+  if restored, recorded := hex.EncodeToString(sha256h.Sum(nil)), remote.Meta[MetaSHA256]; recorded != "" && restored != recorded {
+    return n, fmt.Errorf("%w: restored file %s has the sha256 hash %s instead of %s", ErrCorrupted, remote.Name, restored,
+      recorded)
+  }
+  return n, nil
+}
+
+// DownloadBackup writes the decompressed content of a backup to a given file path,
+// replacing the file only once the new one is completely written.
+// It returns the number of bytes written.
+func DownloadBackup(ctx context.Context, b Backend, remote *RemoteFile, target string) (int64, error) {
+  return downloadBackup(ctx, b, remote, target, false)
+}
+
+// downloadBackup is DownloadBackup, with header also validating the header of the database restored.
+func downloadBackup(ctx context.Context, b Backend, remote *RemoteFile, target string, header bool) (int64, error) {
+  tmp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".tmp")
+  if err != nil {
+    return 0, fmt.Errorf("Unable to create restored file: %v", err)
+  }
+  defer os.Remove(tmp.Name())
+
+  n, err := restoreBackup(ctx, b, remote, tmp, header)
+  if err != nil {
+    tmp.Close()
+    return 0, err
+  }
+  err = tmp.Sync()
+  if closeErr := tmp.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    return 0, fmt.Errorf("Unable to restore backup %s: %v", remote.Name, err)
+  }
+  if err := os.Rename(tmp.Name(), target); err != nil {
+    return 0, fmt.Errorf("Unable to restore backup %s: %v", remote.Name, err)
+  }
+  return n, nil
+}
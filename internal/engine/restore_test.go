@@ -0,0 +1,113 @@
+package engine_test
+
+import (
+  "context"
+  "io"
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+func TestRestoreRingFiles(t *testing.T) {
+  tests := []struct {
+    name string
+    // synced is whether the file was backed up before restoring it
+    synced bool
+    // output is -o relative to the directory of the file, or "" to restore next to it
+    output  string
+    want    engine.Action
+    wantErr bool
+  }{
+    { name: "next to the file", synced: true, want: engine.ActionRestored },
+    { name: "to -o", synced: true, output: "other.kdbx", want: engine.ActionRestored },
+    { name: "over the file itself", synced: true, output: "ring.kdbx", want: engine.ActionFailed, wantErr: true },
+    { name: "without backup", want: engine.ActionFailed, wantErr: true },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      f := gdrivetest.NewFixture(t, "secret database")
+      if tt.synced {
+        if r := f.Sync(t); r.Err != nil {
+          t.Fatal(r.Err)
+        }
+      }
+      target := f.Path + engine.RestoredSuffix
+      if tt.output != "" {
+        target = filepath.Join(filepath.Dir(f.Path), tt.output)
+        f.Opts.Output = target
+      }
+
+      results := engine.RestoreRingFiles(f.Ctx, f.Backend, f.Opts, f.State, []string{ f.Path })
+      if len(results) != 1 {
+        t.Fatalf("RestoreRingFiles returned %d results, want 1", len(results))
+      }
+      r := results[0]
+      if r.Action != tt.want || (r.Err != nil) != tt.wantErr {
+        t.Fatalf("restore = %s, %v, want %s", r.Action, r.Err, tt.want)
+      }
+      if tt.wantErr {
+        return
+      }
+      if content, err := ioutil.ReadFile(target); err != nil || string(content) != "secret database" {
+        t.Errorf("restored %q, %v, want %q", content, err, "secret database")
+      }
+    })
+  }
+}
+
+// corruptingClient downloads every revision with other content than uploaded.
+type corruptingClient struct {
+  *gdrivetest.FakeClient
+}
+
+func (c corruptingClient) DownloadRevision(ctx context.Context, id, revisionId string) (io.ReadCloser, error) {
+  return ioutil.NopCloser(strings.NewReader("corrupted")), nil
+}
+
+func TestRestoreRingFilesRevision(t *testing.T) {
+  tests := []struct {
+    name     string
+    revision string
+    corrupt  bool
+    want     engine.Action
+  }{
+    { name: "first revision", revision: "1", want: engine.ActionRestored },
+    { name: "latest revision", revision: "2", want: engine.ActionRestored },
+    { name: "corrupted revision", revision: "1", corrupt: true, want: engine.ActionCorrupted },
+    { name: "unknown revision", revision: "3", want: engine.ActionFailed },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      f := gdrivetest.NewFixture(t, "first")
+      if r := f.Sync(t); r.Err != nil {
+        t.Fatal(r.Err)
+      }
+      f.Write(t, "second version")
+      if r := f.Sync(t); r.Err != nil {
+        t.Fatal(r.Err)
+      }
+      b := f.Backend
+      if tt.corrupt {
+        b = gdrive.New(corruptingClient{ f.Drive }, f.Opts, nil, f.FolderId)
+      }
+
+      f.Opts.Revision = tt.revision
+      results := engine.RestoreRingFiles(f.Ctx, b, f.Opts, f.State, []string{ f.Path })
+      if len(results) != 1 || results[0].Action != tt.want {
+        t.Fatalf("RestoreRingFiles = %+v, want %s", results, tt.want)
+      }
+      if tt.want != engine.ActionRestored {
+        return
+      }
+      want := map[string]string{ "1": "first", "2": "second version" }[tt.revision]
+      if content, err := ioutil.ReadFile(f.Path + engine.RestoredSuffix); err != nil || string(content) != want {
+        t.Errorf("restored %q, %v, want %q", content, err, want)
+      }
+    })
+  }
+}
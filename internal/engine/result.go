@@ -0,0 +1,39 @@
+package engine
+
+import (
+  "time"
+)
+
+// Action is the outcome of backing up a single .kdbx file.
+type Action string
+
+const (
+  ActionCreated   Action = "created"
+  ActionUpdated   Action = "updated"
+  ActionUnchanged Action = "unchanged"
+  ActionQueued    Action = "queued"
+  ActionFailed    Action = "failed"
+  ActionRestored  Action = "restored"
+
+  // ActionOutdated is the result of the check command, when the backup is missing or differs from the local file
+  ActionOutdated Action = "outdated"
+
+  // ActionVerified, ActionMissing and ActionCorrupted are the results of the verify command,
+  // ActionCorrupted also of restores downloading a corrupted backup
+  ActionVerified  Action = "verified"
+  ActionMissing   Action = "missing"
+  ActionCorrupted Action = "corrupted"
+)
+
+// Result is the result of backing up a single .kdbx file.
+type Result struct {
+  Path     string
+  Backend  string
+  Hash     string
+  RemoteId string
+  Action   Action
+  Format   string
+  Bytes    int64
+  Duration time.Duration
+  Err      error
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+  "fmt"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// settleInterval is how long the .kdbx file size and modification time
+// have to stay unchanged, before the file is considered completely saved.
+const settleInterval = time.Second
+
+// waitUntilSettled waits until the file at the given path stops changing, is not
+// open for writing where that can be detected, and has no temporary file of a save
+// in progress next to it, so a database KeePassX is saving right now is not backed up
+// half-written. A symlink is waited for by its target, which the application saves.
+// A file of the size and modification time its hash was cached for is not waited for, being
+// unchanged since the last sync, and one last modified longer than settleInterval ago is not
+// watched for changes, so an unchanged ring of files does not cost a second per file and run.
+// It returns an error if the file is still changing after -wait-timeout.
+func waitUntilSettled(opts *config.Options, fileState *state.FileState, path string) error {
+  target := fsutil.RealPath(path)
+  // KeePassXC holds the lock file as long as the database is open, not only while saving it,
+  // so an open database is backed up once it has been saved, which the temporary file of the save
+  // and the modification time tell, and waiting for it to be closed would fail every backup of it
+  if isOpen(target) {
+    opts.Log().Debug("File .kdbx is open in KeePass", "file", path)
+  }
+  timeout := opts.WaitTimeout
+  deadline := time.Now().Add(timeout)
+  for {
+    before, err := os.Stat(path)
+    if err != nil {
+      return err
+    }
+    if fileState.CachedHash(before) != "" {
+      return nil
+    }
+    settled, waited := time.Since(before.ModTime()) >= settleInterval, false
+    if !settled {
+      time.Sleep(settleInterval)
+      waited = true
+      after, err := os.Stat(path)
+      if err != nil {
+        return err
+      }
+      settled = hashing.SameVersion(before, after)
+    }
+
+    if settled && !fileInUse(target) && !saveInProgress(target) {
+      return nil
+    }
+    if time.Now().After(deadline) {
+      return fmt.Errorf("file is still being written after %v", timeout)
+    }
+    opts.Log().Info("File .kdbx is being written, waiting", "file", path)
+    if !waited {
+      time.Sleep(settleInterval)
+    }
+  }
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/kdbx"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/selfupdate"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// stdinPrefix prefixes the names of the backups of the standard input to give their paths in the state,
+// which name no local file, while their base names are the names of the backups.
+const stdinPrefix = "-/"
+
+// StdinPath returns the path, under which the state and the results record the backup
+// of the standard input with a given name.
+func StdinPath(name string) string {
+  return stdinPrefix + name
+}
+
+// IsStdinPath reports whether a path is the one of a backup of the standard input.
+func IsStdinPath(path string) bool {
+  return strings.HasPrefix(path, stdinPrefix)
+}
+
+// SyncStdin backs up the content read from r, e.g. a database another program exports, to all backends,
+// under a given name, like a file of that name. The content is spooled to a private temporary file in the
+// state directory while hashing it, as its hash is compared with the backups before uploading, and it is
+// streamed from there like a snapshot of a file, so it is never held in memory. Backups changed elsewhere since the last sync are overwritten or kept with -on-conflict, there
+// being no local file to merge them into, and a backup, which would be queued without network connectivity,
+// fails instead, as the content is not there on the next sync.
+// It returns the result of every backend.
+func SyncStdin(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, r io.Reader, name string) []Result {
+  start := time.Now()
+  path := StdinPath(name)
+  results := make([]Result, len(backends))
+  for i, b := range backends {
+    results[i] = Result{ Path: path, Backend: b.Name() }
+  }
+  fail := func(err error) []Result {
+    for i := range results {
+      results[i].Err = err
+      results[i].Duration = time.Since(start)
+    }
+    return results
+  }
+
+  dir, err := config.StateDir()
+  if err != nil {
+    return fail(fmt.Errorf("Unable to read standard input: %v", err))
+  }
+  spool, size, hash, sha, err := hashing.SnapshotReader(r, dir)
+  if err != nil {
+    return fail(fmt.Errorf("Unable to read standard input: %v", err))
+  }
+  defer hashing.RemoveSnapshot(spool)
+  if size == 0 {
+    return fail(fmt.Errorf("Standard input is empty"))
+  }
+  fileState := st.File(path)
+  fileState.CacheSHA256(sha)
+
+  // the content is as new as the run, which received it
+  meta := map[string]string{ MetaToolVersion: selfupdate.Version, MetaModTime: start.UTC().Format(time.RFC3339Nano),
+    MetaSHA256: sha }
+  if hostname, err := os.Hostname(); err == nil {
+    meta[MetaHostname] = hostname
+  }
+  var format string
+  if !opts.IsGeneric(name) {
+    if header, err := kdbx.Read(io.NewSectionReader(spool, 0, size)); err == nil {
+      meta[MetaKdbxVersion], meta[MetaKdbxCipher], meta[MetaKdbxKDF] = header.Version, header.Cipher, header.KDF
+      format = header.String()
+    } else if err != kdbx.ErrNotKdbx {
+      opts.Log().Warn("Unable to read database header", "file", path, "error", err)
+    }
+  }
+
+  payload, payloadHash, payloadSize := spool, hash, size
+  if opts.Compress != "" {
+    payload, payloadHash, err = compress.Snapshot(spool, size, opts.Compress)
+    if err != nil {
+      return fail(fmt.Errorf("Unable to compress standard input: %v", err))
+    }
+    defer hashing.RemoveSnapshot(payload)
+    info, err := payload.Stat()
+    if err != nil {
+      return fail(fmt.Errorf("Unable to compress standard input: %v", err))
+    }
+    payloadSize = info.Size()
+    fileState.CachePayloadHash(opts.Compress, payloadHash)
+  }
+  ringFileName := compress.BackupName(path, opts.Compress)
+
+  // the state is updated in between the lookups and the uploads run in parallel
+  uploads := make(chan struct{}, opts.Jobs)
+  remotes := make([]*RemoteFile, len(backends))
+  Parallel(len(backends), uploads, func(i int) {
+    remotes[i], results[i].Err = backends[i].Find(ctx, ringFileName, fileState.BackendId(backends[i].Name()))
+  })
+  for i, remote := range remotes {
+    results[i].Format, results[i].Hash = format, hash
+    if results[i].Err != nil || remote == nil {
+      continue
+    }
+    backend := backends[i].Name()
+    logger := opts.Log().With("file", path, "backend", backend, "id", remote.Id)
+    fileState.SetBackendId(backend, remote.Id)
+    results[i].RemoteId = remote.Id
+    switch {
+    case remote.Md5 == payloadHash && sameSHA256(remote, sha):
+      logger.Info("The passwords file has not been changed since last sync")
+      results[i].Action = ActionUnchanged
+      fileState.SetSyncedHash(backend, payloadHash)
+    case !diverged(fileState, backend, remote, payloadHash):
+    case opts.OnConflict == "merge":
+      results[i].Err = fmt.Errorf("Backup was changed elsewhere since last sync, and the standard input cannot be merged")
+    default:
+      _, results[i].Err = resolveConflict(ctx, opts, backends[i], remote, path, false, logger)
+    }
+  }
+
+  showProgress := opts.Progress && len(backends) == 1
+  Parallel(len(backends), uploads, func(i int) {
+    if results[i].Action != "" || results[i].Err != nil {
+      return
+    }
+    b, remote := backends[i], remotes[i]
+    logger := opts.Log().With("file", path, "backend", b.Name())
+    media := hashing.NewVerifyingReader(io.NewSectionReader(payload, 0, payloadSize), payloadHash)
+    if showProgress {
+      p := progress.NewReader(media, payloadSize, ringFileName, os.Stderr)
+      defer p.Finish()
+      media = p
+    }
+    if remote != nil {
+      logger.Info("Updating .kdbx file", "bytes", payloadSize)
+    } else {
+      logger.Info("Creating .kdbx file", "bytes", payloadSize)
+    }
+    id, err := b.Upload(ctx, path, ringFileName, remote, media, payloadSize, payloadHash, meta)
+    if err != nil {
+      results[i].Err = err
+      return
+    }
+    results[i].RemoteId, results[i].Bytes = id, payloadSize
+    if remote != nil {
+      logger.Info("Successfully updated .kdbx file", "id", id, "bytes", payloadSize)
+      results[i].Action = ActionUpdated
+    } else {
+      logger.Info("Successfully created .kdbx file", "id", id, "bytes", payloadSize)
+      results[i].Action = ActionCreated
+    }
+  })
+
+  for i, r := range results {
+    if r.Action == ActionCreated || r.Action == ActionUpdated {
+      fileState.SetBackendId(backends[i].Name(), r.RemoteId)
+      fileState.SetSyncedHash(backends[i].Name(), payloadHash)
+    }
+    // the content read once is not there to be queued for the next sync
+    if IsOffline(r.Err) {
+      results[i].Err = fmt.Errorf("No network connectivity, unable to queue the standard input: %v", r.Err)
+    }
+    results[i].Duration = time.Since(start)
+  }
+  return results
+}
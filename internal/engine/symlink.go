@@ -0,0 +1,52 @@
+package engine
+
+import (
+  "os"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// ResolveLinks prepares the state of given files, which are symlinks, e.g. of a dotfile manager:
+// a symlink to a file backed up by its real path before takes over the state of the real path, so its
+// backups keep their history, and a symlink, whose target is gone, is told together with the target
+// recorded by the last backup, which tells where the target moved from.
+func ResolveLinks(opts *config.Options, st *state.State, paths []string) {
+  for _, p := range paths {
+    info, err := os.Lstat(p)
+    if err != nil || info.Mode()&os.ModeSymlink == 0 {
+      continue
+    }
+    fs, backedUp := st.Files[p]
+    if _, err := os.Stat(p); os.IsNotExist(err) {
+      target := ""
+      if backedUp {
+        target = fs.Target
+      }
+      opts.Log().Warn("Symlink target is missing, was it moved?", "file", p, "target", target)
+      continue
+    }
+    target := fsutil.RealPath(p)
+    if backedUp || target == p || containsFile(paths, target) {
+      continue
+    }
+    // backups are named after the file, so only the ones of the same name carry on
+    if fs, ok := st.Files[target]; ok && hasBackups(fs) && compress.BackupName(target, "") == compress.BackupName(p, "") {
+      opts.Log().Info("Backing up symlink in place of its target", "file", p, "target", target)
+      st.RemovePending(target)
+      st.Move(target, p)
+    }
+  }
+}
+
+// containsFile reports whether path is one of paths.
+func containsFile(paths []string, path string) bool {
+  for _, p := range paths {
+    if config.SamePath(p, path) {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,316 @@
+// Package engine implements syncing local files to backends and restoring them.
+package engine
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "os"
+  "sync"
+  "time"
+
+  "go.opentelemetry.io/otel/attribute"
+  "go.opentelemetry.io/otel/trace"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+  "github.com/pawelu/keepassx_backup_tool/internal/kdbx"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/selfupdate"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tracing"
+)
+
+// SyncRingFiles backs up given files to all backends, with up to opts.Jobs files
+// and uploads in progress at once.
+// It returns the results of every backend in the order of the given paths.
+func SyncRingFiles(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, paths []string) []Result {
+  results := make([][]Result, len(paths))
+  uploads := make(chan struct{}, opts.Jobs)
+  jobs := make(chan int)
+  var wg sync.WaitGroup
+  for w := 0; w < opts.Jobs && w < len(paths); w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range jobs {
+        start := time.Now()
+        fileCtx, span := tracing.Tracer.Start(ctx, "backup", trace.WithAttributes(attribute.String("file", paths[i])))
+        results[i] = syncRingFile(fileCtx, opts, st, backends, uploads, paths[i])
+        var err error
+        for k := range results[i] {
+          results[i][k].Duration = time.Since(start)
+          if results[i][k].Err != nil {
+            err = results[i][k].Err
+          }
+        }
+        tracing.EndSpan(span, err)
+      }
+    }()
+  }
+  for i := range paths {
+    jobs <- i
+  }
+  close(jobs)
+  wg.Wait()
+
+  var all []Result
+  for _, r := range results {
+    all = append(all, r...)
+  }
+  return all
+}
+
+// syncRingFile uploads a snapshot of the local .kdbx file to all backends, which do not
+// have an up to date copy yet, taking the snapshot only when some of them need it.
+// It returns the result of every backend with the action taken, also when failing part way.
+func syncRingFile(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, uploads chan struct{}, localRingFilePath string) []Result {
+  results := make([]Result, len(backends))
+  for i, b := range backends {
+    results[i] = Result{ Path: localRingFilePath, Backend: b.Name() }
+  }
+  // failRemaining fails all backends, which have not finished yet
+  failRemaining := func(err error) []Result {
+    for i := range results {
+      if results[i].Action == "" && results[i].Err == nil {
+        results[i].Err = err
+      }
+    }
+    return results
+  }
+  remaining := func() bool {
+    for _, r := range results {
+      if r.Action == "" && r.Err == nil {
+        return true
+      }
+    }
+    return false
+  }
+
+  ringFileName := compress.BackupName(localRingFilePath, opts.Compress)
+
+  fileState := st.File(localRingFilePath)
+  if err := waitUntilSettled(opts, fileState, localRingFilePath); err != nil {
+    return failRemaining(fmt.Errorf("Unable to back up .kdbx file: %v", err))
+  }
+
+  original, err := os.Stat(localRingFilePath)
+  if err != nil {
+    return failRemaining(fmt.Errorf("Unable to snapshot .kdbx file: %v", err))
+  }
+  fileState.Inode = fsutil.FileID(localRingFilePath, original)
+  // a symlink is backed up under its own path, so backups carry on when its target moves
+  target := fsutil.RealPath(localRingFilePath)
+  if target == localRingFilePath {
+    target = ""
+  }
+  if target != "" && fileState.Target != "" && target != fileState.Target {
+    opts.Log().Info("Symlink target moved", "file", localRingFilePath, "from", fileState.Target, "to", target)
+  }
+  fileState.Target = target
+
+  // every backup records where and from what it was made, the format is recorded for databases only,
+  // not for key files and other files, and keepassxc-cli merges KDBX databases only;
+  // generic secrets files are not looked into
+  meta := map[string]string{ MetaToolVersion: selfupdate.Version, MetaModTime: original.ModTime().UTC().Format(time.RFC3339Nano) }
+  if hostname, err := os.Hostname(); err == nil {
+    meta[MetaHostname] = hostname
+  }
+  mergeable := false
+  if opts.IsGeneric(localRingFilePath) {
+    opts.Log().Debug("Backing up generic secrets file", "file", localRingFilePath)
+  } else if header, err := kdbx.ReadFile(localRingFilePath); err == nil {
+    mergeable = !header.Legacy
+    meta[MetaKdbxVersion], meta[MetaKdbxCipher], meta[MetaKdbxKDF] = header.Version, header.Cipher, header.KDF
+    for i := range results {
+      results[i].Format = header.String()
+    }
+  } else if err != kdbx.ErrNotKdbx {
+    opts.Log().Warn("Unable to read database header", "file", localRingFilePath, "error", err)
+  }
+
+  remotes := make([]*RemoteFile, len(backends))
+  Parallel(len(backends), uploads, func(i int) {
+    b := backends[i]
+    opts.Log().Debug("Checking for .kdbx file existence", "file", localRingFilePath, "backend", b.Name())
+    _, span := tracing.Tracer.Start(ctx, "lookup", trace.WithAttributes(attribute.String("backend", b.Name())))
+    remotes[i], results[i].Err = b.Find(ctx, ringFileName, fileState.BackendId(b.Name()))
+    tracing.EndSpan(span, results[i].Err)
+  })
+  for i, remote := range remotes {
+    if remote != nil {
+      fileState.SetBackendId(backends[i].Name(), remote.Id)
+      results[i].RemoteId = remote.Id
+    }
+  }
+
+  // a file unchanged since it was hashed last time is not read at all,
+  // unless the backup records another sha256 hash than the cached one
+  checkUnchanged := func(hash, payloadHash, sha256 string) {
+    for i, remote := range remotes {
+      if results[i].Err == nil && remote != nil && remote.Md5 == payloadHash && sameSHA256(remote, sha256) {
+        opts.Log().Info("The passwords file has not been changed since last sync", "file", localRingFilePath,
+          "backend", backends[i].Name())
+        results[i].Hash = hash
+        results[i].Action = ActionUnchanged
+        fileState.SetSyncedHash(backends[i].Name(), payloadHash)
+      }
+    }
+  }
+  if cached := fileState.CachedPayloadHash(original, opts.Compress); cached != "" {
+    checkUnchanged(fileState.Hash, cached, fileState.SHA256)
+  }
+  if !remaining() {
+    return results
+  }
+
+  // the original is read only once, hashing it while copying it into the snapshot,
+  // and a save in progress during copying is detected by comparing its metadata
+  _, span := tracing.Tracer.Start(ctx, "hash")
+  ringFile, ringFileHash, ringFileSHA256, err := hashing.SnapshotFile(localRingFilePath)
+  if err != nil {
+    return failRemaining(tracing.EndSpan(span, fmt.Errorf("Unable to snapshot .kdbx file: %v", err)))
+  }
+  defer hashing.RemoveSnapshot(ringFile)
+  tracing.EndSpan(span, nil)
+
+  if modified, err := hashing.IsModified(localRingFilePath, original); err != nil || modified {
+    return failRemaining(fmt.Errorf("File .kdbx was modified while taking a snapshot, try again later"))
+  }
+  fileState.CacheHash(original, ringFileHash)
+  fileState.CacheSHA256(ringFileSHA256)
+  meta[MetaSHA256] = ringFileSHA256
+  size := original.Size()
+
+  // if .kdbx is empty file, by comparing to md5("")
+  if ringFileHash == "d41d8cd98f00b204e9800998ecf8427e" {
+    return failRemaining(fmt.Errorf("File .kdbx is empty"))
+  }
+
+  // compressed backups are compared and verified by the hash of the compressed data
+  payload, payloadHash, payloadSize := ringFile, ringFileHash, size
+  if opts.Compress != "" {
+    _, span := tracing.Tracer.Start(ctx, "compress")
+    payload, payloadHash, err = compress.Snapshot(ringFile, size, opts.Compress)
+    if err != nil {
+      return failRemaining(tracing.EndSpan(span, fmt.Errorf("Unable to compress .kdbx file: %v", err)))
+    }
+    defer hashing.RemoveSnapshot(payload)
+    info, err := payload.Stat()
+    if err != nil {
+      return failRemaining(tracing.EndSpan(span, fmt.Errorf("Unable to compress .kdbx file: %v", err)))
+    }
+    payloadSize = info.Size()
+    tracing.EndSpan(span, nil)
+    fileState.CachePayloadHash(opts.Compress, payloadHash)
+  }
+
+  checkUnchanged(ringFileHash, payloadHash, ringFileSHA256)
+  if !remaining() {
+    return results
+  }
+
+  // the backups changed elsewhere since the last sync are resolved with -on-conflict,
+  // and the ones which look newer than the local file are replaced with -on-older-local warn only
+  merged := false
+  for i, remote := range remotes {
+    if results[i].Action != "" || results[i].Err != nil || remote == nil {
+      continue
+    }
+    name := backends[i].Name()
+    logger := opts.Log().With("file", localRingFilePath, "backend", name, "id", remote.Id)
+    switch {
+    case diverged(fileState, name, remote, payloadHash):
+      var ok bool
+      if ok, results[i].Err = resolveConflict(ctx, opts, backends[i], remote, localRingFilePath, mergeable, logger); ok {
+        fileState.SetSyncedHash(name, remote.Md5)
+        merged = true
+      }
+    case olderLocal(fileState, name, remote, payloadHash, original.ModTime()):
+      if opts.OnOlderLocal == "warn" {
+        logger.Warn("Backup looks newer than .kdbx file, overwriting it, see -on-older-local", "modified", original.ModTime(),
+          "backup_modified", remote.SourceModTime())
+        break
+      }
+      results[i].Err = fmt.Errorf("Backup looks newer than .kdbx file, not overwriting it, see -on-older-local")
+    }
+  }
+  // the merged file is backed up from a new snapshot, the merged backups being up to date
+  if merged {
+    return syncRingFile(ctx, opts, st, backends, uploads, localRingFilePath)
+  }
+
+  // the progress bars of several uploads would overwrite each other
+  showProgress := opts.Progress && len(backends) == 1
+
+  Parallel(len(backends), uploads, func(i int) {
+    if results[i].Action != "" || results[i].Err != nil {
+      return
+    }
+    b, remote := backends[i], remotes[i]
+    logger := opts.Log().With("file", localRingFilePath, "backend", b.Name())
+    results[i].Hash = ringFileHash
+
+    // all backends read the same snapshot, which is hashed again while reading it
+    media := hashing.NewVerifyingReader(io.NewSectionReader(payload, 0, payloadSize), payloadHash)
+    if showProgress {
+      p := progress.NewReader(media, payloadSize, ringFileName, os.Stderr)
+      defer p.Finish()
+      media = p
+    }
+    if opts.OnProgress != nil {
+      backend := b.Name()
+      media = progress.NewFuncReader(media, payloadSize, func(read, total int64) {
+        opts.OnProgress(localRingFilePath, backend, read, total)
+      })
+    }
+
+    if results[i].Format != "" {
+      logger = logger.With("format", results[i].Format)
+    }
+    if remote != nil {
+      logger.Info("Updating .kdbx file", "bytes", payloadSize)
+    } else {
+      logger.Info("Creating .kdbx file", "bytes", payloadSize)
+    }
+    start := time.Now()
+    uploadCtx, span := tracing.Tracer.Start(ctx, "upload", trace.WithAttributes(attribute.String("backend", b.Name()),
+      attribute.Int64("bytes", payloadSize)))
+    id, err := b.Upload(uploadCtx, localRingFilePath, ringFileName, remote, media, payloadSize, payloadHash, meta)
+    tracing.EndSpan(span, err)
+    if err != nil {
+      results[i].Err = err
+      return
+    }
+
+    results[i].RemoteId = id
+    results[i].Bytes = payloadSize
+    if remote != nil {
+      logger.Info("Successfully updated .kdbx file", "id", id, "bytes", payloadSize, "duration", time.Since(start))
+      results[i].Action = ActionUpdated
+    } else {
+      logger.Info("Successfully created .kdbx file", "id", id, "bytes", payloadSize, "duration", time.Since(start))
+      results[i].Action = ActionCreated
+    }
+  })
+
+  uploaded := false
+  for i, r := range results {
+    if r.Action == ActionCreated || r.Action == ActionUpdated {
+      fileState.SetBackendId(backends[i].Name(), r.RemoteId)
+      fileState.SetSyncedHash(backends[i].Name(), payloadHash)
+      uploaded = true
+    }
+  }
+
+  // the snapshot is consistent on its own, but tell the user that a newer
+  // version exists, which will be uploaded on the next run
+  if modified, _ := hashing.IsModified(localRingFilePath, original); uploaded && modified {
+    opts.Log().Warn("File .kdbx was modified during upload, the new version will be uploaded on next sync",
+      "file", localRingFilePath)
+  }
+
+  return results
+}
@@ -0,0 +1,115 @@
+package engine_test
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+func TestSyncRingFiles(t *testing.T) {
+  tests := []struct {
+    name    string
+    initial string
+    // changed is the new content of the local file before the second sync, or "" to sync it unchanged
+    changed string
+    want    engine.Action
+  }{
+    { name: "unchanged file is skipped", initial: "first", want: engine.ActionUnchanged },
+    { name: "changed file is updated", initial: "first", changed: "second version", want: engine.ActionUpdated },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      f := gdrivetest.NewFixture(t, tt.initial)
+      if r := f.Sync(t); r.Err != nil || r.Action != engine.ActionCreated {
+        t.Fatalf("first sync = %s, %v, want %s", r.Action, r.Err, engine.ActionCreated)
+      }
+      want := tt.initial
+      if tt.changed != "" {
+        f.Write(t, tt.changed)
+        want = tt.changed
+      }
+      r := f.Sync(t)
+      if r.Err != nil || r.Action != tt.want {
+        t.Fatalf("second sync = %s, %v, want %s", r.Action, r.Err, tt.want)
+      }
+      if got := f.Backup(t); got != want {
+        t.Errorf("backup = %q, want %q", got, want)
+      }
+      if r.RemoteId == "" || f.State.File(f.Path).BackendId("drive") != r.RemoteId {
+        t.Errorf("state records backup %q, want %q", f.State.File(f.Path).BackendId("drive"), r.RemoteId)
+      }
+    })
+  }
+}
+
+func TestSyncRingFilesEmptyFile(t *testing.T) {
+  f := gdrivetest.NewFixture(t, "")
+  if r := f.Sync(t); r.Err == nil {
+    t.Fatalf("sync of empty file = %s, want error", r.Action)
+  }
+}
+
+func TestSyncRingFilesConflict(t *testing.T) {
+  tests := []struct {
+    onConflict string
+    wantErr    bool
+    want       string
+  }{
+    { onConflict: "", want: "local change" },
+    { onConflict: "keep", wantErr: true, want: "remote change" },
+    // only KDBX databases are merged, which the file is not
+    { onConflict: "merge", wantErr: true, want: "remote change" },
+  }
+  for _, tt := range tests {
+    t.Run("on-conflict="+tt.onConflict, func(t *testing.T) {
+      f := gdrivetest.NewFixture(t, "first")
+      if r := f.Sync(t); r.Err != nil {
+        t.Fatal(r.Err)
+      }
+      // another machine changes the backup, while the local file is changed too
+      remote, err := f.Backend.Find(f.Ctx, filepath.Base(f.Path), "")
+      if err != nil {
+        t.Fatal(err)
+      }
+      _, err = f.Drive.Update(f.Ctx, remote.Id, remote.Name, nil, "", bytes.NewReader([]byte("remote change")), 0)
+      if err != nil {
+        t.Fatal(err)
+      }
+      f.Write(t, "local change")
+
+      f.Opts.OnConflict = tt.onConflict
+      r := f.Sync(t)
+      if (r.Err != nil) != tt.wantErr {
+        t.Fatalf("sync = %s, %v, want error %v", r.Action, r.Err, tt.wantErr)
+      }
+      if got := f.Backup(t); got != tt.want {
+        t.Errorf("backup = %q, want %q", got, tt.want)
+      }
+    })
+  }
+}
+
+// TestSyncRingFilesSettled backs up a file saved a while ago, and then skips it unchanged,
+// without waiting for it to settle.
+func TestSyncRingFilesSettled(t *testing.T) {
+  f := gdrivetest.NewFixture(t, "first")
+  saved := time.Now().Add(-time.Hour)
+  if err := os.Chtimes(f.Path, saved, saved); err != nil {
+    t.Fatal(err)
+  }
+  start := time.Now()
+  if r := f.Sync(t); r.Err != nil || r.Action != engine.ActionCreated {
+    t.Fatalf("first sync = %s, %v, want %s", r.Action, r.Err, engine.ActionCreated)
+  }
+  if r := f.Sync(t); r.Err != nil || r.Action != engine.ActionUnchanged {
+    t.Fatalf("second sync = %s, %v, want %s", r.Action, r.Err, engine.ActionUnchanged)
+  }
+  if elapsed := time.Since(start); elapsed >= time.Second {
+    t.Errorf("syncs took %v, want no wait for the file to settle", elapsed)
+  }
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+  "context"
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// VerifyRingFiles downloads the backups of given files by all backends, checking that they exist and that
+// their content has the hashes recorded by the backends and in their metadata, without the local files.
+// It returns the result of every backend in the order of the given paths: ActionVerified, ActionMissing
+// or ActionCorrupted, or ActionFailed if a backup could not be verified.
+func VerifyRingFiles(ctx context.Context, opts *config.Options, st *state.State, backends []Backend, paths []string) []Result {
+  var results []Result
+  for _, path := range paths {
+    fileState := st.File(path)
+    name := compress.BackupName(path, opts.Compress)
+    for _, b := range backends {
+      results = append(results, verifyBackup(ctx, opts, fileState, b, path, name))
+    }
+  }
+  return results
+}
+
+// verifyBackup downloads the backup of a local file with a given name by a backend, and checks its hashes.
+func verifyBackup(ctx context.Context, opts *config.Options, fileState *state.FileState, b Backend, path, name string) Result {
+  start := time.Now()
+  result := Result{ Path: path, Backend: b.Name() }
+  logger := opts.Log().With("file", path, "backend", b.Name())
+  remote, err := b.Find(ctx, name, fileState.BackendId(b.Name()))
+  if err != nil {
+    result.Action, result.Err = ActionFailed, err
+    return result
+  }
+  if remote == nil {
+    logger.Error("Backup is missing")
+    result.Action, result.Err = ActionMissing, fmt.Errorf("Backup is missing")
+    return result
+  }
+  result.RemoteId = remote.Id
+
+  md5Hash, sha256Hash, n, err := hashBackup(ctx, b, remote)
+  result.Hash, result.Bytes, result.Duration = md5Hash, n, time.Since(start)
+  if err != nil {
+    result.Action, result.Err = ActionFailed, err
+    return result
+  }
+  switch recorded := remote.Meta[MetaSHA256]; {
+  case remote.Md5 != "" && md5Hash != remote.Md5:
+    err = fmt.Errorf("Backup is corrupted, its md5 hash is %s instead of %s", md5Hash, remote.Md5)
+  case recorded != "" && sha256Hash != recorded:
+    err = fmt.Errorf("Backup is corrupted, the sha256 hash of the file is %s instead of %s", sha256Hash, recorded)
+  }
+  if err != nil {
+    logger.Error("Backup is corrupted", "id", remote.Id, "error", err)
+    result.Action, result.Err = ActionCorrupted, err
+    return result
+  }
+
+  // another machine backing up the same file replaces the backup made by this one
+  if synced := fileState.SyncedHash(b.Name()); synced != "" && synced != md5Hash {
+    logger.Warn("Backup differs from the one synced last time, it was changed elsewhere", "id", remote.Id,
+      "md5", md5Hash, "synced", synced)
+  }
+  logger.Info("Backup verified", "id", remote.Id, "md5", md5Hash)
+  result.Action = ActionVerified
+  return result
+}
+
+// hashBackup downloads a backup, returning the md5 hash of its content, the sha256 hash of the file
+// it decompresses to and the number of bytes downloaded.
+func hashBackup(ctx context.Context, b Backend, remote *RemoteFile) (string, string, int64, error) {
+  body, err := b.Download(ctx, remote)
+  if err != nil {
+    return "", "", 0, err
+  }
+  defer body.Close()
+  md5h, sha256h := md5.New(), sha256.New()
+  counted := &countingReader{ r: io.TeeReader(body, md5h) }
+  r, err := compress.NewDecompressor(counted, remote.Name)
+  if err != nil {
+    return "", "", counted.n, fmt.Errorf("Unable to decompress backup %s: %v", remote.Name, err)
+  }
+  defer r.Close()
+  if _, err := io.Copy(sha256h, r); err != nil {
+    return "", "", counted.n, fmt.Errorf("Unable to download backup %s: %v", remote.Name, err)
+  }
+  // the md5 hash is of all of the content, also after the end of the compressed stream
+  if _, err := io.Copy(ioutil.Discard, counted); err != nil {
+    return "", "", counted.n, fmt.Errorf("Unable to download backup %s: %v", remote.Name, err)
+  }
+  return hex.EncodeToString(md5h.Sum(nil)), hex.EncodeToString(sha256h.Sum(nil)), counted.n, nil
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+  r io.Reader
+  n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+  n, err := c.r.Read(p)
+  c.n += int64(n)
+  return n, err
+}
@@ -0,0 +1,109 @@
+// Package events publishes what happens during a run to subscribers, such as
+// notifiers, metrics and the history log, so the sync code does not call them itself.
+package events
+
+import (
+  "sync"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Event is one of the event types below.
+type Event interface {
+  event()
+}
+
+// RunStarted is published when a run, e.g. every backup of the daemon, starts backing up.
+type RunStarted struct{}
+
+// BackupStarted is published when the backends have been set up and files
+// are about to be backed up.
+type BackupStarted struct {
+  Paths    []string
+  Backends []string
+}
+
+// FileUploaded is published for every file uploaded to a backend.
+type FileUploaded struct {
+  Result engine.Result
+}
+
+// BackupQueued is published for every file queued for a backend, which needs
+// network connectivity, until the next run.
+type BackupQueued struct {
+  Result engine.Result
+}
+
+// BackupFailed is published for every file, which failed to be backed up to a backend.
+type BackupFailed struct {
+  Result engine.Result
+}
+
+// SyncFinished is published with the results of all files and backends,
+// once they have been recorded in the state.
+type SyncFinished struct {
+  Results []engine.Result
+  State   *state.State
+}
+
+// RunFinished is published with the report of the run, before the application exits.
+type RunFinished struct {
+  Report *report.Report
+}
+
+func (RunStarted) event()    {}
+func (BackupStarted) event() {}
+func (FileUploaded) event()  {}
+func (BackupQueued) event()  {}
+func (BackupFailed) event()  {}
+func (SyncFinished) event()  {}
+func (RunFinished) event()   {}
+
+var (
+  mu       sync.Mutex
+  handlers []func(e Event)
+)
+
+// Subscribe registers a handler called with every published event.
+func Subscribe(h func(e Event)) {
+  mu.Lock()
+  defer mu.Unlock()
+  handlers = append(handlers, h)
+}
+
+// OnRunFinished registers a handler called with the report of the run.
+func OnRunFinished(h func(r *report.Report)) {
+  Subscribe(func(e Event) {
+    if f, ok := e.(RunFinished); ok {
+      h(f.Report)
+    }
+  })
+}
+
+// Publish calls all handlers with an event, in the order they subscribed.
+func Publish(e Event) {
+  mu.Lock()
+  hs := handlers
+  mu.Unlock()
+  for _, h := range hs {
+    h(e)
+  }
+}
+
+// PublishResults publishes the event of every uploaded, queued or failed file,
+// followed by SyncFinished with all results and the state recording them.
+func PublishResults(results []engine.Result, st *state.State) {
+  for _, r := range results {
+    switch r.Action {
+    case engine.ActionCreated, engine.ActionUpdated:
+      Publish(FileUploaded{ Result: r })
+    case engine.ActionQueued:
+      Publish(BackupQueued{ Result: r })
+    case engine.ActionFailed:
+      Publish(BackupFailed{ Result: r })
+    }
+  }
+  Publish(SyncFinished{ Results: results, State: st })
+}
@@ -0,0 +1,164 @@
+// Package export stores exports of the databases next to them: the entries as XML
+// or CSV, the database information or a health report, made with keepassxc-cli and
+// sealed with a passphrase, as they are not encrypted by KeePassXC.
+package export
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/keepassxc"
+  "github.com/pawelu/keepassx_backup_tool/internal/seal"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase the exports are sealed with,
+// which may also be read from the file named by PassphraseEnv_FILE, or the descriptor by PassphraseEnv_FD.
+// The database password is used without it.
+const PassphraseEnv = config.EnvPrefix + "EXPORT_PASSPHRASE"
+
+// Suffix is appended to the names of the sealed exports.
+const Suffix = ".enc"
+
+// Formats are the exports -export may ask for, with the keepassxc-cli commands
+// making them and the suffix of their file names.
+var Formats = []string{ "xml", "csv", "info", "health" }
+
+var commands = map[string][]string{
+  "xml":    { "export", "--format", "xml" },
+  "csv":    { "export", "--format", "csv" },
+  "info":   { "db-info" },
+  "health": { "analyze" },
+}
+
+var suffixes = map[string]string{
+  "xml":    ".xml",
+  "csv":    ".csv",
+  "info":   ".info.txt",
+  "health": ".health.txt",
+}
+
+// ParseFormats parses the comma separated formats of -export.
+func ParseFormats(s string) ([]string, error) {
+  var formats []string
+  for _, f := range strings.Split(s, ",") {
+    if f = strings.TrimSpace(f); f == "" {
+      continue
+    }
+    if _, ok := commands[f]; !ok {
+      return nil, fmt.Errorf("Unknown export %q, expected %s", f, strings.Join(Formats, ", "))
+    }
+    formats = append(formats, f)
+  }
+  return formats, nil
+}
+
+// Dir generates the directory holding the sealed exports.
+// It returns the directory path, creating it if necessary.
+func Dir() (string, error) {
+  stateDir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  dir := filepath.Join(stateDir, "exports")
+  return dir, os.MkdirAll(dir, 0700)
+}
+
+// Path returns the path of the sealed export of a database in a given format,
+// e.g. exports/ring.kdbx.csv.enc in the state directory.
+func Path(dir, db, format string) string {
+  return filepath.Join(dir, filepath.Base(db)+suffixes[format]+Suffix)
+}
+
+// exportPassphrase returns the passphrase of the exports from the environment, or the database password
+// from keepassxc.Password unless given.
+func exportPassphrase() (string, error) {
+  passphrase, err := config.EnvSecret(PassphraseEnv)
+  if err != nil {
+    return "", err
+  }
+  // files holding the passphrase usually end with a newline
+  if passphrase = bytes.TrimRight(passphrase, "\r\n"); len(passphrase) == 0 {
+    passphrase, err = keepassxc.Password()
+  }
+  return string(passphrase), err
+}
+
+// Exporter makes the sealed exports with keepassxc-cli.
+type Exporter struct {
+  cli        *keepassxc.CLI
+  dir        string
+  passphrase string
+}
+
+// NewExporter creates the exporter with the database password and the passphrase
+// from the environment or asked for on the terminal. Without the password, keepassxc-cli asks for it
+// on the terminal, which works with a passphrase in the environment only.
+func NewExporter(keyFile string) (*Exporter, error) {
+  dir, err := Dir()
+  if err != nil {
+    return nil, err
+  }
+  passphrase, err := exportPassphrase()
+  if err != nil {
+    return nil, err
+  }
+  if passphrase == "" {
+    return nil, fmt.Errorf("Exports need a passphrase in %s or the database password in %s", PassphraseEnv,
+      keepassxc.PasswordEnv)
+  }
+  cli, err := keepassxc.NewCLI(keyFile)
+  if err != nil {
+    return nil, err
+  }
+  return &Exporter{ cli: cli, dir: dir, passphrase: passphrase }, nil
+}
+
+// Export makes the sealed export of a database in a given format, unless the one made before
+// is newer than the database, and returns its path.
+func (e *Exporter) Export(ctx context.Context, db, format string) (string, error) {
+  out := Path(e.dir, db, format)
+  dbInfo, err := os.Stat(db)
+  if err != nil {
+    return "", err
+  }
+  // a new export is sealed with a new salt, so it would be uploaded on every run
+  if outInfo, err := os.Stat(out); err == nil && outInfo.ModTime().After(dbInfo.ModTime()) {
+    return out, nil
+  }
+
+  command := commands[format]
+  plain, err := e.cli.Run(ctx, command[0], append(command[1:], db)...)
+  if err != nil {
+    return "", err
+  }
+
+  sealed, err := seal.Seal(plain, e.passphrase)
+  if err != nil {
+    return "", err
+  }
+  return out, fsutil.WriteFileAtomic(out, sealed, 0600)
+}
+
+// Open decrypts a sealed export with the passphrase, or the database password, from the environment.
+func Open(file string) ([]byte, error) {
+  passphrase, err := exportPassphrase()
+  if err != nil {
+    return nil, err
+  }
+  if passphrase == "" {
+    return nil, fmt.Errorf("Decrypting needs the passphrase in %s or the database password in %s", PassphraseEnv,
+      keepassxc.PasswordEnv)
+  }
+  b, err := ioutil.ReadFile(file)
+  if err != nil {
+    return nil, err
+  }
+  return seal.Open(b, passphrase)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package fsutil
+
+import (
+  "os"
+  "syscall"
+)
+
+// FileID returns the inode of a file with given metadata, which stays the same when the file is renamed,
+// or 0 if unknown.
+func FileID(path string, info os.FileInfo) uint64 {
+  if st, ok := info.Sys().(*syscall.Stat_t); ok {
+    return uint64(st.Ino)
+  }
+  return 0
+}
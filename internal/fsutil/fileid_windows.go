@@ -0,0 +1,23 @@
+//go:build windows
+
+package fsutil
+
+import (
+  "os"
+  "syscall"
+)
+
+// FileID returns the file index of a file, which stays the same when the file is renamed,
+// or 0 if unknown.
+func FileID(path string, info os.FileInfo) uint64 {
+  f, err := os.Open(path)
+  if err != nil {
+    return 0
+  }
+  defer f.Close()
+  var d syscall.ByHandleFileInformation
+  if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+    return 0
+  }
+  return uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)
+}
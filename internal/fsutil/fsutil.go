@@ -0,0 +1,39 @@
+// Package fsutil implements file system helpers shared by the other packages.
+package fsutil
+
+import (
+  "os"
+  "path/filepath"
+)
+
+// WriteFileAtomic replaces the file at a given path with data, so that after
+// a crash the file contains either the previous or the new content.
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+  tmp := file + ".tmp"
+  f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+  if err != nil {
+    return err
+  }
+  _, err = f.Write(data)
+  if err == nil {
+    err = f.Sync()
+  }
+  if closeErr := f.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    os.Remove(tmp)
+    return err
+  }
+  return os.Rename(tmp, file)
+}
+
+// RealPath returns the path of the file a given path links to, with all symlinks resolved,
+// or the path itself, when it has no symlinks or they cannot be resolved.
+func RealPath(path string) string {
+  resolved, err := filepath.EvalSymlinks(path)
+  if err != nil || resolved == filepath.Clean(path) {
+    return path
+  }
+  return resolved
+}
@@ -0,0 +1,168 @@
+// Package gdrive implements the Google Drive backend.
+package gdrive
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// driveTimeLayout is the RFC 3339 format of the times Drive stores, with milliseconds.
+const driveTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Backend stores backups in the -remote-folder folder of Google Drive,
+// recording uploads in the journal, so interrupted ones are found on the next run.
+type Backend struct {
+  client   Client
+  opts     *config.Options
+  jr       *Journal
+  folderId string
+}
+
+// New creates the backend storing backups through c in the folder with a given id,
+// recording uploads in jr, unless it is nil.
+func New(c Client, opts *config.Options, jr *Journal, folderId string) *Backend {
+  return &Backend{ client: c, opts: opts, jr: jr, folderId: folderId }
+}
+
+// WithOptions returns a copy of the backend using other options.
+func (d *Backend) WithOptions(opts *config.Options) *Backend {
+  c := *d
+  c.opts = opts
+  return &c
+}
+
+func (d *Backend) Name() string {
+  return "drive"
+}
+
+func (d *Backend) Find(ctx context.Context, name, remoteId string) (*engine.RemoteFile, error) {
+  f, err := findRingFile(ctx, d.client, d.opts, remoteId, d.folderId, name)
+  if err != nil || f == nil {
+    return nil, err
+  }
+  modTime, _ := time.Parse(time.RFC3339, f.ModifiedTime)
+  return &engine.RemoteFile{ Id: f.Id, Name: f.Name, Md5: f.Md5Checksum, ModTime: modTime, Size: f.Size,
+    Meta: f.AppProperties }, nil
+}
+
+func (d *Backend) Upload(ctx context.Context, path, ringFileName string, remote *engine.RemoteFile, r io.Reader, size int64, hash string,
+  meta map[string]string) (string, error) {
+  // the backup is modified when the local file was, not when it was uploaded
+  modifiedTime := ""
+  if t, err := time.Parse(time.RFC3339, meta[engine.MetaModTime]); err == nil {
+    modifiedTime = t.UTC().Format(driveTimeLayout)
+  }
+  var f *File
+  if remote != nil {
+    err := d.jr.begin(journalEntry{ Op: opUpdate, Path: path, Name: ringFileName, FolderId: d.folderId,
+      FileId: remote.Id, Hash: hash })
+    if err != nil {
+      return "", err
+    }
+    f, err = d.client.Update(ctx, remote.Id, ringFileName, meta, modifiedTime, r, d.opts.ChunkSize)
+    if err != nil {
+      return "", fmt.Errorf("Unable to update .kdbx file: %w", err)
+    }
+  } else {
+    err := d.jr.begin(journalEntry{ Op: opCreate, Path: path, Name: ringFileName, FolderId: d.folderId, Hash: hash })
+    if err != nil {
+      return "", err
+    }
+    f, err = d.client.Create(ctx, d.folderId, ringFileName, meta, modifiedTime, r, d.opts.ChunkSize)
+    if err != nil {
+      return "", fmt.Errorf("Unable to create .kdbx: %w", err)
+    }
+  }
+
+  if err := verifyUpload(ctx, f, hash); err != nil {
+    return "", err
+  }
+  if err := d.jr.finish(path); err != nil {
+    return "", err
+  }
+  return f.Id, nil
+}
+
+func (d *Backend) Download(ctx context.Context, remote *engine.RemoteFile) (io.ReadCloser, error) {
+  if remote.Revision != "" {
+    body, err := d.client.DownloadRevision(ctx, remote.Id, remote.Revision)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to download revision %s of .kdbx file %s: %w", remote.Revision, remote.Id, err)
+    }
+    return body, nil
+  }
+  body, err := d.client.Download(ctx, remote.Id)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to download .kdbx file %s: %w", remote.Id, err)
+  }
+  return body, nil
+}
+
+// List lists the backups in the backups folder, which are not in the trash.
+func (d *Backend) List(ctx context.Context) ([]*engine.RemoteFile, error) {
+  files, err := d.client.ListChildren(ctx, d.folderId)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to list backups folder: %w", err)
+  }
+  var remotes []*engine.RemoteFile
+  for _, f := range files {
+    // folders have no content, so no md5 hash
+    if f.Trashed || f.Md5Checksum == "" {
+      continue
+    }
+    modTime, _ := time.Parse(time.RFC3339, f.ModifiedTime)
+    remotes = append(remotes, &engine.RemoteFile{ Id: f.Id, Name: f.Name, Md5: f.Md5Checksum, ModTime: modTime,
+      Size: f.Size, Meta: f.AppProperties })
+  }
+  return remotes, nil
+}
+
+// Revisions lists the revisions of a backup Drive keeps, the oldest first.
+func (d *Backend) Revisions(ctx context.Context, remote *engine.RemoteFile) ([]*Revision, error) {
+  revisions, err := d.client.ListRevisions(ctx, remote.Id)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to list revisions of .kdbx file %s: %w", remote.Id, err)
+  }
+  return revisions, nil
+}
+
+// FindRevision looks up a revision of a backup Drive keeps, without the metadata, which describes
+// the latest revision.
+func (d *Backend) FindRevision(ctx context.Context, remote *engine.RemoteFile, revisionId string) (*engine.RemoteFile, error) {
+  revisions, err := d.Revisions(ctx, remote)
+  if err != nil {
+    return nil, err
+  }
+  for _, rev := range revisions {
+    if rev.Id == revisionId {
+      modTime, _ := time.Parse(time.RFC3339, rev.ModifiedTime)
+      return &engine.RemoteFile{ Id: remote.Id, Name: remote.Name, Md5: rev.Md5Checksum, ModTime: modTime, Size: rev.Size,
+        Revision: rev.Id }, nil
+    }
+  }
+  return nil, fmt.Errorf("Revision %s of .kdbx file %s not found", revisionId, remote.Id)
+}
+
+// Rename renames a backup, keeping the revisions Drive keeps of it.
+func (d *Backend) Rename(ctx context.Context, remote *engine.RemoteFile, name string) (*engine.RemoteFile, error) {
+  f, err := d.client.Rename(ctx, remote.Id, name)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to rename .kdbx file %s: %w", remote.Id, err)
+  }
+  modTime, _ := time.Parse(time.RFC3339, f.ModifiedTime)
+  return &engine.RemoteFile{ Id: f.Id, Name: f.Name, Md5: f.Md5Checksum, ModTime: modTime, Size: f.Size,
+    Meta: f.AppProperties }, nil
+}
+
+// Remove moves a backup to the Drive trash, from which the user may still restore it.
+func (d *Backend) Remove(ctx context.Context, remote *engine.RemoteFile) error {
+  if err := d.client.Trash(ctx, remote.Id); err != nil {
+    return fmt.Errorf("Unable to move file %s to the trash: %w", remote.Id, err)
+  }
+  return nil
+}
@@ -0,0 +1,47 @@
+package gdrive
+
+import (
+  "context"
+  "log/slog"
+  "os"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// WatchChanges polls the changes of the drive every interval until the context is done,
+// calling changed with every backup in the folder with a given id, which was uploaded from
+// another machine, told by the hostname recorded with it, or by hand.
+// It returns an error, if the changes cannot be watched at all.
+func WatchChanges(ctx context.Context, c Client, folderId string, interval time.Duration, logger *slog.Logger,
+  changed func(f *File)) error {
+  hostname, _ := os.Hostname()
+  token, err := c.ChangesToken(ctx)
+  if err != nil {
+    return err
+  }
+
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ctx.Done():
+      return nil
+    case <-ticker.C:
+    }
+    files, next, err := c.Changes(ctx, token, folderId)
+    if err != nil {
+      if ctx.Err() == nil {
+        logger.Warn("Unable to list changes of Drive", "error", err)
+      }
+      continue
+    }
+    token = next
+    for _, f := range files {
+      if source := f.AppProperties[engine.MetaHostname]; source != hostname {
+        logger.Debug("Backup changed elsewhere", "name", f.Name, "id", f.Id, "source_hostname", source)
+        changed(f)
+      }
+    }
+  }
+}
@@ -0,0 +1,438 @@
+package gdrive
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "io"
+  "log/slog"
+  "net/http"
+
+  "google.golang.org/api/drive/v3"
+  "google.golang.org/api/googleapi"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// folderMimeType is the MIME type Drive gives to folders.
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// File is the metadata of a file stored on Drive.
+type File struct {
+  Id           string
+  Name         string
+  Md5Checksum  string
+  ModifiedTime string
+  Size         int64
+  Trashed      bool
+
+  // AppProperties are the properties set by the application, e.g. the KDBX format
+  AppProperties map[string]string
+}
+
+// Revision is the metadata of a revision of the content of a file, which Drive keeps
+// for 30 days or up to 100 revisions, unless it is kept forever.
+type Revision struct {
+  Id           string
+  Md5Checksum  string
+  ModifiedTime string
+  Size         int64
+  KeepForever  bool
+}
+
+// Client is the narrow set of Drive operations the backend uses,
+// implemented by NewClient on top of the Drive API, and in memory by gdrivetest.NewFakeClient for tests.
+type Client interface {
+  // FindFolder looks up a folder with a given name in a parent folder, or with an empty parentId
+  // in the Drive root, the root of the shared drive, or the folder shared by another account.
+  // A trashed folder is restored when restoreTrashed is set, otherwise it is ignored.
+  // It returns nil if the folder does not exist.
+  FindFolder(ctx context.Context, parentId, name string, restoreTrashed bool) (*File, error)
+
+  // CreateFolder creates a folder with a given name in a parent folder, or with an empty parentId
+  // in the Drive root, the root of the shared drive, or the folder shared by another account.
+  CreateFolder(ctx context.Context, parentId, name string) (*File, error)
+
+  // ListFolders lists the folders with a given name in a parent folder, or with an empty parentId
+  // in the root like FindFolder, which are not in the trash, the oldest first.
+  ListFolders(ctx context.Context, parentId, name string) ([]*File, error)
+
+  // ListChildren lists all files and folders in a folder, including the ones in the trash.
+  ListChildren(ctx context.Context, folderId string) ([]*File, error)
+
+  // Move moves a file from a folder into another one.
+  Move(ctx context.Context, id, fromId, toId string) error
+
+  // Rename gives a file another name, keeping its content and revisions.
+  Rename(ctx context.Context, id, name string) (*File, error)
+
+  // FindFile looks up a file with a given name in a folder.
+  // A trashed file is restored when restoreTrashed is set, otherwise it is ignored.
+  // It returns nil if the file does not exist.
+  FindFile(ctx context.Context, folderId, name string, restoreTrashed bool) (*File, error)
+
+  // Get retrieves a file by id, including one in the trash.
+  Get(ctx context.Context, id string) (*File, error)
+
+  // Create uploads a new file with given appProperties into a folder, in chunks of a given size.
+  // The file is given modifiedTime in RFC 3339 format, unless it is "", which leaves the upload time.
+  Create(ctx context.Context, folderId, name string, props map[string]string, modifiedTime string, media io.Reader,
+    chunkSize int) (*File, error)
+
+  // Update uploads new content of an existing file, replacing the given appProperties and modifiedTime,
+  // like Create, in chunks of a given size.
+  Update(ctx context.Context, id, name string, props map[string]string, modifiedTime string, media io.Reader,
+    chunkSize int) (*File, error)
+
+  // ListVersions lists all files with a given name in a folder, which are not in the trash.
+  ListVersions(ctx context.Context, folderId, name string) ([]*File, error)
+
+  // Download retrieves the content of a file.
+  Download(ctx context.Context, id string) (io.ReadCloser, error)
+
+  // Delete removes a file permanently.
+  Delete(ctx context.Context, id string) error
+
+  // Trash moves a file or folder to the trash, from which the user may still restore it.
+  Trash(ctx context.Context, id string) error
+
+  // ListRevisions lists the revisions of the content of a file Drive keeps, the oldest first.
+  ListRevisions(ctx context.Context, id string) ([]*Revision, error)
+
+  // DownloadRevision retrieves the content of a file as of a revision.
+  DownloadRevision(ctx context.Context, id, revisionId string) (io.ReadCloser, error)
+
+  // ChangesToken returns the token of the current position in the changes of the drive.
+  ChangesToken(ctx context.Context) (string, error)
+
+  // Changes lists the files in a folder changed since the position of a given token,
+  // which are not in the trash, and returns the token of the position after them.
+  Changes(ctx context.Context, token, folderId string) ([]*File, string, error)
+}
+
+// serviceClient implements Client with the Drive API.
+type serviceClient struct {
+  srv    *drive.Service
+  logger *slog.Logger
+
+  // driveId is the id of the shared drive holding the backups folder, or "" for My Drive
+  driveId string
+
+  // rootId is the id of the folder shared by another account holding the backups folder, or ""
+  rootId string
+}
+
+// NewClient returns the client calling the Drive API through srv, logging to logger.
+func NewClient(srv *drive.Service, logger *slog.Logger) Client {
+  return &serviceClient{ srv: srv, logger: logger }
+}
+
+// NewSharedDriveClient returns the client calling the Drive API through srv, logging to logger,
+// which keeps the backups folder on the shared drive with a given id instead of My Drive.
+func NewSharedDriveClient(srv *drive.Service, logger *slog.Logger, driveId string) Client {
+  return &serviceClient{ srv: srv, logger: logger, driveId: driveId }
+}
+
+// NewSharedFolderClient returns the client calling the Drive API through srv, logging to logger,
+// which keeps the backups folder in the folder with a given id shared by another account,
+// on the shared drive with a given id, or on My Drive of the owner for "".
+func NewSharedFolderClient(srv *drive.Service, logger *slog.Logger, folderId, driveId string) Client {
+  return &serviceClient{ srv: srv, logger: logger, driveId: driveId, rootId: folderId }
+}
+
+// OpenClient returns the client calling the Drive API through srv, keeping the backups folder
+// in the folder of -shared-folder, or on the shared drive of -shared-drive, if given, or on My Drive.
+func OpenClient(ctx context.Context, srv *drive.Service, opts *config.Options) (Client, error) {
+  if opts.SharedFolder != "" {
+    folderId, driveId, err := ResolveSharedFolder(ctx, srv, opts.SharedFolder)
+    if err != nil {
+      return nil, err
+    }
+    return NewSharedFolderClient(srv, opts.Log(), folderId, driveId), nil
+  }
+  if opts.SharedDrive == "" {
+    return NewClient(srv, opts.Log()), nil
+  }
+  driveId, err := ResolveSharedDrive(ctx, srv, opts.SharedDrive)
+  if err != nil {
+    return nil, err
+  }
+  return NewSharedDriveClient(srv, opts.Log(), driveId), nil
+}
+
+// ResolveSharedDrive returns the id of the shared drive with a given name. Listing shared drives
+// needs more than the drive.file scope the application is authorized with, so unless a shared
+// drive is found by its name, the name is taken for the id of the shared drive.
+func ResolveSharedDrive(ctx context.Context, srv *drive.Service, name string) (string, error) {
+  r, err := srv.Drives.List().Q(fmt.Sprintf("name = '%s'", EscapeQuery(name))).Fields("drives(id, name)").
+    Context(ctx).Do()
+  var apiErr *googleapi.Error
+  if err != nil && !(errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden) {
+    return "", fmt.Errorf("Unable to list shared drives: %w", err)
+  }
+  if err == nil && len(r.Drives) > 0 {
+    return r.Drives[0].Id, nil
+  }
+  // the id is checked by the first call creating or listing files on the shared drive
+  return name, nil
+}
+
+// parent returns the id of a parent folder, or for an empty parentId of the shared folder,
+// or the root of the drive holding the backups folder.
+func (c *serviceClient) parent(parentId string) string {
+  switch {
+  case parentId != "":
+    return parentId
+  case c.rootId != "":
+    return c.rootId
+  case c.driveId != "":
+    return c.driveId
+  default:
+    return "root"
+  }
+}
+
+// fileFields are the fields of File, which every call requests.
+const fileFields = "id, name, md5Checksum, modifiedTime, size, trashed, appProperties"
+
+func (c *serviceClient) FindFolder(ctx context.Context, parentId, name string, restoreTrashed bool) (*File, error) {
+  query := fmt.Sprintf("mimeType = '%s' and name = '%s' and '%s' in parents", folderMimeType, EscapeQuery(name),
+    EscapeQuery(c.parent(parentId)))
+  return c.find(ctx, query, restoreTrashed)
+}
+
+func (c *serviceClient) CreateFolder(ctx context.Context, parentId, name string) (*File, error) {
+  myFile := drive.File{ Name: name, MimeType: folderMimeType, Parents: []string{ c.parent(parentId) } }
+  f, err := c.srv.Files.Create(&myFile).Fields(fileFields).SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, err
+  }
+  return fromDrive(f), nil
+}
+
+func (c *serviceClient) FindFile(ctx context.Context, folderId, name string, restoreTrashed bool) (*File, error) {
+  query := fmt.Sprintf("name = '%s' and '%s' in parents", EscapeQuery(name), EscapeQuery(folderId))
+  return c.find(ctx, query, restoreTrashed)
+}
+
+func (c *serviceClient) Get(ctx context.Context, id string) (*File, error) {
+  f, err := c.srv.Files.Get(id).Fields(fileFields).SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, err
+  }
+  return fromDrive(f), nil
+}
+
+func (c *serviceClient) Create(ctx context.Context, folderId, name string, props map[string]string, modifiedTime string,
+  media io.Reader, chunkSize int) (*File, error) {
+  myFile := drive.File{ Name: name, Parents: []string{ folderId }, AppProperties: props, ModifiedTime: modifiedTime }
+  f, err := c.srv.Files.Create(&myFile).Media(media, googleapi.ChunkSize(chunkSize)).Fields(fileFields).
+    SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, err
+  }
+  return fromDrive(f), nil
+}
+
+func (c *serviceClient) Update(ctx context.Context, id, name string, props map[string]string, modifiedTime string,
+  media io.Reader, chunkSize int) (*File, error) {
+  myFile := drive.File{ Name: name, AppProperties: props, ModifiedTime: modifiedTime }
+  f, err := c.srv.Files.Update(id, &myFile).Media(media, googleapi.ChunkSize(chunkSize)).Fields(fileFields).
+    SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, err
+  }
+  return fromDrive(f), nil
+}
+
+func (c *serviceClient) ListVersions(ctx context.Context, folderId, name string) ([]*File, error) {
+  query := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", EscapeQuery(name), EscapeQuery(folderId))
+  files, err := c.listAll(ctx, c.listCall(query))
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve files: %w", err)
+  }
+  return files, nil
+}
+
+func (c *serviceClient) Download(ctx context.Context, id string) (io.ReadCloser, error) {
+  resp, err := c.srv.Files.Get(id).SupportsAllDrives(true).Context(ctx).Download()
+  if err != nil {
+    return nil, err
+  }
+  return resp.Body, nil
+}
+
+func (c *serviceClient) Delete(ctx context.Context, id string) error {
+  return c.srv.Files.Delete(id).SupportsAllDrives(true).Context(ctx).Do()
+}
+
+func (c *serviceClient) Trash(ctx context.Context, id string) error {
+  _, err := c.srv.Files.Update(id, &drive.File{ Trashed: true }).SupportsAllDrives(true).Context(ctx).Do()
+  return err
+}
+
+func (c *serviceClient) ListRevisions(ctx context.Context, id string) ([]*Revision, error) {
+  var revisions []*Revision
+  err := c.srv.Revisions.List(id).Fields("nextPageToken, revisions(id, md5Checksum, modifiedTime, size, keepForever)").
+    Pages(ctx, func(r *drive.RevisionList) error {
+      for _, rev := range r.Revisions {
+        revisions = append(revisions, &Revision{ Id: rev.Id, Md5Checksum: rev.Md5Checksum, ModifiedTime: rev.ModifiedTime,
+          Size: rev.Size, KeepForever: rev.KeepForever })
+      }
+      return nil
+    })
+  return revisions, err
+}
+
+func (c *serviceClient) DownloadRevision(ctx context.Context, id, revisionId string) (io.ReadCloser, error) {
+  resp, err := c.srv.Revisions.Get(id, revisionId).Context(ctx).Download()
+  if err != nil {
+    return nil, err
+  }
+  return resp.Body, nil
+}
+
+// find looks up the first file matching a given query, which is not in the trash.
+// If only a trashed file matches, it is restored when restoreTrashed is set,
+// otherwise nil is returned and the caller creates a new one.
+func (c *serviceClient) find(ctx context.Context, query string, restoreTrashed bool) (*File, error) {
+  r, err := c.list(ctx, query + " and trashed = false")
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve files: %w", err)
+  }
+  if len(r.Files) > 0 {
+    return fromDrive(r.Files[0]), nil
+  }
+
+  r, err = c.list(ctx, query + " and trashed = true")
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve trashed files: %w", err)
+  }
+  if len(r.Files) == 0 {
+    return nil, nil
+  }
+
+  if !restoreTrashed {
+    c.logger.Warn("Found matching file in the trash, ignoring it, run with -restore-trashed to restore it instead",
+      "id", r.Files[0].Id)
+    return nil, nil
+  }
+
+  c.logger.Info("Restoring file from the trash", "id", r.Files[0].Id)
+  untrash := drive.File{ Trashed: false, ForceSendFields: []string{ "Trashed" } }
+  f, err := c.srv.Files.Update(r.Files[0].Id, &untrash).Fields(fileFields).SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to restore file from the trash: %w", err)
+  }
+  return fromDrive(f), nil
+}
+
+// list runs a files query, including files on shared drives, or on the shared drive only,
+// if the backups folder is kept there.
+func (c *serviceClient) list(ctx context.Context, query string) (*drive.FileList, error) {
+  return c.listCall(query).Context(ctx).Do()
+}
+
+// listCall prepares listing the files matching a given query, on the shared drive, if any.
+func (c *serviceClient) listCall(query string) *drive.FilesListCall {
+  call := c.srv.Files.List().Fields("nextPageToken, files(" + fileFields + ")").Q(query).
+    SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+  if c.driveId != "" {
+    call = call.Corpora("drive").DriveId(c.driveId)
+  }
+  return call
+}
+
+// listAll lists all files matching a given query, in all pages of the response.
+func (c *serviceClient) listAll(ctx context.Context, call *drive.FilesListCall) ([]*File, error) {
+  var files []*File
+  err := call.Pages(ctx, func(r *drive.FileList) error {
+    for _, f := range r.Files {
+      files = append(files, fromDrive(f))
+    }
+    return nil
+  })
+  return files, err
+}
+
+func (c *serviceClient) ListFolders(ctx context.Context, parentId, name string) ([]*File, error) {
+  query := fmt.Sprintf("mimeType = '%s' and name = '%s' and '%s' in parents and trashed = false", folderMimeType,
+    EscapeQuery(name), EscapeQuery(c.parent(parentId)))
+  folders, err := c.listAll(ctx, c.listCall(query).OrderBy("createdTime"))
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve folders: %w", err)
+  }
+  return folders, nil
+}
+
+func (c *serviceClient) ListChildren(ctx context.Context, folderId string) ([]*File, error) {
+  query := fmt.Sprintf("'%s' in parents", EscapeQuery(folderId))
+  files, err := c.listAll(ctx, c.listCall(query))
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve files: %w", err)
+  }
+  return files, nil
+}
+
+func (c *serviceClient) Move(ctx context.Context, id, fromId, toId string) error {
+  _, err := c.srv.Files.Update(id, &drive.File{}).AddParents(toId).RemoveParents(fromId).Fields("id").
+    SupportsAllDrives(true).Context(ctx).Do()
+  return err
+}
+
+func (c *serviceClient) Rename(ctx context.Context, id, name string) (*File, error) {
+  f, err := c.srv.Files.Update(id, &drive.File{ Name: name }).Fields(fileFields).SupportsAllDrives(true).Context(ctx).Do()
+  if err != nil {
+    return nil, err
+  }
+  return fromDrive(f), nil
+}
+
+// fromDrive converts the metadata returned by the Drive API.
+func fromDrive(f *drive.File) *File {
+  return &File{ Id: f.Id, Name: f.Name, Md5Checksum: f.Md5Checksum, ModifiedTime: f.ModifiedTime, Size: f.Size,
+    Trashed: f.Trashed, AppProperties: f.AppProperties }
+}
+
+func (c *serviceClient) ChangesToken(ctx context.Context) (string, error) {
+  call := c.srv.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx)
+  if c.driveId != "" {
+    call = call.DriveId(c.driveId)
+  }
+  t, err := call.Do()
+  if err != nil {
+    return "", err
+  }
+  return t.StartPageToken, nil
+}
+
+func (c *serviceClient) Changes(ctx context.Context, token, folderId string) ([]*File, string, error) {
+  var files []*File
+  for {
+    call := c.srv.Changes.List(token).Fields("nextPageToken, newStartPageToken, changes(removed, file(" + fileFields + ", parents))").
+      Spaces("drive").SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Context(ctx)
+    if c.driveId != "" {
+      call = call.DriveId(c.driveId)
+    }
+    r, err := call.Do()
+    if err != nil {
+      return nil, "", err
+    }
+    for _, change := range r.Changes {
+      if change.Removed || change.File == nil || change.File.Trashed {
+        continue
+      }
+      for _, parent := range change.File.Parents {
+        if parent == folderId {
+          files = append(files, fromDrive(change.File))
+          break
+        }
+      }
+    }
+    // the last page has the token of the changes to come
+    if r.NewStartPageToken != "" {
+      return files, r.NewStartPageToken, nil
+    }
+    token = r.NextPageToken
+  }
+}
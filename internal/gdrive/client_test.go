@@ -0,0 +1,138 @@
+package gdrive_test
+
+import (
+  "bytes"
+  "context"
+  "io/ioutil"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// TestServiceClient backs up through the Drive API client talking to the emulator: creating, skipping,
+// updating and pruning backups, with uploads in a single request and resumable ones in chunks.
+func TestServiceClient(t *testing.T) {
+  tests := []struct {
+    name      string
+    chunkSize int
+    size      int
+  }{
+    { name: "single request", size: 1000 },
+    { name: "resumable chunks", chunkSize: 256 * 1024, size: 600 * 1024 },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ctx := context.Background()
+      e := gdrivetest.NewEmulator()
+      defer e.Close()
+      srv, err := e.Service(ctx)
+      if err != nil {
+        t.Fatal(err)
+      }
+      logger := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+      opts := &config.Options{ Jobs: 1, WaitTimeout: time.Minute, ChunkSize: tt.chunkSize, Logger: logger }
+      c := gdrive.NewClient(srv, logger)
+      folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+      if err != nil {
+        t.Fatalf("FindBackupsFolder: %v", err)
+      }
+      dir := t.TempDir()
+      jr, err := gdrive.OpenJournal(filepath.Join(dir, "journal.json"))
+      if err != nil {
+        t.Fatal(err)
+      }
+      b := gdrive.New(c, opts, jr, folderId)
+      st := &state.State{}
+      path := filepath.Join(dir, "ring.kdbx")
+
+      sync := func(content string, want engine.Action) engine.Result {
+        t.Helper()
+        if content != "" {
+          gdrivetest.WriteFile(t, path, content)
+        }
+        results := engine.SyncRingFiles(ctx, opts, st, []engine.Backend{ b }, []string{ path })
+        if len(results) != 1 || results[0].Err != nil || results[0].Action != want {
+          t.Fatalf("SyncRingFiles = %+v, want %s", results, want)
+        }
+        if content == "" {
+          return results[0]
+        }
+        if got, err := e.Files.Content(results[0].RemoteId); err != nil || string(got) != content {
+          t.Fatalf("backup has %d bytes, %v, want %d", len(got), err, len(content))
+        }
+        return results[0]
+      }
+      created := sync(strings.Repeat("a", tt.size), engine.ActionCreated)
+      sync("", engine.ActionUnchanged)
+      updated := sync(strings.Repeat("b", tt.size+1), engine.ActionUpdated)
+      if updated.RemoteId != created.RemoteId {
+        t.Errorf("update created backup %s, want %s updated", updated.RemoteId, created.RemoteId)
+      }
+      if len(jr.Entries) != 0 {
+        t.Errorf("journal keeps %d entries of finished uploads", len(jr.Entries))
+      }
+
+      // the backup of a removed database, made on this machine long ago
+      hostname, _ := os.Hostname()
+      orphan, err := e.Files.Create(ctx, folderId, "removed.kdbx", map[string]string{ engine.MetaHostname: hostname },
+        "2020-01-01T00:00:00Z", bytes.NewReader([]byte("orphan")), 0)
+      if err != nil {
+        t.Fatal(err)
+      }
+      orphans, err := engine.FindOrphans(ctx, opts, st, []engine.Backend{ b }, []string{ path })
+      if err != nil || len(orphans) != 1 || orphans[0].Remote.Id != orphan.Id {
+        t.Fatalf("FindOrphans = %d orphans, %v, want %s", len(orphans), err, orphan.Id)
+      }
+      if err := b.Remove(ctx, orphans[0].Remote); err != nil {
+        t.Fatalf("Remove: %v", err)
+      }
+      if f, err := e.Files.Get(ctx, orphan.Id); err != nil || !f.Trashed {
+        t.Errorf("pruned orphan = %+v, %v, want it in the trash", f, err)
+      }
+      if orphans, err := engine.FindOrphans(ctx, opts, st, []engine.Backend{ b }, []string{ path }); err != nil ||
+        len(orphans) != 0 {
+        t.Errorf("FindOrphans after pruning = %d orphans, %v, want none", len(orphans), err)
+      }
+      sync("", engine.ActionUnchanged)
+    })
+  }
+}
+
+// TestServiceClientListVersions lists the backups of the same name in several pages.
+func TestServiceClientListVersions(t *testing.T) {
+  ctx := context.Background()
+  e := gdrivetest.NewEmulator()
+  defer e.Close()
+  e.PageSize = 2
+  srv, err := e.Service(ctx)
+  if err != nil {
+    t.Fatal(err)
+  }
+  folder, err := e.Files.CreateFolder(ctx, "", gdrive.BackupsFolder)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for i := 0; i < 5; i++ {
+    if _, err := e.Files.Create(ctx, folder.Id, "ring.kdbx", nil, "", bytes.NewReader([]byte("version")), 0); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if _, err := e.Files.Create(ctx, folder.Id, "other.kdbx", nil, "", bytes.NewReader([]byte("other")), 0); err != nil {
+    t.Fatal(err)
+  }
+
+  c := gdrive.NewClient(srv, slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+  versions, err := c.ListVersions(ctx, folder.Id, "ring.kdbx")
+  if err != nil || len(versions) != 5 {
+    t.Errorf("ListVersions = %d versions, %v, want 5", len(versions), err)
+  }
+}
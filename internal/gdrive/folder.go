@@ -0,0 +1,184 @@
+package gdrive
+
+import (
+  "context"
+  "fmt"
+  "log/slog"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/tracing"
+)
+
+// BackupsFolder is the default -remote-folder, the folder in the Drive root backups are stored in.
+const BackupsFolder = "automatic_backups"
+
+// folderPath returns the names of the folders of -remote-folder, from the Drive root down.
+func folderPath(opts *config.Options) []string {
+  var names []string
+  for _, name := range strings.Split(opts.RemoteFolder, "/") {
+    if name = strings.TrimSpace(name); name != "" {
+      names = append(names, name)
+    }
+  }
+  if len(names) == 0 {
+    return []string{ BackupsFolder }
+  }
+  return names
+}
+
+// FindBackupsFolder looks up the -remote-folder folder, e.g. automatic_backups in the Drive root
+// or Backups/KeePass/laptop, creating every folder of the path, which does not exist yet.
+// It returns the folder id.
+func FindBackupsFolder(ctx context.Context, c Client, opts *config.Options) (folderId string, err error) {
+  ctx, span := tracing.Tracer.Start(ctx, "folder lookup")
+  defer func() { tracing.EndSpan(span, err) }()
+
+  for _, name := range folderPath(opts) {
+    opts.Log().Debug("Checking for backups folder existence", "folder", name)
+    folders, err := c.ListFolders(ctx, folderId, name)
+    if err != nil {
+      return "", err
+    }
+    var folder *File
+    if len(folders) > 0 {
+      if folder, err = resolveDuplicateFolders(ctx, c, opts, folders); err != nil {
+        return "", err
+      }
+    } else if folder, err = c.FindFolder(ctx, folderId, name, opts.RestoreTrashed); err != nil {
+      return "", err
+    }
+    if folder == nil {
+      opts.Log().Info("Creating backups folder", "folder", name)
+      if folder, err = c.CreateFolder(ctx, folderId, name); err != nil {
+        return "", fmt.Errorf("Unable to create %s folder: %w", name, err)
+      }
+    }
+    folderId = folder.Id
+  }
+  return folderId, nil
+}
+
+// LookupBackupsFolder looks up the -remote-folder folder, without creating anything,
+// taking the oldest one of duplicate folders.
+// It returns the folder id, or "" if any folder of the path does not exist.
+func LookupBackupsFolder(ctx context.Context, c Client, opts *config.Options) (string, error) {
+  folderId := ""
+  for _, name := range folderPath(opts) {
+    folders, err := c.ListFolders(ctx, folderId, name)
+    if err != nil || len(folders) == 0 {
+      return "", err
+    }
+    folderId = folders[0].Id
+  }
+  return folderId, nil
+}
+
+// OpenBackupsFolder looks up the -remote-folder folder like FindBackupsFolder, unless the id
+// remembered in the state from the previous run still names a folder, which is not in the trash.
+// It returns the folder id, which it remembers in the state.
+func OpenBackupsFolder(ctx context.Context, c Client, opts *config.Options, st *state.State) (string, error) {
+  key := folderKey(opts)
+  if id := st.FolderId(key); id != "" {
+    f, err := c.Get(ctx, id)
+    switch {
+    case isNotFound(err):
+      opts.Log().Warn("Backups folder was deleted", "folder", opts.RemoteFolder, "id", id)
+    case err != nil:
+      return "", fmt.Errorf("Unable to retrieve backups folder %s: %w", id, err)
+    case f.Trashed:
+      opts.Log().Warn("Backups folder is in the trash", "folder", opts.RemoteFolder, "id", id)
+    default:
+      return id, nil
+    }
+  }
+  id, err := FindBackupsFolder(ctx, c, opts)
+  if err != nil {
+    return "", err
+  }
+  st.SetFolderId(key, id)
+  return id, nil
+}
+
+// folderKey identifies the -remote-folder folder in the state, on the drive or in the shared folder
+// holding it.
+func folderKey(opts *config.Options) string {
+  key := "drive:" + strings.Join(folderPath(opts), "/")
+  switch {
+  case opts.SharedFolder != "":
+    key = "shared-folder:" + opts.SharedFolder + ":" + key
+  case opts.SharedDrive != "":
+    key = "shared-drive:" + opts.SharedDrive + ":" + key
+  }
+  return key
+}
+
+// resolveDuplicateFolders picks the oldest one of the folders with the same name, e.g. created
+// by the first runs on two machines at the same time, moving the files of the others into it
+// with -merge-duplicate-folders, and trashing the ones left empty.
+// It returns the picked folder.
+func resolveDuplicateFolders(ctx context.Context, c Client, opts *config.Options, folders []*File) (*File, error) {
+  canonical := folders[0]
+  for _, dup := range folders[1:] {
+    logger := opts.Log().With("folder", canonical.Name, "id", canonical.Id, "duplicate_id", dup.Id)
+    if !opts.MergeDuplicates {
+      logger.Warn("Found duplicate backups folder, using the oldest one, run with -merge-duplicate-folders to merge them")
+      continue
+    }
+    if err := mergeFolder(ctx, c, canonical, dup, logger); err != nil {
+      return nil, err
+    }
+  }
+  return canonical, nil
+}
+
+// mergeFolder moves the files of a duplicate folder into the canonical one, except the ones
+// named like files already there, which are left for the user to compare, and moves
+// the duplicate folder to the trash once it is empty. The folder is never deleted permanently,
+// as it may still hold files of the user, which the application is not allowed to see.
+func mergeFolder(ctx context.Context, c Client, canonical, dup *File, logger *slog.Logger) error {
+  existing, err := c.ListChildren(ctx, canonical.Id)
+  if err != nil {
+    return err
+  }
+  names := make(map[string]bool)
+  for _, f := range existing {
+    names[f.Name] = true
+  }
+
+  files, err := c.ListChildren(ctx, dup.Id)
+  if err != nil {
+    return err
+  }
+  left := 0
+  for _, f := range files {
+    if names[f.Name] {
+      logger.Warn("Not moving file of duplicate backups folder, the backups folder has one with the same name",
+        "file", f.Name, "file_id", f.Id)
+      left++
+      continue
+    }
+    if err := c.Move(ctx, f.Id, dup.Id, canonical.Id); err != nil {
+      return fmt.Errorf("Unable to move %s from duplicate backups folder: %w", f.Name, err)
+    }
+    names[f.Name] = true
+    logger.Info("Moved file of duplicate backups folder", "file", f.Name, "file_id", f.Id)
+  }
+  if left > 0 {
+    return nil
+  }
+  if err := c.Trash(ctx, dup.Id); err != nil {
+    return fmt.Errorf("Unable to move duplicate backups folder to the trash: %w", err)
+  }
+  logger.Info("Moved empty duplicate backups folder to the trash")
+  return nil
+}
+
+// queryEscaper escapes the characters with special meaning in Drive query string literals.
+var queryEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// EscapeQuery escapes a value, so it can be put between apostrophes in a Drive query.
+func EscapeQuery(value string) string {
+  return queryEscaper.Replace(value)
+}
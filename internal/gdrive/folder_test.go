@@ -0,0 +1,86 @@
+package gdrive_test
+
+import (
+  "bytes"
+  "context"
+  "io/ioutil"
+  "log/slog"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+func TestFindBackupsFolderMergesDuplicates(t *testing.T) {
+  tests := []struct {
+    name string
+    // files are the names of the files in the duplicate folder, ring.kdbx being in the oldest folder too
+    files []string
+    // trashed is whether the duplicate folder ends up in the trash
+    trashed bool
+  }{
+    { name: "empty duplicate", trashed: true },
+    { name: "files moved", files: []string{ "other.kdbx", "keyfile.key" }, trashed: true },
+    { name: "file named like one in the oldest folder", files: []string{ "other.kdbx", "ring.kdbx" } },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ctx := context.Background()
+      e := gdrivetest.NewEmulator()
+      defer e.Close()
+      srv, err := e.Service(ctx)
+      if err != nil {
+        t.Fatal(err)
+      }
+      logger := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+      opts := &config.Options{ MergeDuplicates: true, Logger: logger }
+
+      oldest, err := e.Files.CreateFolder(ctx, "", gdrive.BackupsFolder)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if _, err := e.Files.Create(ctx, oldest.Id, "ring.kdbx", nil, "", bytes.NewReader([]byte("a")), 0); err != nil {
+        t.Fatal(err)
+      }
+      dup, err := e.Files.CreateFolder(ctx, "", gdrive.BackupsFolder)
+      if err != nil {
+        t.Fatal(err)
+      }
+      for _, name := range tt.files {
+        if _, err := e.Files.Create(ctx, dup.Id, name, nil, "", bytes.NewReader([]byte(name)), 0); err != nil {
+          t.Fatal(err)
+        }
+      }
+
+      folderId, err := gdrive.FindBackupsFolder(ctx, gdrive.NewClient(srv, logger), opts)
+      if err != nil {
+        t.Fatalf("FindBackupsFolder: %v", err)
+      }
+      if folderId != oldest.Id {
+        t.Errorf("FindBackupsFolder = %s, want the oldest folder %s", folderId, oldest.Id)
+      }
+      // the duplicate folder is never deleted, as it may hold files the application cannot see
+      f, err := e.Files.Get(ctx, dup.Id)
+      if err != nil {
+        t.Fatalf("duplicate folder is gone: %v", err)
+      }
+      if f.Trashed != tt.trashed {
+        t.Errorf("duplicate folder trashed = %v, want %v", f.Trashed, tt.trashed)
+      }
+      children, err := e.Files.ListChildren(ctx, oldest.Id)
+      if err != nil {
+        t.Fatal(err)
+      }
+      names := make(map[string]bool)
+      for _, c := range children {
+        names[c.Name] = true
+      }
+      for _, name := range tt.files {
+        if !names[name] {
+          t.Errorf("%s was not moved into the oldest folder", name)
+        }
+      }
+    })
+  }
+}
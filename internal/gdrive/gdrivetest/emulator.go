@@ -0,0 +1,472 @@
+package gdrivetest
+
+import (
+  "context"
+  "crypto/md5"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "mime"
+  "mime/multipart"
+  "net/http"
+  "net/http/httptest"
+  "strconv"
+  "strings"
+  "sync"
+
+  "google.golang.org/api/drive/v3"
+  "google.golang.org/api/option"
+)
+
+// Emulator is an HTTP server implementing the subset of the Drive API v3 the
+// backend uses: listing files by query, getting, downloading, creating, updating,
+// moving, trashing and deleting them, with multipart and resumable uploads. Files are stored in
+// a FakeClient, so they can be inspected and modified directly.
+type Emulator struct {
+  Files *FakeClient
+  // PageSize limits the files listed in every page of a list, 0 to list all of them in one page
+  PageSize int
+
+  server *httptest.Server
+
+  mu      sync.Mutex
+  uploads map[string]*resumableUpload
+  nextId  int
+}
+
+// resumableUpload is an upload session started with uploadType=resumable.
+type resumableUpload struct {
+  fileId   string
+  metadata emulatedFile
+  content  []byte
+}
+
+// folderMimeType is the MIME type Drive gives to folders.
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// emulatedFile is the JSON representation of a file in requests and responses.
+type emulatedFile struct {
+  Id            string            `json:"id,omitempty"`
+  Name          string            `json:"name,omitempty"`
+  MimeType      string            `json:"mimeType,omitempty"`
+  Parents       []string          `json:"parents,omitempty"`
+  Md5Checksum   string            `json:"md5Checksum,omitempty"`
+  ModifiedTime  string            `json:"modifiedTime,omitempty"`
+  Size          int64             `json:"size,omitempty,string"`
+  Trashed       *bool             `json:"trashed,omitempty"`
+  AppProperties map[string]string `json:"appProperties,omitempty"`
+}
+
+// NewEmulator starts an emulator listening on a local port, until Close is called.
+func NewEmulator() *Emulator {
+  e := &Emulator{ Files: NewFakeClient(), uploads: make(map[string]*resumableUpload) }
+  e.server = httptest.NewServer(e)
+  return e
+}
+
+// URL returns the base URL of the emulated Drive API.
+func (e *Emulator) URL() string {
+  return e.server.URL + "/drive/v3/"
+}
+
+// Service returns a Drive service sending all requests to the emulator.
+func (e *Emulator) Service(ctx context.Context) (*drive.Service, error) {
+  return drive.NewService(ctx, option.WithEndpoint(e.URL()), option.WithHTTPClient(e.server.Client()))
+}
+
+// Close shuts the emulator down.
+func (e *Emulator) Close() {
+  e.server.Close()
+}
+
+// ServeHTTP routes a Drive API request.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  path := r.URL.Path
+  upload := strings.HasPrefix(path, "/upload/drive/v3/files")
+  path = strings.TrimPrefix(strings.TrimPrefix(path, "/upload"), "/drive/v3/files")
+  id := strings.TrimPrefix(path, "/")
+  if path != "" && !strings.HasPrefix(path, "/") {
+    emulatorError(w, http.StatusNotFound, "Unknown endpoint "+r.URL.Path)
+    return
+  }
+
+  switch {
+  case upload && r.URL.Query().Get("upload_id") != "":
+    e.continueUpload(w, r)
+  case upload:
+    e.startUpload(w, r, id)
+  case r.Method == http.MethodGet && id == "":
+    e.list(w, r)
+  case r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media":
+    e.download(w, r, id)
+  case r.Method == http.MethodGet:
+    e.get(w, id)
+  case r.Method == http.MethodPost && id == "":
+    e.updateMetadata(w, r, "")
+  case r.Method == http.MethodPatch && id != "":
+    e.updateMetadata(w, r, id)
+  case r.Method == http.MethodDelete && id != "":
+    if err := e.Files.Delete(r.Context(), id); err != nil {
+      emulatorError(w, http.StatusNotFound, err.Error())
+      return
+    }
+    w.WriteHeader(http.StatusNoContent)
+  default:
+    emulatorError(w, http.StatusMethodNotAllowed, "Unsupported request "+r.Method+" "+r.URL.Path)
+  }
+}
+
+// list answers files.list, supporting the conditions of the queries the backend sends.
+func (e *Emulator) list(w http.ResponseWriter, r *http.Request) {
+  match, err := parseQuery(r.URL.Query().Get("q"))
+  if err != nil {
+    emulatorError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  var files []emulatedFile
+  c := e.Files
+  c.mu.Lock()
+  for _, f := range c.sorted() {
+    if match(f) {
+      files = append(files, toEmulated(f))
+    }
+  }
+  c.mu.Unlock()
+
+  // the page token is the index of the first file of the page
+  start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+  if start > len(files) {
+    start = len(files)
+  }
+  page := map[string]interface{}{ "files": files[start:] }
+  if e.PageSize > 0 && len(files)-start > e.PageSize {
+    page["files"] = files[start : start+e.PageSize]
+    page["nextPageToken"] = strconv.Itoa(start + e.PageSize)
+  }
+  writeEmulated(w, page)
+}
+
+func (e *Emulator) get(w http.ResponseWriter, id string) {
+  c := e.Files
+  c.mu.Lock()
+  f, err := c.get(id)
+  var out emulatedFile
+  if err == nil {
+    out = toEmulated(f)
+  }
+  c.mu.Unlock()
+  if err != nil {
+    emulatorError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  writeEmulated(w, out)
+}
+
+func (e *Emulator) download(w http.ResponseWriter, r *http.Request, id string) {
+  content, err := e.Files.Content(id)
+  if err != nil {
+    emulatorError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  w.Header().Set("Content-Type", "application/octet-stream")
+  w.Write(content)
+}
+
+// updateMetadata creates a file without content, e.g. a folder, or updates
+// the name, the trashed flag or the parent of an existing one.
+func (e *Emulator) updateMetadata(w http.ResponseWriter, r *http.Request, id string) {
+  var meta emulatedFile
+  if err := json.NewDecoder(r.Body).Decode(&meta); err != nil && err != io.EOF {
+    emulatorError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  if to := r.URL.Query().Get("addParents"); id != "" && to != "" {
+    if err := e.Files.Move(r.Context(), id, r.URL.Query().Get("removeParents"), to); err != nil {
+      emulatorError(w, http.StatusBadRequest, err.Error())
+      return
+    }
+  }
+  f, err := e.store(id, meta, nil)
+  if err != nil {
+    emulatorError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  writeEmulated(w, f)
+}
+
+// startUpload handles an upload with uploadType=multipart, or starts a resumable one.
+func (e *Emulator) startUpload(w http.ResponseWriter, r *http.Request, id string) {
+  switch r.URL.Query().Get("uploadType") {
+  case "resumable":
+    var meta emulatedFile
+    if err := json.NewDecoder(r.Body).Decode(&meta); err != nil && err != io.EOF {
+      emulatorError(w, http.StatusBadRequest, err.Error())
+      return
+    }
+    e.mu.Lock()
+    e.nextId++
+    uploadId := strconv.Itoa(e.nextId)
+    e.uploads[uploadId] = &resumableUpload{ fileId: id, metadata: meta }
+    e.mu.Unlock()
+
+    q := r.URL.Query()
+    q.Set("upload_id", uploadId)
+    w.Header().Set("Location", e.server.URL+r.URL.Path+"?"+q.Encode())
+    w.WriteHeader(http.StatusOK)
+  case "multipart":
+    meta, content, err := readMultipart(r)
+    if err != nil {
+      emulatorError(w, http.StatusBadRequest, err.Error())
+      return
+    }
+    e.finishUpload(w, id, meta, content)
+  default:
+    content, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+      emulatorError(w, http.StatusBadRequest, err.Error())
+      return
+    }
+    e.finishUpload(w, id, emulatedFile{}, content)
+  }
+}
+
+// continueUpload receives a chunk of a resumable upload, given with its
+// Content-Range, and finishes the upload with the last chunk.
+func (e *Emulator) continueUpload(w http.ResponseWriter, r *http.Request) {
+  uploadId := r.URL.Query().Get("upload_id")
+  e.mu.Lock()
+  u, ok := e.uploads[uploadId]
+  e.mu.Unlock()
+  if !ok {
+    emulatorError(w, http.StatusNotFound, "Unknown upload "+uploadId)
+    return
+  }
+
+  chunk, err := ioutil.ReadAll(r.Body)
+  if err != nil {
+    emulatorError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  // Content-Range is "bytes first-last/total", "bytes */total" or with "*" as total
+  total := -1
+  if cr := r.Header.Get("Content-Range"); cr != "" {
+    if i := strings.LastIndex(cr, "/"); i >= 0 && cr[i+1:] != "*" {
+      if total, err = strconv.Atoi(cr[i+1:]); err != nil {
+        emulatorError(w, http.StatusBadRequest, "Invalid Content-Range "+cr)
+        return
+      }
+    }
+  }
+
+  e.mu.Lock()
+  u.content = append(u.content, chunk...)
+  done := total < 0 && len(chunk) == 0 || total >= 0 && len(u.content) >= total
+  if done {
+    delete(e.uploads, uploadId)
+  }
+  received := len(u.content)
+  e.mu.Unlock()
+
+  if !done {
+    if received > 0 {
+      w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+    }
+    // clients asking not to get a 308, which HTTP clients take for a redirect, get it in a header
+    if r.Header.Get("X-GUploader-No-308") == "yes" {
+      w.Header().Set("X-Http-Status-Code-Override", "308")
+      w.WriteHeader(http.StatusOK)
+      return
+    }
+    w.WriteHeader(http.StatusPermanentRedirect)
+    return
+  }
+  e.finishUpload(w, u.fileId, u.metadata, u.content)
+}
+
+// finishUpload stores the uploaded content as a new file, or a new version of the file with id.
+func (e *Emulator) finishUpload(w http.ResponseWriter, id string, meta emulatedFile, content []byte) {
+  f, err := e.store(id, meta, content)
+  if err != nil {
+    emulatorError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  writeEmulated(w, f)
+}
+
+// store creates a file, when id is empty, or updates the file with id, with the given
+// metadata and content, unless content is nil.
+func (e *Emulator) store(id string, meta emulatedFile, content []byte) (emulatedFile, error) {
+  c := e.Files
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  var f *fakeFile
+  if id == "" {
+    parent := "root"
+    if len(meta.Parents) > 0 {
+      parent = meta.Parents[0]
+    }
+    if parent != "root" {
+      if _, err := c.get(parent); err != nil {
+        return emulatedFile{}, err
+      }
+    }
+    f = c.add(meta.Name, parent)
+    f.folder = meta.MimeType == folderMimeType
+  } else {
+    var err error
+    if f, err = c.get(id); err != nil {
+      return emulatedFile{}, err
+    }
+    if meta.Name != "" {
+      f.Name = meta.Name
+    }
+  }
+  if meta.Trashed != nil {
+    f.Trashed = *meta.Trashed
+  }
+  setProperties(f, meta.AppProperties)
+  if content != nil {
+    sum := md5.Sum(content)
+    c.write(f, content, hex.EncodeToString(sum[:]), int64(len(content)))
+  }
+  setModifiedTime(f, meta.ModifiedTime)
+  return toEmulated(f), nil
+}
+
+// parseQuery parses a files.list query made of conditions joined with "and":
+// name = '...', mimeType = '...', trashed = true or false, and '...' in parents.
+// It returns a predicate matching the files the query selects.
+func parseQuery(q string) (func(f *fakeFile) bool, error) {
+  var conds []func(f *fakeFile) bool
+  rest := strings.TrimSpace(q)
+  for rest != "" {
+    var cond func(f *fakeFile) bool
+    switch {
+    case strings.HasPrefix(rest, "name = '"), strings.HasPrefix(rest, "mimeType = '"):
+      field := rest[:strings.Index(rest, " ")]
+      value, n, err := parseQueryString(rest[strings.Index(rest, "'"):])
+      if err != nil {
+        return nil, err
+      }
+      rest = rest[strings.Index(rest, "'")+n:]
+      if field == "name" {
+        cond = func(f *fakeFile) bool { return f.Name == value }
+      } else {
+        cond = func(f *fakeFile) bool { return f.folder == (value == folderMimeType) }
+      }
+    case strings.HasPrefix(rest, "trashed = true"):
+      rest = rest[len("trashed = true"):]
+      cond = func(f *fakeFile) bool { return f.Trashed }
+    case strings.HasPrefix(rest, "trashed = false"):
+      rest = rest[len("trashed = false"):]
+      cond = func(f *fakeFile) bool { return !f.Trashed }
+    case strings.HasPrefix(rest, "'"):
+      value, n, err := parseQueryString(rest)
+      if err != nil {
+        return nil, err
+      }
+      rest = strings.TrimSpace(rest[n:])
+      if !strings.HasPrefix(rest, "in parents") {
+        return nil, fmt.Errorf("Unsupported query %q", q)
+      }
+      rest = rest[len("in parents"):]
+      cond = func(f *fakeFile) bool { return f.parent == value }
+    default:
+      return nil, fmt.Errorf("Unsupported query %q", q)
+    }
+    conds = append(conds, cond)
+
+    rest = strings.TrimSpace(rest)
+    if rest != "" {
+      if !strings.HasPrefix(rest, "and ") {
+        return nil, fmt.Errorf("Unsupported query %q", q)
+      }
+      rest = strings.TrimSpace(rest[len("and "):])
+    }
+  }
+
+  return func(f *fakeFile) bool {
+    for _, cond := range conds {
+      if !cond(f) {
+        return false
+      }
+    }
+    return true
+  }, nil
+}
+
+// parseQueryString parses a string literal between apostrophes, escaped with EscapeQuery.
+// It returns the value and the length of the literal.
+func parseQueryString(s string) (string, int, error) {
+  var value strings.Builder
+  for i := 1; i < len(s); i++ {
+    switch s[i] {
+    case '\\':
+      if i+1 == len(s) {
+        return "", 0, fmt.Errorf("Unterminated string in query")
+      }
+      i++
+      value.WriteByte(s[i])
+    case '\'':
+      return value.String(), i + 1, nil
+    default:
+      value.WriteByte(s[i])
+    }
+  }
+  return "", 0, fmt.Errorf("Unterminated string in query")
+}
+
+// readMultipart reads the metadata and the content of a multipart upload.
+func readMultipart(r *http.Request) (emulatedFile, []byte, error) {
+  var meta emulatedFile
+  _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+  if err != nil {
+    return meta, nil, err
+  }
+  mr := multipart.NewReader(r.Body, params["boundary"])
+  part, err := mr.NextPart()
+  if err != nil {
+    return meta, nil, err
+  }
+  if err := json.NewDecoder(part).Decode(&meta); err != nil {
+    return meta, nil, err
+  }
+  part, err = mr.NextPart()
+  if err != nil {
+    return meta, nil, err
+  }
+  content, err := ioutil.ReadAll(part)
+  return meta, content, err
+}
+
+// toEmulated returns the JSON representation of a stored file.
+func toEmulated(f *fakeFile) emulatedFile {
+  trashed := f.Trashed
+  out := emulatedFile{ Id: f.Id, Name: f.Name, Parents: []string{ f.parent }, Md5Checksum: f.Md5Checksum,
+    ModifiedTime: f.ModifiedTime, Size: f.Size, Trashed: &trashed, AppProperties: f.AppProperties }
+  if f.folder {
+    out.MimeType = folderMimeType
+  } else {
+    out.MimeType = "application/octet-stream"
+  }
+  return out
+}
+
+// writeEmulated sends a JSON response.
+func writeEmulated(w http.ResponseWriter, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(w).Encode(v)
+}
+
+// emulatorError sends an error response in the format of the Drive API.
+func emulatorError(w http.ResponseWriter, code int, message string) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(code)
+  json.NewEncoder(w).Encode(map[string]interface{}{
+    "error": map[string]interface{}{ "code": code, "message": message },
+  })
+}
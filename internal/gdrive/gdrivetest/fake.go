@@ -0,0 +1,400 @@
+// Package gdrivetest provides an in-memory Drive and a Drive API emulator backed by it, for tests
+// exercising the Drive backend without network access.
+package gdrivetest
+
+import (
+  "bytes"
+  "context"
+  "crypto/md5"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+
+  "google.golang.org/api/googleapi"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+)
+
+// FakeClient implements gdrive.Client in memory, so the sync engine can be exercised
+// without network access. It is safe for concurrent use.
+type FakeClient struct {
+  // Discard makes the client keep only the checksum and size of the content written, not the content,
+  // so uploads of large files are not held in memory. It is set before the first upload.
+  Discard bool
+
+  mu     sync.Mutex
+  files  map[string]*fakeFile
+  nextId int
+
+  // changed holds the ids of the files in the order they were written
+  changed []string
+}
+
+// fakeFile is a file or folder stored by FakeClient.
+type fakeFile struct {
+  gdrive.File
+  parent  string
+  folder  bool
+  content []byte
+
+  // revisions holds every content written, the oldest first
+  revisions []fakeRevision
+}
+
+// fakeRevision is a revision of the content of a file stored by FakeClient.
+type fakeRevision struct {
+  gdrive.Revision
+  content []byte
+}
+
+// NewFakeClient returns an empty in-memory Drive.
+func NewFakeClient() *FakeClient {
+  return &FakeClient{ files: make(map[string]*fakeFile) }
+}
+
+func (c *FakeClient) Trash(ctx context.Context, id string) error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return err
+  }
+  f.Trashed = true
+  return nil
+}
+
+// Content returns the content of a file.
+func (c *FakeClient) Content(id string) ([]byte, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  return append([]byte(nil), f.content...), nil
+}
+
+func (c *FakeClient) FindFolder(ctx context.Context, parentId, name string, restoreTrashed bool) (*gdrive.File, error) {
+  if parentId == "" {
+    parentId = "root"
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  return c.find(func(f *fakeFile) bool { return f.folder && f.parent == parentId && f.Name == name }, restoreTrashed)
+}
+
+func (c *FakeClient) CreateFolder(ctx context.Context, parentId, name string) (*gdrive.File, error) {
+  if parentId == "" {
+    parentId = "root"
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f := c.add(name, parentId)
+  f.folder = true
+  return c.meta(f), nil
+}
+
+func (c *FakeClient) ListFolders(ctx context.Context, parentId, name string) ([]*gdrive.File, error) {
+  if parentId == "" {
+    parentId = "root"
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  var folders []*gdrive.File
+  for _, f := range c.sorted() {
+    if f.folder && !f.Trashed && f.parent == parentId && f.Name == name {
+      folders = append(folders, c.meta(f))
+    }
+  }
+  return folders, nil
+}
+
+func (c *FakeClient) ListChildren(ctx context.Context, folderId string) ([]*gdrive.File, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  var files []*gdrive.File
+  for _, f := range c.sorted() {
+    if f.parent == folderId {
+      files = append(files, c.meta(f))
+    }
+  }
+  return files, nil
+}
+
+func (c *FakeClient) Move(ctx context.Context, id, fromId, toId string) error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return err
+  }
+  if _, err := c.get(toId); err != nil {
+    return err
+  }
+  if f.parent != fromId {
+    return &googleapi.Error{ Code: http.StatusBadRequest, Message: fmt.Sprintf("File %s is not in folder %s.", id, fromId) }
+  }
+  f.parent = toId
+  return nil
+}
+
+func (c *FakeClient) Rename(ctx context.Context, id, name string) (*gdrive.File, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  f.Name = name
+  return c.meta(f), nil
+}
+
+func (c *FakeClient) FindFile(ctx context.Context, folderId, name string, restoreTrashed bool) (*gdrive.File, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  return c.find(func(f *fakeFile) bool { return f.parent == folderId && f.Name == name }, restoreTrashed)
+}
+
+func (c *FakeClient) Get(ctx context.Context, id string) (*gdrive.File, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  return c.meta(f), nil
+}
+
+func (c *FakeClient) Create(ctx context.Context, folderId, name string, props map[string]string, modifiedTime string,
+  media io.Reader, chunkSize int) (*gdrive.File, error) {
+  content, sum, size, err := c.receive(media)
+  if err != nil {
+    return nil, err
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if _, err := c.get(folderId); err != nil {
+    return nil, err
+  }
+  f := c.add(name, folderId)
+  setProperties(f, props)
+  c.write(f, content, sum, size)
+  setModifiedTime(f, modifiedTime)
+  return c.meta(f), nil
+}
+
+func (c *FakeClient) Update(ctx context.Context, id, name string, props map[string]string, modifiedTime string,
+  media io.Reader, chunkSize int) (*gdrive.File, error) {
+  content, sum, size, err := c.receive(media)
+  if err != nil {
+    return nil, err
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  f.Name = name
+  setProperties(f, props)
+  c.write(f, content, sum, size)
+  setModifiedTime(f, modifiedTime)
+  return c.meta(f), nil
+}
+
+func (c *FakeClient) ListVersions(ctx context.Context, folderId, name string) ([]*gdrive.File, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  var files []*gdrive.File
+  for _, f := range c.sorted() {
+    if f.parent == folderId && f.Name == name && !f.Trashed {
+      files = append(files, c.meta(f))
+    }
+  }
+  return files, nil
+}
+
+func (c *FakeClient) Download(ctx context.Context, id string) (io.ReadCloser, error) {
+  content, err := c.Content(id)
+  if err != nil {
+    return nil, err
+  }
+  return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (c *FakeClient) Delete(ctx context.Context, id string) error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if _, err := c.get(id); err != nil {
+    return err
+  }
+  delete(c.files, id)
+  return nil
+}
+
+func (c *FakeClient) ListRevisions(ctx context.Context, id string) ([]*gdrive.Revision, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  revisions := make([]*gdrive.Revision, len(f.revisions))
+  for i := range f.revisions {
+    rev := f.revisions[i].Revision
+    revisions[i] = &rev
+  }
+  return revisions, nil
+}
+
+func (c *FakeClient) DownloadRevision(ctx context.Context, id, revisionId string) (io.ReadCloser, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  f, err := c.get(id)
+  if err != nil {
+    return nil, err
+  }
+  for _, rev := range f.revisions {
+    if rev.Id == revisionId {
+      return ioutil.NopCloser(bytes.NewReader(rev.content)), nil
+    }
+  }
+  return nil, &googleapi.Error{ Code: http.StatusNotFound, Message: fmt.Sprintf("Revision not found: %s.", revisionId) }
+}
+
+func (c *FakeClient) ChangesToken(ctx context.Context) (string, error) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  return strconv.Itoa(len(c.changed)), nil
+}
+
+func (c *FakeClient) Changes(ctx context.Context, token, folderId string) ([]*gdrive.File, string, error) {
+  start, err := strconv.Atoi(token)
+  if err != nil {
+    return nil, "", &googleapi.Error{ Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid page token: %s.", token) }
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  var files []*gdrive.File
+  seen := make(map[string]bool)
+  for _, id := range c.changed[start:] {
+    f, ok := c.files[id]
+    if !ok || seen[id] || f.Trashed || f.parent != folderId {
+      continue
+    }
+    seen[id] = true
+    files = append(files, c.meta(f))
+  }
+  return files, strconv.Itoa(len(c.changed)), nil
+}
+
+// get returns a file by id, failing the way the Drive API does for a missing one.
+func (c *FakeClient) get(id string) (*fakeFile, error) {
+  f, ok := c.files[id]
+  if !ok {
+    return nil, &googleapi.Error{ Code: http.StatusNotFound, Message: fmt.Sprintf("File not found: %s.", id) }
+  }
+  return f, nil
+}
+
+// add stores a new empty file in a given folder.
+func (c *FakeClient) add(name, parent string) *fakeFile {
+  c.nextId++
+  f := &fakeFile{ File: gdrive.File{ Id: "fake" + strconv.Itoa(c.nextId), Name: name }, parent: parent }
+  f.ModifiedTime = time.Now().UTC().Format(time.RFC3339)
+  c.files[f.Id] = f
+  return f
+}
+
+// receive reads the content written, unless discarded, with its md5 checksum and size.
+func (c *FakeClient) receive(media io.Reader) ([]byte, string, int64, error) {
+  var content bytes.Buffer
+  w := io.Writer(&content)
+  if c.Discard {
+    w = ioutil.Discard
+  }
+  digest := md5.New()
+  size, err := io.Copy(io.MultiWriter(w, digest), media)
+  return content.Bytes(), hex.EncodeToString(digest.Sum(nil)), size, err
+}
+
+// write replaces the content of a file, updating its checksum, size and modification time.
+func (c *FakeClient) write(f *fakeFile, content []byte, sum string, size int64) {
+  f.content = content
+  f.Md5Checksum = sum
+  f.Size = size
+  f.ModifiedTime = time.Now().UTC().Format(time.RFC3339)
+  c.changed = append(c.changed, f.Id)
+  f.revisions = append(f.revisions, fakeRevision{ Revision: gdrive.Revision{ Id: strconv.Itoa(len(f.revisions) + 1),
+    Md5Checksum: f.Md5Checksum, ModifiedTime: f.ModifiedTime, Size: size }, content: content })
+}
+
+// setModifiedTime replaces the modification time of a file with one given in RFC 3339 format,
+// normalized like Drive, unless it is "".
+func setModifiedTime(f *fakeFile, modifiedTime string) {
+  if t, err := time.Parse(time.RFC3339, modifiedTime); err == nil {
+    f.ModifiedTime = t.UTC().Format(time.RFC3339)
+  }
+}
+
+// find returns the first file matching a given predicate, preferring one not in the trash.
+func (c *FakeClient) find(match func(f *fakeFile) bool, restoreTrashed bool) (*gdrive.File, error) {
+  var trashed *fakeFile
+  for _, f := range c.sorted() {
+    if !match(f) {
+      continue
+    }
+    if !f.Trashed {
+      return c.meta(f), nil
+    }
+    if trashed == nil {
+      trashed = f
+    }
+  }
+  if trashed == nil || !restoreTrashed {
+    return nil, nil
+  }
+  trashed.Trashed = false
+  return c.meta(trashed), nil
+}
+
+// sorted returns all files in the order they were created.
+func (c *FakeClient) sorted() []*fakeFile {
+  files := make([]*fakeFile, 0, len(c.files))
+  for i := 1; i <= c.nextId; i++ {
+    if f, ok := c.files["fake" + strconv.Itoa(i)]; ok {
+      files = append(files, f)
+    }
+  }
+  return files
+}
+
+// meta returns a copy of the metadata of a file, so callers cannot modify the stored one.
+func (c *FakeClient) meta(f *fakeFile) *gdrive.File {
+  m := f.File
+  m.AppProperties = make(map[string]string)
+  for k, v := range f.AppProperties {
+    m.AppProperties[k] = v
+  }
+  return &m
+}
+
+// setProperties adds appProperties to a file, replacing the values of the same keys, like Drive.
+func setProperties(f *fakeFile, props map[string]string) {
+  if len(props) == 0 {
+    return
+  }
+  if f.AppProperties == nil {
+    f.AppProperties = make(map[string]string)
+  }
+  for k, v := range props {
+    f.AppProperties[k] = v
+  }
+}
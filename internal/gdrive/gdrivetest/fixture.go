@@ -0,0 +1,87 @@
+package gdrivetest
+
+import (
+  "context"
+  "io/ioutil"
+  "log/slog"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Fixture is a Drive backend on an in-memory Drive, and a local file to back up to it.
+type Fixture struct {
+  Ctx      context.Context
+  Opts     *config.Options
+  State    *state.State
+  Drive    *FakeClient
+  FolderId string
+  Backend  engine.Backend
+  Path     string
+}
+
+// NewFixture creates the backend and the local file with given content.
+func NewFixture(t testing.TB, content string) *Fixture {
+  t.Helper()
+  ctx := context.Background()
+  opts := &config.Options{ Jobs: 1, WaitTimeout: time.Minute, ChunkSize: 256 * 1024,
+    Logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil)) }
+  c := NewFakeClient()
+  folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+  if err != nil {
+    t.Fatalf("FindBackupsFolder: %v", err)
+  }
+  f := &Fixture{ Ctx: ctx, Opts: opts, State: &state.State{}, Drive: c, FolderId: folderId,
+    Backend: gdrive.New(c, opts, nil, folderId), Path: filepath.Join(t.TempDir(), "ring.kdbx") }
+  f.Write(t, content)
+  return f
+}
+
+// Write replaces the content of the local file, making it newer than before.
+func (f *Fixture) Write(t testing.TB, content string) {
+  t.Helper()
+  WriteFile(t, f.Path, content)
+}
+
+// Sync backs up the local file, failing the test unless there is a single result.
+func (f *Fixture) Sync(t testing.TB) engine.Result {
+  t.Helper()
+  results := engine.SyncRingFiles(f.Ctx, f.Opts, f.State, []engine.Backend{ f.Backend }, []string{ f.Path })
+  if len(results) != 1 {
+    t.Fatalf("SyncRingFiles returned %d results, want 1", len(results))
+  }
+  return results[0]
+}
+
+// Backup returns the content of the backup on Drive.
+func (f *Fixture) Backup(t testing.TB) string {
+  t.Helper()
+  remote, err := f.Backend.Find(f.Ctx, filepath.Base(f.Path), "")
+  if err != nil || remote == nil {
+    t.Fatalf("Find: %v, %v", remote, err)
+  }
+  content, err := f.Drive.Content(remote.Id)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return string(content)
+}
+
+// WriteFile replaces the content of a file, making it newer than before.
+func WriteFile(t testing.TB, path, content string) {
+  t.Helper()
+  if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+    t.Fatal(err)
+  }
+  // the hash is cached by the modification time, which may be coarse
+  modTime := time.Now().Add(time.Duration(len(content)) * time.Minute)
+  if err := os.Chtimes(path, modTime, modTime); err != nil {
+    t.Fatal(err)
+  }
+}
@@ -0,0 +1,103 @@
+package gdrivetest_test
+
+import (
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "runtime"
+  "testing"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+// TestSyncRingFilesStreamsLargeFile backs up a sparse file of several GB, which is streamed
+// from the disk to Drive, and never held in memory.
+func TestSyncRingFilesStreamsLargeFile(t *testing.T) {
+  if testing.Short() {
+    t.Skip("writes a snapshot of several GB")
+  }
+  const size = 3 << 30
+  // the snapshot of the file is taken in the temporary directory
+  t.Setenv("TMPDIR", t.TempDir())
+  f := gdrivetest.NewFixture(t, "ring")
+  f.Drive.Discard = true
+  f.Path = filepath.Join(filepath.Dir(f.Path), "large.kdbx")
+  file, err := os.Create(f.Path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = file.Truncate(size)
+  if closeErr := file.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  runtime.GC()
+  var before, after runtime.MemStats
+  runtime.ReadMemStats(&before)
+  r := f.Sync(t)
+  runtime.ReadMemStats(&after)
+  if r.Err != nil || r.Action != engine.ActionCreated || r.Bytes != size {
+    t.Fatalf("sync = %s of %d bytes, %v, want %s of %d bytes", r.Action, r.Bytes, r.Err, engine.ActionCreated, size)
+  }
+  backup, err := f.Drive.Get(f.Ctx, r.RemoteId)
+  if err != nil || backup.Size != size || backup.Md5Checksum != r.Hash {
+    t.Errorf("backup = %+v, %v, want %d bytes with md5 %s", backup, err, size, r.Hash)
+  }
+  if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+    t.Errorf("backing up %d bytes allocated %d bytes, want at most %d", size, allocated, 64<<20)
+  }
+}
+
+// zeros reads zero bytes forever.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+  for i := range b {
+    b[i] = 0
+  }
+  return len(b), nil
+}
+
+// TestSyncStdinStreamsLargeInput backs up a standard input of several GB, which is spooled to the disk
+// and streamed from there to Drive, and never held in memory.
+func TestSyncStdinStreamsLargeInput(t *testing.T) {
+  if testing.Short() {
+    t.Skip("spools a standard input of several GB")
+  }
+  const size = 2 << 30
+  // the standard input is spooled in the state directory
+  home := t.TempDir()
+  t.Setenv("HOME", home)
+  t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+  f := gdrivetest.NewFixture(t, "ring")
+  f.Drive.Discard = true
+
+  runtime.GC()
+  var before, after runtime.MemStats
+  runtime.ReadMemStats(&before)
+  results := engine.SyncStdin(f.Ctx, f.Opts, f.State, []engine.Backend{ f.Backend }, io.LimitReader(zeros{}, size), "large.kdbx")
+  runtime.ReadMemStats(&after)
+  if len(results) != 1 || results[0].Err != nil || results[0].Action != engine.ActionCreated || results[0].Bytes != size {
+    t.Fatalf("SyncStdin = %+v, want %s of %d bytes", results, engine.ActionCreated, size)
+  }
+  backup, err := f.Drive.Get(f.Ctx, results[0].RemoteId)
+  if err != nil || backup.Size != size || backup.Md5Checksum != results[0].Hash {
+    t.Errorf("backup = %+v, %v, want %d bytes with md5 %s", backup, err, size, results[0].Hash)
+  }
+  if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+    t.Errorf("backing up %d bytes allocated %d bytes, want at most %d", size, allocated, 64<<20)
+  }
+  // the spooled input is removed
+  entries, err := ioutil.ReadDir(filepath.Join(home, "state", "keepassx_backup"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, e := range entries {
+    t.Errorf("state directory keeps %s", e.Name())
+  }
+}
@@ -0,0 +1,211 @@
+package gdrive
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "log/slog"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+
+  "google.golang.org/api/googleapi"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+)
+
+// Operations recorded in the journal.
+const (
+  opCreate = "create"
+  opUpdate = "update"
+)
+
+// journalEntry describes a Drive operation which has been started,
+// but not yet confirmed as finished.
+type journalEntry struct {
+  Op        string    `json:"op"`
+  Path      string    `json:"path"`
+  Name      string    `json:"name,omitempty"`
+  FolderId  string    `json:"folder_id"`
+  FileId    string    `json:"file_id,omitempty"`
+  Hash      string    `json:"hash"`
+  StartedAt time.Time `json:"started_at"`
+}
+
+// Journal records operations before they are executed, so after a crash
+// the next run can find out which of them have actually reached Drive.
+type Journal struct {
+  file    string
+  mu      sync.Mutex
+  Entries []journalEntry `json:"entries"`
+}
+
+// JournalCacheFile generates journal file path/filename.
+// It returns the generated journal path/filename.
+func JournalCacheFile() (string, error) {
+  dir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "journal.json"), nil
+}
+
+// OpenJournal reads the journal from a given file path.
+// A missing file results in an empty journal.
+func OpenJournal(file string) (*Journal, error) {
+  j := &Journal{ file: file }
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return j, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  err = json.Unmarshal(b, j)
+  return j, err
+}
+
+// save writes the journal back to its file.
+func (j *Journal) save() error {
+  b, err := json.MarshalIndent(j, "", "  ")
+  if err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(j.file, b, 0600)
+}
+
+// begin records an operation, which is about to be executed, unless the journal is nil.
+func (j *Journal) begin(e journalEntry) error {
+  if j == nil {
+    return nil
+  }
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  e.StartedAt = time.Now()
+  j.Entries = append(j.Entries, e)
+  if err := j.save(); err != nil {
+    return fmt.Errorf("Unable to write journal: %v", err)
+  }
+  return nil
+}
+
+// finish removes the operations on a given file, once they are completed.
+func (j *Journal) finish(path string) error {
+  if j == nil {
+    return nil
+  }
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  entries := j.Entries[:0]
+  for _, e := range j.Entries {
+    if e.Path != path {
+      entries = append(entries, e)
+    }
+  }
+  j.Entries = entries
+  if err := j.save(); err != nil {
+    return fmt.Errorf("Unable to write journal: %v", err)
+  }
+  return nil
+}
+
+// Reconcile checks operations left unfinished by a previous, interrupted run
+// against the content of Drive and clears the journal. Operations, which cannot be
+// checked for now, e.g. without network connectivity, are kept for the next run, and
+// so are the others then, as their files are not backed up again by this run.
+// It returns paths of files, which have to be backed up again.
+func (j *Journal) Reconcile(ctx context.Context, c Client, logger *slog.Logger) ([]string, error) {
+  var retry []string
+  var unchecked, retried []journalEntry
+  var failed error
+  for _, e := range j.Entries {
+    remoteFile, err := journaledFile(ctx, c, e)
+    switch {
+    case err != nil && isTransient(err):
+      logger.Warn("Unable to check interrupted operation on Drive", "op", e.Op, "file", e.Path, "error", err)
+      unchecked = append(unchecked, e)
+      if failed == nil {
+        failed = err
+      }
+    case err != nil:
+      // backing the file up again is safe, when Drive refuses to tell what became of the operation
+      logger.Warn("Unable to check interrupted operation on Drive, retrying", "op", e.Op, "file", e.Path, "error", err)
+      retry, retried = append(retry, e.Path), append(retried, e)
+    case remoteFile != nil && remoteFile.Md5Checksum == e.Hash:
+      logger.Info("Interrupted operation has completed on Drive", "op", e.Op, "file", e.Path, "id", remoteFile.Id)
+    default:
+      logger.Warn("Interrupted operation has not completed on Drive, retrying", "op", e.Op, "file", e.Path)
+      retry, retried = append(retry, e.Path), append(retried, e)
+    }
+  }
+
+  j.Entries = nil
+  if failed != nil {
+    j.Entries = append(unchecked, retried...)
+  }
+  if err := j.save(); err != nil {
+    return nil, fmt.Errorf("Unable to write journal: %v", err)
+  }
+  if failed != nil {
+    return nil, failed
+  }
+  return retry, nil
+}
+
+// isTransient reports whether an error of the Drive API may go away on its own: a network error,
+// a server error, or exceeding a rate limit.
+func isTransient(err error) bool {
+  var apiErr *googleapi.Error
+  if !errors.As(err, &apiErr) {
+    return true
+  }
+  if apiErr.Code == http.StatusForbidden {
+    for _, e := range apiErr.Errors {
+      if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+        return true
+      }
+    }
+  }
+  return apiErr.Code >= 500 || apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusRequestTimeout
+}
+
+// journaledFile retrieves the remote file a journal entry operated on.
+// It returns nil if the file does not exist, e.g. it was deleted or trashed since.
+func journaledFile(ctx context.Context, c Client, e journalEntry) (*File, error) {
+  if e.Op == opUpdate {
+    f, err := c.Get(ctx, e.FileId)
+    switch {
+    case isNotFound(err):
+      return nil, nil
+    case err != nil:
+      return nil, fmt.Errorf("Unable to retrieve file %s: %w", e.FileId, err)
+    case f.Trashed:
+      return nil, nil
+    }
+    return f, nil
+  }
+
+  // entries written before compression was supported have no name
+  name := e.Name
+  if name == "" {
+    name = filepath.Base(e.Path)
+  }
+  files, err := c.ListVersions(ctx, e.FolderId, name)
+  if isNotFound(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  for _, f := range files {
+    if f.Md5Checksum == e.Hash {
+      return f, nil
+    }
+  }
+  return nil, nil
+}
@@ -0,0 +1,208 @@
+package gdrive_test
+
+import (
+  "bytes"
+  "context"
+  "crypto/md5"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "io/ioutil"
+  "log/slog"
+  "net/http"
+  "path/filepath"
+  "reflect"
+  "sort"
+  "testing"
+
+  "google.golang.org/api/googleapi"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+)
+
+// md5Hex returns the md5 hash Drive records for a given content.
+func md5Hex(content string) string {
+  sum := md5.Sum([]byte(content))
+  return hex.EncodeToString(sum[:])
+}
+
+func TestJournalReconcile(t *testing.T) {
+  ctx := context.Background()
+  logger := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+  c := gdrivetest.NewFakeClient()
+  folder, err := c.CreateFolder(ctx, "", gdrive.BackupsFolder)
+  if err != nil {
+    t.Fatal(err)
+  }
+  existing, err := c.Create(ctx, folder.Id, "updated.kdbx", nil, "", bytes.NewReader([]byte("new content")), 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  stale, err := c.Create(ctx, folder.Id, "stale.kdbx", nil, "", bytes.NewReader([]byte("old content")), 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := c.Create(ctx, folder.Id, "created.kdbx", nil, "", bytes.NewReader([]byte("created")), 0); err != nil {
+    t.Fatal(err)
+  }
+  trashed, err := c.Create(ctx, folder.Id, "trashed.kdbx", nil, "", bytes.NewReader([]byte("new content")), 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := c.Trash(ctx, trashed.Id); err != nil {
+    t.Fatal(err)
+  }
+
+  tests := []struct {
+    name  string
+    entry map[string]string
+    retry bool
+  }{
+    { name: "create reached Drive", entry: map[string]string{ "op": "create", "path": "/db/created.kdbx",
+      "name": "created.kdbx", "hash": md5Hex("created") } },
+    { name: "create did not reach Drive", entry: map[string]string{ "op": "create", "path": "/db/lost.kdbx",
+      "name": "lost.kdbx", "hash": md5Hex("lost") }, retry: true },
+    // entries written before compression was supported have no name
+    { name: "create without name", entry: map[string]string{ "op": "create", "path": "/db/created.kdbx",
+      "hash": md5Hex("created") } },
+    { name: "update reached Drive", entry: map[string]string{ "op": "update", "path": "/db/updated.kdbx",
+      "file_id": existing.Id, "hash": md5Hex("new content") } },
+    { name: "update did not reach Drive", entry: map[string]string{ "op": "update", "path": "/db/stale.kdbx",
+      "file_id": stale.Id, "hash": md5Hex("new content") }, retry: true },
+    { name: "updated file was deleted", entry: map[string]string{ "op": "update", "path": "/db/deleted.kdbx",
+      "file_id": "deleted", "hash": md5Hex("new content") }, retry: true },
+    { name: "updated file was trashed", entry: map[string]string{ "op": "update", "path": "/db/trashed.kdbx",
+      "file_id": trashed.Id, "hash": md5Hex("new content") }, retry: true },
+    { name: "backups folder was deleted", entry: map[string]string{ "op": "create", "path": "/db/created.kdbx",
+      "name": "created.kdbx", "hash": md5Hex("created"), "folder_id": "deleted" }, retry: true },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if tt.entry["folder_id"] == "" {
+        tt.entry["folder_id"] = folder.Id
+      }
+      jr, _ := openJournal(t, tt.entry)
+      retry, err := jr.Reconcile(ctx, c, logger)
+      if err != nil {
+        t.Fatalf("Reconcile: %v", err)
+      }
+      var want []string
+      if tt.retry {
+        want = []string{ tt.entry["path"] }
+      }
+      if !reflect.DeepEqual(retry, want) {
+        t.Errorf("Reconcile = %v, want %v", retry, want)
+      }
+      if len(jr.Entries) != 0 {
+        t.Errorf("journal keeps %d entries, want none", len(jr.Entries))
+      }
+    })
+  }
+}
+
+// reopenJournal reads a journal again from a given file.
+func reopenJournal(t *testing.T, file string) *gdrive.Journal {
+  t.Helper()
+  reopened, err := gdrive.OpenJournal(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return reopened
+}
+
+// openJournal writes a journal with given entries to a temporary file and opens it.
+// It returns the journal and its file.
+func openJournal(t *testing.T, entries ...map[string]string) (*gdrive.Journal, string) {
+  t.Helper()
+  file := filepath.Join(t.TempDir(), "journal.json")
+  b, err := json.Marshal(map[string]interface{}{ "entries": entries })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(file, b, 0600); err != nil {
+    t.Fatal(err)
+  }
+  jr, err := gdrive.OpenJournal(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return jr, file
+}
+
+// failingClient fails retrieving the files with given ids with given errors.
+type failingClient struct {
+  *gdrivetest.FakeClient
+  errs map[string]error
+}
+
+func (c *failingClient) Get(ctx context.Context, id string) (*gdrive.File, error) {
+  if err := c.errs[id]; err != nil {
+    return nil, err
+  }
+  return c.FakeClient.Get(ctx, id)
+}
+
+func TestJournalReconcileErrors(t *testing.T) {
+  ctx := context.Background()
+  logger := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+  serverErr := &googleapi.Error{ Code: http.StatusInternalServerError, Message: "Backend Error" }
+  tests := []struct {
+    name string
+    err  error
+    // wantErr is whether reconciling fails, keeping the entries for the next run
+    wantErr bool
+  }{
+    { name: "server error", err: serverErr, wantErr: true },
+    { name: "rate limit", err: &googleapi.Error{ Code: http.StatusForbidden,
+      Errors: []googleapi.ErrorItem{ { Reason: "userRateLimitExceeded" } } }, wantErr: true },
+    { name: "network error", err: errors.New("connection refused"), wantErr: true },
+    // a file the application may not see is backed up again
+    { name: "permission denied", err: &googleapi.Error{ Code: http.StatusForbidden,
+      Errors: []googleapi.ErrorItem{ { Reason: "insufficientFilePermissions" } } } },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      c := &failingClient{ FakeClient: gdrivetest.NewFakeClient(), errs: map[string]error{ "failing": tt.err } }
+      folder, err := c.CreateFolder(ctx, "", gdrive.BackupsFolder)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if _, err := c.Create(ctx, folder.Id, "done.kdbx", nil, "", bytes.NewReader([]byte("done")), 0); err != nil {
+        t.Fatal(err)
+      }
+      jr, file := openJournal(t,
+        map[string]string{ "op": "update", "path": "/db/failing.kdbx", "file_id": "failing", "folder_id": folder.Id,
+          "hash": md5Hex("new") },
+        map[string]string{ "op": "create", "path": "/db/done.kdbx", "name": "done.kdbx", "folder_id": folder.Id,
+          "hash": md5Hex("done") },
+        map[string]string{ "op": "create", "path": "/db/lost.kdbx", "name": "lost.kdbx", "folder_id": folder.Id,
+          "hash": md5Hex("lost") })
+
+      retry, err := jr.Reconcile(ctx, c, logger)
+      if (err != nil) != tt.wantErr {
+        t.Fatalf("Reconcile = %v, %v, want error %v", retry, err, tt.wantErr)
+      }
+      var kept []string
+      reopened := reopenJournal(t, file)
+      for _, e := range reopened.Entries {
+        kept = append(kept, e.Path)
+      }
+      sort.Strings(kept)
+      if tt.wantErr {
+        // the completed operation is cleared, the rest is checked again on the next run
+        if want := []string{ "/db/failing.kdbx", "/db/lost.kdbx" }; !reflect.DeepEqual(kept, want) {
+          t.Errorf("journal keeps %v, want %v", kept, want)
+        }
+        return
+      }
+      sort.Strings(retry)
+      if want := []string{ "/db/failing.kdbx", "/db/lost.kdbx" }; !reflect.DeepEqual(retry, want) {
+        t.Errorf("Reconcile = %v, want %v", retry, want)
+      }
+      if len(kept) != 0 {
+        t.Errorf("journal keeps %v, want none", kept)
+      }
+    })
+  }
+}
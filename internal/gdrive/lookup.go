@@ -0,0 +1,57 @@
+package gdrive
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+
+  "google.golang.org/api/googleapi"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/tracing"
+)
+
+// findRingFile retrieves the remote .kdbx file by the id remembered from the previous sync,
+// falling back to searching the backups folder by name when the id is unknown, or the file
+// has been deleted or trashed in the meantime.
+// It returns nil if the remote file does not exist.
+func findRingFile(ctx context.Context, c Client, opts *config.Options, remoteId, backupsFolderId, ringFileName string) (*File, error) {
+  if remoteId != "" {
+    f, err := c.Get(ctx, remoteId)
+    switch {
+    case isNotFound(err):
+      opts.Log().Warn("Remote .kdbx file was deleted", "file", ringFileName, "id", remoteId)
+    case err != nil:
+      return nil, fmt.Errorf("Unable to retrieve .kdbx file %s: %w", remoteId, err)
+    case f.Trashed:
+      opts.Log().Warn("Remote .kdbx file is in the trash", "file", ringFileName, "id", remoteId)
+    default:
+      return f, nil
+    }
+  }
+
+  return c.FindFile(ctx, backupsFolderId, ringFileName, opts.RestoreTrashed)
+}
+
+// isNotFound reports whether err is a Drive API error caused by a missing file.
+func isNotFound(err error) bool {
+  var apiErr *googleapi.Error
+  return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// verifyChecksum compares the md5 checksum Drive calculated for the uploaded
+// file with the hash of the local snapshot.
+func verifyChecksum(f *File, ringFileHash string) error {
+  if f.Md5Checksum != ringFileHash {
+    return fmt.Errorf("Uploaded .kdbx file is corrupted, id: %s, expected md5 %s, Drive reported %q",
+      f.Id, ringFileHash, f.Md5Checksum)
+  }
+  return nil
+}
+
+// verifyUpload traces verifying the checksum of the uploaded file.
+func verifyUpload(ctx context.Context, f *File, ringFileHash string) error {
+  _, span := tracing.Tracer.Start(ctx, "verify")
+  return tracing.EndSpan(span, verifyChecksum(f, ringFileHash))
+}
@@ -0,0 +1,74 @@
+package gdrive
+
+import (
+  "context"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+)
+
+// Mirror copies the backups in the backups folder of src, e.g. on Drive of the main Google account,
+// to the backups folder of dst on Drive of another account, keeping their metadata and modification
+// times. Backups dst has the same content of are left alone, and backups only dst has are kept,
+// so a backup removed from src by mistake is not lost on dst too.
+// It returns the result of every backup of src, with its name for the path.
+func Mirror(ctx context.Context, opts *config.Options, src, dst *Backend) ([]engine.Result, error) {
+  remotes, err := src.List(ctx)
+  if err != nil {
+    return nil, err
+  }
+  results := make([]engine.Result, len(remotes))
+  engine.Parallel(len(remotes), make(chan struct{}, opts.Jobs), func(i int) {
+    start := time.Now()
+    results[i] = mirrorBackup(ctx, opts, src, dst, remotes[i])
+    results[i].Duration = time.Since(start)
+  })
+  return results, nil
+}
+
+// mirrorBackup copies a backup of src to dst, unless dst has a backup of that name with the same content.
+func mirrorBackup(ctx context.Context, opts *config.Options, src, dst *Backend, remote *engine.RemoteFile) engine.Result {
+  result := engine.Result{ Path: remote.Name, Backend: dst.Name(), Hash: remote.Md5 }
+  logger := opts.Log().With("name", remote.Name, "id", remote.Id)
+  fail := func(err error) engine.Result {
+    logger.Error("Unable to copy backup", "error", err)
+    result.Action, result.Err = engine.ActionFailed, err
+    return result
+  }
+
+  target, err := dst.Find(ctx, remote.Name, "")
+  if err != nil {
+    return fail(err)
+  }
+  if target != nil {
+    result.RemoteId = target.Id
+    if target.Md5 == remote.Md5 {
+      logger.Info("The copy of the backup is up to date")
+      result.Action = engine.ActionUnchanged
+      return result
+    }
+  }
+
+  body, err := src.Download(ctx, remote)
+  if err != nil {
+    return fail(err)
+  }
+  defer body.Close()
+  logger.Info("Copying backup", "bytes", remote.Size)
+  // the path only names the upload in the journal, which copies are not recorded in
+  id, err := dst.Upload(ctx, remote.Name, remote.Name, target, hashing.NewVerifyingReader(body, remote.Md5), remote.Size,
+    remote.Md5, remote.Meta)
+  if err != nil {
+    return fail(err)
+  }
+  logger.Info("Successfully copied backup", "copy", id, "bytes", remote.Size)
+  result.RemoteId, result.Bytes = id, remote.Size
+  if target != nil {
+    result.Action = engine.ActionUpdated
+  } else {
+    result.Action = engine.ActionCreated
+  }
+  return result
+}
@@ -0,0 +1,65 @@
+package gdrive
+
+import (
+  "context"
+  "fmt"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+)
+
+// Quota is the storage quota of the Drive account, which Gmail and Google Photos use too.
+type Quota struct {
+  Usage int64
+
+  // Limit is 0 for unlimited storage
+  Limit int64
+}
+
+// Percent returns the used percentage of the limit, or 0 for unlimited storage.
+func (q *Quota) Percent() float64 {
+  if q.Limit <= 0 {
+    return 0
+  }
+  return float64(q.Usage) * 100 / float64(q.Limit)
+}
+
+// String describes the usage, e.g. 13.2 GiB of 15.0 GiB used (88%).
+func (q *Quota) String() string {
+  if q.Limit <= 0 {
+    return fmt.Sprintf("%s used, unlimited", progress.FormatBytes(q.Usage))
+  }
+  return fmt.Sprintf("%s of %s used (%.0f%%)", progress.FormatBytes(q.Usage), progress.FormatBytes(q.Limit), q.Percent())
+}
+
+// GetQuota retrieves the storage quota of the account srv is authorized for.
+func GetQuota(ctx context.Context, srv *drive.Service) (*Quota, error) {
+  about, err := srv.About.Get().Fields("storageQuota(limit, usage)").Context(ctx).Do()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve storage quota: %w", err)
+  }
+  if about.StorageQuota == nil {
+    return &Quota{}, nil
+  }
+  return &Quota{ Usage: about.StorageQuota.Usage, Limit: about.StorageQuota.Limit }, nil
+}
+
+// WarnQuota warns when the storage of the account is used beyond -quota-warn percent,
+// as uploads fail once it is full. Backups on a shared drive use the storage of the organization,
+// which is not checked.
+func WarnQuota(ctx context.Context, srv *drive.Service, opts *config.Options) {
+  if opts.QuotaWarn <= 0 || opts.SharedDrive != "" {
+    return
+  }
+  q, err := GetQuota(ctx, srv)
+  if err != nil {
+    opts.Log().Debug("Unable to check storage quota", "error", err)
+    return
+  }
+  if q.Percent() >= float64(opts.QuotaWarn) {
+    opts.Log().Warn("Drive storage is almost full, backups fail once it is full", "usage", progress.FormatBytes(q.Usage),
+      "limit", progress.FormatBytes(q.Limit), "percent", int(q.Percent()))
+  }
+}
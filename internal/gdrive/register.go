@@ -0,0 +1,47 @@
+package gdrive
+
+import (
+  "context"
+  "fmt"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+func init() {
+  engine.Register("drive", newFromEnv)
+}
+
+// newFromEnv creates the backend storing backups in the -remote-folder folder,
+// creating the folder if necessary, and reconciles the journal left by the previous run.
+func newFromEnv(ctx context.Context, env *engine.Env) (engine.Backend, error) {
+  c, err := OpenClient(ctx, env.Drive, env.Opts)
+  if err != nil {
+    return nil, err
+  }
+  var folderId string
+  if env.State != nil {
+    folderId, err = OpenBackupsFolder(ctx, c, env.Opts, env.State)
+  } else {
+    folderId, err = FindBackupsFolder(ctx, c, env.Opts)
+  }
+  if err != nil {
+    return nil, err
+  }
+
+  journalFile, err := JournalCacheFile()
+  if err != nil {
+    return nil, fmt.Errorf("Unable to get path to journal file: %w", err)
+  }
+  jr, err := OpenJournal(journalFile)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read journal file: %w", err)
+  }
+  // operations interrupted by a crash are retried, unless they have reached Drive
+  retry, err := jr.Reconcile(ctx, c, env.Opts.Log())
+  if err != nil {
+    return nil, fmt.Errorf("Unable to reconcile journal: %w", err)
+  }
+  env.Retry = append(env.Retry, retry...)
+
+  return New(c, env.Opts, jr, folderId), nil
+}
@@ -0,0 +1,77 @@
+package gdrive
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "strings"
+
+  "google.golang.org/api/drive/v3"
+  "google.golang.org/api/googleapi"
+)
+
+// sharedFolderFields are the fields of the folders looked up by ResolveSharedFolder.
+const sharedFolderFields = "id, name, mimeType, driveId, ownedByMe, owners(displayName, emailAddress), capabilities(canAddChildren)"
+
+// ResolveSharedFolder looks up the folder shared with the user by another account, given by its id,
+// which is the last part of the URL of the folder in the browser, or by its path starting with
+// the name of the shared folder, e.g. Family/KeePass. Folders shared by others are seen with
+// the drive scope only, not with drive.file, and the user has to be an editor of the folder.
+// It returns the id of the folder, and of the shared drive holding it, or "" for My Drive of the owner.
+func ResolveSharedFolder(ctx context.Context, srv *drive.Service, folder string) (string, string, error) {
+  f, err := findSharedFolder(ctx, srv, folder)
+  if err != nil {
+    return "", "", err
+  }
+  owner := "you"
+  if !f.OwnedByMe && len(f.Owners) > 0 {
+    owner = f.Owners[0].EmailAddress
+  }
+  if f.Capabilities != nil && !f.Capabilities.CanAddChildren {
+    return "", "", fmt.Errorf("Folder %s is shared by %s read-only, ask to be made an editor of it", folder, owner)
+  }
+  return f.Id, f.DriveId, nil
+}
+
+// findSharedFolder looks up a shared folder by id, or else by path.
+func findSharedFolder(ctx context.Context, srv *drive.Service, folder string) (*drive.File, error) {
+  if !strings.Contains(folder, "/") {
+    f, err := srv.Files.Get(folder).Fields(sharedFolderFields).SupportsAllDrives(true).Context(ctx).Do()
+    var apiErr *googleapi.Error
+    switch {
+    case err == nil && f.MimeType == folderMimeType:
+      return f, nil
+    case err == nil, errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusBadRequest):
+      // not an id, but the name of a shared folder
+    default:
+      return nil, fmt.Errorf("Unable to find shared folder %s: %w", folder, err)
+    }
+  }
+
+  var f *drive.File
+  for _, name := range strings.Split(folder, "/") {
+    if name = strings.TrimSpace(name); name == "" {
+      continue
+    }
+    query := fmt.Sprintf("mimeType = '%s' and name = '%s' and trashed = false", folderMimeType, EscapeQuery(name))
+    if f == nil {
+      query += " and sharedWithMe"
+    } else {
+      query += fmt.Sprintf(" and '%s' in parents", EscapeQuery(f.Id))
+    }
+    r, err := srv.Files.List().Q(query).Fields("files(" + sharedFolderFields + ")").
+      SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Context(ctx).Do()
+    if err != nil {
+      return nil, fmt.Errorf("Unable to find shared folder %s: %w", folder, err)
+    }
+    if len(r.Files) == 0 {
+      return nil, fmt.Errorf("Shared folder %s not found, there is no folder %s", folder, name)
+    }
+    f = r.Files[0]
+  }
+  if f == nil {
+    return nil, fmt.Errorf("Empty shared folder path %q", folder)
+  }
+  return f, nil
+}
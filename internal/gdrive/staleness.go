@@ -0,0 +1,65 @@
+package gdrive
+
+import (
+  "context"
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/compress"
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// CheckMaxAge checks that the last successful backup of every file is not older
+// than the -max-age option. The time is taken from the local state, or from the
+// modification time of the remote file, when the file was backed up on another machine.
+// It returns the report of the check, with report.ExitStale code if any backup is too old.
+func CheckMaxAge(ctx context.Context, c Client, opts *config.Options, st *state.State, paths []string) *report.Report {
+  var stale []string
+  for _, path := range paths {
+    last, err := lastBackupTime(ctx, c, opts, st, path)
+    if err != nil {
+      return &report.Report{ Code: report.ExitFailure, Message: fmt.Sprintf("Unable to check backup of %s: %v", path, err) }
+    }
+
+    age := time.Since(last)
+    switch {
+    case last.IsZero():
+      opts.Log().Error("File has never been backed up", "file", path)
+      stale = append(stale, fmt.Sprintf("%s: never backed up", path))
+    case age > opts.MaxAge:
+      opts.Log().Error("Last backup is too old", "file", path, "last_backup", last, "age", age.Round(time.Second))
+      stale = append(stale, fmt.Sprintf("%s: last backed up %v ago", path, age.Round(time.Minute)))
+    default:
+      opts.Log().Info("Last backup is recent", "file", path, "last_backup", last, "age", age.Round(time.Second))
+    }
+  }
+
+  if len(stale) > 0 {
+    return &report.Report{ Code: report.ExitStale, Message: "Backups are stale:\n" + strings.Join(stale, "\n") }
+  }
+  return &report.Report{ Code: report.ExitSuccess }
+}
+
+// lastBackupTime returns the time of the last successful backup of a file,
+// or zero time if it has never been backed up.
+func lastBackupTime(ctx context.Context, c Client, opts *config.Options, st *state.State, path string) (time.Time, error) {
+  if fs, ok := st.Files[path]; ok && !fs.LastBackup.IsZero() {
+    return fs.LastBackup, nil
+  }
+
+  // look up existing backups only, the check never creates anything
+  folderId, err := LookupBackupsFolder(ctx, c, opts)
+  if err != nil || folderId == "" {
+    return time.Time{}, err
+  }
+
+  // compressed backups are named like sync names them
+  f, err := c.FindFile(ctx, folderId, compress.BackupName(path, opts.Compress), false)
+  if err != nil || f == nil {
+    return time.Time{}, err
+  }
+  return time.Parse(time.RFC3339, f.ModifiedTime)
+}
@@ -0,0 +1,57 @@
+package gdrive_test
+
+import (
+  "bytes"
+  "context"
+  "io/ioutil"
+  "log/slog"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive/gdrivetest"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// TestCheckMaxAge checks backups made on another machine, which this one has no state of.
+func TestCheckMaxAge(t *testing.T) {
+  recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+  tests := []struct {
+    name     string
+    compress string
+    // backup is the name of the backup on Drive, or "" for none
+    backup   string
+    modified string
+    want     int
+  }{
+    { name: "recent backup", backup: "ring.kdbx", modified: recent, want: report.ExitSuccess },
+    { name: "recent compressed backup", compress: "gzip", backup: "ring.kdbx.gz", modified: recent,
+      want: report.ExitSuccess },
+    { name: "old backup", backup: "ring.kdbx", modified: "2020-01-01T00:00:00Z", want: report.ExitStale },
+    { name: "never backed up", want: report.ExitStale },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ctx := context.Background()
+      opts := &config.Options{ MaxAge: time.Hour, Compress: tt.compress,
+        Logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil)) }
+      c := gdrivetest.NewFakeClient()
+      folder, err := c.CreateFolder(ctx, "", gdrive.BackupsFolder)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if tt.backup != "" {
+        if _, err := c.Create(ctx, folder.Id, tt.backup, nil, tt.modified, bytes.NewReader([]byte("backup")), 0); err != nil {
+          t.Fatal(err)
+        }
+      }
+
+      r := gdrive.CheckMaxAge(ctx, c, opts, &state.State{}, []string{ "/home/sampleuser/ring.kdbx" })
+      if r.Code != tt.want {
+        t.Errorf("CheckMaxAge = %d %q, want %d", r.Code, r.Message, tt.want)
+      }
+    })
+  }
+}
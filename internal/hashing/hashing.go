@@ -0,0 +1,83 @@
+// Package hashing hashes and snapshots local files.
+package hashing
+
+import (
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "io"
+  "io/ioutil"
+  "os"
+)
+
+// FileHash calculates the md5 hash of the file at the given path.
+// It returns the hex encoded hash and any read error encountered.
+func FileHash(path string) (string, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return "", err
+  }
+  defer f.Close()
+
+  digest := md5.New()
+  if _, err := io.Copy(digest, f); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// SnapshotFile copies the file at the given path into a private temporary
+// file, so the upload never reads a database KeePassX is saving at the moment.
+// It returns the opened snapshot, and the md5 and sha256 hashes of its content.
+func SnapshotFile(path string) (*os.File, string, string, error) {
+  src, err := os.Open(path)
+  if err != nil {
+    return nil, "", "", err
+  }
+  defer src.Close()
+
+  snapshot, _, hash, hash256, err := SnapshotReader(src, "")
+  return snapshot, hash, hash256, err
+}
+
+// SnapshotReader copies the content read from r into a private temporary file in a given directory,
+// or in the temporary directory if "", e.g. to spool the standard input.
+// It returns the opened snapshot, its size, and the md5 and sha256 hashes of its content.
+func SnapshotReader(r io.Reader, dir string) (*os.File, int64, string, string, error) {
+  snapshot, err := ioutil.TempFile(dir, "keepassx_backup_")
+  if err != nil {
+    return nil, 0, "", "", err
+  }
+
+  digest, digest256 := md5.New(), sha256.New()
+  size, err := io.Copy(io.MultiWriter(snapshot, digest, digest256), r)
+  if err == nil {
+    _, err = snapshot.Seek(0, 0)
+  }
+  if err != nil {
+    RemoveSnapshot(snapshot)
+    return nil, 0, "", "", err
+  }
+  return snapshot, size, hex.EncodeToString(digest.Sum(nil)), hex.EncodeToString(digest256.Sum(nil)), nil
+}
+
+// RemoveSnapshot closes and deletes the temporary file created by SnapshotFile.
+func RemoveSnapshot(snapshot *os.File) {
+  snapshot.Close()
+  os.Remove(snapshot.Name())
+}
+
+// SameVersion reports whether two results of stat describe the same version of a file,
+// which has neither been written to nor replaced in between.
+func SameVersion(a, b os.FileInfo) bool {
+  return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// IsModified reports whether the file at the given path is no longer the version described by before.
+func IsModified(path string, before os.FileInfo) (bool, error) {
+  after, err := os.Stat(path)
+  if err != nil {
+    return false, err
+  }
+  return !SameVersion(before, after), nil
+}
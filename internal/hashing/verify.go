@@ -0,0 +1,35 @@
+package hashing
+
+import (
+  "crypto/md5"
+  "encoding/hex"
+  "fmt"
+  "hash"
+  "io"
+)
+
+// verifyingReader hashes the data read from a snapshot, and fails at the end of it
+// when the hash differs, so a corrupted temporary file is never stored as a backup.
+type verifyingReader struct {
+  r        io.Reader
+  hash     hash.Hash
+  expected string
+}
+
+// NewVerifyingReader creates a reader failing at the end of r, unless the md5 hash
+// of the data read from it is expected.
+func NewVerifyingReader(r io.Reader, expected string) io.Reader {
+  return &verifyingReader{ r: r, hash: md5.New(), expected: expected }
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+  n, err := v.r.Read(p)
+  v.hash.Write(p[:n])
+  if err == io.EOF {
+    if streamed := hex.EncodeToString(v.hash.Sum(nil)); streamed != v.expected {
+      return n, fmt.Errorf("Snapshot of .kdbx file changed during upload, expected md5 %s, read %s",
+        v.expected, streamed)
+    }
+  }
+  return n, err
+}
@@ -0,0 +1,81 @@
+package i18n
+
+// de holds the German translations.
+var de = map[string]string{
+  // answers to [Y/n] questions
+  "y": "j",
+  "yes": "ja",
+
+  "Go to the following link in your browser then type the authorization code: \n%v\n": "Öffne den folgenden Link im Browser und gib dann den Autorisierungscode ein: \n%v\n",
+
+  "Password of the databases: ": "Passwort der Datenbanken: ",
+  "Passphrase of the encrypted token file: ": "Passphrase der verschlüsselten Token-Datei: ",
+  "Passphrase of the recovery bundle: ": "Passphrase des Wiederherstellungspakets: ",
+  "Passphrase of the exported setup: ": "Passphrase der exportierten Einrichtung: ",
+
+  "No databases found, which are not backed up yet": "Keine Datenbanken gefunden, die noch nicht gesichert werden",
+  "Back up %s? [Y/n] ": "%s sichern? [J/n] ",
+  "Added %d databases to user %s in %s\n": "%d Datenbanken zum Benutzer %s in %s hinzugefügt\n",
+
+  "FILE\tLAST BACKUP\tFAILURES": "DATEI\tLETZTE SICHERUNG\tFEHLER",
+  "never": "nie",
+  "%d backups queued until network connectivity returns\n": "%d Sicherungen warten auf die Netzwerkverbindung\n",
+  "Drive storage: shared drive, using the storage of the organization": "Drive-Speicher: geteilte Ablage, nutzt den Speicher der Organisation",
+  "Drive storage: %s\n": "Drive-Speicher: %s\n",
+
+  "\nSummary: %d backups, %d created, %d updated, %d unchanged, %d queued, %d failed\n": "\nZusammenfassung: %d Sicherungen, %d erstellt, %d aktualisiert, %d unverändert, %d in der Warteschlange, %d fehlgeschlagen\n",
+  "Uploaded %s in %v\n\n": "%s in %v hochgeladen\n\n",
+  "FILE\tBACKEND\tACTION\tFORMAT\tUPLOADED\tDURATION\tERROR": "DATEI\tZIEL\tAKTION\tFORMAT\tHOCHGELADEN\tDAUER\tFEHLER",
+
+  "Select the backup to restore (up/down, enter to select, q to quit)\n\n": "Wähle die wiederherzustellende Sicherung (hoch/runter, Enter wählt aus, q beendet)\n\n",
+  "Restoring %s, %s\n\nRestore to: %s_\n\n(enter to restore, esc to go back)\n": "Wiederherstellen von %s, %s\n\nWiederherstellen nach: %s_\n\n(Enter stellt wieder her, Esc geht zurück)\n",
+  "Downloading %s": "Herunterladen: %s",
+  " of %s (%d%%)": " von %s (%d%%)",
+  "Unable to restore: %v\n": "Wiederherstellen fehlgeschlagen: %v\n",
+  "Restored %s to %s, verified\n": "%s nach %s wiederhergestellt, geprüft\n",
+  "latest": "neueste",
+  "revision %s": "Revision %s",
+
+  "keepassx_backup_tool dashboard (b back up now, r refresh, q quit)\n\n": "keepassx_backup_tool-Übersicht (b jetzt sichern, r aktualisieren, q beenden)\n\n",
+  "Loading...\n": "Wird geladen...\n",
+  "Daemon: unreachable, %v\n": "Dienst: nicht erreichbar, %v\n",
+  "Daemon: %s\n": "Dienst: %s\n",
+  "\nFiles:\n": "\nDateien:\n",
+  "  none backed up yet\n": "  noch keine gesichert\n",
+  "  %d failures": "  %d Fehler",
+  "  queued until online": "  wartet auf die Verbindung",
+  "%s (%s ago)": "%s (vor %s)",
+  "\nRecent events:\n": "\nLetzte Ereignisse:\n",
+  "  none\n": "  keine\n",
+  "\nUpdated %s\n": "\nAktualisiert um %s\n",
+  "backing up since %s": "sichert seit %s",
+  "next backup at %s": "nächste Sicherung um %s",
+  "last run %s at %s": "letzter Lauf %s um %s",
+  "idle": "untätig",
+  "A backup is running already": "Eine Sicherung läuft bereits",
+  "Unable to start backup: %v": "Sicherung kann nicht gestartet werden: %v",
+  "Backup started": "Sicherung gestartet",
+  "Starting backup...": "Sicherung wird gestartet...",
+  "Setup of %s imported, back up with:\n\n  %s%s\n": "Einrichtung von %s importiert, sichern mit:\n\n  %s%s\n",
+  "  Unable to compare: %v\n": "  Vergleich nicht möglich: %v\n",
+  "  \tLOCAL\tBACKUP": "  \tLOKAL\tSICHERUNG",
+  "size": "Größe",
+  "modified": "geändert",
+  "format": "Format",
+  "machine": "Rechner",
+  "  No backup yet, back up to push the local file": "  Noch keine Sicherung, sichern, um die lokale Datei hochzuladen",
+  "  In sync": "  Synchron",
+  "  The local file looks newer, back up to push it": "  Die lokale Datei scheint neuer, sichern, um sie hochzuladen",
+  "  The backup looks newer, restore to pull it": "  Die Sicherung scheint neuer, wiederherstellen, um sie herunterzuladen",
+  "  Both were changed since the last sync, see -on-conflict": "  Beide wurden seit der letzten Synchronisierung geändert, siehe -on-conflict",
+  "No orphaned backups found": "Keine verwaisten Sicherungen gefunden",
+  "BACKEND\tNAME\tSIZE\tMODIFIED": "BACKEND\tNAME\tGRÖSSE\tGEÄNDERT",
+  "Remove %s from %s? [y/N] ": "%s aus %s entfernen? [j/N] ",
+  "Removed %d orphaned backups\n": "%d verwaiste Sicherungen entfernt\n",
+  "%s looks renamed from %s, rename its backups too? [Y/n] ": "%s wurde anscheinend von %s umbenannt, auch die Sicherungen umbenennen? [J/n] ",
+  "FILE\tHOST\tBACKEND\tVERSION\tTIME\tSIZE\tLOCATION": "DATEI\tHOST\tBACKEND\tVERSION\tZEIT\tGRÖSSE\tORT",
+  "BACKEND\tFILES\tVERSIONS\tSIZE": "BACKEND\tDATEIEN\tVERSIONEN\tGRÖSSE",
+  "total": "gesamt",
+  "FILE\tBACKEND\tVERSION\tTIME\tHOST\tHASH\tSIZE": "DATEI\tBACKEND\tVERSION\tZEIT\tHOST\tHASH\tGRÖSSE",
+  "Cataloged %d backups from the history log": "%d Sicherungen aus dem Verlaufsprotokoll katalogisiert",
+}
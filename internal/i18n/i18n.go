@@ -0,0 +1,74 @@
+// Package i18n translates the messages shown to the user, like prompts, tables and summaries,
+// but not the logs, using the catalog of the language of -lang, or of the locale from the environment.
+// The English messages are the keys of the catalogs, and are shown when there is no translation.
+package i18n
+
+import (
+  "fmt"
+  "os"
+  "strings"
+)
+
+// Languages lists the supported languages.
+var Languages = []string{ "en", "de", "pl" }
+
+// catalogs holds the translations of the English messages, by language.
+var catalogs = map[string]map[string]string{
+  "de": de,
+  "pl": pl,
+}
+
+// catalog holds the translations of the selected language, nil for English.
+var catalog map[string]string
+
+// Setup selects the language of the messages: a given one, or without it the one of the locale
+// in $LC_ALL, $LC_MESSAGES or $LANG, which falls back to English if it is not supported.
+// It is not safe to call while messages are translated.
+func Setup(lang string) error {
+  if lang == "" {
+    for _, env := range []string{ "LC_ALL", "LC_MESSAGES", "LANG" } {
+      if locale := os.Getenv(env); locale != "" {
+        catalog = catalogs[language(locale)]
+        return nil
+      }
+    }
+    return nil
+  }
+  if lang = language(lang); lang != "en" && catalogs[lang] == nil {
+    return fmt.Errorf("Unknown language %q, expected %s", lang, strings.Join(Languages, ", "))
+  }
+  catalog = catalogs[lang]
+  return nil
+}
+
+// language returns the language of a locale like pl_PL.UTF-8, which is English for C and POSIX.
+func language(locale string) string {
+  if i := strings.IndexAny(locale, "_-.@"); i >= 0 {
+    locale = locale[:i]
+  }
+  locale = strings.ToLower(locale)
+  if locale == "c" || locale == "posix" {
+    return "en"
+  }
+  return locale
+}
+
+// T translates a message.
+func T(msg string) string {
+  if translated, ok := catalog[msg]; ok {
+    return translated
+  }
+  return msg
+}
+
+// Sprintf formats the translation of a format string.
+func Sprintf(format string, args ...interface{}) string {
+  return fmt.Sprintf(T(format), args...)
+}
+
+// IsYes reports whether an answer to a [Y/n] question is yes, in English or in the selected language,
+// which an empty answer is too.
+func IsYes(answer string) bool {
+  answer = strings.ToLower(strings.TrimSpace(answer))
+  return answer == "" || answer == "y" || answer == "yes" || answer == T("y") || answer == T("yes")
+}
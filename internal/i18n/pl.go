@@ -0,0 +1,81 @@
+package i18n
+
+// pl holds the Polish translations.
+var pl = map[string]string{
+  // answers to [Y/n] questions
+  "y": "t",
+  "yes": "tak",
+
+  "Go to the following link in your browser then type the authorization code: \n%v\n": "Otwórz poniższy link w przeglądarce, a następnie wpisz kod autoryzacji: \n%v\n",
+
+  "Password of the databases: ": "Hasło baz danych: ",
+  "Passphrase of the encrypted token file: ": "Hasło zaszyfrowanego pliku tokenu: ",
+  "Passphrase of the recovery bundle: ": "Hasło pakietu odzyskiwania: ",
+  "Passphrase of the exported setup: ": "Hasło wyeksportowanej konfiguracji: ",
+
+  "No databases found, which are not backed up yet": "Nie znaleziono baz danych, które nie mają jeszcze kopii zapasowej",
+  "Back up %s? [Y/n] ": "Tworzyć kopię zapasową %s? [T/n] ",
+  "Added %d databases to user %s in %s\n": "Dodano bazy danych (%d) do użytkownika %s w %s\n",
+
+  "FILE\tLAST BACKUP\tFAILURES": "PLIK\tOSTATNIA KOPIA\tBŁĘDY",
+  "never": "nigdy",
+  "%d backups queued until network connectivity returns\n": "Kopie w kolejce do czasu przywrócenia połączenia z siecią: %d\n",
+  "Drive storage: shared drive, using the storage of the organization": "Miejsce na Dysku: dysk współdzielony, korzysta z miejsca organizacji",
+  "Drive storage: %s\n": "Miejsce na Dysku: %s\n",
+
+  "\nSummary: %d backups, %d created, %d updated, %d unchanged, %d queued, %d failed\n": "\nPodsumowanie: kopie: %d, utworzone: %d, zaktualizowane: %d, bez zmian: %d, w kolejce: %d, nieudane: %d\n",
+  "Uploaded %s in %v\n\n": "Wysłano %s w %v\n\n",
+  "FILE\tBACKEND\tACTION\tFORMAT\tUPLOADED\tDURATION\tERROR": "PLIK\tMIEJSCE\tAKCJA\tFORMAT\tWYSŁANO\tCZAS\tBŁĄD",
+
+  "Select the backup to restore (up/down, enter to select, q to quit)\n\n": "Wybierz kopię do przywrócenia (góra/dół, enter wybiera, q kończy)\n\n",
+  "Restoring %s, %s\n\nRestore to: %s_\n\n(enter to restore, esc to go back)\n": "Przywracanie %s, %s\n\nPrzywróć do: %s_\n\n(enter przywraca, esc wraca)\n",
+  "Downloading %s": "Pobieranie %s",
+  " of %s (%d%%)": " z %s (%d%%)",
+  "Unable to restore: %v\n": "Nie można przywrócić: %v\n",
+  "Restored %s to %s, verified\n": "Przywrócono %s do %s, zweryfikowano\n",
+  "latest": "najnowsza",
+  "revision %s": "wersja %s",
+
+  "keepassx_backup_tool dashboard (b back up now, r refresh, q quit)\n\n": "Panel keepassx_backup_tool (b tworzy kopię teraz, r odświeża, q kończy)\n\n",
+  "Loading...\n": "Wczytywanie...\n",
+  "Daemon: unreachable, %v\n": "Usługa: nieosiągalna, %v\n",
+  "Daemon: %s\n": "Usługa: %s\n",
+  "\nFiles:\n": "\nPliki:\n",
+  "  none backed up yet\n": "  brak kopii\n",
+  "  %d failures": "  błędy: %d",
+  "  queued until online": "  w kolejce do czasu połączenia",
+  "%s (%s ago)": "%s (%s temu)",
+  "\nRecent events:\n": "\nOstatnie zdarzenia:\n",
+  "  none\n": "  brak\n",
+  "\nUpdated %s\n": "\nZaktualizowano %s\n",
+  "backing up since %s": "kopia w toku od %s",
+  "next backup at %s": "następna kopia o %s",
+  "last run %s at %s": "ostatnie uruchomienie: %s, %s",
+  "idle": "bezczynna",
+  "A backup is running already": "Kopia jest już w toku",
+  "Unable to start backup: %v": "Nie można rozpocząć kopii: %v",
+  "Backup started": "Rozpoczęto kopię",
+  "Starting backup...": "Rozpoczynanie kopii...",
+  "Setup of %s imported, back up with:\n\n  %s%s\n": "Zaimportowano konfigurację z %s, kopia zapasowa poleceniem:\n\n  %s%s\n",
+  "  Unable to compare: %v\n": "  Nie można porównać: %v\n",
+  "  \tLOCAL\tBACKUP": "  \tLOKALNIE\tKOPIA",
+  "size": "rozmiar",
+  "modified": "zmieniono",
+  "format": "format",
+  "machine": "komputer",
+  "  No backup yet, back up to push the local file": "  Brak kopii, wykonaj kopię, aby wysłać plik lokalny",
+  "  In sync": "  Zsynchronizowane",
+  "  The local file looks newer, back up to push it": "  Plik lokalny wygląda na nowszy, wykonaj kopię, aby go wysłać",
+  "  The backup looks newer, restore to pull it": "  Kopia wygląda na nowszą, przywróć ją, aby ją pobrać",
+  "  Both were changed since the last sync, see -on-conflict": "  Oba zmieniono od ostatniej synchronizacji, zobacz -on-conflict",
+  "No orphaned backups found": "Nie znaleziono osieroconych kopii",
+  "BACKEND\tNAME\tSIZE\tMODIFIED": "BACKEND\tNAZWA\tROZMIAR\tZMIENIONO",
+  "Remove %s from %s? [y/N] ": "Usunąć %s z %s? [t/N] ",
+  "Removed %d orphaned backups\n": "Usunięto osierocone kopie: %d\n",
+  "%s looks renamed from %s, rename its backups too? [Y/n] ": "%s wygląda na przemianowany z %s, zmienić też nazwy kopii? [T/n] ",
+  "FILE\tHOST\tBACKEND\tVERSION\tTIME\tSIZE\tLOCATION": "PLIK\tHOST\tBACKEND\tWERSJA\tCZAS\tROZMIAR\tPOŁOŻENIE",
+  "BACKEND\tFILES\tVERSIONS\tSIZE": "BACKEND\tPLIKI\tWERSJE\tROZMIAR",
+  "total": "razem",
+  "FILE\tBACKEND\tVERSION\tTIME\tHOST\tHASH\tSIZE": "PLIK\tBACKEND\tWERSJA\tCZAS\tHOST\tHASH\tROZMIAR",
+  "Cataloged %d backups from the history log": "Skatalogowane kopie z dziennika historii: %d",
+}
@@ -0,0 +1,144 @@
+// Package initscript generates the service scripts running the daemon command
+// under systemd, FreeBSD rc.d and OpenRC.
+package initscript
+
+import (
+  "bytes"
+  "fmt"
+  "strings"
+  "text/template"
+)
+
+// Name is the name of the generated services.
+const Name = "keepassx_backup"
+
+// Service describes the daemon the generated scripts run.
+type Service struct {
+  // Exe is the absolute path of the executable
+  Exe string
+
+  // Args are the arguments after the executable, starting with the daemon command
+  Args []string
+
+  // User runs the daemon, so it finds the token and the state of that user
+  User string
+}
+
+// Inits lists the supported init systems.
+var Inits = []string{ "systemd", "rc.d", "openrc" }
+
+var templates = map[string]*template.Template{
+  "systemd": template.Must(template.New("systemd").Parse(`# Install as ~/.config/systemd/user/{{.Name}}.service, then run
+# systemctl --user enable --now {{.Name}}
+[Unit]
+Description=KeePassX backup daemon
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+WatchdogSec=5min
+ExecStart={{.SystemdCommand}}
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`)),
+
+  "rc.d": template.Must(template.New("rc.d").Parse(`#!/bin/sh
+#
+# PROVIDE: {{.Name}}
+# REQUIRE: LOGIN NETWORKING
+# KEYWORD: shutdown
+#
+# Install as /usr/local/etc/rc.d/{{.Name}}, then add {{.Name}}_enable="YES"
+# to /etc/rc.conf, and optionally {{.Name}}_runas to run the daemon as another user.
+
+. /etc/rc.subr
+
+name="{{.Name}}"
+rcvar="{{.Name}}_enable"
+
+load_rc_config $name
+: ${ {{- .Name}}_enable:="NO"}
+: ${ {{- .Name}}_runas:={{.ShellUser}}}
+
+# daemon(8) restarts the daemon if it exits, and sends its output to syslog
+pidfile="/var/run/${name}.pid"
+command="/usr/sbin/daemon"
+command_args="-r -S -T ${name} -u ${ {{- .Name}}_runas} -P ${pidfile} {{.ShellCommand}}"
+
+run_rc_command "$1"
+`)),
+
+  "openrc": template.Must(template.New("openrc").Parse(`#!/sbin/openrc-run
+# Install as /etc/init.d/{{.Name}}, then run rc-update add {{.Name}} default
+
+name="{{.Name}}"
+description="KeePassX backup daemon"
+command={{.ShellExe}}
+command_args="{{.ShellArgs}}"
+command_user={{.ShellUser}}
+command_background=true
+pidfile="/run/${RC_SVCNAME}.pid"
+output_log="/var/log/${RC_SVCNAME}.log"
+error_log="/var/log/${RC_SVCNAME}.log"
+
+depend() {
+  need net
+  after firewall
+}
+
+start_pre() {
+  checkpath -f -m 0600 -o "$command_user" "$output_log"
+}
+`)),
+}
+
+// Generate writes the script of a given init system running the service.
+func Generate(init string, s *Service) ([]byte, error) {
+  t, ok := templates[init]
+  if !ok {
+    return nil, fmt.Errorf("Unknown init system %q, expected %s", init, strings.Join(Inits, ", "))
+  }
+  var shellArgs []string
+  for _, a := range s.Args {
+    shellArgs = append(shellArgs, ShellQuote(a))
+  }
+  var systemdArgs []string
+  for _, a := range append([]string{ s.Exe }, s.Args...) {
+    systemdArgs = append(systemdArgs, systemdQuote(a))
+  }
+
+  var buf bytes.Buffer
+  err := t.Execute(&buf, map[string]string{
+    "Name":           Name,
+    "ShellExe":       ShellQuote(s.Exe),
+    "ShellUser":      ShellQuote(s.User),
+    "ShellCommand":   doubleQuoted(ShellQuote(s.Exe) + " " + strings.Join(shellArgs, " ")),
+    "ShellArgs":      doubleQuoted(strings.Join(shellArgs, " ")),
+    "SystemdCommand": strings.Join(systemdArgs, " "),
+  })
+  return buf.Bytes(), err
+}
+
+// ShellQuote quotes a word for sh.
+func ShellQuote(s string) string {
+  return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// doubleQuoted escapes quoted words for a double quoted variable, which rc.subr
+// and openrc-run evaluate again when running the command.
+func doubleQuoted(s string) string {
+  return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s)
+}
+
+// systemdQuote quotes a word of a systemd command line, escaping specifiers.
+func systemdQuote(s string) string {
+  s = strings.ReplaceAll(s, "%", "%%")
+  if s != "" && !strings.ContainsAny(s, " \t\"'\\$;") {
+    return s
+  }
+  s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(s)
+  return `"` + s + `"`
+}
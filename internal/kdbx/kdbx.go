@@ -0,0 +1,241 @@
+// Package kdbx reads the unencrypted header of KeePass databases, describing
+// the format version, the cipher and the key derivation function, of KDBX files
+// and of the .kdb files of KeePass 1.x and KeePassX.
+package kdbx
+
+import (
+  "bufio"
+  "encoding/binary"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+)
+
+// Signatures starting every KDBX file, and the second one of KDB files.
+const (
+  signature1    = 0x9AA2D903
+  signature2    = 0xB54BFB67
+  signature2Kdb = 0xB54BFB65
+)
+
+// kdbHeaderSize is the size of the fixed header of KDB files, followed by the
+// contents encrypted in blocks of kdbBlockSize bytes.
+const (
+  kdbHeaderSize = 124
+  kdbBlockSize  = 16
+)
+
+// Flags of KDB files telling the cipher.
+const (
+  kdbFlagRijndael = 2
+  kdbFlagTwofish  = 8
+)
+
+// Header field ids.
+const (
+  fieldEnd           = 0
+  fieldCipherId      = 2
+  fieldKdfParameters = 11
+)
+
+// ErrNotKdbx is returned for files, which are neither KDBX nor KDB databases.
+var ErrNotKdbx = errors.New("not a KDBX file")
+
+// maxFieldSize limits header fields, so a corrupted file is not read into memory.
+const maxFieldSize = 1 << 20
+
+var ciphers = map[string]string{
+  "31c1f2e6bf714350be5805216afc5aff": "AES-256",
+  "d6038a2b8b6f4cb5a524339a31dbb59a": "ChaCha20",
+  "ad68f29f576f4bb9a36ad47af965346c": "Twofish",
+}
+
+var kdfs = map[string]string{
+  "c9d9f39a628a4460bf740d08c18a4fea": "AES-KDF",
+  "7c02bb8279a74ac0927d114a00648238": "AES-KDF",
+  "ef636ddf8c29444b91f7a9a403e30a0c": "Argon2d",
+  "9e298b1956db4773b23dfc3ec6f0a1e6": "Argon2id",
+}
+
+// Header describes a KDBX database.
+type Header struct {
+  // Version is the format version, e.g. 3.1 or 4.0
+  Version string
+
+  // Cipher encrypts the database, e.g. AES-256 or ChaCha20
+  Cipher string
+
+  // KDF derives the key from the master key, e.g. AES-KDF or Argon2d
+  KDF string
+
+  // Legacy is set for the KDB databases of KeePass 1.x, with the 1.x Version
+  Legacy bool
+}
+
+// String describes the header in a single line, e.g. KDBX 4.0, AES-256, Argon2d.
+func (h *Header) String() string {
+  if h.Legacy {
+    return fmt.Sprintf("KDB %s, %s, %s", h.Version, h.Cipher, h.KDF)
+  }
+  return fmt.Sprintf("KDBX %s, %s, %s", h.Version, h.Cipher, h.KDF)
+}
+
+// ReadFile reads the header of the database at a given path.
+func ReadFile(path string) (*Header, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  h, err := Read(bufio.NewReader(f))
+  if err != nil || !h.Legacy {
+    return h, err
+  }
+  // the contents of KDB files are padded to whole cipher blocks
+  info, err := f.Stat()
+  if err != nil {
+    return nil, err
+  }
+  if size := info.Size(); size <= kdbHeaderSize || (size-kdbHeaderSize)%kdbBlockSize != 0 {
+    return nil, fmt.Errorf("KDB file of %d bytes is truncated", size)
+  }
+  return h, nil
+}
+
+// Read reads the header of a database.
+// It returns ErrNotKdbx, if the data does not start with the KDBX or KDB signatures.
+func Read(r io.Reader) (*Header, error) {
+  var start struct {
+    Sig1, Sig2   uint32
+    Minor, Major uint16
+  }
+  if err := binary.Read(r, binary.LittleEndian, &start); err != nil {
+    return nil, ErrNotKdbx
+  }
+  if start.Sig1 == signature1 && start.Sig2 == signature2Kdb {
+    return readKdb(r, uint32(start.Minor)|uint32(start.Major)<<16)
+  }
+  if start.Sig1 != signature1 || start.Sig2 != signature2 {
+    return nil, ErrNotKdbx
+  }
+
+  // KDBX 3 always derives the key with AES-KDF
+  h := &Header{ Version: fmt.Sprintf("%d.%d", start.Major, start.Minor), Cipher: "unknown", KDF: "AES-KDF" }
+  for {
+    id, data, err := readField(r, start.Major >= 4)
+    if err != nil {
+      return nil, fmt.Errorf("Unable to read KDBX header: %v", err)
+    }
+    switch id {
+    case fieldEnd:
+      return h, nil
+    case fieldCipherId:
+      h.Cipher = lookup(ciphers, data)
+    case fieldKdfParameters:
+      h.KDF = lookup(kdfs, kdfUUID(data))
+    }
+  }
+}
+
+// readKdb reads the rest of the fixed header of a KDB file, following the signatures
+// and its flags, read as the KDBX version.
+func readKdb(r io.Reader, flags uint32) (*Header, error) {
+  var rest struct {
+    Version         uint32
+    MasterSeed      [16]byte
+    IV              [16]byte
+    Groups, Entries uint32
+    ContentsHash    [32]byte
+    TransformSeed   [32]byte
+    TransformRounds uint32
+  }
+  if err := binary.Read(r, binary.LittleEndian, &rest); err != nil {
+    return nil, fmt.Errorf("Unable to read KDB header: %v", err)
+  }
+  if rest.Version>>16 != 3 {
+    return nil, fmt.Errorf("Unable to read KDB header: unknown version %#x", rest.Version)
+  }
+  // KDB always derives the key with AES rounds
+  h := &Header{ Version: "1.x", Cipher: "unknown", KDF: "AES-KDF", Legacy: true }
+  switch {
+  case flags&kdbFlagRijndael != 0:
+    h.Cipher = "AES-256"
+  case flags&kdbFlagTwofish != 0:
+    h.Cipher = "Twofish"
+  }
+  return h, nil
+}
+
+// readField reads a header field, which has a 32 bit size in KDBX 4 and a 16 bit one before.
+func readField(r io.Reader, wideSize bool) (byte, []byte, error) {
+  var id [1]byte
+  if _, err := io.ReadFull(r, id[:]); err != nil {
+    return 0, nil, err
+  }
+  var size uint32
+  if wideSize {
+    if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+      return 0, nil, err
+    }
+  } else {
+    var size16 uint16
+    if err := binary.Read(r, binary.LittleEndian, &size16); err != nil {
+      return 0, nil, err
+    }
+    size = uint32(size16)
+  }
+  if size > maxFieldSize {
+    return 0, nil, fmt.Errorf("header field %d of %d bytes is too large", id[0], size)
+  }
+  data := make([]byte, size)
+  if _, err := io.ReadFull(r, data); err != nil {
+    return 0, nil, err
+  }
+  return id[0], data, nil
+}
+
+// kdfUUID finds the $UUID entry in the variant dictionary of the KDF parameters.
+func kdfUUID(dict []byte) []byte {
+  // a version of 2 bytes, then entries of a type byte, the key and the value with 32 bit sizes
+  p := 2
+  for p < len(dict) && dict[p] != 0 {
+    p++
+    key, next, ok := sized(dict, p)
+    if !ok {
+      return nil
+    }
+    value, next, ok := sized(dict, next)
+    if !ok {
+      return nil
+    }
+    if string(key) == "$UUID" {
+      return value
+    }
+    p = next
+  }
+  return nil
+}
+
+// sized returns the slice of a variant dictionary starting with its 32 bit size at p,
+// and the position after it.
+func sized(dict []byte, p int) ([]byte, int, bool) {
+  if p+4 > len(dict) {
+    return nil, 0, false
+  }
+  n := int(binary.LittleEndian.Uint32(dict[p:]))
+  p += 4
+  if n < 0 || p+n > len(dict) {
+    return nil, 0, false
+  }
+  return dict[p : p+n], p + n, true
+}
+
+// lookup names a cipher or KDF by its UUID.
+func lookup(names map[string]string, uuid []byte) string {
+  if name, ok := names[hex.EncodeToString(uuid)]; ok {
+    return name
+  }
+  return "unknown"
+}
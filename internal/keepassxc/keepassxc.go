@@ -0,0 +1,90 @@
+// Package keepassxc runs keepassxc-cli on the backed up databases.
+package keepassxc
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "os"
+  "os/exec"
+  "runtime"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/prompt"
+)
+
+// PasswordEnv is the environment variable holding the password of the databases,
+// which may also be read from the file named by PasswordEnv_FILE, or the descriptor by PasswordEnv_FD.
+const PasswordEnv = config.EnvPrefix + "DB_PASSWORD"
+
+// Password returns the password of the databases from the environment, or asked for on the terminal,
+// or nil.
+func Password() ([]byte, error) {
+  return prompt.EnvSecret(PasswordEnv, "Password of the databases: ")
+}
+
+// path returns the path of keepassxc-cli, which is not in the PATH on macOS.
+func path() string {
+  if p, err := exec.LookPath("keepassxc-cli"); err == nil {
+    return p
+  }
+  if runtime.GOOS == "darwin" {
+    return "/Applications/KeePassXC.app/Contents/MacOS/keepassxc-cli"
+  }
+  return "keepassxc-cli"
+}
+
+// CLI opens the databases with keepassxc-cli.
+type CLI struct {
+  // KeyFile, unless empty, is the key file of the databases
+  KeyFile string
+
+  password []byte
+}
+
+// NewCLI creates the keepassxc-cli runner with the password from Password.
+// Without it, keepassxc-cli asks for the password on the terminal.
+func NewCLI(keyFile string) (*CLI, error) {
+  password, err := Password()
+  if err != nil {
+    return nil, err
+  }
+  return &CLI{ KeyFile: keyFile, password: password }, nil
+}
+
+// Run runs a keepassxc-cli command with given arguments, which end with the databases.
+// It returns the standard output of the command.
+func (c *CLI) Run(ctx context.Context, command string, args ...string) ([]byte, error) {
+  cmdArgs := []string{ command }
+  if c.KeyFile != "" {
+    cmdArgs = append(cmdArgs, "--key-file", c.KeyFile)
+  }
+  cmdArgs = append(cmdArgs, args...)
+  cmd := exec.CommandContext(ctx, path(), cmdArgs...)
+  var stdout, stderr bytes.Buffer
+  cmd.Stdout = &stdout
+  if len(c.password) > 0 {
+    // keepassxc-cli reads the password from the standard input, when it is not a terminal
+    cmd.Stdin = bytes.NewReader(append(append([]byte{}, c.password...), '\n'))
+    cmd.Stderr = &stderr
+  } else {
+    cmd.Stdin = os.Stdin
+    cmd.Stderr = os.Stderr
+  }
+  if err := cmd.Run(); err != nil {
+    if msg := strings.TrimSpace(stderr.String()); msg != "" {
+      return nil, fmt.Errorf("keepassxc-cli %s failed: %v: %s", command, err, msg)
+    }
+    return nil, fmt.Errorf("keepassxc-cli %s failed: %w", command, err)
+  }
+  return stdout.Bytes(), nil
+}
+
+// Merge merges the entries of another database, opened with the same credentials,
+// into a database, using the merge semantics of KeePassXC: the newer version of an entry
+// wins, keeping the older one in its history, and deletions are merged too.
+func (c *CLI) Merge(ctx context.Context, db, other string) error {
+  _, err := c.Run(ctx, "merge", "--same-credentials", db, other)
+  return err
+}
@@ -0,0 +1,281 @@
+package localdir
+
+import (
+  "context"
+  "crypto/md5"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+)
+
+// casManifest lists the versions of a backup stored by a casBackend, oldest first.
+type casManifest struct {
+  Name     string       `json:"name"`
+  Versions []casVersion `json:"versions"`
+}
+
+// casVersion is a single version of a backup, referencing the object with its content.
+type casVersion struct {
+  SHA256 string    `json:"sha256"`
+  MD5    string    `json:"md5"`
+  Size   int64     `json:"size"`
+  Time   time.Time `json:"time"`
+}
+
+// casBackend stores backups in a local directory as objects named by the SHA-256
+// hash of their content, referenced from a manifest of every backup, so identical
+// content backed up by several machines, or unchanged versions, is stored only once.
+type casBackend struct {
+  dir string
+}
+
+func (c *casBackend) Name() string {
+  return "dir"
+}
+
+// manifestPath returns the path of the manifest of a backup with a given name.
+func (c *casBackend) manifestPath(name string) string {
+  return filepath.Join(c.dir, "manifests", name+".json")
+}
+
+// objectPath returns the path of the object with a given SHA-256 hash,
+// spreading objects over subdirectories by the first byte of the hash.
+func (c *casBackend) objectPath(sha string) string {
+  return filepath.Join(c.dir, "objects", sha[:2], sha)
+}
+
+// readManifest reads the manifest of a backup with a given name.
+// It returns nil if the backup does not exist.
+func (c *casBackend) readManifest(name string) (*casManifest, error) {
+  b, err := ioutil.ReadFile(c.manifestPath(name))
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read manifest of %s: %v", name, err)
+  }
+  m := &casManifest{}
+  if err := json.Unmarshal(b, m); err != nil {
+    return nil, fmt.Errorf("Unable to parse manifest of %s: %v", name, err)
+  }
+  if len(m.Versions) == 0 {
+    return nil, nil
+  }
+  return m, nil
+}
+
+func (c *casBackend) Find(ctx context.Context, name, remoteId string) (*engine.RemoteFile, error) {
+  m, err := c.readManifest(name)
+  if err != nil || m == nil {
+    return nil, err
+  }
+  latest := m.Versions[len(m.Versions)-1]
+  return &engine.RemoteFile{ Id: latest.SHA256, Name: name, Md5: latest.MD5, ModTime: latest.Time, Size: latest.Size }, nil
+}
+
+func (c *casBackend) Upload(ctx context.Context, path, name string, remote *engine.RemoteFile, r io.Reader, size int64, hash string,
+  meta map[string]string) (string, error) {
+  objects := filepath.Join(c.dir, "objects")
+  if err := os.MkdirAll(objects, 0700); err != nil {
+    return "", fmt.Errorf("Unable to create objects directory: %v", err)
+  }
+
+  tmp, err := ioutil.TempFile(objects, ".tmp")
+  if err != nil {
+    return "", fmt.Errorf("Unable to create object: %v", err)
+  }
+  defer os.Remove(tmp.Name())
+
+  md5Digest, shaDigest := md5.New(), sha256.New()
+  n, err := io.Copy(io.MultiWriter(tmp, md5Digest, shaDigest), r)
+  if err == nil {
+    err = tmp.Sync()
+  }
+  if closeErr := tmp.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    return "", fmt.Errorf("Unable to write object: %v", err)
+  }
+  if written := hex.EncodeToString(md5Digest.Sum(nil)); written != hash {
+    return "", fmt.Errorf("Backup %s is corrupted, expected md5 %s, wrote %s", name, hash, written)
+  }
+  sha := hex.EncodeToString(shaDigest.Sum(nil))
+
+  // an existing object has the same content already
+  object := c.objectPath(sha)
+  if _, err := os.Stat(object); os.IsNotExist(err) {
+    if err := os.MkdirAll(filepath.Dir(object), 0700); err != nil {
+      return "", fmt.Errorf("Unable to create objects directory: %v", err)
+    }
+    if err := os.Rename(tmp.Name(), object); err != nil {
+      return "", fmt.Errorf("Unable to write object %s: %v", sha, err)
+    }
+  } else if err != nil {
+    return "", fmt.Errorf("Unable to retrieve object %s: %v", sha, err)
+  }
+
+  m, err := c.readManifest(name)
+  if err != nil {
+    return "", err
+  }
+  if m == nil {
+    m = &casManifest{ Name: name }
+  }
+  m.Versions = append(m.Versions, casVersion{ SHA256: sha, MD5: hash, Size: n, Time: time.Now().UTC() })
+  b, err := json.MarshalIndent(m, "", "  ")
+  if err != nil {
+    return "", err
+  }
+  if err := os.MkdirAll(filepath.Dir(c.manifestPath(name)), 0700); err != nil {
+    return "", fmt.Errorf("Unable to create manifests directory: %v", err)
+  }
+  if err := fsutil.WriteFileAtomic(c.manifestPath(name), b, 0600); err != nil {
+    return "", fmt.Errorf("Unable to write manifest of %s: %v", name, err)
+  }
+  return sha, nil
+}
+
+func (c *casBackend) Download(ctx context.Context, remote *engine.RemoteFile) (io.ReadCloser, error) {
+  f, err := os.Open(c.objectPath(remote.Id))
+  if err != nil {
+    return nil, fmt.Errorf("Unable to open object %s: %v", remote.Id, err)
+  }
+  return f, nil
+}
+
+// Rename renames the manifest of a backup, which keeps referencing the objects of all of its versions.
+func (c *casBackend) Rename(ctx context.Context, remote *engine.RemoteFile, name string) (*engine.RemoteFile, error) {
+  m, err := c.readManifest(remote.Name)
+  if err != nil {
+    return nil, err
+  }
+  if m == nil {
+    return nil, fmt.Errorf("No manifest of %s found", remote.Name)
+  }
+  m.Name = name
+  b, err := json.MarshalIndent(m, "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  if err := fsutil.WriteFileAtomic(c.manifestPath(name), b, 0600); err != nil {
+    return nil, fmt.Errorf("Unable to write manifest of %s: %v", name, err)
+  }
+  if err := os.Remove(c.manifestPath(remote.Name)); err != nil {
+    return nil, fmt.Errorf("Unable to delete manifest of %s: %v", remote.Name, err)
+  }
+  renamed := *remote
+  renamed.Name = name
+  return &renamed, nil
+}
+
+// Remove deletes the manifest of a backup, and the objects of its versions,
+// unless other backups reference them too, or an object listed by List.
+func (c *casBackend) Remove(ctx context.Context, remote *engine.RemoteFile) error {
+  if strings.HasPrefix(remote.Name, objectsPrefix) {
+    if err := os.Remove(filepath.Join(c.dir, filepath.FromSlash(remote.Name))); err != nil {
+      return fmt.Errorf("Unable to delete object %s: %v", remote.Name, err)
+    }
+    return nil
+  }
+  m, err := c.readManifest(remote.Name)
+  if err != nil {
+    return err
+  }
+  if err := os.Remove(c.manifestPath(remote.Name)); err != nil {
+    return fmt.Errorf("Unable to delete manifest of %s: %v", remote.Name, err)
+  }
+  if m == nil {
+    return nil
+  }
+
+  referenced, err := c.referencedObjects()
+  if err != nil {
+    return err
+  }
+  for _, v := range m.Versions {
+    if !referenced[v.SHA256] {
+      os.Remove(c.objectPath(v.SHA256))
+    }
+  }
+  return nil
+}
+
+// objectsPrefix starts the names of objects listed by List, which backups are never named like.
+const objectsPrefix = "objects/"
+
+// List lists the backups of the manifests, and the objects no manifest references, e.g. left over
+// by an interrupted upload, named by their path in the backup directory.
+func (c *casBackend) List(ctx context.Context) ([]*engine.RemoteFile, error) {
+  files, err := filepath.Glob(filepath.Join(c.dir, "manifests", "*.json"))
+  if err != nil {
+    return nil, err
+  }
+  var remotes []*engine.RemoteFile
+  for _, f := range files {
+    remote, err := c.Find(ctx, strings.TrimSuffix(filepath.Base(f), ".json"), "")
+    if err != nil {
+      return nil, err
+    }
+    if remote != nil {
+      remotes = append(remotes, remote)
+    }
+  }
+
+  referenced, err := c.referencedObjects()
+  if err != nil {
+    return nil, err
+  }
+  objects := filepath.Join(c.dir, "objects")
+  err = filepath.Walk(objects, func(path string, info os.FileInfo, err error) error {
+    if os.IsNotExist(err) {
+      return nil
+    }
+    if err != nil || info.IsDir() || referenced[info.Name()] {
+      return err
+    }
+    rel, err := filepath.Rel(c.dir, path)
+    if err != nil {
+      return err
+    }
+    remotes = append(remotes, &engine.RemoteFile{ Id: info.Name(), Name: filepath.ToSlash(rel), ModTime: info.ModTime(),
+      Size: info.Size() })
+    return nil
+  })
+  if err != nil {
+    return nil, fmt.Errorf("Unable to list objects: %v", err)
+  }
+  return remotes, nil
+}
+
+// referencedObjects returns the set of objects referenced from any manifest.
+func (c *casBackend) referencedObjects() (map[string]bool, error) {
+  files, err := filepath.Glob(filepath.Join(c.dir, "manifests", "*.json"))
+  if err != nil {
+    return nil, err
+  }
+  referenced := make(map[string]bool)
+  for _, f := range files {
+    m, err := c.readManifest(strings.TrimSuffix(filepath.Base(f), ".json"))
+    if err != nil {
+      return nil, err
+    }
+    if m == nil {
+      continue
+    }
+    for _, v := range m.Versions {
+      referenced[v.SHA256] = true
+    }
+  }
+  return referenced, nil
+}
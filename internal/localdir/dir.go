@@ -0,0 +1,152 @@
+// Package localdir implements the backends storing backups in a local directory.
+package localdir
+
+import (
+  "context"
+  "crypto/md5"
+  "encoding/hex"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+)
+
+// dirBackend stores backups in a local directory, e.g. a mounted NAS share
+// or USB drive, next to a .md5 file with the hash of every backup.
+type dirBackend struct {
+  dir string
+}
+
+// New creates the backend for -backup-dir with the -backup-dir-layout.
+func New(opts *config.Options) engine.Backend {
+  if opts.DirLayout == "cas" {
+    return &casBackend{ dir: opts.BackupDir }
+  }
+  return &dirBackend{ dir: opts.BackupDir }
+}
+
+func (d *dirBackend) Name() string {
+  return "dir"
+}
+
+func (d *dirBackend) Find(ctx context.Context, name, remoteId string) (*engine.RemoteFile, error) {
+  backup := filepath.Join(d.dir, name)
+  info, err := os.Stat(backup)
+  if os.IsNotExist(err) {
+    return nil, nil
+  } else if err != nil {
+    return nil, fmt.Errorf("Unable to retrieve backup %s: %v", backup, err)
+  }
+
+  // the hash file saves reading the backup on every run
+  b, err := ioutil.ReadFile(backup + ".md5")
+  if err == nil {
+    return &engine.RemoteFile{ Id: backup, Name: name, Md5: strings.TrimSpace(string(b)), ModTime: info.ModTime(),
+      Size: info.Size() }, nil
+  }
+  hash, err := hashing.FileHash(backup)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to calculate md5 hash of backup %s: %v", backup, err)
+  }
+  return &engine.RemoteFile{ Id: backup, Name: name, Md5: hash, ModTime: info.ModTime(), Size: info.Size() }, nil
+}
+
+func (d *dirBackend) Upload(ctx context.Context, path, name string, remote *engine.RemoteFile, r io.Reader, size int64, hash string,
+  meta map[string]string) (string, error) {
+  if err := os.MkdirAll(d.dir, 0700); err != nil {
+    return "", fmt.Errorf("Unable to create backup directory: %v", err)
+  }
+  backup := filepath.Join(d.dir, name)
+
+  tmp, err := ioutil.TempFile(d.dir, "."+name+".tmp")
+  if err != nil {
+    return "", fmt.Errorf("Unable to create backup: %v", err)
+  }
+  defer os.Remove(tmp.Name())
+
+  digest := md5.New()
+  _, err = io.Copy(io.MultiWriter(tmp, digest), r)
+  if err == nil {
+    err = tmp.Sync()
+  }
+  if closeErr := tmp.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    return "", fmt.Errorf("Unable to write backup %s: %v", backup, err)
+  }
+  if written := hex.EncodeToString(digest.Sum(nil)); written != hash {
+    return "", fmt.Errorf("Backup %s is corrupted, expected md5 %s, wrote %s", backup, hash, written)
+  }
+
+  if err := os.Rename(tmp.Name(), backup); err != nil {
+    return "", fmt.Errorf("Unable to write backup %s: %v", backup, err)
+  }
+  if err := fsutil.WriteFileAtomic(backup+".md5", []byte(hash+"\n"), 0600); err != nil {
+    return "", fmt.Errorf("Unable to write hash of backup %s: %v", backup, err)
+  }
+  return backup, nil
+}
+
+func (d *dirBackend) Download(ctx context.Context, remote *engine.RemoteFile) (io.ReadCloser, error) {
+  f, err := os.Open(remote.Id)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to open backup %s: %v", remote.Id, err)
+  }
+  return f, nil
+}
+
+// Rename renames a backup, together with its hash file.
+func (d *dirBackend) Rename(ctx context.Context, remote *engine.RemoteFile, name string) (*engine.RemoteFile, error) {
+  backup := filepath.Join(d.dir, name)
+  if err := os.Rename(remote.Id, backup); err != nil {
+    return nil, fmt.Errorf("Unable to rename backup %s: %v", remote.Id, err)
+  }
+  if err := os.Rename(remote.Id+".md5", backup+".md5"); err != nil && !os.IsNotExist(err) {
+    return nil, fmt.Errorf("Unable to rename hash of backup %s: %v", remote.Id, err)
+  }
+  renamed := *remote
+  renamed.Id, renamed.Name = backup, name
+  return &renamed, nil
+}
+
+func (d *dirBackend) Remove(ctx context.Context, remote *engine.RemoteFile) error {
+  if err := os.Remove(remote.Id); err != nil {
+    return fmt.Errorf("Unable to delete backup %s: %v", remote.Id, err)
+  }
+  os.Remove(remote.Id + ".md5")
+  return nil
+}
+
+// List lists the files in the backup directory, except the hash files of the backups.
+func (d *dirBackend) List(ctx context.Context) ([]*engine.RemoteFile, error) {
+  infos, err := ioutil.ReadDir(d.dir)
+  if os.IsNotExist(err) {
+    return nil, nil
+  } else if err != nil {
+    return nil, fmt.Errorf("Unable to list backup directory: %v", err)
+  }
+  var remotes []*engine.RemoteFile
+  for _, info := range infos {
+    name := info.Name()
+    if info.IsDir() {
+      continue
+    }
+    // hash files are removed with their backups, unless left over
+    if strings.HasSuffix(name, ".md5") {
+      if _, err := os.Stat(filepath.Join(d.dir, strings.TrimSuffix(name, ".md5"))); err == nil {
+        continue
+      }
+    }
+    remotes = append(remotes, &engine.RemoteFile{ Id: filepath.Join(d.dir, name), Name: name, ModTime: info.ModTime(),
+      Size: info.Size() })
+  }
+  return remotes, nil
+}
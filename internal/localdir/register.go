@@ -0,0 +1,17 @@
+package localdir
+
+import (
+  "context"
+  "fmt"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+func init() {
+  engine.Register("dir", func(ctx context.Context, env *engine.Env) (engine.Backend, error) {
+    if env.Opts.BackupDir == "" {
+      return nil, fmt.Errorf("The dir backend requires -backup-dir")
+    }
+    return New(env.Opts), nil
+  })
+}
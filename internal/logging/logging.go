@@ -0,0 +1,143 @@
+// Package logging sets up the logger and exits the application.
+package logging
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "log/slog"
+  "os"
+  "strings"
+  "sync"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// Setup installs the default logger, writing messages of the
+// configured level and above to the standard error, the standard output,
+// syslog or journald, as text or JSON lines.
+func Setup(opts *config.Options) error {
+  var level slog.Level
+  if err := level.UnmarshalText([]byte(opts.LogLevel)); err != nil {
+    return fmt.Errorf("invalid log level %q", opts.LogLevel)
+  }
+
+  // containers collect the standard output of the application
+  out := os.Stderr
+  if opts.LogTarget == "stdout" {
+    out = os.Stdout
+  }
+  handlerOpts := &slog.HandlerOptions{ Level: level }
+  var handler slog.Handler
+  switch opts.LogFormat {
+  case "text":
+    handler = slog.NewTextHandler(out, handlerOpts)
+  case "json":
+    handler = slog.NewJSONHandler(out, handlerOpts)
+  default:
+    return fmt.Errorf("invalid log format %q", opts.LogFormat)
+  }
+
+  // syslog and journald record time and priority on their own
+  if opts.LogTarget != "stderr" && opts.LogTarget != "stdout" {
+    emit, err := newLogTarget(opts.LogTarget)
+    if err != nil {
+      return err
+    }
+    handler = newLineHandler(emit, opts.LogFormat, level)
+  }
+
+  slog.SetDefault(slog.New(handler))
+  return nil
+}
+
+// logIdentifier identifies messages of the application in syslog and journald.
+const logIdentifier = "keepassx_backup_tool"
+
+// emitFunc sends a single formatted log line with the given level.
+type emitFunc func(level slog.Level, line string) error
+
+// lineHandler is a slog.Handler formatting every record as a single line,
+// without time and level, and passing it to an emitFunc.
+type lineHandler struct {
+  handler slog.Handler
+  emit    emitFunc
+
+  // shared by handlers derived with WithAttrs and WithGroup
+  mu  *sync.Mutex
+  buf *bytes.Buffer
+}
+
+// newLineHandler creates a lineHandler formatting records as text or json.
+func newLineHandler(emit emitFunc, format string, level slog.Level) *lineHandler {
+  h := &lineHandler{ emit: emit, mu: &sync.Mutex{}, buf: &bytes.Buffer{} }
+  handlerOpts := &slog.HandlerOptions{
+    Level: level,
+    ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+      if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+        return slog.Attr{}
+      }
+      return a
+    },
+  }
+  if format == "json" {
+    h.handler = slog.NewJSONHandler(h.buf, handlerOpts)
+  } else {
+    h.handler = slog.NewTextHandler(h.buf, handlerOpts)
+  }
+  return h
+}
+
+func (h *lineHandler) Enabled(ctx context.Context, level slog.Level) bool {
+  return h.handler.Enabled(ctx, level)
+}
+
+func (h *lineHandler) Handle(ctx context.Context, r slog.Record) error {
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  h.buf.Reset()
+  if err := h.handler.Handle(ctx, r); err != nil {
+    return err
+  }
+  return h.emit(r.Level, strings.TrimSuffix(h.buf.String(), "\n"))
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+  return &lineHandler{ handler: h.handler.WithAttrs(attrs), emit: h.emit, mu: h.mu, buf: h.buf }
+}
+
+func (h *lineHandler) WithGroup(name string) slog.Handler {
+  return &lineHandler{ handler: h.handler.WithGroup(name), emit: h.emit, mu: h.mu, buf: h.buf }
+}
+
+// fatalCode is the exit code of Fatal.
+var fatalCode = report.ExitFailure
+
+// SetFatalCode replaces the exit code of Fatal, for commands giving ExitFailure another meaning.
+func SetFatalCode(code int) {
+  fatalCode = code
+}
+
+// Fatal logs an error message with the given key-value pairs and exits.
+func Fatal(msg string, args ...any) {
+  slog.Error(msg, args...)
+  Exit(&report.Report{ Code: fatalCode, Message: fatalMessage(msg, args...) })
+}
+
+// fatalMessage formats a message with an error from the key-value pairs, if any.
+func fatalMessage(msg string, args ...any) string {
+  for i := 0; i+1 < len(args); i += 2 {
+    if args[i] == "error" {
+      return fmt.Sprintf("%s: %v", msg, args[i+1])
+    }
+  }
+  return msg
+}
+
+// Exit publishes the report of the run and exits with its code.
+func Exit(r *report.Report) {
+  events.Publish(events.RunFinished{ Report: r })
+  os.Exit(r.Code)
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+  "fmt"
+)
+
+// newLogTarget reports that syslog and journald are not available on this platform.
+func newLogTarget(target string) (emitFunc, error) {
+  return nil, fmt.Errorf("log target %q is not supported on this platform", target)
+}
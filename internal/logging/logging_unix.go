@@ -0,0 +1,81 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "log/slog"
+  "log/syslog"
+  "net"
+  "strings"
+)
+
+// journaldSocket is the socket of the journald native protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newLogTarget connects to the syslog or journald log target.
+// It returns the function sending log lines to it.
+func newLogTarget(target string) (emitFunc, error) {
+  switch target {
+  case "syslog":
+    w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, logIdentifier)
+    if err != nil {
+      return nil, fmt.Errorf("unable to connect to syslog: %v", err)
+    }
+    return func(level slog.Level, line string) error {
+      switch {
+      case level >= slog.LevelError:
+        return w.Err(line)
+      case level >= slog.LevelWarn:
+        return w.Warning(line)
+      case level >= slog.LevelInfo:
+        return w.Info(line)
+      default:
+        return w.Debug(line)
+      }
+    }, nil
+
+  case "journald":
+    conn, err := net.Dial("unixgram", journaldSocket)
+    if err != nil {
+      return nil, fmt.Errorf("unable to connect to journald: %v", err)
+    }
+    return func(level slog.Level, line string) error {
+      var msg bytes.Buffer
+      writeJournalField(&msg, "MESSAGE", line)
+      writeJournalField(&msg, "PRIORITY", fmt.Sprint(journalPriority(level)))
+      writeJournalField(&msg, "SYSLOG_IDENTIFIER", logIdentifier)
+      _, err := conn.Write(msg.Bytes())
+      return err
+    }, nil
+  }
+  return nil, fmt.Errorf("invalid log target %q", target)
+}
+
+// journalPriority maps a slog level to a syslog priority, as used by journald.
+func journalPriority(level slog.Level) syslog.Priority {
+  switch {
+  case level >= slog.LevelError:
+    return syslog.LOG_ERR
+  case level >= slog.LevelWarn:
+    return syslog.LOG_WARNING
+  case level >= slog.LevelInfo:
+    return syslog.LOG_INFO
+  default:
+    return syslog.LOG_DEBUG
+  }
+}
+
+// writeJournalField appends a field in the journald native protocol format,
+// using the binary length-prefixed form for values spanning several lines.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+  if !strings.Contains(value, "\n") {
+    fmt.Fprintf(buf, "%s=%s\n", name, value)
+    return
+  }
+  buf.WriteString(name + "\n")
+  binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+  buf.WriteString(value + "\n")
+}
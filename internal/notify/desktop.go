@@ -0,0 +1,60 @@
+package notify
+
+import (
+  "os"
+  "os/exec"
+  "runtime"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// macNotificationScript shows a notification with the title and body taken
+// from the environment, so they never need quoting.
+const macNotificationScript = `display notification (system attribute "KBT_BODY") with title (system attribute "KBT_TITLE")`
+
+// windowsNotificationScript shows a toast notification with the title and body
+// taken from the environment, so they never need quoting.
+const windowsNotificationScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$t.GetElementsByTagName('text')[0].AppendChild($t.CreateTextNode($env:KBT_TITLE)) > $null
+$t.GetElementsByTagName('text')[1].AppendChild($t.CreateTextNode($env:KBT_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('KeePassX Backup Tool').Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
+
+// desktopNotifier shows desktop notifications with notify-send, the macOS
+// notification center or Windows toasts.
+type desktopNotifier struct {
+  statuses map[string]bool
+}
+
+// newDesktopNotifier creates a desktopNotifier for a comma separated list of run statuses.
+func newDesktopNotifier(statuses string) (*desktopNotifier, error) {
+  s, err := parseStatuses(statuses)
+  if err != nil {
+    return nil, err
+  }
+  return &desktopNotifier{ statuses: s }, nil
+}
+
+func (n *desktopNotifier) notify(r *report.Report) error {
+  if !n.statuses[r.Status()] {
+    return nil
+  }
+
+  var cmd *exec.Cmd
+  switch runtime.GOOS {
+  case "darwin":
+    cmd = exec.Command("osascript", "-e", macNotificationScript)
+  case "windows":
+    cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsNotificationScript)
+  default:
+    urgency := "normal"
+    if r.Status() == report.StatusFailure {
+      urgency = "critical"
+    }
+    cmd = exec.Command("notify-send", "-u", urgency, "-a", "KeePassX Backup Tool", r.Title(), r.Text())
+  }
+  cmd.Env = append(os.Environ(), "KBT_TITLE=" + r.Title(), "KBT_BODY=" + r.Text())
+  return cmd.Run()
+}
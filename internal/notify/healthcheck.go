@@ -0,0 +1,56 @@
+package notify
+
+import (
+  "context"
+  "errors"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// healthcheck pings a healthchecks.io compatible check, so missing or
+// failed runs are reported by the monitoring service.
+type healthcheck struct {
+  client *http.Client
+  url    string
+}
+
+// ping sends a ping to the check URL with the given suffix, e.g. /start or /fail,
+// and an optional body, which is shown in the check log. The URL identifies the
+// check, so only its host is logged.
+func (h *healthcheck) ping(suffix, body string) {
+  ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+  defer cancel()
+
+  req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(h.url, "/")+suffix,
+    strings.NewReader(body))
+  if err != nil {
+    slog.Warn("Unable to ping healthcheck, invalid URL")
+    return
+  }
+  resp, err := h.client.Do(req)
+  if err != nil {
+    var urlErr *url.Error
+    if errors.As(err, &urlErr) {
+      err = urlErr.Err
+    }
+    slog.Warn("Unable to ping healthcheck", "host", req.URL.Host, "error", err)
+    return
+  }
+  resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    slog.Warn("Unable to ping healthcheck", "host", req.URL.Host, "status", resp.Status)
+  }
+}
+
+// finish reports the result of the run.
+func (h *healthcheck) finish(r *report.Report) {
+  if r.Status() != report.StatusFailure {
+    h.ping("", r.Text())
+  } else {
+    h.ping("/fail", r.Text())
+  }
+}
@@ -0,0 +1,272 @@
+package notify
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/tls"
+  "encoding/binary"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net"
+  "net/url"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+  "github.com/pawelu/keepassx_backup_tool/internal/transport"
+)
+
+// mqttDefaultTopic is used when the MQTT URL has no path.
+const mqttDefaultTopic = "keepassx_backup"
+
+// mqttStatus is the retained message published after every run.
+type mqttStatus struct {
+  Status     string     `json:"status"`
+  Title      string     `json:"title"`
+  ExitCode   int        `json:"exit_code"`
+  Timestamp  time.Time  `json:"timestamp"`
+  LastBackup *time.Time `json:"last_backup,omitempty"`
+  Files      []mqttFile `json:"files"`
+}
+
+// mqttFile is the status of a single file in the MQTT message.
+type mqttFile struct {
+  Path       string     `json:"path"`
+  Action     engine.Action     `json:"action,omitempty"`
+  LastBackup *time.Time `json:"last_backup,omitempty"`
+  Error      string     `json:"error,omitempty"`
+}
+
+// mqttNotifier publishes the status of every run to an MQTT topic as a
+// retained message, so new subscribers get the last status immediately.
+type mqttNotifier struct {
+  url       *url.URL
+  topic     string
+  tlsConfig *tls.Config
+  dial      transport.DialFunc
+  paths     []string
+
+  // lastBackups are the last backups of the files recorded in the state by the last sync
+  lastBackups map[string]time.Time
+}
+
+// newMQTTNotifier creates a notifier publishing to a given mqtt:// or mqtts:// URL,
+// with an optional user and password, and the topic as the path, through -proxy, if any.
+func newMQTTNotifier(opts *config.Options, rawURL string, paths []string) (*mqttNotifier, error) {
+  u, err := url.Parse(rawURL)
+  if err != nil {
+    return nil, fmt.Errorf("invalid MQTT URL")
+  }
+  dial, err := transport.NewDialer(opts, notifyTimeout)
+  if err != nil {
+    return nil, err
+  }
+  n := &mqttNotifier{ url: u, topic: strings.TrimPrefix(u.Path, "/"), dial: dial, paths: paths,
+    lastBackups: make(map[string]time.Time) }
+  if n.topic == "" {
+    n.topic = mqttDefaultTopic
+  }
+  switch u.Scheme {
+  case "mqtt", "tcp":
+    if u.Port() == "" {
+      u.Host = net.JoinHostPort(u.Hostname(), "1883")
+    }
+  case "mqtts", "ssl":
+    if u.Port() == "" {
+      u.Host = net.JoinHostPort(u.Hostname(), "8883")
+    }
+    if n.tlsConfig, err = transport.NewTLSConfig(opts); err != nil {
+      return nil, err
+    }
+    n.tlsConfig.ServerName = u.Hostname()
+  default:
+    return nil, fmt.Errorf("unsupported MQTT URL scheme %q", u.Scheme)
+  }
+  return n, nil
+}
+
+func (n *mqttNotifier) notify(r *report.Report) error {
+  payload, err := json.Marshal(n.Status(r, time.Now()))
+  if err != nil {
+    return err
+  }
+  if err := n.publish(payload); err != nil {
+    // the URL may contain the password, only the host is safe to log
+    return fmt.Errorf("%s: %v", n.url.Host, err)
+  }
+  return nil
+}
+
+// recordState remembers the last backups of the files, as recorded in the state by a sync.
+func (n *mqttNotifier) recordState(st *state.State) {
+  for _, path := range n.paths {
+    if fs, ok := st.Files[path]; ok && !fs.LastBackup.IsZero() {
+      n.lastBackups[path] = fs.LastBackup
+    }
+  }
+}
+
+// Status builds the message for a run. The last backup times come from the state
+// recorded by the last sync, so they are also known when nothing was uploaded or a file failed.
+func (n *mqttNotifier) Status(r *report.Report, now time.Time) *mqttStatus {
+  s := &mqttStatus{ Status: r.Status(), Title: r.Title(), ExitCode: r.Code, Timestamp: now,
+    Files: []mqttFile{} }
+
+  // a file failed if any of its backends failed
+  results := make(map[string]engine.Result)
+  for _, f := range r.Results {
+    if results[f.Path].Err == nil {
+      results[f.Path] = f
+    }
+  }
+  for _, path := range n.paths {
+    f := mqttFile{ Path: path, Action: results[path].Action }
+    if err := results[path].Err; err != nil {
+      f.Error = err.Error()
+    }
+    if lastBackup, ok := n.lastBackups[path]; ok {
+      f.LastBackup = &lastBackup
+      // the oldest backup is the one to alert on
+      if s.LastBackup == nil || lastBackup.Before(*s.LastBackup) {
+        s.LastBackup = &lastBackup
+      }
+    }
+    s.Files = append(s.Files, f)
+  }
+  return s
+}
+
+// publish connects to the broker, publishes a retained message with QoS 1
+// and disconnects, using MQTT 3.1.1.
+func (n *mqttNotifier) publish(payload []byte) error {
+  ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+  defer cancel()
+  conn, err := n.dial(ctx, "tcp", n.url.Host)
+  if err != nil {
+    return err
+  }
+  defer conn.Close()
+  conn.SetDeadline(time.Now().Add(notifyTimeout))
+  if n.tlsConfig != nil {
+    tlsConn := tls.Client(conn, n.tlsConfig)
+    if err := tlsConn.HandshakeContext(ctx); err != nil {
+      return err
+    }
+    conn = tlsConn
+  }
+  r := bufio.NewReader(conn)
+
+  // CONNECT with a clean session
+  var connect bytes.Buffer
+  mqttString(&connect, "MQTT")
+  connect.WriteByte(4)
+  flags := byte(0x02)
+  if n.url.User != nil {
+    flags |= 0x80
+    if _, ok := n.url.User.Password(); ok {
+      flags |= 0x40
+    }
+  }
+  connect.WriteByte(flags)
+  binary.Write(&connect, binary.BigEndian, uint16(30))
+  mqttString(&connect, fmt.Sprintf("keepassx_backup_tool-%d", os.Getpid()))
+  if n.url.User != nil {
+    mqttString(&connect, n.url.User.Username())
+    if password, ok := n.url.User.Password(); ok {
+      mqttString(&connect, password)
+    }
+  }
+  if err := mqttWritePacket(conn, 0x10, connect.Bytes()); err != nil {
+    return err
+  }
+  packetType, body, err := mqttReadPacket(r)
+  if err != nil {
+    return err
+  }
+  if packetType != 0x20 || len(body) != 2 {
+    return fmt.Errorf("unexpected response to connect")
+  }
+  if body[1] != 0 {
+    return fmt.Errorf("connection refused with return code %d", body[1])
+  }
+
+  // PUBLISH with QoS 1 and the retain flag, acknowledged with PUBACK
+  const packetId = 1
+  var publish bytes.Buffer
+  mqttString(&publish, n.topic)
+  binary.Write(&publish, binary.BigEndian, uint16(packetId))
+  publish.Write(payload)
+  if err := mqttWritePacket(conn, 0x33, publish.Bytes()); err != nil {
+    return err
+  }
+  packetType, body, err = mqttReadPacket(r)
+  if err != nil {
+    return err
+  }
+  if packetType != 0x40 || len(body) != 2 || binary.BigEndian.Uint16(body) != packetId {
+    return fmt.Errorf("publish was not acknowledged")
+  }
+
+  return mqttWritePacket(conn, 0xe0, nil)
+}
+
+// mqttString writes a length prefixed UTF-8 string.
+func mqttString(b *bytes.Buffer, s string) {
+  binary.Write(b, binary.BigEndian, uint16(len(s)))
+  b.WriteString(s)
+}
+
+// mqttWritePacket writes a control packet with a given fixed header byte and body.
+func mqttWritePacket(w io.Writer, header byte, body []byte) error {
+  packet := []byte{ header }
+  // the remaining length is encoded 7 bits at a time
+  length := len(body)
+  for {
+    digit := byte(length % 128)
+    length /= 128
+    if length > 0 {
+      digit |= 0x80
+    }
+    packet = append(packet, digit)
+    if length == 0 {
+      break
+    }
+  }
+  _, err := w.Write(append(packet, body...))
+  return err
+}
+
+// mqttReadPacket reads a control packet.
+// It returns the packet type and the body.
+func mqttReadPacket(r *bufio.Reader) (byte, []byte, error) {
+  header, err := r.ReadByte()
+  if err != nil {
+    return 0, nil, err
+  }
+  length, multiplier := 0, 1
+  for i := 0; ; i++ {
+    digit, err := r.ReadByte()
+    if err != nil {
+      return 0, nil, err
+    }
+    if i == 4 {
+      return 0, nil, fmt.Errorf("malformed packet length")
+    }
+    length += int(digit&0x7f) * multiplier
+    multiplier *= 128
+    if digit&0x80 == 0 {
+      break
+    }
+  }
+  body := make([]byte, length)
+  if _, err := io.ReadFull(r, body); err != nil {
+    return 0, nil, err
+  }
+  return header & 0xf0, body, nil
+}
@@ -0,0 +1,172 @@
+// Package notify sends the reports of runs to the user.
+package notify
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/events"
+  "github.com/pawelu/keepassx_backup_tool/internal/logging"
+  "github.com/pawelu/keepassx_backup_tool/internal/plugin"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// notifyTimeout limits how long sending a single notification may take,
+// so an unreachable service does not block the backup.
+const notifyTimeout = 10 * time.Second
+
+// notifier sends the report of a run to the user.
+type notifier interface {
+  notify(r *report.Report) error
+}
+
+// Setup subscribes to the reports of runs for all configured notifications and notify plugins,
+// which use a given HTTP client and report on the given local file paths.
+func Setup(opts *config.Options, client *http.Client, paths []string, plugins []plugin.Plugin) {
+  if opts.HealthcheckURL != "" {
+    hc := &healthcheck{ client: client, url: opts.HealthcheckURL }
+    events.Subscribe(func(e events.Event) {
+      if _, ok := e.(events.RunStarted); ok {
+        hc.ping("/start", "")
+      }
+    })
+    events.OnRunFinished(hc.finish)
+  }
+
+  if opts.NotifyDesktop != "" {
+    n, err := newDesktopNotifier(opts.NotifyDesktop)
+    if err != nil {
+      logging.Fatal("Invalid desktop notification option", "error", err)
+    }
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  if opts.TelegramToken != "" || opts.TelegramChatId != "" {
+    if opts.TelegramToken == "" || opts.TelegramChatId == "" {
+      logging.Fatal("Both -telegram-token and -telegram-chat-id have to be given")
+    }
+    n := &telegramNotifier{ client: client, token: opts.TelegramToken, chatId: opts.TelegramChatId }
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  if opts.NtfyURL != "" {
+    n := &ntfyNotifier{ client: client, url: opts.NtfyURL, token: opts.NtfyToken }
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  if opts.GotifyURL != "" || opts.GotifyToken != "" {
+    if opts.GotifyURL == "" || opts.GotifyToken == "" {
+      logging.Fatal("Both -gotify-url and -gotify-token have to be given")
+    }
+    n := &gotifyNotifier{ client: client, url: opts.GotifyURL, token: opts.GotifyToken }
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  if opts.MqttURL != "" {
+    n, err := newMQTTNotifier(opts, opts.MqttURL, paths)
+    if err != nil {
+      logging.Fatal("Invalid MQTT option", "error", err)
+    }
+    events.Subscribe(func(e events.Event) {
+      if f, ok := e.(events.SyncFinished); ok {
+        n.recordState(f.State)
+      }
+    })
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  if opts.WebhookURL != "" {
+    n, err := newWebhookNotifier(client, opts.WebhookURL, opts.WebhookFormat)
+    if err != nil {
+      logging.Fatal("Invalid webhook option", "error", err)
+    }
+    events.OnRunFinished(notifyHandler(n))
+  }
+
+  for _, p := range plugins {
+    if p.Kind == plugin.KindNotify {
+      events.OnRunFinished(notifyHandler(pluginNotifier{ p }))
+    }
+  }
+}
+
+// pluginNotifier sends the report with a notify plugin.
+type pluginNotifier struct {
+  p plugin.Plugin
+}
+
+func (n pluginNotifier) notify(r *report.Report) error {
+  return n.p.Notify(r)
+}
+
+// notifyHandler creates a handler sending reports with a notifier.
+func notifyHandler(n notifier) func(r *report.Report) {
+  return func(r *report.Report) {
+    if err := n.notify(r); err != nil {
+      slog.Warn("Unable to send notification", "error", err)
+    }
+  }
+}
+
+// parseStatuses parses a comma separated list of run statuses.
+// It returns the set of given statuses.
+func parseStatuses(list string) (map[string]bool, error) {
+  statuses := make(map[string]bool)
+  for _, s := range strings.Split(list, ",") {
+    s = strings.TrimSpace(s)
+    switch s {
+    case report.StatusSuccess, report.StatusSkip, report.StatusFailure:
+      statuses[s] = true
+    default:
+      return nil, fmt.Errorf("unknown run status %q", s)
+    }
+  }
+  return statuses, nil
+}
+
+// postJSON sends a payload encoded as JSON to a given URL.
+func postJSON(client *http.Client, target string, payload interface{}) error {
+  b, err := json.Marshal(payload)
+  if err != nil {
+    return err
+  }
+  return post(client, target, map[string]string{ "Content-Type": "application/json" }, b)
+}
+
+// post sends a body with the given headers to a given URL.
+func post(client *http.Client, target string, header map[string]string, body []byte) error {
+  ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+  defer cancel()
+
+  // webhook URLs and bot tokens are secrets, keep them out of the logs
+  req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+  if err != nil {
+    return fmt.Errorf("invalid notification URL")
+  }
+  for k, v := range header {
+    req.Header.Set(k, v)
+  }
+
+  resp, err := client.Do(req)
+  if err != nil {
+    var urlErr *url.Error
+    if errors.As(err, &urlErr) {
+      return fmt.Errorf("%s: %v", req.URL.Host, urlErr.Err)
+    }
+    return err
+  }
+  resp.Body.Close()
+  if resp.StatusCode < 200 || resp.StatusCode > 299 {
+    return fmt.Errorf("%s responded with %s", req.URL.Host, resp.Status)
+  }
+  return nil
+}
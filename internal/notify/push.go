@@ -0,0 +1,60 @@
+package notify
+
+import (
+  "encoding/json"
+  "net/http"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// ntfyNotifier publishes the report of every run to an ntfy topic.
+type ntfyNotifier struct {
+  client *http.Client
+  url    string
+  token  string
+}
+
+func (n *ntfyNotifier) notify(r *report.Report) error {
+  header := map[string]string{ "Title": r.Title(), "Tags": "key" }
+  if r.Status() == report.StatusFailure {
+    header["Priority"] = "high"
+    header["Tags"] = "warning"
+  }
+  if n.token != "" {
+    header["Authorization"] = "Bearer " + n.token
+  }
+  return post(n.client, n.url, header, []byte(r.Text()))
+}
+
+// gotifyNotifier sends the report of every run as a Gotify message.
+type gotifyNotifier struct {
+  client *http.Client
+  url    string
+  token  string
+}
+
+func (n *gotifyNotifier) notify(r *report.Report) error {
+  priority := 5
+  if r.Status() == report.StatusFailure {
+    priority = 8
+  }
+  message := map[string]interface{}{
+    "title":    r.Title(),
+    "message":  r.Text(),
+    "priority": priority,
+  }
+  target := strings.TrimSuffix(n.url, "/") + "/message"
+  return postJSONWithToken(n.client, target, n.token, message)
+}
+
+// postJSONWithToken sends a payload encoded as JSON to Gotify,
+// passing the application token in a header instead of the URL.
+func postJSONWithToken(client *http.Client, target, token string, payload interface{}) error {
+  b, err := json.Marshal(payload)
+  if err != nil {
+    return err
+  }
+  header := map[string]string{ "Content-Type": "application/json", "X-Gotify-Key": token }
+  return post(client, target, header, b)
+}
@@ -0,0 +1,25 @@
+package notify
+
+import (
+  "net/http"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// telegramAPI is the base URL of the Telegram Bot API.
+const telegramAPI = "https://api.telegram.org/bot"
+
+// telegramNotifier sends the report of every run as a Telegram bot message.
+type telegramNotifier struct {
+  client *http.Client
+  token  string
+  chatId string
+}
+
+func (n *telegramNotifier) notify(r *report.Report) error {
+  message := map[string]string{
+    "chat_id": n.chatId,
+    "text":    r.Title() + "\n" + r.Text(),
+  }
+  return postJSON(n.client, telegramAPI + n.token + "/sendMessage", message)
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+  "fmt"
+  "net/http"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// webhookNotifier posts the report of every run to a webhook URL.
+type webhookNotifier struct {
+  client *http.Client
+  url    string
+  format string
+}
+
+// webhookFile describes a single file in the generic webhook payload.
+type webhookFile struct {
+  Path    string `json:"path"`
+  Backend string `json:"backend"`
+  Action  engine.Action `json:"action"`
+  Bytes   int64  `json:"bytes"`
+  Error   string `json:"error,omitempty"`
+}
+
+// webhookPayload is the generic webhook payload.
+type webhookPayload struct {
+  Status   string        `json:"status"`
+  Title    string        `json:"title"`
+  ExitCode int           `json:"exit_code"`
+  Message  string        `json:"message,omitempty"`
+  Files    []webhookFile `json:"files"`
+}
+
+// newWebhookNotifier creates a webhookNotifier for a payload format:
+// generic, slack (also accepted by Mattermost) or discord.
+func newWebhookNotifier(client *http.Client, url, format string) (*webhookNotifier, error) {
+  switch format {
+  case "generic", "slack", "discord":
+  default:
+    return nil, fmt.Errorf("unknown webhook format %q", format)
+  }
+  return &webhookNotifier{ client: client, url: url, format: format }, nil
+}
+
+func (n *webhookNotifier) notify(r *report.Report) error {
+  text := r.Title() + "\n" + r.Text()
+  switch n.format {
+  case "slack":
+    return postJSON(n.client, n.url, map[string]string{ "text": text })
+  case "discord":
+    return postJSON(n.client, n.url, map[string]string{ "content": text })
+  }
+
+  payload := webhookPayload{ Status: r.Status(), Title: r.Title(), ExitCode: r.Code, Message: r.Message,
+    Files: []webhookFile{} }
+  for _, f := range r.Results {
+    wf := webhookFile{ Path: f.Path, Backend: f.Backend, Action: f.Action, Bytes: f.Bytes }
+    if f.Err != nil {
+      wf.Error = f.Err.Error()
+    }
+    payload.Files = append(payload.Files, wf)
+  }
+  return postJSON(n.client, n.url, payload)
+}
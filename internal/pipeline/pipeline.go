@@ -0,0 +1,128 @@
+// Package pipeline runs the export commands of other password managers, writing
+// their secrets into files backed up like the databases, and removes the files afterwards.
+package pipeline
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// Placeholder in a command is replaced with the path of the file the command writes to.
+// Commands without it write to the standard output.
+const Placeholder = "{}"
+
+// Pipeline is an export command given with -pipeline name=command.
+type Pipeline struct {
+  // Name names the written file and its backup
+  Name string
+
+  // Command is run by the shell
+  Command string
+}
+
+// Parse parses a pipeline given as name=command.
+func Parse(spec string) (*Pipeline, error) {
+  parts := strings.SplitN(spec, "=", 2)
+  if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+    return nil, fmt.Errorf("Pipeline %q is not given as name=command", spec)
+  }
+  name := strings.TrimSpace(parts[0])
+  if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+    return nil, fmt.Errorf("Pipeline name %q is not a file name", name)
+  }
+  return &Pipeline{ Name: name, Command: strings.TrimSpace(parts[1]) }, nil
+}
+
+// Dir generates the directory holding the files written by the pipelines, which are
+// kept at the same paths between runs, so their state is kept too.
+// It returns the directory path, creating it if necessary.
+func Dir() (string, error) {
+  stateDir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  dir := filepath.Join(stateDir, "pipelines")
+  return dir, os.MkdirAll(dir, 0700)
+}
+
+// shell returns the command running a command line with the shell.
+func shell(ctx context.Context, command string) *exec.Cmd {
+  if runtime.GOOS == "windows" {
+    return exec.CommandContext(ctx, "cmd", "/C", command)
+  }
+  return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// quote quotes a path for the shell.
+func quote(path string) string {
+  if runtime.GOOS == "windows" {
+    return `"` + path + `"`
+  }
+  return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// Run runs the export command writing the file of the pipeline in a given directory.
+// It returns the path of the file, which is removed again if the command fails.
+func (p *Pipeline) Run(ctx context.Context, dir string) (string, error) {
+  path := filepath.Join(dir, p.Name)
+  // the file is created for the user only, before the command writes secrets to it
+  f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+  if err != nil {
+    return "", err
+  }
+  var cmd *exec.Cmd
+  if strings.Contains(p.Command, Placeholder) {
+    cmd = shell(ctx, strings.ReplaceAll(p.Command, Placeholder, quote(path)))
+  } else {
+    cmd = shell(ctx, p.Command)
+    cmd.Stdout = f
+  }
+  cmd.Stderr = os.Stderr
+  err = cmd.Run()
+  if closeErr := f.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    Remove(path)
+    return "", fmt.Errorf("Pipeline %s failed: %v", p.Name, err)
+  }
+  if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+    Remove(path)
+    return "", fmt.Errorf("Pipeline %s has written nothing", p.Name)
+  }
+  return path, nil
+}
+
+// Remove overwrites the file written by a pipeline with zeros before removing it,
+// so the secrets are not left in the freed blocks of file systems overwriting in place.
+func Remove(path string) error {
+  f, err := os.OpenFile(path, os.O_WRONLY, 0)
+  if os.IsNotExist(err) {
+    return nil
+  }
+  if err != nil {
+    return err
+  }
+  if fi, err := f.Stat(); err == nil {
+    zeros := make([]byte, 64*1024)
+    for left := fi.Size(); left > 0; left -= int64(len(zeros)) {
+      n := int64(len(zeros))
+      if left < n {
+        n = left
+      }
+      if _, err := f.Write(zeros[:n]); err != nil {
+        break
+      }
+    }
+    f.Sync()
+  }
+  f.Close()
+  return os.Remove(path)
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "log/slog"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// remoteFile describes a backup in responses of backend plugins.
+type remoteFile struct {
+  Id   string `json:"id"`
+  Name string `json:"name"`
+  Md5  string `json:"md5,omitempty"`
+
+  // ModTime is when the backup was last changed, if the plugin knows
+  ModTime time.Time `json:"mod_time,omitempty"`
+}
+
+// backend stores backups with a backend plugin, which handles the operations
+// find, upload, download and remove.
+type backend struct {
+  p Plugin
+}
+
+// RegisterBackends makes the backend plugins available by their names, skipping
+// the ones named like a backend compiled into the application.
+func RegisterBackends(plugins []Plugin) {
+  for _, p := range plugins {
+    if p.Kind != KindBackend {
+      continue
+    }
+    if _, err := engine.Lookup(p.Name); err == nil {
+      slog.Warn("Ignoring plugin named like a built-in backend", "plugin", p.Path)
+      continue
+    }
+    b := &backend{ p: p }
+    engine.Register(p.Name, func(ctx context.Context, env *engine.Env) (engine.Backend, error) {
+      return b, nil
+    })
+  }
+}
+
+func (b *backend) Name() string {
+  return b.p.Name
+}
+
+func (b *backend) Find(ctx context.Context, name, remoteId string) (*engine.RemoteFile, error) {
+  var resp response
+  if err := b.p.call(ctx, &request{ Op: "find", Name: name, RemoteId: remoteId }, &resp); err != nil {
+    return nil, err
+  }
+  if resp.File == nil {
+    return nil, nil
+  }
+  return &engine.RemoteFile{ Id: resp.File.Id, Name: resp.File.Name, Md5: resp.File.Md5, ModTime: resp.File.ModTime }, nil
+}
+
+func (b *backend) Upload(ctx context.Context, path, ringFileName string, remote *engine.RemoteFile, r io.Reader, size int64, hash string,
+  meta map[string]string) (string, error) {
+  req := &request{ Op: "upload", Path: path, Name: ringFileName, Hash: hash, Metadata: meta, Size: size }
+  if remote != nil {
+    req.RemoteId = remote.Id
+  }
+
+  var resp response
+  if err := b.p.send(ctx, req, r, &resp); err != nil {
+    return "", err
+  }
+  if resp.Id == "" {
+    return "", fmt.Errorf("Plugin %s returned no id of the uploaded file", b.p.Path)
+  }
+  return resp.Id, nil
+}
+
+func (b *backend) Download(ctx context.Context, remote *engine.RemoteFile) (io.ReadCloser, error) {
+  var resp response
+  return b.p.open(ctx, &request{ Op: "download", Name: remote.Name, RemoteId: remote.Id }, &resp)
+}
+
+func (b *backend) Remove(ctx context.Context, remote *engine.RemoteFile) error {
+  var resp response
+  return b.p.call(ctx, &request{ Op: "remove", Name: remote.Name, RemoteId: remote.Id }, &resp)
+}
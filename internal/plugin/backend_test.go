@@ -0,0 +1,211 @@
+package plugin_test
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/md5"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "log/slog"
+  "math/rand"
+  "os"
+  "path/filepath"
+  "runtime"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/plugin"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// fixtureDirEnv is the directory, where the test binary run as a backend plugin stores the backups.
+const fixtureDirEnv = "KEEPASSX_BACKUP_PLUGIN_FIXTURE_DIR"
+
+func TestMain(m *testing.M) {
+  if dir := os.Getenv(fixtureDirEnv); dir != "" {
+    if err := serveFixture(dir, bufio.NewReader(os.Stdin), os.Stdout); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+    os.Exit(0)
+  }
+  os.Exit(m.Run())
+}
+
+// fixtureRequest is the part of a request the fixture plugin reads.
+type fixtureRequest struct {
+  Op       string `json:"op"`
+  Name     string `json:"name"`
+  RemoteId string `json:"remote_id"`
+  Size     int64  `json:"size"`
+}
+
+// serveFixture handles a single request like a backend plugin, which keeps the backups as files in dir,
+// identified by their names.
+func serveFixture(dir string, in *bufio.Reader, out io.Writer) error {
+  line, err := in.ReadBytes('\n')
+  if err != nil {
+    return err
+  }
+  var req fixtureRequest
+  if err := json.Unmarshal(line, &req); err != nil {
+    return err
+  }
+  respond := json.NewEncoder(out).Encode
+
+  switch req.Op {
+  case "find":
+    f, err := os.Open(filepath.Join(dir, req.Name))
+    if os.IsNotExist(err) {
+      return respond(struct{}{})
+    }
+    if err != nil {
+      return err
+    }
+    defer f.Close()
+    digest := md5.New()
+    if _, err := io.Copy(digest, f); err != nil {
+      return err
+    }
+    return respond(map[string]interface{}{ "file": map[string]string{ "id": req.Name, "name": req.Name,
+      "md5": hex.EncodeToString(digest.Sum(nil)) } })
+  case "upload":
+    f, err := os.Create(filepath.Join(dir, req.Name))
+    if err != nil {
+      return err
+    }
+    defer f.Close()
+    if n, err := io.Copy(f, in); err != nil || n != req.Size {
+      return respond(map[string]string{ "error": fmt.Sprintf("received %d bytes, %v, want %d", n, err, req.Size) })
+    }
+    return respond(map[string]string{ "id": req.Name })
+  case "download":
+    f, err := os.Open(filepath.Join(dir, req.RemoteId))
+    if err != nil {
+      return respond(map[string]string{ "error": err.Error() })
+    }
+    defer f.Close()
+    fi, err := f.Stat()
+    if err != nil {
+      return err
+    }
+    if err := respond(map[string]int64{ "size": fi.Size() }); err != nil {
+      return err
+    }
+    _, err = io.Copy(out, f)
+    return err
+  case "remove":
+    if err := os.Remove(filepath.Join(dir, req.RemoteId)); err != nil {
+      return respond(map[string]string{ "error": err.Error() })
+    }
+    return respond(struct{}{})
+  }
+  return fmt.Errorf("unsupported operation %s", req.Op)
+}
+
+// installFixture installs the test binary as the backend plugin named fixture in a plugins directory,
+// storing the backups in a directory of its own, which it returns.
+func installFixture(t *testing.T) string {
+  t.Helper()
+  exe, err := os.Executable()
+  if err != nil {
+    t.Fatal(err)
+  }
+  content, err := ioutil.ReadFile(exe)
+  if err != nil {
+    t.Fatal(err)
+  }
+  pluginsDir, backupsDir := t.TempDir(), t.TempDir()
+  name := "backend-fixture"
+  if runtime.GOOS == "windows" {
+    name += ".exe"
+  }
+  if err := ioutil.WriteFile(filepath.Join(pluginsDir, name), content, 0700); err != nil {
+    t.Fatal(err)
+  }
+  t.Setenv(fixtureDirEnv, backupsDir)
+
+  plugins, err := plugin.Discover(pluginsDir)
+  if err != nil || len(plugins) != 1 {
+    t.Fatalf("Discover = %+v, %v, want the fixture plugin", plugins, err)
+  }
+  plugin.RegisterBackends(plugins)
+  return backupsDir
+}
+
+// TestBackend backs up a database to a backend plugin, restores it and removes the backup,
+// streaming the database to and from the plugin without holding it in memory.
+func TestBackend(t *testing.T) {
+  const size = 64 << 20
+  backupsDir := installFixture(t)
+  ctx := context.Background()
+  opts := &config.Options{ Jobs: 1, WaitTimeout: time.Minute, Logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil)) }
+  factory, err := engine.Lookup("fixture")
+  if err != nil {
+    t.Fatal(err)
+  }
+  b, err := factory(ctx, &engine.Env{ Opts: opts })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  path := filepath.Join(t.TempDir(), "ring.kdbx")
+  f, err := os.Create(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = io.CopyN(f, rand.New(rand.NewSource(1)), size)
+  if closeErr := f.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  runtime.GC()
+  var before, after runtime.MemStats
+  runtime.ReadMemStats(&before)
+  st := &state.State{}
+  results := engine.SyncRingFiles(ctx, opts, st, []engine.Backend{ b }, []string{ path })
+  if len(results) != 1 || results[0].Err != nil || results[0].Action != engine.ActionCreated {
+    t.Fatalf("SyncRingFiles = %+v, want %s", results, engine.ActionCreated)
+  }
+  results = engine.RestoreRingFiles(ctx, b, opts, st, []string{ path })
+  if len(results) != 1 || results[0].Err != nil || results[0].Action != engine.ActionRestored {
+    t.Fatalf("RestoreRingFiles = %+v, want %s", results, engine.ActionRestored)
+  }
+  runtime.ReadMemStats(&after)
+  if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+    t.Errorf("backing up and restoring %d bytes allocated %d bytes, want at most %d", size, allocated, 16<<20)
+  }
+
+  for _, p := range []string{ filepath.Join(backupsDir, "ring.kdbx"), path + engine.RestoredSuffix } {
+    content, err := ioutil.ReadFile(p)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if want, _ := ioutil.ReadFile(path); !bytes.Equal(content, want) {
+      t.Errorf("%s has %d bytes, differing from the %d bytes of the database", p, len(content), len(want))
+    }
+  }
+
+  remote, err := b.Find(ctx, "ring.kdbx", "")
+  if err != nil || remote == nil {
+    t.Fatalf("Find = %+v, %v, want the backup", remote, err)
+  }
+  if err := b.Remove(ctx, remote); err != nil {
+    t.Fatalf("Remove: %v", err)
+  }
+  if err := b.Remove(ctx, remote); err == nil {
+    t.Errorf("Remove of a removed backup succeeded, want the error of the plugin")
+  }
+  if _, err := b.Download(ctx, remote); err == nil {
+    t.Errorf("Download of a removed backup succeeded, want the error of the plugin")
+  }
+}
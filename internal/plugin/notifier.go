@@ -0,0 +1,51 @@
+package plugin
+
+import (
+  "context"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+)
+
+// notifyTimeout limits how long a notify plugin may run, so a hanging one
+// does not block the exit.
+const notifyTimeout = 30 * time.Second
+
+// reportFile describes a single file in the report sent to notify plugins.
+type reportFile struct {
+  Path    string        `json:"path"`
+  Backend string        `json:"backend"`
+  Action  engine.Action `json:"action"`
+  Bytes   int64         `json:"bytes"`
+  Error   string        `json:"error,omitempty"`
+}
+
+// reportPayload is the report of a run sent to notify plugins.
+type reportPayload struct {
+  Status   string       `json:"status"`
+  Title    string       `json:"title"`
+  Text     string       `json:"text"`
+  ExitCode int          `json:"exit_code"`
+  Message  string       `json:"message,omitempty"`
+  Files    []reportFile `json:"files"`
+}
+
+// Notify sends the report of a run to a notify plugin with the notify operation.
+func (p Plugin) Notify(r *report.Report) error {
+  ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+  defer cancel()
+
+  payload := &reportPayload{ Status: r.Status(), Title: r.Title(), Text: r.Text(), ExitCode: r.Code,
+    Message: r.Message, Files: []reportFile{} }
+  for _, f := range r.Results {
+    rf := reportFile{ Path: f.Path, Backend: f.Backend, Action: f.Action, Bytes: f.Bytes }
+    if f.Err != nil {
+      rf.Error = f.Err.Error()
+    }
+    payload.Files = append(payload.Files, rf)
+  }
+
+  var resp response
+  return p.call(ctx, &request{ Op: "notify", Report: payload }, &resp)
+}
@@ -0,0 +1,230 @@
+// Package plugin runs external programs as backends and notifiers, so users can add
+// destinations and notifications without rebuilding the application.
+//
+// A plugin is an executable in the plugins directory named backend-<name> or
+// notify-<name>. Every operation runs the plugin once, writing a single JSON request line
+// to its standard input and reading a single JSON response line from its standard output.
+// The content of a backup is never put in JSON: it follows the request of an upload and
+// the response of a download as raw bytes, so it is streamed and not held in memory.
+// The standard error of the plugin is passed through. A response with a non-empty
+// error field, or a non-zero exit status, fails the operation.
+package plugin
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+)
+
+// Kinds of plugins, which are the prefixes of their file names.
+const (
+  KindBackend = "backend"
+  KindNotify  = "notify"
+)
+
+// Plugin is an executable found in the plugins directory.
+type Plugin struct {
+  Kind string
+  Name string
+  Path string
+}
+
+// request is written to the standard input of a plugin.
+type request struct {
+  Op       string            `json:"op"`
+  Path     string            `json:"path,omitempty"`
+  Name     string            `json:"name,omitempty"`
+  RemoteId string            `json:"remote_id,omitempty"`
+  Hash     string            `json:"hash,omitempty"`
+  Metadata map[string]string `json:"metadata,omitempty"`
+  // Size is the number of bytes of the content following the request of an upload
+  Size   int64          `json:"size,omitempty"`
+  Report   *reportPayload    `json:"report,omitempty"`
+}
+
+// response is read from the standard output of a plugin.
+type response struct {
+  Error string      `json:"error,omitempty"`
+  File  *remoteFile `json:"file,omitempty"`
+  Id    string      `json:"id,omitempty"`
+  // Size is the number of bytes of the content following the response to a download
+  Size int64 `json:"size,omitempty"`
+}
+
+// Discover lists the plugins in a given directory.
+// A missing directory holds no plugins.
+func Discover(dir string) ([]Plugin, error) {
+  entries, err := ioutil.ReadDir(dir)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read plugins directory: %w", err)
+  }
+
+  var plugins []Plugin
+  for _, fi := range entries {
+    if fi.IsDir() || (runtime.GOOS != "windows" && fi.Mode()&0111 == 0) {
+      continue
+    }
+    name := strings.TrimSuffix(fi.Name(), ".exe")
+    for _, kind := range []string{ KindBackend, KindNotify } {
+      if pluginName := strings.TrimPrefix(name, kind+"-"); pluginName != name && pluginName != "" {
+        plugins = append(plugins, Plugin{ Kind: kind, Name: pluginName, Path: filepath.Join(dir, fi.Name()) })
+      }
+    }
+  }
+  return plugins, nil
+}
+
+// call runs the plugin with a request, decoding the response into resp.
+func (p Plugin) call(ctx context.Context, req *request, resp *response) error {
+  return p.send(ctx, req, nil, resp)
+}
+
+// send runs the plugin with a request followed by the content read from data, if any,
+// decoding the response into resp.
+func (p Plugin) send(ctx context.Context, req *request, data io.Reader, resp *response) error {
+  in, err := requestLine(req)
+  if err != nil {
+    return err
+  }
+
+  var out bytes.Buffer
+  cmd := exec.CommandContext(ctx, p.Path)
+  cmd.Stdin = bytes.NewReader(in)
+  if data != nil {
+    cmd.Stdin = io.MultiReader(cmd.Stdin, data)
+  }
+  cmd.Stdout = &out
+  cmd.Stderr = os.Stderr
+  if err := cmd.Run(); err != nil {
+    return fmt.Errorf("Plugin %s failed on %s: %w", p.Path, req.Op, err)
+  }
+  return p.decode(req, out.Bytes(), resp)
+}
+
+// open runs the plugin with a request, decoding the response into resp, and returns
+// the content following the response, which fails when the plugin does.
+func (p Plugin) open(ctx context.Context, req *request, resp *response) (io.ReadCloser, error) {
+  in, err := requestLine(req)
+  if err != nil {
+    return nil, err
+  }
+
+  cmd := exec.CommandContext(ctx, p.Path)
+  cmd.Stdin = bytes.NewReader(in)
+  cmd.Stderr = os.Stderr
+  stdout, err := cmd.StdoutPipe()
+  if err != nil {
+    return nil, err
+  }
+  if err := cmd.Start(); err != nil {
+    return nil, fmt.Errorf("Plugin %s failed on %s: %w", p.Path, req.Op, err)
+  }
+  r := &contentReader{ p: p, op: req.Op, cmd: cmd, r: bufio.NewReader(stdout) }
+  line, err := r.r.ReadBytes('\n')
+  if err != nil {
+    // a plugin failing before responding is told by its exit status
+    if r.wait(); r.err != nil {
+      return nil, r.err
+    }
+  }
+  if err := p.decode(req, line, resp); err != nil {
+    r.Close()
+    return nil, err
+  }
+  r.size = resp.Size
+  if r.done && r.read != r.size {
+    return nil, r.sizeError()
+  }
+  return r, nil
+}
+
+// requestLine encodes a request as a single line.
+func requestLine(req *request) ([]byte, error) {
+  in, err := json.Marshal(req)
+  if err != nil {
+    return nil, err
+  }
+  return append(in, '\n'), nil
+}
+
+// decode decodes the response of the plugin to a request into resp.
+func (p Plugin) decode(req *request, out []byte, resp *response) error {
+  if err := json.Unmarshal(out, resp); err != nil {
+    return fmt.Errorf("Plugin %s returned invalid response to %s: %w", p.Path, req.Op, err)
+  }
+  if resp.Error != "" {
+    return fmt.Errorf("Plugin %s failed on %s: %s", p.Path, req.Op, resp.Error)
+  }
+  return nil
+}
+
+// contentReader reads the content written by a plugin after its response,
+// failing unless the plugin writes size bytes and exits successfully.
+type contentReader struct {
+  p    Plugin
+  op   string
+  cmd  *exec.Cmd
+  r    *bufio.Reader
+  size int64
+  read int64
+  done bool
+  err  error
+}
+
+func (r *contentReader) Read(b []byte) (int, error) {
+  if r.done {
+    return 0, r.eof()
+  }
+  n, err := r.r.Read(b)
+  r.read += int64(n)
+  if err == io.EOF {
+    r.wait()
+    return n, r.eof()
+  }
+  return n, err
+}
+
+// wait waits for the plugin to exit, once all of its output is read.
+func (r *contentReader) wait() {
+  r.done = true
+  if err := r.cmd.Wait(); err != nil {
+    r.err = fmt.Errorf("Plugin %s failed on %s: %w", r.p.Path, r.op, err)
+  } else if r.read != r.size {
+    r.err = r.sizeError()
+  }
+}
+
+// sizeError tells that the plugin wrote another number of bytes than it responded with.
+func (r *contentReader) sizeError() error {
+  return fmt.Errorf("Plugin %s returned %d bytes on %s, want %d", r.p.Path, r.read, r.op, r.size)
+}
+
+// eof returns the error the plugin failed with, or io.EOF.
+func (r *contentReader) eof() error {
+  if r.err != nil {
+    return r.err
+  }
+  return io.EOF
+}
+
+// Close stops the plugin, unless it exited already.
+func (r *contentReader) Close() error {
+  if !r.done {
+    r.done = true
+    r.cmd.Process.Kill()
+    r.cmd.Wait()
+  }
+  return nil
+}
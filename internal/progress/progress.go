@@ -0,0 +1,121 @@
+// Package progress draws the upload progress bar.
+package progress
+
+import (
+  "fmt"
+  "io"
+  "strings"
+  "sync"
+  "time"
+)
+
+// progressInterval limits how often the progress bar is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// progressWidth is the number of characters of the bar itself.
+const progressWidth = 30
+
+// Reader draws a progress bar with percentage, speed and ETA,
+// while the upload reads the snapshot.
+type Reader struct {
+  r     io.Reader
+  total int64
+  label string
+  w     io.Writer
+
+  mu    sync.Mutex
+  read  int64
+  start time.Time
+  drawn time.Time
+}
+
+// NewReader creates a Reader drawing to w, for reading total bytes from r.
+func NewReader(r io.Reader, total int64, label string, w io.Writer) *Reader {
+  return &Reader{ r: r, total: total, label: label, w: w, start: time.Now() }
+}
+
+func (p *Reader) Read(b []byte) (int, error) {
+  n, err := p.r.Read(b)
+
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  p.read += int64(n)
+  if time.Since(p.drawn) >= progressInterval || p.read == p.total {
+    p.draw()
+  }
+  return n, err
+}
+
+// draw redraws the progress bar in place.
+func (p *Reader) draw() {
+  p.drawn = time.Now()
+
+  fraction := 1.0
+  if p.total > 0 {
+    fraction = float64(p.read) / float64(p.total)
+  }
+  if fraction > 1 {
+    fraction = 1
+  }
+  filled := int(fraction * progressWidth)
+  bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+
+  elapsed := time.Since(p.start).Seconds()
+  speed := 0.0
+  if elapsed > 0 {
+    speed = float64(p.read) / elapsed
+  }
+  eta := "--"
+  if speed > 0 {
+    eta = (time.Duration(float64(p.total-p.read) / speed * float64(time.Second))).Round(time.Second).String()
+  }
+
+  fmt.Fprintf(p.w, "\r%s [%s] %3.0f%% %s/s ETA %s  ", p.label, bar, fraction*100,
+    FormatBytes(int64(speed)), eta)
+}
+
+// Finish ends the progress bar line.
+func (p *Reader) Finish() {
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  if !p.drawn.IsZero() {
+    fmt.Fprintln(p.w)
+  }
+}
+
+// FormatBytes formats a byte count with a binary unit prefix.
+func FormatBytes(n int64) string {
+  const unit = 1024
+  if n < unit {
+    return fmt.Sprintf("%d B", n)
+  }
+  div, exp := int64(unit), 0
+  for m := n / unit; m >= unit; m /= unit {
+    div *= unit
+    exp++
+  }
+  return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// funcReader reports how many bytes have been read to a callback.
+type funcReader struct {
+  r     io.Reader
+  total int64
+  read  int64
+  f     func(read, total int64)
+}
+
+// NewFuncReader creates a reader calling f after every read from r,
+// with the bytes read so far out of total.
+func NewFuncReader(r io.Reader, total int64, f func(read, total int64)) io.Reader {
+  return &funcReader{ r: r, total: total, f: f }
+}
+
+func (p *funcReader) Read(b []byte) (int, error) {
+  n, err := p.r.Read(b)
+  if n > 0 {
+    p.read += int64(n)
+    p.f(p.read, p.total)
+  }
+  return n, err
+}
@@ -0,0 +1,65 @@
+// Package prompt asks the user for secrets on the terminal, without echoing them.
+package prompt
+
+import (
+  "bytes"
+  "fmt"
+  "os"
+  "sync"
+
+  "golang.org/x/term"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+)
+
+// disabled is set with -non-interactive.
+var disabled bool
+
+// Disable makes Interactive report false even in a terminal, so the user is never asked anything.
+func Disable() {
+  disabled = true
+}
+
+// Interactive reports whether the standard input is a terminal, so the user can be asked.
+func Interactive() bool {
+  return !disabled && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Secret asks for a secret with a given label on the standard error, reading it from the terminal
+// with the echo disabled.
+func Secret(label string) ([]byte, error) {
+  fmt.Fprint(os.Stderr, i18n.T(label))
+  b, err := term.ReadPassword(int(os.Stdin.Fd()))
+  // the newline typed by the user is not echoed either
+  fmt.Fprintln(os.Stderr)
+  if err != nil {
+    return nil, fmt.Errorf("Unable to read secret from terminal: %v", err)
+  }
+  return b, nil
+}
+
+// asked holds the secrets the user was asked for, by environment variable, so the user is asked only once.
+var asked sync.Map
+
+// EnvSecret returns a secret given in an environment variable, see config.EnvSecret, without the trailing
+// newline of a file, or asks for it with a given label, when interactive. It returns nil, if the secret
+// is not given, or the user typed nothing.
+func EnvSecret(env, label string) ([]byte, error) {
+  b, err := config.EnvSecret(env)
+  if err != nil {
+    return nil, err
+  }
+  // files holding secrets usually end with a newline
+  if b = bytes.TrimRight(b, "\r\n"); len(b) > 0 || !Interactive() {
+    return b, nil
+  }
+  if b, ok := asked.Load(env); ok {
+    return b.([]byte), nil
+  }
+  if b, err = Secret(label); err != nil {
+    return nil, err
+  }
+  asked.Store(env, b)
+  return b, nil
+}
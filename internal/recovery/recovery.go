@@ -0,0 +1,77 @@
+// Package recovery writes the disaster recovery bundle: the files needed to recover the backups on a new machine,
+// in a gzipped tar archive sealed with a passphrase, and armored as text to print it or store it offline.
+package recovery
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "encoding/pem"
+  "errors"
+  "io"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/seal"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase of the bundle,
+// which may also be read from the file named by PassphraseEnv_FILE, or the descriptor by PassphraseEnv_FD.
+const PassphraseEnv = config.EnvPrefix + "BUNDLE_PASSPHRASE"
+
+// pemType is the type of the armored block of a bundle.
+const pemType = "KEEPASSX BACKUP RECOVERY BUNDLE"
+
+// ErrNotBundle is returned by Open for data, which is not a bundle.
+var ErrNotBundle = errors.New("not a recovery bundle")
+
+// Entry is a file of a bundle.
+type Entry struct {
+  Name string
+  Data []byte
+}
+
+// Write writes a bundle of given entries, sealed with a passphrase, armored with the given headers,
+// which are not encrypted, e.g. telling how to open the bundle.
+func Write(w io.Writer, entries []Entry, passphrase string, headers map[string]string) error {
+  var archive bytes.Buffer
+  gz := gzip.NewWriter(&archive)
+  tw := tar.NewWriter(gz)
+  now := time.Now().Truncate(time.Second)
+  for _, e := range entries {
+    hdr := &tar.Header{ Name: e.Name, Mode: 0600, Size: int64(len(e.Data)), ModTime: now, Typeflag: tar.TypeReg }
+    if err := tw.WriteHeader(hdr); err != nil {
+      return err
+    }
+    if _, err := tw.Write(e.Data); err != nil {
+      return err
+    }
+  }
+  if err := tw.Close(); err != nil {
+    return err
+  }
+  if err := gz.Close(); err != nil {
+    return err
+  }
+  sealed, err := seal.Seal(archive.Bytes(), passphrase)
+  if err != nil {
+    return err
+  }
+  return pem.Encode(w, &pem.Block{ Type: pemType, Headers: headers, Bytes: sealed })
+}
+
+// IsBundle reports whether data is an armored bundle.
+func IsBundle(data []byte) bool {
+  block, _ := pem.Decode(data)
+  return block != nil && block.Type == pemType
+}
+
+// Open decrypts an armored bundle with a passphrase.
+// It returns the gzipped tar archive of its entries.
+func Open(data []byte, passphrase string) ([]byte, error) {
+  block, _ := pem.Decode(data)
+  if block == nil || block.Type != pemType {
+    return nil, ErrNotBundle
+  }
+  return seal.Open(block.Bytes, passphrase)
+}
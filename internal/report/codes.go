@@ -0,0 +1,89 @@
+package report
+
+import (
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// Exit codes of the application.
+const (
+  ExitSuccess        = 0
+  ExitFailure        = 1
+  ExitPartialFailure = 2
+  ExitReauthRequired = 3
+  ExitStale          = 4
+
+  // ExitSkipped is used instead of ExitSuccess with -exit-skipped,
+  // when nothing has changed since the last backup
+  ExitSkipped = 5
+)
+
+// Exit codes of the check, diff and verify commands.
+const (
+  ExitInSync     = 0
+  ExitOutdated   = 1
+  ExitCheckError = 2
+)
+
+// ExitCode returns the exit code reflecting whether some or all of the files failed.
+func ExitCode(results []engine.Result) int {
+  failed := 0
+  for _, r := range results {
+    if r.Err != nil {
+      failed++
+    }
+  }
+
+  switch {
+  case failed == 0:
+    return ExitSuccess
+  case failed < len(results):
+    return ExitPartialFailure
+  default:
+    return ExitFailure
+  }
+}
+
+// CheckExitCode returns the exit code of the check command: ExitCheckError if checking some of the files failed,
+// ExitOutdated if some of the backups are missing or outdated, and ExitInSync otherwise.
+func CheckExitCode(results []engine.Result) int {
+  code := ExitInSync
+  for _, r := range results {
+    if r.Err != nil {
+      return ExitCheckError
+    }
+    if r.Action == engine.ActionOutdated {
+      code = ExitOutdated
+    }
+  }
+  return code
+}
+
+// DiffExitCode returns the exit code of the diff command: ExitCheckError if comparing some of the files failed,
+// ExitOutdated if some of the files differ from their backups, and ExitInSync otherwise.
+func DiffExitCode(diffs []engine.Diff) int {
+  code := ExitInSync
+  for _, d := range diffs {
+    if d.Err != nil {
+      return ExitCheckError
+    }
+    if d.Newer != engine.NewerNone {
+      code = ExitOutdated
+    }
+  }
+  return code
+}
+
+// VerifyExitCode returns the exit code of the verify command: ExitCheckError if verifying some of the backups failed,
+// ExitOutdated if some of them are missing or corrupted, and ExitInSync otherwise.
+func VerifyExitCode(results []engine.Result) int {
+  code := ExitInSync
+  for _, r := range results {
+    switch r.Action {
+    case engine.ActionFailed:
+      return ExitCheckError
+    case engine.ActionMissing, engine.ActionCorrupted:
+      code = ExitOutdated
+    }
+  }
+  return code
+}
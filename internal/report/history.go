@@ -0,0 +1,153 @@
+package report
+
+import (
+  "encoding/csv"
+  "encoding/json"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// HistoryEvent is a single line of the history log.
+type HistoryEvent struct {
+  Time     time.Time `json:"time"`
+  File     string    `json:"file"`
+  Hash     string    `json:"hash,omitempty"`
+  Backend  string    `json:"backend"`
+  RemoteId string    `json:"remote_id,omitempty"`
+  Result   engine.Action    `json:"result"`
+  Format   string    `json:"format,omitempty"`
+  Bytes    int64     `json:"bytes,omitempty"`
+  Error    string    `json:"error,omitempty"`
+}
+
+// HistoryCacheFile generates history log path/filename.
+// It returns the generated history log path/filename.
+func HistoryCacheFile() (string, error) {
+  dir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// AppendHistory appends an event for every backed up file to the history log,
+// one JSON object per line, and flushes it to disk.
+func AppendHistory(results []engine.Result) error {
+  file, err := HistoryCacheFile()
+  if err != nil {
+    return err
+  }
+  f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  enc := json.NewEncoder(f)
+  now := time.Now()
+  for _, r := range results {
+    e := HistoryEvent{ Time: now, File: r.Path, Hash: r.Hash, Backend: r.Backend, RemoteId: r.RemoteId,
+      Result: r.Action, Format: r.Format, Bytes: r.Bytes }
+    if r.Err != nil {
+      e.Error = r.Err.Error()
+    }
+    if err := enc.Encode(e); err != nil {
+      return err
+    }
+  }
+  return f.Sync()
+}
+
+// LoadHistory reads all events of the history log.
+// A missing log holds no events.
+func LoadHistory() ([]HistoryEvent, error) {
+  file, err := HistoryCacheFile()
+  if err != nil {
+    return nil, err
+  }
+  f, err := os.Open(file)
+  if os.IsNotExist(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  var events []HistoryEvent
+  dec := json.NewDecoder(f)
+  for {
+    var e HistoryEvent
+    err := dec.Decode(&e)
+    if err == io.EOF {
+      return events, nil
+    }
+    if err != nil {
+      return nil, err
+    }
+    events = append(events, e)
+  }
+}
+
+// HistoryFilter selects the events of the history log of some files and backends, made within
+// a time range. Empty fields select the events of all files, all backends, or of any time.
+type HistoryFilter struct {
+  Files    []string
+  Backends []string
+  Since    time.Time
+  Until    time.Time
+}
+
+// Match reports whether the filter selects an event.
+func (f *HistoryFilter) Match(e HistoryEvent) bool {
+  if len(f.Files) > 0 && !matchAny(f.Files, e.File, config.SamePath) {
+    return false
+  }
+  if len(f.Backends) > 0 && !matchAny(f.Backends, e.Backend, func(a, b string) bool { return a == b }) {
+    return false
+  }
+  return (f.Since.IsZero() || !e.Time.Before(f.Since)) && (f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// matchAny reports whether any of values is the same as v.
+func matchAny(values []string, v string, same func(a, b string) bool) bool {
+  for _, value := range values {
+    if same(value, v) {
+      return true
+    }
+  }
+  return false
+}
+
+// historyColumns are the columns of the CSV export of the history log.
+var historyColumns = []string{ "time", "file", "backend", "result", "hash", "remote_id", "format", "bytes", "error" }
+
+// WriteHistoryCSV writes events of the history log as CSV, with a header line,
+// and the times in RFC 3339 format in the local time zone.
+func WriteHistoryCSV(w io.Writer, events []HistoryEvent) error {
+  cw := csv.NewWriter(w)
+  cw.Write(historyColumns)
+  for _, e := range events {
+    cw.Write([]string{ e.Time.Local().Format(time.RFC3339), e.File, e.Backend, string(e.Result), e.Hash, e.RemoteId, e.Format,
+      strconv.FormatInt(e.Bytes, 10), e.Error })
+  }
+  cw.Flush()
+  return cw.Error()
+}
+
+// WriteHistoryJSON writes events of the history log as an indented JSON array
+// of the objects of the lines of the log.
+func WriteHistoryJSON(w io.Writer, events []HistoryEvent) error {
+  if events == nil {
+    events = []HistoryEvent{}
+  }
+  enc := json.NewEncoder(w)
+  enc.SetIndent("", "  ")
+  return enc.Encode(events)
+}
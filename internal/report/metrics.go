@@ -0,0 +1,101 @@
+package report
+
+import (
+  "bytes"
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// labelEscaper escapes Prometheus label values.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes Prometheus metrics about the run and all backed up files
+// in the text exposition format, replacing the file atomically, as required
+// by the node_exporter textfile collector.
+func WriteMetrics(path string, runStart time.Time, results []engine.Result, st *state.State) error {
+  var buf bytes.Buffer
+
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_last_run_timestamp_seconds Time of the last run.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_last_run_timestamp_seconds gauge")
+  fmt.Fprintf(&buf, "keepassx_backup_last_run_timestamp_seconds %d\n", runStart.Unix())
+
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_last_run_duration_seconds Duration of the last run.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_last_run_duration_seconds gauge")
+  fmt.Fprintf(&buf, "keepassx_backup_last_run_duration_seconds %f\n", time.Since(runStart).Seconds())
+
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_last_run_uploaded_bytes Bytes uploaded by the last run.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_last_run_uploaded_bytes gauge")
+  for _, r := range results {
+    fmt.Fprintf(&buf, "keepassx_backup_last_run_uploaded_bytes{%s} %d\n", fileLabels(r.Path, r.Backend), r.Bytes)
+  }
+
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_last_run_success Whether the file was backed up by the last run.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_last_run_success gauge")
+  for _, r := range results {
+    success := 0
+    if r.Err == nil && r.Action != engine.ActionQueued {
+      success = 1
+    }
+    fmt.Fprintf(&buf, "keepassx_backup_last_run_success{%s} %d\n", fileLabels(r.Path, r.Backend), success)
+  }
+
+  paths := make([]string, 0, len(st.Files))
+  for p := range st.Files {
+    paths = append(paths, p)
+  }
+  sort.Strings(paths)
+
+  // states of older versions count by file only, until the file is backed up again
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_last_success_timestamp_seconds Time of the last successful backup.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_last_success_timestamp_seconds gauge")
+  for _, p := range paths {
+    fs := st.Files[p]
+    if len(fs.Backends) == 0 && !fs.LastBackup.IsZero() {
+      fmt.Fprintf(&buf, "keepassx_backup_last_success_timestamp_seconds{%s} %d\n", fileLabels(p, ""), fs.LastBackup.Unix())
+    }
+    for _, b := range backendNames(fs) {
+      if last := fs.Backends[b].LastBackup; !last.IsZero() {
+        fmt.Fprintf(&buf, "keepassx_backup_last_success_timestamp_seconds{%s} %d\n", fileLabels(p, b), last.Unix())
+      }
+    }
+  }
+
+  fmt.Fprintln(&buf, "# HELP keepassx_backup_failures_total Failed backups.")
+  fmt.Fprintln(&buf, "# TYPE keepassx_backup_failures_total counter")
+  for _, p := range paths {
+    fs := st.Files[p]
+    if len(fs.Backends) == 0 {
+      fmt.Fprintf(&buf, "keepassx_backup_failures_total{%s} %d\n", fileLabels(p, ""), fs.Failures)
+    }
+    for _, b := range backendNames(fs) {
+      fmt.Fprintf(&buf, "keepassx_backup_failures_total{%s} %d\n", fileLabels(p, b), fs.Backends[b].Failures)
+    }
+  }
+
+  return fsutil.WriteFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// backendNames returns the sorted names of the backends a file was backed up to.
+func backendNames(fs *state.FileState) []string {
+  names := make([]string, 0, len(fs.Backends))
+  for b := range fs.Backends {
+    names = append(names, b)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// fileLabels formats the labels identifying metrics of a backed up file,
+// and the backend it was backed up to, unless the metric covers all of them.
+func fileLabels(path, backend string) string {
+  if backend == "" {
+    return fmt.Sprintf(`file="%s"`, labelEscaper.Replace(path))
+  }
+  return fmt.Sprintf(`file="%s",backend="%s"`, labelEscaper.Replace(path), labelEscaper.Replace(backend))
+}
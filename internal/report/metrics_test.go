@@ -0,0 +1,53 @@
+package report_test
+
+import (
+  "errors"
+  "io/ioutil"
+  "log/slog"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+func TestWriteMetrics(t *testing.T) {
+  opts := &config.Options{ Logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil)) }
+  st := &state.State{}
+  // a state of an older version, without backends
+  st.File("/old.kdbx").Failures = 3
+
+  for i := 0; i < 2; i++ {
+    engine.Apply(opts, st, []engine.Result{
+      { Path: "/ring.kdbx", Backend: "drive", Action: engine.ActionUpdated },
+      { Path: "/ring.kdbx", Backend: "dir", Action: engine.ActionFailed, Err: errors.New("disk full") },
+    }, nil)
+  }
+
+  path := filepath.Join(t.TempDir(), "keepassx_backup.prom")
+  if err := report.WriteMetrics(path, time.Now(), nil, st); err != nil {
+    t.Fatal(err)
+  }
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  metrics := string(b)
+  for _, want := range []string{
+    `keepassx_backup_failures_total{file="/ring.kdbx",backend="dir"} 2`,
+    `keepassx_backup_failures_total{file="/ring.kdbx",backend="drive"} 0`,
+    `keepassx_backup_failures_total{file="/old.kdbx"} 3`,
+    `keepassx_backup_last_success_timestamp_seconds{file="/ring.kdbx",backend="drive"} `,
+  } {
+    if !strings.Contains(metrics, want) {
+      t.Errorf("metrics lack %s:\n%s", want, metrics)
+    }
+  }
+  if strings.Contains(metrics, `keepassx_backup_last_success_timestamp_seconds{file="/ring.kdbx",backend="dir"}`) {
+    t.Errorf("metrics have last success of failing backend:\n%s", metrics)
+  }
+}
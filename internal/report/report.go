@@ -0,0 +1,73 @@
+// Package report describes finished runs in summaries, result files,
+// metrics and the history log.
+package report
+
+import (
+  "fmt"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+)
+
+// Run statuses, which notifications can be selected for.
+const (
+  StatusSuccess = "success"
+  StatusSkip    = "skip"
+  StatusFailure = "failure"
+)
+
+// Report describes a finished run.
+type Report struct {
+  Code     int
+  Results  []engine.Result
+  Duration time.Duration
+
+  // message describes an error which stopped the run before backing up files
+  Message string
+}
+
+// Status classifies the run as failed, successful if any file was uploaded,
+// or skipped if there was nothing to upload.
+func (r *Report) Status() string {
+  if r.Code == ExitSkipped {
+    return StatusSkip
+  }
+  if r.Code != ExitSuccess {
+    return StatusFailure
+  }
+  for _, f := range r.Results {
+    if f.Action == engine.ActionCreated || f.Action == engine.ActionUpdated || f.Action == engine.ActionRestored {
+      return StatusSuccess
+    }
+  }
+  return StatusSkip
+}
+
+// Title returns a short, human readable description of the run status.
+func (r *Report) Title() string {
+  switch r.Status() {
+  case StatusSuccess:
+    return "KeePassX backup succeeded"
+  case StatusSkip:
+    return "KeePassX backup is up to date"
+  default:
+    return "KeePassX backup failed"
+  }
+}
+
+// Text describes the result of the run, one file per line.
+func (r *Report) Text() string {
+  if r.Message != "" {
+    return r.Message
+  }
+  var b strings.Builder
+  for _, f := range r.Results {
+    fmt.Fprintf(&b, "%s (%s): %s", f.Path, f.Backend, f.Action)
+    if f.Err != nil {
+      fmt.Fprintf(&b, ": %v", f.Err)
+    }
+    b.WriteString("\n")
+  }
+  return b.String()
+}
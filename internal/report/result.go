@@ -0,0 +1,104 @@
+package report
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "log/slog"
+  "strings"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+)
+
+// RunResult is the content of the JSON result file.
+type RunResult struct {
+  Status    string    `json:"status"`
+  ExitCode  int       `json:"exit_code"`
+  Timestamp time.Time `json:"timestamp"`
+  Duration  float64   `json:"duration_seconds"`
+  Error     string    `json:"error,omitempty"`
+  // Queued is the number of backups queued until network connectivity returns
+  Queued int `json:"queued,omitempty"`
+}
+
+// ResultFileHandler creates a handler, writing the result of the run to a given file path.
+func ResultFileHandler(path string) func(r *Report) {
+  return func(r *Report) {
+    if err := r.SaveResult(path, time.Now()); err != nil {
+      slog.Error("Unable to write result file", "path", path, "error", err)
+    }
+  }
+}
+
+// ErrorText describes the errors of the run, if any.
+func (r *Report) ErrorText() string {
+  if r.Message != "" {
+    return r.Message
+  }
+  var errs []string
+  for _, f := range r.Results {
+    if f.Err != nil {
+      errs = append(errs, fmt.Sprintf("%s (%s): %v", f.Path, f.Backend, f.Err))
+    }
+  }
+  return strings.Join(errs, "; ")
+}
+
+// SaveResult writes the result of the run to a given file path, in the Prometheus
+// text format if the path ends with .prom, and as JSON otherwise.
+func (r *Report) SaveResult(path string, now time.Time) error {
+  var buf bytes.Buffer
+  if strings.HasSuffix(path, ".prom") {
+    fmt.Fprintln(&buf, "# HELP keepassx_backup_result_timestamp_seconds Time the last run finished.")
+    fmt.Fprintln(&buf, "# TYPE keepassx_backup_result_timestamp_seconds gauge")
+    fmt.Fprintf(&buf, "keepassx_backup_result_timestamp_seconds %d\n", now.Unix())
+    fmt.Fprintln(&buf, "# HELP keepassx_backup_result_exit_code Exit code of the last run.")
+    fmt.Fprintln(&buf, "# TYPE keepassx_backup_result_exit_code gauge")
+    fmt.Fprintf(&buf, "keepassx_backup_result_exit_code %d\n", r.Code)
+    fmt.Fprintln(&buf, "# HELP keepassx_backup_result_status Status of the last run.")
+    fmt.Fprintln(&buf, "# TYPE keepassx_backup_result_status gauge")
+    for _, status := range []string{ StatusSuccess, StatusSkip, StatusFailure } {
+      value := 0
+      if r.Status() == status {
+        value = 1
+      }
+      fmt.Fprintf(&buf, "keepassx_backup_result_status{status=\"%s\"} %d\n", status, value)
+    }
+  } else {
+    b, err := json.MarshalIndent(r.RunResult(now), "", "  ")
+    if err != nil {
+      return err
+    }
+    buf.Write(b)
+    buf.WriteString("\n")
+  }
+  return fsutil.WriteFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// RunResult returns the result of the run finished at a given time, as in the JSON result file.
+func (r *Report) RunResult(now time.Time) *RunResult {
+  result := &RunResult{ Status: r.Status(), ExitCode: r.Code, Timestamp: now, Duration: r.Duration.Seconds(),
+    Error: r.ErrorText() }
+  for _, f := range r.Results {
+    if f.Action == engine.ActionQueued {
+      result.Queued++
+    }
+  }
+  return result
+}
+
+// LoadResult reads the JSON result file from a given file path.
+func LoadResult(path string) (*RunResult, error) {
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  result := &RunResult{}
+  if err := json.Unmarshal(b, result); err != nil {
+    return nil, err
+  }
+  return result, nil
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+  "bytes"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+)
+
+// ANSI escape sequences coloring the rows of the summary table by action:
+// green for unchanged and verified files, yellow for uploaded ones and red for failures.
+const (
+  colorGreen  = "\x1b[32m"
+  colorYellow = "\x1b[33m"
+  colorRed    = "\x1b[31m"
+  colorReset  = "\x1b[0m"
+)
+
+var actionColors = map[engine.Action]string{
+  engine.ActionUnchanged: colorGreen,
+  engine.ActionCreated:   colorYellow,
+  engine.ActionUpdated:   colorYellow,
+  engine.ActionRestored:  colorYellow,
+  engine.ActionFailed:    colorRed,
+  engine.ActionVerified:  colorGreen,
+  engine.ActionMissing:   colorRed,
+  engine.ActionCorrupted: colorRed,
+}
+
+// ColorEnabled reports whether the summary written to a given file is colored:
+// it is a terminal, and neither NO_COLOR is set nor TERM is dumb.
+func ColorEnabled(f *os.File) bool {
+  if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+    return false
+  }
+  fi, err := f.Stat()
+  return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// WriteSummary writes a human readable summary of the run: totals of files
+// by action, transferred bytes and duration, followed by a table of files,
+// with the rows colored by action if color is set.
+func (r *Report) WriteSummary(w io.Writer, color bool) error {
+  counts := make(map[engine.Action]int)
+  var total int64
+  for _, f := range r.Results {
+    counts[f.Action]++
+    total += f.Bytes
+  }
+
+  fmt.Fprint(w, i18n.Sprintf("\nSummary: %d backups, %d created, %d updated, %d unchanged, %d queued, %d failed\n",
+    len(r.Results), counts[engine.ActionCreated], counts[engine.ActionUpdated], counts[engine.ActionUnchanged],
+    counts[engine.ActionQueued], counts[engine.ActionFailed]))
+  fmt.Fprint(w, i18n.Sprintf("Uploaded %s in %v\n\n", progress.FormatBytes(total), r.Duration.Round(time.Millisecond)))
+
+  // the escape sequences would count in the widths of the columns, so the aligned rows are colored
+  var table bytes.Buffer
+  tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(tw, i18n.T("FILE\tBACKEND\tACTION\tFORMAT\tUPLOADED\tDURATION\tERROR"))
+  for _, f := range r.Results {
+    errText := ""
+    if f.Err != nil {
+      errText = f.Err.Error()
+    }
+    fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\t%s\n", f.Path, f.Backend, f.Action, f.Format, progress.FormatBytes(f.Bytes),
+      f.Duration.Round(time.Millisecond), errText)
+  }
+  if err := tw.Flush(); err != nil {
+    return err
+  }
+  rows := strings.SplitAfter(table.String(), "\n")
+  for i, row := range rows {
+    if c := actionColors[resultAction(r.Results, i-1)]; color && c != "" {
+      row = c + strings.TrimSuffix(row, "\n") + colorReset + "\n"
+    }
+    if _, err := io.WriteString(w, row); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// resultAction returns the action of the result with a given index, if any.
+func resultAction(results []engine.Result, i int) engine.Action {
+  if i < 0 || i >= len(results) {
+    return ""
+  }
+  return results[i].Action
+}
+
+// SaveSummary writes the summary of the run to a given file path.
+func (r *Report) SaveSummary(path string) error {
+  var buf bytes.Buffer
+  if err := r.WriteSummary(&buf, false); err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,77 @@
+// Package seal encrypts small files with a passphrase, using AES-256-GCM with
+// the key derived with scrypt. Sealed data holds the salt, followed by the nonce
+// and the encrypted data.
+package seal
+
+import (
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "errors"
+
+  "golang.org/x/crypto/scrypt"
+)
+
+// Parameters of deriving the key from the passphrase.
+const (
+  scryptN  = 1 << 15
+  saltSize = 16
+  keySize  = 32
+)
+
+// ErrTruncated is returned by Open for data too short to be sealed.
+var ErrTruncated = errors.New("sealed data is truncated")
+
+// ErrWrongPassphrase is returned by Open, when the data cannot be decrypted.
+var ErrWrongPassphrase = errors.New("unable to decrypt, wrong passphrase?")
+
+// aead derives the key from the passphrase and a salt.
+func aead(passphrase string, salt []byte) (cipher.AEAD, error) {
+  key, err := scrypt.Key([]byte(passphrase), salt, scryptN, 8, 1, keySize)
+  if err != nil {
+    return nil, err
+  }
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  return cipher.NewGCM(block)
+}
+
+// Seal encrypts data with a passphrase.
+func Seal(plain []byte, passphrase string) ([]byte, error) {
+  salt := make([]byte, saltSize)
+  if _, err := rand.Read(salt); err != nil {
+    return nil, err
+  }
+  a, err := aead(passphrase, salt)
+  if err != nil {
+    return nil, err
+  }
+  nonce := make([]byte, a.NonceSize())
+  if _, err := rand.Read(nonce); err != nil {
+    return nil, err
+  }
+  out := append(salt, nonce...)
+  return a.Seal(out, nonce, plain, nil), nil
+}
+
+// Open decrypts data sealed with a passphrase.
+func Open(sealed []byte, passphrase string) ([]byte, error) {
+  if len(sealed) < saltSize {
+    return nil, ErrTruncated
+  }
+  a, err := aead(passphrase, sealed[:saltSize])
+  if err != nil {
+    return nil, err
+  }
+  sealed = sealed[saltSize:]
+  if len(sealed) < a.NonceSize() {
+    return nil, ErrTruncated
+  }
+  plain, err := a.Open(nil, sealed[:a.NonceSize()], sealed[a.NonceSize():], nil)
+  if err != nil {
+    return nil, ErrWrongPassphrase
+  }
+  return plain, nil
+}
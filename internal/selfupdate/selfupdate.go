@@ -0,0 +1,261 @@
+// Package selfupdate replaces the running executable with the latest release
+// published on GitHub, verifying its checksum and signature.
+package selfupdate
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/ed25519"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "log/slog"
+  "net/http"
+  "os"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+)
+
+// Version is the version of the running executable, set when building a release
+// with -ldflags "-X github.com/pawelu/keepassx_backup_tool/internal/selfupdate.Version=v1.2.3".
+var Version = "dev"
+
+// PublicKey is the base64 encoded Ed25519 key, which the checksums file of releases
+// is signed with, set with -ldflags like Version. Without it, only checksums are verified.
+var PublicKey = ""
+
+// releasesURL is the GitHub API endpoint of the latest release.
+const releasesURL = "https://api.github.com/repos/pawelu/keepassx_backup_tool/releases/latest"
+
+// Names of the release assets besides the executables.
+const (
+  checksumsAsset = "SHA256SUMS"
+  signatureAsset = "SHA256SUMS.sig"
+)
+
+// maxAssetSize limits downloads, so a broken release cannot fill the disk.
+const maxAssetSize = 256 << 20
+
+// release is the part of a GitHub release used here.
+type release struct {
+  TagName string  `json:"tag_name"`
+  Assets  []asset `json:"assets"`
+}
+
+type asset struct {
+  Name string `json:"name"`
+  URL  string `json:"browser_download_url"`
+}
+
+// AssetName returns the name of the release executable of the running platform.
+func AssetName() string {
+  name := fmt.Sprintf("keepassx_backup_tool_%s_%s", runtime.GOOS, runtime.GOARCH)
+  if runtime.GOOS == "windows" {
+    name += ".exe"
+  }
+  return name
+}
+
+// Update replaces the running executable with the latest release, if it is newer.
+// It returns the version of the latest release, and whether it was installed.
+func Update(ctx context.Context, client *http.Client, logger *slog.Logger) (string, bool, error) {
+  var rel release
+  b, err := get(ctx, client, releasesURL)
+  if err != nil {
+    return "", false, fmt.Errorf("Unable to get latest release: %v", err)
+  }
+  if err := json.Unmarshal(b, &rel); err != nil {
+    return "", false, fmt.Errorf("Unable to parse latest release: %v", err)
+  }
+  if !newer(rel.TagName, Version) {
+    logger.Info("Already up to date", "version", Version, "latest", rel.TagName)
+    return rel.TagName, false, nil
+  }
+
+  urls := make(map[string]string)
+  for _, a := range rel.Assets {
+    urls[a.Name] = a.URL
+  }
+  name := AssetName()
+  if urls[name] == "" || urls[checksumsAsset] == "" {
+    return rel.TagName, false, fmt.Errorf("Release %s has no %s or %s", rel.TagName, name, checksumsAsset)
+  }
+
+  sums, err := get(ctx, client, urls[checksumsAsset])
+  if err != nil {
+    return rel.TagName, false, fmt.Errorf("Unable to download %s: %v", checksumsAsset, err)
+  }
+  if err := verifySignature(ctx, client, sums, urls[signatureAsset], logger); err != nil {
+    return rel.TagName, false, err
+  }
+  want, err := checksum(sums, name)
+  if err != nil {
+    return rel.TagName, false, err
+  }
+
+  exe, err := os.Executable()
+  if err != nil {
+    return rel.TagName, false, err
+  }
+  if exe, err = filepath.EvalSymlinks(exe); err != nil {
+    return rel.TagName, false, err
+  }
+  logger.Info("Downloading release", "version", rel.TagName, "asset", name)
+  tmp, err := download(ctx, client, urls[name], filepath.Dir(exe), want)
+  if err != nil {
+    return rel.TagName, false, err
+  }
+  if err := replace(exe, tmp); err != nil {
+    os.Remove(tmp)
+    return rel.TagName, false, fmt.Errorf("Unable to replace %s: %v", exe, err)
+  }
+  return rel.TagName, true, nil
+}
+
+// verifySignature verifies the Ed25519 signature of the checksums file with PublicKey.
+func verifySignature(ctx context.Context, client *http.Client, sums []byte, sigURL string, logger *slog.Logger) error {
+  if PublicKey == "" {
+    logger.Warn("This build has no release signing key, verifying the checksum only")
+    return nil
+  }
+  key, err := base64.StdEncoding.DecodeString(PublicKey)
+  if err != nil || len(key) != ed25519.PublicKeySize {
+    return fmt.Errorf("Invalid release signing key built in")
+  }
+  if sigURL == "" {
+    return fmt.Errorf("Release has no %s", signatureAsset)
+  }
+  sig, err := get(ctx, client, sigURL)
+  if err != nil {
+    return fmt.Errorf("Unable to download %s: %v", signatureAsset, err)
+  }
+  if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+    return fmt.Errorf("Signature of %s does not match, refusing to update", checksumsAsset)
+  }
+  return nil
+}
+
+// checksum finds the SHA-256 hash of an asset in a checksums file in the format of sha256sum.
+func checksum(sums []byte, name string) (string, error) {
+  s := bufio.NewScanner(bytes.NewReader(sums))
+  for s.Scan() {
+    fields := strings.Fields(s.Text())
+    if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+      return strings.ToLower(fields[0]), nil
+    }
+  }
+  return "", fmt.Errorf("No checksum of %s in %s", name, checksumsAsset)
+}
+
+// download downloads the executable to a temporary file in a given directory,
+// verifying its SHA-256 hash.
+// It returns the path of the temporary file.
+func download(ctx context.Context, client *http.Client, url, dir, want string) (string, error) {
+  resp, err := request(ctx, client, url)
+  if err != nil {
+    return "", err
+  }
+  defer resp.Body.Close()
+
+  f, err := ioutil.TempFile(dir, ".keepassx_backup_tool-update-")
+  if err != nil {
+    return "", err
+  }
+  h := sha256.New()
+  _, err = io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxAssetSize))
+  if closeErr := f.Close(); err == nil {
+    err = closeErr
+  }
+  if err == nil && hex.EncodeToString(h.Sum(nil)) != want {
+    err = fmt.Errorf("Checksum of the downloaded executable does not match, refusing to update")
+  }
+  if err == nil {
+    err = os.Chmod(f.Name(), 0755)
+  }
+  if err != nil {
+    os.Remove(f.Name())
+    return "", err
+  }
+  return f.Name(), nil
+}
+
+// replace moves the new executable over the running one. Windows does not replace
+// a running executable, but lets it be renamed, so the old one is kept as .old there.
+func replace(exe, tmp string) error {
+  if runtime.GOOS != "windows" {
+    return os.Rename(tmp, exe)
+  }
+  old := exe + ".old"
+  os.Remove(old)
+  if err := os.Rename(exe, old); err != nil {
+    return err
+  }
+  if err := os.Rename(tmp, exe); err != nil {
+    os.Rename(old, exe)
+    return err
+  }
+  return nil
+}
+
+// get downloads a small file.
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+  resp, err := request(ctx, client, url)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// request sends a GET request, failing unless the response is 200 OK.
+func request(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+  req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+  if err != nil {
+    return nil, err
+  }
+  req.Header.Set("Accept", "application/vnd.github+json")
+  resp, err := client.Do(req)
+  if err != nil {
+    return nil, err
+  }
+  if resp.StatusCode != http.StatusOK {
+    resp.Body.Close()
+    return nil, fmt.Errorf("%s: %s", url, resp.Status)
+  }
+  return resp, nil
+}
+
+// newer reports whether version a, like v1.2.3, is newer than b.
+// Development builds are older than every release.
+func newer(a, b string) bool {
+  if b == "dev" {
+    return a != ""
+  }
+  pa, pb := parseVersion(a), parseVersion(b)
+  for i := range pa {
+    if pa[i] != pb[i] {
+      return pa[i] > pb[i]
+    }
+  }
+  return false
+}
+
+// parseVersion parses the major, minor and patch numbers of a version, ignoring suffixes.
+func parseVersion(v string) [3]int {
+  var p [3]int
+  v = strings.TrimPrefix(v, "v")
+  if i := strings.IndexAny(v, "-+"); i >= 0 {
+    v = v[:i]
+  }
+  for i, s := range strings.SplitN(v, ".", 3) {
+    p[i], _ = strconv.Atoi(s)
+  }
+  return p
+}
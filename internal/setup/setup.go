@@ -0,0 +1,115 @@
+// Package setup exports the setup of the application to a file, and imports it on another machine:
+// the options, the files backed up, and the Drive credentials, optionally sealed with a passphrase.
+package setup
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "time"
+
+  "golang.org/x/oauth2"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/seal"
+)
+
+// Version is the version of the format of the setup files written.
+const Version = 1
+
+// PassphraseEnv is the environment variable holding the passphrase of the sealed secrets,
+// which may also be read from the file named by PassphraseEnv_FILE, or the descriptor by PassphraseEnv_FD.
+const PassphraseEnv = config.EnvPrefix + "SETUP_PASSPHRASE"
+
+// ErrSealed is returned by File.Open without the passphrase of sealed secrets.
+var ErrSealed = errors.New("the secrets are sealed with a passphrase")
+
+// File is an exported setup.
+type File struct {
+  Version  int       `json:"version"`
+  Created  time.Time `json:"created"`
+  Hostname string    `json:"hostname,omitempty"`
+
+  // Flags are the options set on the exporting machine, in the command line or the environment
+  Flags []string `json:"flags,omitempty"`
+
+  // Files are the paths of the files backed up
+  Files []string `json:"files"`
+
+  // Secrets are the Drive credentials, unless sealed
+  Secrets *Secrets `json:"secrets,omitempty"`
+
+  // Sealed are the secrets encrypted with a passphrase, see the seal package
+  Sealed []byte `json:"sealed,omitempty"`
+}
+
+// Secrets are the credentials of a setup.
+type Secrets struct {
+  ClientSecret   json.RawMessage `json:"client_secret,omitempty"`
+  ServiceAccount json.RawMessage `json:"service_account,omitempty"`
+
+  // Token is the OAuth token authorized with the client secret, if any
+  Token *oauth2.Token `json:"token,omitempty"`
+
+  // Flags are the options holding secrets, e.g. tokens of the notifications
+  Flags []string `json:"flags,omitempty"`
+}
+
+// Seal encrypts the secrets with a passphrase.
+func (f *File) Seal(passphrase string) error {
+  plain, err := json.Marshal(f.Secrets)
+  if err != nil {
+    return err
+  }
+  if f.Sealed, err = seal.Seal(plain, passphrase); err != nil {
+    return err
+  }
+  f.Secrets = nil
+  return nil
+}
+
+// Open decrypts the secrets sealed with a passphrase, if they are sealed.
+func (f *File) Open(passphrase string) error {
+  if len(f.Sealed) == 0 {
+    return nil
+  }
+  if passphrase == "" {
+    return ErrSealed
+  }
+  plain, err := seal.Open(f.Sealed, passphrase)
+  if err != nil {
+    return fmt.Errorf("Unable to decrypt the secrets of the setup: %w", err)
+  }
+  s := &Secrets{}
+  if err := json.Unmarshal(plain, s); err != nil {
+    return fmt.Errorf("Unable to parse the secrets of the setup: %v", err)
+  }
+  f.Secrets, f.Sealed = s, nil
+  return nil
+}
+
+// Marshal encodes the setup as indented JSON.
+func (f *File) Marshal() ([]byte, error) {
+  b, err := json.MarshalIndent(f, "", "  ")
+  if err != nil {
+    return nil, err
+  }
+  return append(b, '\n'), nil
+}
+
+// Load reads a setup from a file.
+func Load(path string) (*File, error) {
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  f := &File{}
+  if err := json.Unmarshal(b, f); err != nil {
+    return nil, fmt.Errorf("Unable to parse setup file %s: %v", path, err)
+  }
+  if f.Version < 1 || f.Version > Version {
+    return nil, fmt.Errorf("Unsupported version %d of setup file %s", f.Version, path)
+  }
+  return f, nil
+}
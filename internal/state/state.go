@@ -0,0 +1,295 @@
+// Package state keeps the state of backed up files between runs.
+package state
+
+import (
+  "encoding/json"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/fsutil"
+  "github.com/pawelu/keepassx_backup_tool/internal/hashing"
+)
+
+// State is kept between runs in the state directory.
+type State struct {
+  // Pending lists backups which could not be uploaded because of
+  // missing network connectivity.
+  Pending []PendingBackup `json:"pending,omitempty"`
+
+  // Files holds the state of every backed up file, by local path.
+  Files map[string]*FileState `json:"files,omitempty"`
+
+  // Folders holds the ids of the backups folders, by the options selecting them.
+  Folders map[string]string `json:"folders,omitempty"`
+
+  // mu guards Files while files are backed up in parallel
+  mu sync.Mutex
+}
+
+// FileState is the state of a single backed up file.
+type FileState struct {
+  // RemoteId is the Drive id of the backup.
+  RemoteId string `json:"remote_id,omitempty"`
+
+  // Remotes holds the ids of the backups by the other backends.
+  Remotes map[string]string `json:"remotes,omitempty"`
+
+  // LastBackup is the time of the last successful sync.
+  LastBackup time.Time `json:"last_backup,omitempty"`
+
+  // Failures counts failed syncs since the state was created.
+  Failures int `json:"failures,omitempty"`
+
+  // Backends holds the last successful sync and the failed syncs by backend.
+  Backends map[string]*BackendState `json:"backends,omitempty"`
+
+  // Hash is the md5 hash of the local file, when it had Size and ModTime.
+  Hash    string    `json:"hash,omitempty"`
+  Size    int64     `json:"size,omitempty"`
+  ModTime time.Time `json:"mod_time,omitempty"`
+
+  // Inode identifies the local file on its file system, telling it was renamed, 0 if unknown.
+  Inode uint64 `json:"inode,omitempty"`
+
+  // Target is the real path of the local file, when its path is a symlink.
+  Target string `json:"target,omitempty"`
+
+  // SHA256 is the sha256 hash of the local file with Hash, if the file has been snapshotted.
+  SHA256 string `json:"sha256,omitempty"`
+
+  // PayloadHash is the md5 hash of the file compressed with Compression.
+  Compression string `json:"compression,omitempty"`
+  PayloadHash string `json:"payload_hash,omitempty"`
+
+  // Synced holds the md5 hashes of the backups as of the last sync, by backend,
+  // telling backups changed elsewhere since then.
+  Synced map[string]string `json:"synced,omitempty"`
+}
+
+// BackendState is the state of the backups of a single file by a backend.
+type BackendState struct {
+  // LastBackup is the time of the last successful sync to the backend.
+  LastBackup time.Time `json:"last_backup,omitempty"`
+
+  // Failures counts failed syncs to the backend since it was first backed up to.
+  Failures int `json:"failures,omitempty"`
+}
+
+// PendingBackup is a backup waiting for network connectivity.
+type PendingBackup struct {
+  Path     string    `json:"path"`
+  Hash     string    `json:"hash"`
+  QueuedAt time.Time `json:"queued_at"`
+}
+
+// CacheFile generates state file path/filename.
+// It returns the generated state path/filename.
+func CacheFile() (string, error) {
+  dir, err := config.StateDir()
+  if err != nil {
+    return "", err
+  }
+  return filepath.Join(dir, "state.json"), nil
+}
+
+// Load reads the state from a given file path.
+// A missing file results in an empty state.
+func Load(file string) (*State, error) {
+  st := &State{}
+  b, err := ioutil.ReadFile(file)
+  if os.IsNotExist(err) {
+    return st, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  err = json.Unmarshal(b, st)
+  return st, err
+}
+
+// Save writes the state to a given file path, replacing the previous
+// file only once the new one is completely written.
+func Save(file string, st *State) error {
+  b, err := json.MarshalIndent(st, "", "  ")
+  if err != nil {
+    return err
+  }
+  return fsutil.WriteFileAtomic(file, b, 0600)
+}
+
+// File returns the state of a given file, adding it if necessary.
+func (st *State) File(path string) *FileState {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  if st.Files == nil {
+    st.Files = make(map[string]*FileState)
+  }
+  fs, ok := st.Files[path]
+  if !ok {
+    fs = &FileState{}
+    st.Files[path] = fs
+  }
+  return fs
+}
+
+// Move moves the state of a file to another path, e.g. after the file was renamed.
+func (st *State) Move(from, to string) {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  fs, ok := st.Files[from]
+  if !ok {
+    return
+  }
+  delete(st.Files, from)
+  st.Files[to] = fs
+}
+
+// FolderId returns the id of the backups folder remembered with a given key, or "".
+func (st *State) FolderId(key string) string {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  return st.Folders[key]
+}
+
+// SetFolderId remembers the id of the backups folder with a given key.
+func (st *State) SetFolderId(key, id string) {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  if st.Folders == nil {
+    st.Folders = make(map[string]string)
+  }
+  st.Folders[key] = id
+}
+
+// BackendId returns the id of the backup by a given backend.
+func (fs *FileState) BackendId(backend string) string {
+  if backend == "drive" {
+    return fs.RemoteId
+  }
+  return fs.Remotes[backend]
+}
+
+// SetBackendId remembers the id of the backup by a given backend.
+func (fs *FileState) SetBackendId(backend, id string) {
+  if backend == "drive" {
+    fs.RemoteId = id
+    return
+  }
+  if fs.Remotes == nil {
+    fs.Remotes = make(map[string]string)
+  }
+  fs.Remotes[backend] = id
+}
+
+// Backend returns the state of the backups by a given backend, adding it if necessary.
+func (fs *FileState) Backend(backend string) *BackendState {
+  if fs.Backends == nil {
+    fs.Backends = make(map[string]*BackendState)
+  }
+  bs, ok := fs.Backends[backend]
+  if !ok {
+    bs = &BackendState{}
+    fs.Backends[backend] = bs
+  }
+  return bs
+}
+
+// SyncedHash returns the hash of the backup by a given backend as of the last sync, or "".
+func (fs *FileState) SyncedHash(backend string) string {
+  return fs.Synced[backend]
+}
+
+// SetSyncedHash remembers the hash of the backup by a given backend as of this sync.
+func (fs *FileState) SetSyncedHash(backend, hash string) {
+  if fs.Synced == nil {
+    fs.Synced = make(map[string]string)
+  }
+  fs.Synced[backend] = hash
+}
+
+// CachedHash returns the hash of the file, if its size and modification
+// time are still the same as when it was hashed, or "" otherwise.
+func (fs *FileState) CachedHash(info os.FileInfo) string {
+  if fs.Hash == "" || fs.Size != info.Size() || !fs.ModTime.Equal(info.ModTime()) {
+    return ""
+  }
+  return fs.Hash
+}
+
+// CacheHash remembers the hash of the file with the given metadata.
+func (fs *FileState) CacheHash(info os.FileInfo, hash string) {
+  if hash != fs.Hash {
+    fs.Compression, fs.PayloadHash, fs.SHA256 = "", "", ""
+  }
+  fs.Hash, fs.Size, fs.ModTime = hash, info.Size(), info.ModTime()
+}
+
+// CacheSHA256 remembers the sha256 hash of the file with the cached md5 hash.
+func (fs *FileState) CacheSHA256(hash string) {
+  fs.SHA256 = hash
+}
+
+// CachedPayloadHash returns the hash of the file compressed with a given compression,
+// or of the file itself without one, if the file has not changed since it was hashed,
+// or "" otherwise.
+func (fs *FileState) CachedPayloadHash(info os.FileInfo, compression string) string {
+  hash := fs.CachedHash(info)
+  if hash == "" || compression == "" {
+    return hash
+  }
+  if fs.Compression != compression {
+    return ""
+  }
+  return fs.PayloadHash
+}
+
+// CachePayloadHash remembers the hash of the file compressed with a given compression.
+func (fs *FileState) CachePayloadHash(compression, hash string) {
+  fs.Compression, fs.PayloadHash = compression, hash
+}
+
+// RemovePending drops the queued backup of a given file, if any.
+func (st *State) RemovePending(path string) {
+  pending := st.Pending[:0]
+  for _, p := range st.Pending {
+    if p.Path != path {
+      pending = append(pending, p)
+    }
+  }
+  st.Pending = pending
+}
+
+// QueueBackups records backups of given files to be uploaded on next sync.
+func QueueBackups(st *State, paths []string) {
+  for _, path := range paths {
+    // hash is informational, the current content is uploaded on next sync
+    hash, _ := st.FileHash(path)
+    st.RemovePending(path)
+    st.Pending = append(st.Pending, PendingBackup{ Path: path, Hash: hash, QueuedAt: time.Now() })
+  }
+}
+
+// FileHash calculates the md5 hash of the file at the given path,
+// unless it is cached already.
+func (st *State) FileHash(path string) (string, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return "", err
+  }
+  fs := st.File(path)
+  if cached := fs.CachedHash(info); cached != "" {
+    return cached, nil
+  }
+  hash, err := hashing.FileHash(path)
+  if err != nil {
+    return "", err
+  }
+  if modified, err := hashing.IsModified(path, info); err == nil && !modified {
+    fs.CacheHash(info, hash)
+  }
+  return hash, nil
+}
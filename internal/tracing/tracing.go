@@ -0,0 +1,69 @@
+// Package tracing exports OpenTelemetry spans of a run.
+package tracing
+
+import (
+  "context"
+  "os"
+  "time"
+
+  "go.opentelemetry.io/otel"
+  "go.opentelemetry.io/otel/codes"
+  "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+  "go.opentelemetry.io/otel/sdk/resource"
+  sdktrace "go.opentelemetry.io/otel/sdk/trace"
+  semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+  "go.opentelemetry.io/otel/trace"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// Tracer creates the spans of a run. Without an exporter it uses
+// the no-op global provider, so tracing costs nothing.
+var Tracer = otel.Tracer("github.com/pawelu/keepassx_backup_tool")
+
+// tracingShutdownTimeout limits how long exporting the remaining spans may take.
+const tracingShutdownTimeout = 5 * time.Second
+
+// Setup installs an OTLP/HTTP span exporter, when an endpoint is
+// given with -otlp-endpoint or the standard OTEL_EXPORTER_OTLP_* variables.
+// It returns the function flushing the spans, to be called before exiting.
+func Setup(ctx context.Context, opts *config.Options) (func(), error) {
+  if opts.OtlpEndpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" &&
+    os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+    return func() {}, nil
+  }
+
+  var exporterOpts []otlptracehttp.Option
+  if opts.OtlpEndpoint != "" {
+    exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(opts.OtlpEndpoint))
+  }
+  exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+  if err != nil {
+    return nil, err
+  }
+
+  provider := sdktrace.NewTracerProvider(
+    sdktrace.WithBatcher(exporter),
+    sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+      semconv.ServiceName("keepassx_backup_tool"))),
+  )
+  otel.SetTracerProvider(provider)
+  Tracer = provider.Tracer("github.com/pawelu/keepassx_backup_tool")
+
+  return func() {
+    ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+    defer cancel()
+    provider.Shutdown(ctx)
+  }, nil
+}
+
+// EndSpan ends a span, marking it as failed if err is not nil.
+// It returns err, so it can wrap a returned error.
+func EndSpan(span trace.Span, err error) error {
+  if err != nil {
+    span.RecordError(err)
+    span.SetStatus(codes.Error, err.Error())
+  }
+  span.End()
+  return err
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+  "bufio"
+  "context"
+  "crypto/tls"
+  "encoding/base64"
+  "fmt"
+  "net"
+  "net/http"
+  "net/url"
+  "time"
+
+  "golang.org/x/net/proxy"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// DialFunc connects to an address, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialer creates the dialer of connections, which are not HTTP requests, e.g. to an MQTT broker,
+// through the -proxy proxy, if any: an HTTP(S) proxy tunnels the connection with CONNECT,
+// and a SOCKS5 proxy connects itself. The proxy environment variables are for HTTP only.
+func NewDialer(opts *config.Options, timeout time.Duration) (DialFunc, error) {
+  dialer := &net.Dialer{ Timeout: timeout }
+  if opts.Proxy == "" {
+    return dialer.DialContext, nil
+  }
+  proxyURL, err := url.Parse(opts.Proxy)
+  if err != nil {
+    return nil, fmt.Errorf("invalid proxy URL %q: %v", opts.Proxy, err)
+  }
+  switch proxyURL.Scheme {
+  case "http", "https":
+    tlsConfig, err := NewTLSConfig(opts)
+    if err != nil {
+      return nil, err
+    }
+    return func(ctx context.Context, network, addr string) (net.Conn, error) {
+      return dialConnect(ctx, dialer, tlsConfig, proxyURL, addr)
+    }, nil
+  case "socks5", "socks5h":
+    d, err := proxy.FromURL(proxyURL, dialer)
+    if err != nil {
+      return nil, fmt.Errorf("invalid proxy URL %q: %v", opts.Proxy, err)
+    }
+    if cd, ok := d.(proxy.ContextDialer); ok {
+      return cd.DialContext, nil
+    }
+    return func(ctx context.Context, network, addr string) (net.Conn, error) {
+      return d.Dial(network, addr)
+    }, nil
+  default:
+    return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+  }
+}
+
+// dialConnect connects to an address through a tunnel opened with CONNECT by an HTTP(S) proxy.
+func dialConnect(ctx context.Context, dialer *net.Dialer, tlsConfig *tls.Config, proxyURL *url.URL, addr string) (net.Conn, error) {
+  proxyAddr := proxyURL.Host
+  if proxyURL.Port() == "" {
+    port := "80"
+    if proxyURL.Scheme == "https" {
+      port = "443"
+    }
+    proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+  }
+  conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+  if err != nil {
+    return nil, err
+  }
+  if proxyURL.Scheme == "https" {
+    config := tlsConfig.Clone()
+    config.ServerName = proxyURL.Hostname()
+    tlsConn := tls.Client(conn, config)
+    if err := tlsConn.HandshakeContext(ctx); err != nil {
+      conn.Close()
+      return nil, err
+    }
+    conn = tlsConn
+  }
+  if deadline, ok := ctx.Deadline(); ok {
+    conn.SetDeadline(deadline)
+  }
+
+  req := &http.Request{ Method: http.MethodConnect, URL: &url.URL{ Opaque: addr }, Host: addr, Header: make(http.Header) }
+  if u := proxyURL.User; u != nil {
+    password, _ := u.Password()
+    req.Header.Set("Proxy-Authorization",
+      "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+  }
+  if err := req.Write(conn); err != nil {
+    conn.Close()
+    return nil, err
+  }
+  br := bufio.NewReader(conn)
+  resp, err := http.ReadResponse(br, req)
+  if err != nil {
+    conn.Close()
+    return nil, err
+  }
+  resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    conn.Close()
+    return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxyURL.Host, addr, resp.Status)
+  }
+  conn.SetDeadline(time.Time{})
+  // the server may speak first, right behind the response of the proxy
+  if br.Buffered() > 0 {
+    return &bufferedConn{ Conn: conn, r: br }, nil
+  }
+  return conn, nil
+}
+
+// bufferedConn is a connection, whose first bytes were read into a buffer already.
+type bufferedConn struct {
+  net.Conn
+  r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+  return c.r.Read(b)
+}
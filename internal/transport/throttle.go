@@ -0,0 +1,151 @@
+package transport
+
+import (
+  "fmt"
+  "io"
+  "net/http"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// throttleChunk is the largest amount of data sent without waiting,
+// so the rate is smooth also for large reads.
+const throttleChunk = 16 * 1024
+
+// bwEntry limits the bandwidth from a given minute of the day on.
+type bwEntry struct {
+  minute int
+  // rate is in bytes per second, 0 means unlimited
+  rate int64
+}
+
+// bwSchedule is a list of bandwidth limits sorted by the time they begin.
+type bwSchedule []bwEntry
+
+// parseBwLimit parses a bandwidth limit, either a single rate like 512k or 2M,
+// or a schedule of space separated HH:MM,rate entries like "08:00,512k 23:00,off".
+// Rates are in bytes per second with an optional k, M or G suffix, and 0 or off
+// stands for unlimited.
+func parseBwLimit(s string) (bwSchedule, error) {
+  if !strings.Contains(s, ",") {
+    rate, err := parseRate(s)
+    if err != nil {
+      return nil, err
+    }
+    return bwSchedule{ { minute: 0, rate: rate } }, nil
+  }
+
+  var schedule bwSchedule
+  for _, entry := range strings.Fields(s) {
+    parts := strings.SplitN(entry, ",", 2)
+    if len(parts) != 2 {
+      return nil, fmt.Errorf("invalid schedule entry %q, expected HH:MM,rate", entry)
+    }
+    t, err := time.Parse("15:04", parts[0])
+    if err != nil {
+      return nil, fmt.Errorf("invalid time %q, expected HH:MM", parts[0])
+    }
+    rate, err := parseRate(parts[1])
+    if err != nil {
+      return nil, err
+    }
+    schedule = append(schedule, bwEntry{ minute: t.Hour()*60 + t.Minute(), rate: rate })
+  }
+  sort.Slice(schedule, func(i, j int) bool { return schedule[i].minute < schedule[j].minute })
+  return schedule, nil
+}
+
+// parseRate parses a rate in bytes per second.
+func parseRate(s string) (int64, error) {
+  if s == "off" {
+    return 0, nil
+  }
+  rate, err := config.ParseSize(s)
+  if err != nil {
+    return 0, fmt.Errorf("invalid rate %q", s)
+  }
+  return rate, nil
+}
+
+// rateAt returns the rate limit in force at a given time, in bytes per second.
+// Before the first entry of the day, the last entry of the previous day applies.
+func (s bwSchedule) rateAt(t time.Time) int64 {
+  minute := t.Hour()*60 + t.Minute()
+  rate := s[len(s)-1].rate
+  for _, e := range s {
+    if e.minute > minute {
+      break
+    }
+    rate = e.rate
+  }
+  return rate
+}
+
+// bwLimiter spreads the data sent by all uploads over time,
+// so together they stay within the scheduled rate.
+type bwLimiter struct {
+  schedule bwSchedule
+
+  mu   sync.Mutex
+  next time.Time
+}
+
+// wait blocks until n more bytes may be sent.
+func (l *bwLimiter) wait(n int) {
+  now := time.Now()
+  rate := l.schedule.rateAt(now)
+  if rate <= 0 {
+    return
+  }
+
+  l.mu.Lock()
+  // unused bandwidth is not saved up for later
+  if l.next.Before(now) {
+    l.next = now
+  }
+  delay := l.next.Sub(now)
+  l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+  l.mu.Unlock()
+
+  time.Sleep(delay)
+}
+
+// throttledBody limits the rate a request body is read at.
+type throttledBody struct {
+  body    io.ReadCloser
+  limiter *bwLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+  if len(p) > throttleChunk {
+    p = p[:throttleChunk]
+  }
+  n, err := b.body.Read(p)
+  if n > 0 {
+    b.limiter.wait(n)
+  }
+  return n, err
+}
+
+func (b *throttledBody) Close() error {
+  return b.body.Close()
+}
+
+// throttlingTransport limits the upload bandwidth of all requests.
+type throttlingTransport struct {
+  base    http.RoundTripper
+  limiter *bwLimiter
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  if req.Body == nil || req.Body == http.NoBody {
+    return t.base.RoundTrip(req)
+  }
+  throttled := req.Clone(req.Context())
+  throttled.Body = &throttledBody{ body: req.Body, limiter: t.limiter }
+  return t.base.RoundTrip(throttled)
+}
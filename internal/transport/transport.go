@@ -0,0 +1,202 @@
+// Package transport creates the HTTP client used for all OAuth and Drive traffic.
+package transport
+
+import (
+  "crypto/tls"
+  "crypto/x509"
+  "fmt"
+  "io/ioutil"
+  "log/slog"
+  "net/http"
+  "net/url"
+  "regexp"
+  "strings"
+  "time"
+
+  "golang.org/x/net/http2"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+)
+
+// NewHTTPClient creates the HTTP client used for all OAuth and Drive traffic.
+// Without an explicit proxy URL, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables are honored.
+func NewHTTPClient(opts *config.Options) (*http.Client, error) {
+  transport := http.DefaultTransport.(*http.Transport).Clone()
+
+  if opts.Proxy != "" {
+    proxyURL, err := url.Parse(opts.Proxy)
+    if err != nil {
+      return nil, fmt.Errorf("invalid proxy URL %q: %v", opts.Proxy, err)
+    }
+    // net/http lets the SOCKS5 proxy resolve host names for both socks5 and socks5h
+    switch proxyURL.Scheme {
+    case "http", "https", "socks5", "socks5h":
+    default:
+      return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+    }
+    transport.Proxy = http.ProxyURL(proxyURL)
+  } else {
+    transport.Proxy = http.ProxyFromEnvironment
+  }
+
+  tlsConfig, err := NewTLSConfig(opts)
+  if err != nil {
+    return nil, err
+  }
+  transport.TLSClientConfig = tlsConfig
+
+  // all requests of a run share this transport, so keep enough idle connections
+  // for parallel uploads to be reused instead of opening new ones
+  transport.MaxIdleConnsPerHost = opts.Jobs + 2
+  transport.IdleConnTimeout = idleConnTimeout
+  if err := configureHTTP2(transport); err != nil {
+    return nil, err
+  }
+
+  var rt http.RoundTripper = transport
+  if opts.BwLimit != "" {
+    schedule, err := parseBwLimit(opts.BwLimit)
+    if err != nil {
+      return nil, fmt.Errorf("invalid bandwidth limit: %v", err)
+    }
+    rt = &throttlingTransport{ base: rt, limiter: &bwLimiter{ schedule: schedule } }
+  }
+  if opts.DebugHTTP {
+    rt = &loggingTransport{ base: rt }
+  }
+  return &http.Client{ Transport: rt }, nil
+}
+
+// idleConnTimeout is how long an unused connection is kept open for reuse.
+const idleConnTimeout = 5 * time.Minute
+
+// HTTP/2 health checks, which detect connections broken by a flaky link,
+// instead of waiting for the TCP timeout.
+const (
+  http2ReadIdleTimeout = 30 * time.Second
+  http2PingTimeout     = 15 * time.Second
+)
+
+// configureHTTP2 enables HTTP/2 with a custom TLS configuration, sending pings
+// on connections with no frames received for a while, and closing the ones
+// which do not answer, so the next request opens a working one.
+func configureHTTP2(transport *http.Transport) error {
+  t2, err := http2.ConfigureTransports(transport)
+  if err != nil {
+    return fmt.Errorf("unable to configure HTTP/2: %v", err)
+  }
+  t2.ReadIdleTimeout = http2ReadIdleTimeout
+  t2.PingTimeout = http2PingTimeout
+  return nil
+}
+
+// secretParams are query parameters, whose values never appear in the logs.
+var secretParams = []string{ "access_token", "refresh_token", "client_secret", "code", "key", "token" }
+
+// secretPath matches the secret part of the paths of a host, e.g. the token of a webhook URL.
+type secretPath struct {
+  host    *regexp.Regexp
+  path    *regexp.Regexp
+  replace string
+}
+
+// secretPaths are the paths of the notification services, which are secrets themselves. The ping URLs
+// of healthchecks.io, also when hosted elsewhere, end with a UUID, which is redacted on every host.
+var secretPaths = []secretPath{
+  { regexp.MustCompile(`^api\.telegram\.org$`), regexp.MustCompile(`/bot[^/]+`), "/botREDACTED" },
+  { regexp.MustCompile(`^hooks\.slack\.com$`), regexp.MustCompile(`^(/[^/]+)/.*`), "$1/REDACTED" },
+  { regexp.MustCompile(`^((ptb|canary)\.)?discord(app)?\.com$`), regexp.MustCompile(`(/webhooks/[^/]+)/[^/]+`), "$1/REDACTED" },
+  { regexp.MustCompile(`^(hc-ping\.com|hchk\.io)$`), regexp.MustCompile(`^/.*`), "/REDACTED" },
+  { regexp.MustCompile(``), regexp.MustCompile(`(?i)/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "/REDACTED" },
+}
+
+// loggingTransport logs method, URL, status and duration of every request.
+type loggingTransport struct {
+  base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+  start := time.Now()
+  resp, err := t.base.RoundTrip(req)
+  duration := time.Since(start)
+
+  if err != nil {
+    slog.Info("HTTP request failed", "method", req.Method, "url", redactURL(req.URL),
+      "duration", duration, "error", err)
+    return resp, err
+  }
+  slog.Info("HTTP request", "method", req.Method, "url", redactURL(req.URL),
+    "status", resp.StatusCode, "duration", duration)
+  return resp, nil
+}
+
+// redactURL formats a URL without user credentials, secret paths and secret query parameters.
+func redactURL(u *url.URL) string {
+  redacted := *u
+  if redacted.User != nil {
+    redacted.User = url.User("REDACTED")
+  }
+  host := strings.ToLower(redacted.Hostname())
+  for _, p := range secretPaths {
+    if p.host.MatchString(host) {
+      redacted.Path = p.path.ReplaceAllString(redacted.Path, p.replace)
+      redacted.RawPath = ""
+    }
+  }
+  query := redacted.Query()
+  for _, p := range secretParams {
+    if query.Has(p) {
+      query.Set(p, "REDACTED")
+    }
+  }
+  redacted.RawQuery = query.Encode()
+  return redacted.String()
+}
+
+// tlsVersions maps the accepted -tls-min-version values to TLS versions.
+var tlsVersions = map[string]uint16{
+  "1.0": tls.VersionTLS10,
+  "1.1": tls.VersionTLS11,
+  "1.2": tls.VersionTLS12,
+  "1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig creates the TLS configuration from the CA bundle, client
+// certificate and minimum TLS version options.
+func NewTLSConfig(opts *config.Options) (*tls.Config, error) {
+  minVersion, ok := tlsVersions[opts.TlsMinVersion]
+  if !ok {
+    return nil, fmt.Errorf("unsupported minimum TLS version %q", opts.TlsMinVersion)
+  }
+  config := &tls.Config{ MinVersion: minVersion }
+
+  if opts.CaCert != "" {
+    pem, err := ioutil.ReadFile(opts.CaCert)
+    if err != nil {
+      return nil, fmt.Errorf("unable to read CA certificate file: %v", err)
+    }
+    // trust the system roots as well, so Google endpoints keep working
+    pool, err := x509.SystemCertPool()
+    if err != nil {
+      pool = x509.NewCertPool()
+    }
+    if !pool.AppendCertsFromPEM(pem) {
+      return nil, fmt.Errorf("no certificates found in %s", opts.CaCert)
+    }
+    config.RootCAs = pool
+  }
+
+  if opts.ClientCert != "" || opts.ClientKey != "" {
+    if opts.ClientCert == "" || opts.ClientKey == "" {
+      return nil, fmt.Errorf("both client certificate and client key have to be given")
+    }
+    cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+    if err != nil {
+      return nil, fmt.Errorf("unable to load client certificate: %v", err)
+    }
+    config.Certificates = []tls.Certificate{ cert }
+  }
+
+  return config, nil
+}
@@ -0,0 +1,247 @@
+package tui
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+
+  tea "github.com/charmbracelet/bubbletea"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/daemon"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/report"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// recentEvents is the number of the events of the history log the dashboard shows.
+const recentEvents = 10
+
+// RunDashboard shows the status of the daemon, the last backup of every file by every backend
+// and the recent events of the history log, refreshed every given interval, until the user quits.
+// The state is read from a given file; pressing b has the daemon back up now.
+func RunDashboard(ctx context.Context, c *daemon.Client, stateFile string, refresh time.Duration) error {
+  m := &dashboardModel{ ctx: ctx, c: c, stateFile: stateFile, refresh: refresh }
+  _, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+  return err
+}
+
+// fileRow is the last backup of a file by every backend.
+type fileRow struct {
+  path     string
+  failures int
+  pending  bool
+  backends map[string]time.Time
+}
+
+// snapshotMsg is the status read on every refresh.
+type snapshotMsg struct {
+  at        time.Time
+  status    *daemon.Status
+  statusErr error
+  files     []fileRow
+  backends  []string
+  events    []report.HistoryEvent
+  err       error
+}
+
+// tickMsg starts a refresh.
+type tickMsg time.Time
+
+// backupMsg reports whether the daemon accepted to back up now.
+type backupMsg struct {
+  err error
+}
+
+// dashboardModel is the state of the dashboard.
+type dashboardModel struct {
+  ctx       context.Context
+  c         *daemon.Client
+  stateFile string
+  refresh   time.Duration
+
+  snapshot snapshotMsg
+  message  string
+}
+
+func (m *dashboardModel) Init() tea.Cmd {
+  return m.load
+}
+
+func (m *dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+  switch msg := msg.(type) {
+  case snapshotMsg:
+    m.snapshot = msg
+    return m, tea.Tick(m.refresh, func(t time.Time) tea.Msg { return tickMsg(t) })
+  case tickMsg:
+    return m, m.load
+  case backupMsg:
+    switch {
+    case errors.Is(msg.err, daemon.ErrRunning):
+      m.message = i18n.T("A backup is running already")
+    case msg.err != nil:
+      m.message = i18n.Sprintf("Unable to start backup: %v", msg.err)
+    default:
+      m.message = i18n.T("Backup started")
+    }
+    return m, m.load
+  case tea.KeyMsg:
+    switch msg.String() {
+    case "q", "esc", "ctrl+c":
+      return m, tea.Quit
+    case "b":
+      m.message = i18n.T("Starting backup...")
+      return m, m.backup
+    case "r":
+      return m, m.load
+    }
+  }
+  return m, nil
+}
+
+// backup has the daemon back up now.
+func (m *dashboardModel) backup() tea.Msg {
+  return backupMsg{ err: m.c.Backup(m.ctx) }
+}
+
+// load reads the status of the daemon, the state and the history log.
+func (m *dashboardModel) load() tea.Msg {
+  s := snapshotMsg{ at: time.Now() }
+  s.status, s.statusErr = m.c.Status(m.ctx)
+
+  st, err := state.Load(m.stateFile)
+  if err != nil {
+    s.err = fmt.Errorf("Unable to read state file: %w", err)
+    return s
+  }
+  events, err := report.LoadHistory()
+  if err != nil {
+    s.err = fmt.Errorf("Unable to read history log: %w", err)
+    return s
+  }
+
+  rows := make(map[string]*fileRow)
+  row := func(path string) *fileRow {
+    r, ok := rows[path]
+    if !ok {
+      r = &fileRow{ path: path, backends: make(map[string]time.Time) }
+      rows[path] = r
+    }
+    return r
+  }
+  for path, fs := range st.Files {
+    row(path).failures = fs.Failures
+  }
+  for _, p := range st.Pending {
+    row(p.Path).pending = true
+  }
+  seen := make(map[string]bool)
+  for _, e := range events {
+    if e.Result != engine.ActionCreated && e.Result != engine.ActionUpdated {
+      continue
+    }
+    row(e.File).backends[e.Backend] = e.Time
+    if !seen[e.Backend] {
+      seen[e.Backend] = true
+      s.backends = append(s.backends, e.Backend)
+    }
+  }
+  sort.Strings(s.backends)
+  for _, r := range rows {
+    s.files = append(s.files, *r)
+  }
+  sort.Slice(s.files, func(i, j int) bool { return s.files[i].path < s.files[j].path })
+
+  if n := len(events); n > recentEvents {
+    events = events[n-recentEvents:]
+  }
+  s.events = events
+  return s
+}
+
+func (m *dashboardModel) View() string {
+  var sb strings.Builder
+  s := m.snapshot
+  sb.WriteString(i18n.T("keepassx_backup_tool dashboard (b back up now, r refresh, q quit)\n\n"))
+  switch {
+  case s.at.IsZero():
+    sb.WriteString(i18n.T("Loading...\n"))
+    return sb.String()
+  case s.statusErr != nil:
+    sb.WriteString(i18n.Sprintf("Daemon: unreachable, %v\n", s.statusErr))
+  default:
+    sb.WriteString(i18n.Sprintf("Daemon: %s\n", describeStatus(s.status)))
+  }
+  if m.message != "" {
+    sb.WriteString(m.message + "\n")
+  }
+  if s.err != nil {
+    fmt.Fprintf(&sb, "\n%v\n", s.err)
+    return sb.String()
+  }
+
+  sb.WriteString(i18n.T("\nFiles:\n"))
+  if len(s.files) == 0 {
+    sb.WriteString(i18n.T("  none backed up yet\n"))
+  }
+  for _, f := range s.files {
+    fmt.Fprintf(&sb, "  %s", f.path)
+    if f.failures > 0 {
+      sb.WriteString(i18n.Sprintf("  %d failures", f.failures))
+    }
+    if f.pending {
+      sb.WriteString(i18n.T("  queued until online"))
+    }
+    sb.WriteString("\n")
+    for _, b := range s.backends {
+      fmt.Fprintf(&sb, "    %-10s %s\n", b, formatLast(f.backends[b], s.at))
+    }
+  }
+
+  sb.WriteString(i18n.T("\nRecent events:\n"))
+  if len(s.events) == 0 {
+    sb.WriteString(i18n.T("  none\n"))
+  }
+  for i := len(s.events) - 1; i >= 0; i-- {
+    e := s.events[i]
+    fmt.Fprintf(&sb, "  %s  %-9s  %-10s  %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Result, e.Backend, e.File)
+    if e.Error != "" {
+      sb.WriteString(": " + e.Error)
+    }
+    sb.WriteString("\n")
+  }
+  sb.WriteString(i18n.Sprintf("\nUpdated %s\n", s.at.Local().Format("15:04:05")))
+  return sb.String()
+}
+
+// describeStatus describes the current and the last run of the daemon.
+func describeStatus(s *daemon.Status) string {
+  var parts []string
+  if s.Running && s.StartedAt != nil {
+    parts = append(parts, i18n.Sprintf("backing up since %s", s.StartedAt.Local().Format("15:04:05")))
+  } else if s.NextRun != nil {
+    parts = append(parts, i18n.Sprintf("next backup at %s", s.NextRun.Local().Format("15:04:05")))
+  }
+  if s.LastRun != nil {
+    last := i18n.Sprintf("last run %s at %s", s.LastRun.Status, s.LastRun.Timestamp.Local().Format("2006-01-02 15:04:05"))
+    if s.LastRun.Error != "" {
+      last += ": " + s.LastRun.Error
+    }
+    parts = append(parts, last)
+  }
+  if len(parts) == 0 {
+    return i18n.T("idle")
+  }
+  return strings.Join(parts, ", ")
+}
+
+// formatLast formats the time of a last backup, relative to now.
+func formatLast(t, now time.Time) string {
+  if t.IsZero() {
+    return i18n.T("never")
+  }
+  return i18n.Sprintf("%s (%s ago)", t.Local().Format("2006-01-02 15:04:05"), now.Sub(t).Round(time.Second))
+}
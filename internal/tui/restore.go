@@ -0,0 +1,282 @@
+// Package tui implements the terminal user interfaces: the picker of restore -pick, and the dashboard of the tui command.
+package tui
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "strings"
+  "time"
+
+  tea "github.com/charmbracelet/bubbletea"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/i18n"
+  "github.com/pawelu/keepassx_backup_tool/internal/progress"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+// Version is a backed up version of a file, which the restore picker lists.
+type Version struct {
+  Path   string
+  Remote *engine.RemoteFile
+
+  // Label tells the latest version from the revisions kept by Drive
+  Label string
+
+  // Time and Size are zero if unknown
+  Time time.Time
+  Size int64
+}
+
+// ListVersions lists the versions of the backups of given files by a backend, the newest first:
+// the revisions Drive keeps, or the latest version only by other backends.
+func ListVersions(ctx context.Context, b engine.Backend, opts *config.Options, st *state.State, paths []string) ([]Version, error) {
+  var versions []Version
+  for _, path := range paths {
+    remote, err := engine.FindBackup(ctx, b, opts, st, path)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    d, ok := b.(*gdrive.Backend)
+    if !ok {
+      versions = append(versions, Version{ Path: path, Remote: remote, Label: i18n.T("latest"), Time: remote.SourceModTime() })
+      continue
+    }
+
+    revisions, err := d.Revisions(ctx, remote)
+    if err != nil {
+      return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    for i := len(revisions) - 1; i >= 0; i-- {
+      rev := revisions[i]
+      v := Version{ Path: path, Label: i18n.Sprintf("revision %s", rev.Id), Size: rev.Size }
+      v.Time, _ = time.Parse(time.RFC3339, rev.ModifiedTime)
+      v.Remote = &engine.RemoteFile{ Id: remote.Id, Name: remote.Name, Md5: rev.Md5Checksum, Revision: rev.Id }
+      if i == len(revisions) - 1 {
+        // the latest revision is the backup itself, with its metadata
+        v.Label, v.Remote = i18n.T("latest"), remote
+      }
+      versions = append(versions, v)
+    }
+  }
+  return versions, nil
+}
+
+// RunRestore shows the versions to pick the one to restore from, asks for the path to restore it to,
+// and downloads it, showing the progress, and verifying the md5 hash of the downloaded backup.
+// It returns the result of the restore, or nil if the user quit without restoring anything.
+func RunRestore(ctx context.Context, b engine.Backend, versions []Version) (*engine.Result, error) {
+  if len(versions) == 0 {
+    return nil, fmt.Errorf("No backups found")
+  }
+  m := &restoreModel{ ctx: ctx, b: b, versions: versions }
+  p := tea.NewProgram(m)
+  m.send = p.Send
+  if _, err := p.Run(); err != nil {
+    return nil, err
+  }
+  return m.result, nil
+}
+
+// The screens of the restore picker, in order.
+const (
+  screenList = iota
+  screenTarget
+  screenDownload
+  screenDone
+)
+
+// progressMsg reports the bytes downloaded so far.
+type progressMsg struct {
+  read, total int64
+}
+
+// doneMsg reports the end of the download.
+type doneMsg struct {
+  bytes int64
+  err   error
+}
+
+// restoreModel is the state of the restore picker.
+type restoreModel struct {
+  ctx      context.Context
+  b        engine.Backend
+  versions []Version
+  send     func(msg tea.Msg)
+
+  screen int
+  cursor int
+  target []rune
+  read   int64
+  total  int64
+
+  result *engine.Result
+}
+
+func (m *restoreModel) Init() tea.Cmd {
+  return nil
+}
+
+func (m *restoreModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+  switch msg := msg.(type) {
+  case progressMsg:
+    m.read, m.total = msg.read, msg.total
+    return m, nil
+  case doneMsg:
+    m.screen = screenDone
+    v := m.versions[m.cursor]
+    m.result = &engine.Result{ Path: v.Path, Backend: m.b.Name(), RemoteId: v.Remote.Id, Bytes: msg.bytes }
+    if msg.err != nil {
+      m.result.Action, m.result.Err = engine.ActionFailed, msg.err
+    } else {
+      m.result.Action = engine.ActionRestored
+    }
+    return m, tea.Quit
+  case tea.KeyMsg:
+    if msg.String() == "ctrl+c" {
+      return m, tea.Quit
+    }
+    switch m.screen {
+    case screenList:
+      return m.updateList(msg)
+    case screenTarget:
+      return m.updateTarget(msg)
+    }
+  }
+  return m, nil
+}
+
+// updateList moves the cursor over the versions, and picks one with enter.
+func (m *restoreModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+  switch msg.String() {
+  case "up", "k":
+    if m.cursor > 0 {
+      m.cursor--
+    }
+  case "down", "j":
+    if m.cursor < len(m.versions) - 1 {
+      m.cursor++
+    }
+  case "enter":
+    m.screen = screenTarget
+    m.target = []rune(m.versions[m.cursor].Path + engine.RestoredSuffix)
+  case "q", "esc":
+    return m, tea.Quit
+  }
+  return m, nil
+}
+
+// updateTarget edits the path to restore to, and starts downloading with enter.
+func (m *restoreModel) updateTarget(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+  switch msg.Type {
+  case tea.KeyEnter:
+    target := strings.TrimSpace(string(m.target))
+    if target == "" {
+      return m, nil
+    }
+    m.screen = screenDownload
+    return m, m.download(m.versions[m.cursor], config.NormalizePath(target))
+  case tea.KeyBackspace:
+    if len(m.target) > 0 {
+      m.target = m.target[:len(m.target)-1]
+    }
+  case tea.KeyRunes:
+    m.target = append(m.target, msg.Runes...)
+  default:
+    if msg.String() == "esc" {
+      m.screen = screenList
+    }
+  }
+  return m, nil
+}
+
+// progressInterval limits how often the progress of the download is shown.
+const progressInterval = 100 * time.Millisecond
+
+// download restores a version to a given path in the background.
+func (m *restoreModel) download(v Version, target string) tea.Cmd {
+  return func() tea.Msg {
+    var shown time.Time
+    pb := &progressBackend{ Backend: m.b, size: v.Size, onProgress: func(read, total int64) {
+      if time.Since(shown) >= progressInterval || read == total {
+        shown = time.Now()
+        m.send(progressMsg{ read: read, total: total })
+      }
+    } }
+    if engine.IsActiveFile(v.Path, target) {
+      return doneMsg{ err: fmt.Errorf("Refusing to restore over the active file %s", v.Path) }
+    }
+    n, err := engine.DownloadBackup(m.ctx, pb, v.Remote, target)
+    return doneMsg{ bytes: n, err: err }
+  }
+}
+
+func (m *restoreModel) View() string {
+  var sb strings.Builder
+  switch m.screen {
+  case screenList:
+    sb.WriteString(i18n.T("Select the backup to restore (up/down, enter to select, q to quit)\n\n"))
+    for i, v := range m.versions {
+      cursor := "  "
+      if i == m.cursor {
+        cursor = "> "
+      }
+      fmt.Fprintf(&sb, "%s%s  %-20s  %-25s  %s\n", cursor, v.Path, v.Label, formatTime(v.Time), formatSize(v.Size))
+    }
+  case screenTarget:
+    v := m.versions[m.cursor]
+    sb.WriteString(i18n.Sprintf("Restoring %s, %s\n\nRestore to: %s_\n\n(enter to restore, esc to go back)\n", v.Path, v.Label,
+      string(m.target)))
+  case screenDownload:
+    sb.WriteString(i18n.Sprintf("Downloading %s", progress.FormatBytes(m.read)))
+    if m.total > 0 {
+      sb.WriteString(i18n.Sprintf(" of %s (%d%%)", progress.FormatBytes(m.total), m.read*100/m.total))
+    }
+    sb.WriteString("\n")
+  case screenDone:
+    if m.result.Err != nil {
+      sb.WriteString(i18n.Sprintf("Unable to restore: %v\n", m.result.Err))
+    } else {
+      sb.WriteString(i18n.Sprintf("Restored %s to %s, verified\n", m.result.Path, string(m.target)))
+    }
+  }
+  return sb.String()
+}
+
+// formatTime formats a time of a version, which may be unknown.
+func formatTime(t time.Time) string {
+  if t.IsZero() {
+    return "-"
+  }
+  return t.Local().Format(time.RFC3339)
+}
+
+// formatSize formats a size of a version, which may be unknown.
+func formatSize(n int64) string {
+  if n <= 0 {
+    return "-"
+  }
+  return progress.FormatBytes(n)
+}
+
+// progressBackend reports the progress of downloads from a backend.
+type progressBackend struct {
+  engine.Backend
+  size       int64
+  onProgress func(read, total int64)
+}
+
+func (b *progressBackend) Download(ctx context.Context, remote *engine.RemoteFile) (io.ReadCloser, error) {
+  body, err := b.Backend.Download(ctx, remote)
+  if err != nil {
+    return nil, err
+  }
+  r := progress.NewFuncReader(body, b.size, b.onProgress)
+  return struct {
+    io.Reader
+    io.Closer
+  }{ r, body }, nil
+}
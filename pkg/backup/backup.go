@@ -0,0 +1,137 @@
+// Package backup embeds the sync engine of keepassx_backup_tool in other tools.
+// It backs up files to Google Drive and local directories, uploading only the ones
+// which changed since the last sync, as remembered in the state.
+package backup
+
+import (
+  "context"
+  "time"
+
+  "google.golang.org/api/drive/v3"
+
+  "github.com/pawelu/keepassx_backup_tool/internal/config"
+  "github.com/pawelu/keepassx_backup_tool/internal/engine"
+  "github.com/pawelu/keepassx_backup_tool/internal/gdrive"
+  "github.com/pawelu/keepassx_backup_tool/internal/localdir"
+  "github.com/pawelu/keepassx_backup_tool/internal/state"
+)
+
+type (
+  // Options configures syncing, see NewOptions for the defaults.
+  Options = config.Options
+
+  // Backend stores backups of files, see DriveBackend and DirBackend.
+  Backend = engine.Backend
+
+  // RemoteFile is the backup of a local file stored by a Backend.
+  RemoteFile = engine.RemoteFile
+
+  // Result is the result of backing up a single file to a single Backend.
+  Result = engine.Result
+
+  // Action is the outcome of backing up a single file.
+  Action = engine.Action
+
+  // State is kept between syncs, see LoadState and SaveState.
+  State = state.State
+
+  // Factory creates a backend registered with Register.
+  Factory = engine.Factory
+
+  // Env holds everything besides the options, which backends are created from.
+  Env = engine.Env
+
+  // DriveClient is the set of Drive operations DriveBackend uses, see NewDriveClient.
+  DriveClient = gdrive.Client
+)
+
+// Outcomes of backing up a single file.
+const (
+  ActionCreated   = engine.ActionCreated
+  ActionUpdated   = engine.ActionUpdated
+  ActionUnchanged = engine.ActionUnchanged
+  ActionQueued    = engine.ActionQueued
+  ActionFailed    = engine.ActionFailed
+  ActionRestored  = engine.ActionRestored
+)
+
+// NewOptions returns the options the command line tool uses by default.
+func NewOptions() *Options {
+  return &Options{
+    WaitTimeout: time.Minute,
+    Jobs:        4,
+    ChunkSize:   8 * 1024 * 1024,
+    DirLayout:   "plain",
+  }
+}
+
+// LoadState reads the state from a given file path.
+// A missing file results in an empty state.
+func LoadState(file string) (*State, error) {
+  return state.Load(file)
+}
+
+// SaveState writes the state to a given file path atomically.
+func SaveState(file string, st *State) error {
+  return state.Save(file, st)
+}
+
+// NewDriveClient returns the DriveClient calling the Drive API through srv,
+// logging to opts.Logger.
+func NewDriveClient(srv *drive.Service, opts *Options) DriveClient {
+  return gdrive.NewClient(srv, opts.Log())
+}
+
+// DriveBackend creates the backend storing backups in the automatic_backups folder
+// of Google Drive, creating the folder if necessary, and recording uploads in the
+// journal at a given file path.
+func DriveBackend(ctx context.Context, c DriveClient, opts *Options, journalFile string) (Backend, error) {
+  jr, err := gdrive.OpenJournal(journalFile)
+  if err != nil {
+    return nil, err
+  }
+  folderId, err := gdrive.FindBackupsFolder(ctx, c, opts)
+  if err != nil {
+    return nil, err
+  }
+  return gdrive.New(c, opts, jr, folderId), nil
+}
+
+// DirBackend creates the backend storing backups in opts.BackupDir with opts.DirLayout.
+func DirBackend(opts *Options) Backend {
+  return localdir.New(opts)
+}
+
+// Register makes a backend available by a given name, usually from the init
+// function of the package implementing it.
+func Register(name string, f Factory) {
+  engine.Register(name, f)
+}
+
+// NewBackend creates the backend registered by a given name.
+func NewBackend(ctx context.Context, name string, env *Env) (Backend, error) {
+  f, err := engine.Lookup(name)
+  if err != nil {
+    return nil, err
+  }
+  return f(ctx, env)
+}
+
+// Sync backs up given files to all backends and records the results in the state,
+// which the caller saves afterwards.
+// It returns the result of every file and backend.
+func Sync(ctx context.Context, opts *Options, st *State, backends []Backend, paths []string) []Result {
+  if opts.Jobs < 1 {
+    withJobs := *opts
+    withJobs.Jobs = 1
+    opts = &withJobs
+  }
+  return engine.Apply(opts, st, engine.SyncRingFiles(ctx, opts, st, backends, paths), nil)
+}
+
+// Restore downloads the backups of given files from a backend next to every file,
+// with the ".restored" suffix, or to Options.Output, so the files themselves are never overwritten.
+// It returns the result of every file.
+func Restore(ctx context.Context, b Backend, opts *Options, st *State, paths []string) []Result {
+  return engine.RestoreRingFiles(ctx, b, opts, st, paths)
+}